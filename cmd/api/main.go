@@ -49,6 +49,13 @@ func main() {
 		log.Fatalf("Database migration/seed failed: %v", err)
 	}
 
+	// Bulk jobs do not survive a restart
+	if n, err := models.FailInterruptedBulkJobs(); err != nil {
+		log.Printf("Error failing interrupted bulk jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted bulk jobs as failed.", n)
+	}
+
 	// Setup token cleanup background job
 	bootstrap.SetupTokenCleanup()
 	log.Println("Token cleanup scheduler initialized.")
@@ -66,6 +73,15 @@ func main() {
 	// Start background tasks after DB + services are ready
 	go startBackgroundTasks()
 	go startTemporaryAccessTasks()
+	go startDuplicatePatientDetector()
+	go startReportReviewMonitor()
+	go startTaskRecurrenceScheduler()
+	go startTaskEscalationMonitor()
+	go startEventSweeper()
+	go startSlotReconciler()
+	go startMedicationLinkReconciler()
+	go startWaitlistMonitor()
+	go startReminderScheduler()
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
@@ -157,3 +173,48 @@ func startTemporaryAccessTasks() {
 	monitor := services.NewTemporaryAccessMonitor()
 	monitor.Start()
 }
+
+func startDuplicatePatientDetector() {
+	detector := services.NewDuplicatePatientDetector()
+	detector.Start()
+}
+
+func startReportReviewMonitor() {
+	monitor := services.NewReportReviewMonitor()
+	monitor.Start()
+}
+
+func startTaskRecurrenceScheduler() {
+	scheduler := services.NewTaskRecurrenceScheduler()
+	scheduler.Start()
+}
+
+func startTaskEscalationMonitor() {
+	monitor := services.NewTaskEscalationMonitor(handlers.TriggerWebhook)
+	monitor.Start()
+}
+
+func startEventSweeper() {
+	sweeper := services.NewEventSweeper(handlers.TriggerWebhook)
+	sweeper.Start()
+}
+
+func startSlotReconciler() {
+	reconciler := services.NewSlotReconciler()
+	reconciler.Start()
+}
+
+func startMedicationLinkReconciler() {
+	reconciler := services.NewMedicationLinkReconciler()
+	reconciler.Start()
+}
+
+func startWaitlistMonitor() {
+	monitor := services.NewWaitlistMonitor()
+	monitor.Start()
+}
+
+func startReminderScheduler() {
+	scheduler := services.NewReminderScheduler()
+	scheduler.Start()
+}
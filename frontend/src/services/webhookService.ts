@@ -101,8 +101,10 @@ export const AVAILABLE_EVENTS = [
   { value: 'task.due', label: 'Task Due', description: 'When a task is due today' },
   { value: 'task.overdue', label: 'Task Overdue', description: 'When a task becomes overdue' },
   { value: 'task.completed', label: 'Task Completed', description: 'When a task is completed' },
+  { value: 'task.escalated', label: 'Task Escalated', description: 'When an escalation policy acts on an overdue task' },
   { value: 'consent.expiring', label: 'Consent Expiring', description: 'When consent expires within 30 days' },
   { value: 'consent.expired', label: 'Consent Expired', description: 'When consent has expired' },
+  { value: 'consent.revoked', label: 'Consent Revoked', description: 'When consent is revoked' },
   { value: 'device.implanted', label: 'Device Implanted', description: 'When a device is implanted' },
   { value: 'device.explanted', label: 'Device Explanted', description: 'When a device is explanted' },
 ]
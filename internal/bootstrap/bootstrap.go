@@ -52,7 +52,7 @@ func migrate(db *gorm.DB) error {
 		}
 	}
 
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Token{},
 		&models.Doctor{},
@@ -83,7 +83,60 @@ func migrate(db *gorm.DB) error {
 		&models.Appointment{},
 		&models.PatientNote{},
 		&models.BillingCode{},
-	)
+		&models.DuplicatePatientCandidate{},
+		&models.PatientMedication{},
+		&models.PatientRiskFactors{},
+		&models.AFRiskAlert{},
+		&models.ReportReviewItem{},
+		&models.ReportTurnaroundTarget{},
+		&models.ReportSignoffEvent{},
+		&models.ReportProgrammingChange{},
+		&models.ReportComparisonThreshold{},
+		&models.PatientTagEvent{},
+		&models.TaskSeries{},
+		&models.TaskEscalationPolicy{},
+		&models.TaskEscalation{},
+		&models.EventMarker{},
+		&models.AutomationRule{},
+		&models.AutomationExecution{},
+		&models.TaskChecklistItem{},
+		&models.UserSkill{},
+		&models.UserAbsence{},
+		&models.NoteMention{},
+		&models.BulkJob{},
+		&models.CalendarFeed{},
+		&models.ClinicSession{},
+		&models.ClinicClosure{},
+		&models.ClinicSessionOverride{},
+		&models.FollowUpRule{},
+		&models.ReportFollowUp{},
+		&models.LetterTemplate{},
+		&models.PatientLetter{},
+		&models.WaitlistEntry{},
+		&models.WaitlistOffer{},
+		&models.ReminderRule{},
+		&models.AppointmentReminder{},
+		&models.ClinicResource{},
+		&models.AppointmentResource{},
+	); err != nil {
+		return err
+	}
+
+	// Give legacy patient/medication links a regimen row so history starts complete
+	if err := models.BackfillPatientMedications(db); err != nil {
+		return err
+	}
+
+	// Start with the original clinic hours so booking works before sessions are configured
+	if err := models.SeedDefaultClinicSessions(db); err != nil {
+		return err
+	}
+
+	if err := models.SeedDefaultLetterTemplate(db); err != nil {
+		return err
+	}
+
+	return models.SeedDefaultReminderRules(db)
 }
 
 func shouldSeed(db *gorm.DB) bool {
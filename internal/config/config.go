@@ -11,13 +11,19 @@ import (
 )
 
 type Config struct {
-	Port               string
-	URL                string
-	JWTSecret          string
-	JWTIssuer          string
-	JWTAudience        string
-	MissedGraceMinutes int
-	MissedLookbackDays int
+	Port                string
+	URL                 string
+	JWTSecret           string
+	JWTIssuer           string
+	JWTAudience         string
+	MissedGraceMinutes  int
+	MissedLookbackDays  int
+	BulkSyncLimit       int // Bulk actions on more items run as background jobs
+	BulkMaxItems        int
+	ClinicTimezone      string // Timezone of clinic session templates
+	ClinicName          string // Used in letters to patients
+	ClinicPhone         string
+	WaitlistHoldMinutes int // How long a freed slot is held for a waitlist offer
 }
 
 var (
@@ -40,13 +46,19 @@ func LoadConfig() *Config {
 		}
 
 		loadedConfig = &Config{
-			Port:               getEnv("PORT", "5000"),
-			URL:                getEnv("URL", "http://localhost:8000"),
-			JWTSecret:          jwtSecret,
-			JWTIssuer:          getEnv("JWT_ISSUER", "goReporter"),
-			JWTAudience:        getEnv("JWT_AUDIENCE", "goReporter-client"),
-			MissedGraceMinutes: getEnvInt("MISSED_GRACE_MINUTES", 15),
-			MissedLookbackDays: getEnvInt("MISSED_LOOKBACK_DAYS", 7),
+			Port:                getEnv("PORT", "5000"),
+			URL:                 getEnv("URL", "http://localhost:8000"),
+			JWTSecret:           jwtSecret,
+			JWTIssuer:           getEnv("JWT_ISSUER", "goReporter"),
+			JWTAudience:         getEnv("JWT_AUDIENCE", "goReporter-client"),
+			MissedGraceMinutes:  getEnvInt("MISSED_GRACE_MINUTES", 15),
+			MissedLookbackDays:  getEnvInt("MISSED_LOOKBACK_DAYS", 7),
+			BulkSyncLimit:       getEnvInt("BULK_SYNC_LIMIT", 50),
+			BulkMaxItems:        getEnvInt("BULK_MAX_ITEMS", 5000),
+			ClinicTimezone:      getEnv("CLINIC_TIMEZONE", "Australia/Sydney"),
+			ClinicName:          getEnv("CLINIC_NAME", "Cardiac Device Clinic"),
+			ClinicPhone:         getEnv("CLINIC_PHONE", ""),
+			WaitlistHoldMinutes: getEnvInt("WAITLIST_HOLD_MINUTES", 120),
 		}
 	})
 
@@ -103,6 +103,16 @@ func MarkMissedLettersSent(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"updated": res.RowsAffected, "timestamp": now})
 }
 
+// ReconcileAppointmentSlots recomputes slot booked counts from live appointments now,
+// instead of waiting for the scheduled reconciliation.
+func ReconcileAppointmentSlots(c *fiber.Ctx) error {
+	fixed, err := models.ReconcileSlotBookings()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reconcile slots"})
+	}
+	return c.JSON(fiber.Map{"corrected": fixed})
+}
+
 func parsePositiveInt(val string, fallback int) int {
 	if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
 		return parsed
@@ -268,79 +268,25 @@ func CreateAppointment(c *fiber.Ctx) error {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
 	}
 
-	location := normalizeAppointmentLocation(payload.Location)
-
-	// Check slot availability for clinic appointments
-	var slotID *uint
-	if location == models.AppointmentLocationClinic {
-		// Validate time is within allowed hours (8:00 AM - 11:30 AM)
-		// Convert to Sydney timezone for validation
-		sydneyLoc, err := time.LoadLocation("Australia/Sydney")
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load timezone"})
-		}
-		localTime := startAt.In(sydneyLoc)
-		hour := localTime.Hour()
-		minute := localTime.Minute()
-
-		if hour < 8 || hour > 11 || (hour == 11 && minute > 30) {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": "Clinic appointments are only available between 8:00 AM and 11:30 AM (Sydney time)",
-				"code":  "INVALID_TIME",
-			})
-		}
-
-		available, remaining, err := models.CheckSlotAvailability(startAt, location)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check slot availability"})
-		}
-		if !available {
-			return c.Status(http.StatusConflict).JSON(fiber.Map{
-				"error": "No available slots for this time",
-				"code":  "SLOT_FULL",
-			})
-		}
-
-		// Get or create the slot
-		slot, err := models.GetOrCreateSlot(startAt, location)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reserve slot"})
-		}
-
-		// Increment the booking count
-		if err := models.IncrementSlotBooking(slot.ID); err != nil {
-			return c.Status(http.StatusConflict).JSON(fiber.Map{
-				"error": "Failed to reserve slot - may be full",
-				"code":  "SLOT_BOOKING_FAILED",
-			})
-		}
-
-		slotID = &slot.ID
-
-		// Set end time to 15 minutes after start for clinic appointments if not specified
-		if endAt == nil {
-			endTime := startAt.Add(15 * time.Minute)
-			endAt = &endTime
-		}
-
-		// Return slot availability info
-		c.Append("X-Slot-Remaining", strconv.Itoa(remaining-1))
-	}
-
 	appointment := models.Appointment{
 		Title:       strings.TrimSpace(payload.Title),
 		Description: strings.TrimSpace(payload.Description),
-		Location:    location,
+		Location:    normalizeAppointmentLocation(payload.Location),
 		Status:      normalizeAppointmentStatus(payload.Status),
 		StartAt:     startAt,
 		EndAt:       endAt,
 		PatientID:   payload.PatientID,
-		SlotID:      slotID,
 		CreatedByID: userID,
 	}
 
-	if err := models.CreateAppointment(&appointment); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create appointment"})
+	// Clinic appointments are booked into a slot in the same transaction
+	remaining, err := models.SaveAppointmentBooking(&appointment, true)
+	if err != nil {
+		return slotBookingError(c, err, "Failed to create appointment")
+	}
+	if remaining >= 0 {
+		// Return slot availability info
+		c.Append("X-Slot-Remaining", strconv.Itoa(remaining))
 	}
 
 	created, _ := models.GetAppointmentByID(appointment.ID)
@@ -385,11 +331,11 @@ func UpdateAppointment(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	// Track if we need to update slots
-	oldSlotID := appointment.SlotID
-	oldLocation := appointment.Location
+	// Track if the slot booking needs to change
+	oldStatus := appointment.Status
 	locationChanged := false
 	timeChanged := false
+	patientChanged := false
 
 	if strings.TrimSpace(payload.Title) != "" {
 		appointment.Title = strings.TrimSpace(payload.Title)
@@ -414,6 +360,11 @@ func UpdateAppointment(c *fiber.Ctx) error {
 		}
 		if !parsedStart.Equal(appointment.StartAt) {
 			timeChanged = true
+			// A moved appointment keeps its length unless a new end is given
+			if payload.EndAt == nil && appointment.EndAt != nil {
+				end := appointment.EndAt.Add(parsedStart.Sub(appointment.StartAt)).UTC()
+				appointment.EndAt = &end
+			}
 		}
 		appointment.StartAt = parsedStart
 	}
@@ -432,85 +383,6 @@ func UpdateAppointment(c *fiber.Ctx) error {
 		}
 	}
 
-	// Handle slot changes for clinic appointments
-	if locationChanged || timeChanged {
-		// Release old slot if it was a clinic appointment
-		if oldLocation == models.AppointmentLocationClinic && oldSlotID != nil {
-			_ = models.DecrementSlotBooking(*oldSlotID)
-		}
-
-		// Book new slot if new location is clinic
-		if appointment.Location == models.AppointmentLocationClinic {
-			// Validate time is within allowed hours (8:00 AM - 11:30 AM)
-			// Convert to Sydney timezone for validation
-			sydneyLoc, err := time.LoadLocation("Australia/Sydney")
-			if err != nil {
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load timezone"})
-			}
-			localTime := appointment.StartAt.In(sydneyLoc)
-			hour := localTime.Hour()
-			minute := localTime.Minute()
-
-			if hour < 8 || hour > 11 || (hour == 11 && minute > 30) {
-				// Restore old slot booking if we released it
-				if oldLocation == models.AppointmentLocationClinic && oldSlotID != nil {
-					_ = models.IncrementSlotBooking(*oldSlotID)
-				}
-				return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-					"error": "Clinic appointments are only available between 8:00 AM and 11:30 AM (Sydney time)",
-					"code":  "INVALID_TIME",
-				})
-			}
-
-			available, remaining, err := models.CheckSlotAvailability(appointment.StartAt, appointment.Location)
-			if err != nil {
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check slot availability"})
-			}
-			if !available {
-				// Restore old slot booking if we released it
-				if oldLocation == models.AppointmentLocationClinic && oldSlotID != nil {
-					_ = models.IncrementSlotBooking(*oldSlotID)
-				}
-				return c.Status(http.StatusConflict).JSON(fiber.Map{
-					"error": "No available slots for this time",
-					"code":  "SLOT_FULL",
-				})
-			}
-
-			slot, err := models.GetOrCreateSlot(appointment.StartAt, appointment.Location)
-			if err != nil {
-				// Restore old slot booking if we released it
-				if oldLocation == models.AppointmentLocationClinic && oldSlotID != nil {
-					_ = models.IncrementSlotBooking(*oldSlotID)
-				}
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reserve slot"})
-			}
-
-			if err := models.IncrementSlotBooking(slot.ID); err != nil {
-				// Restore old slot booking if we released it
-				if oldLocation == models.AppointmentLocationClinic && oldSlotID != nil {
-					_ = models.IncrementSlotBooking(*oldSlotID)
-				}
-				return c.Status(http.StatusConflict).JSON(fiber.Map{
-					"error": "Failed to reserve slot - may be full",
-					"code":  "SLOT_BOOKING_FAILED",
-				})
-			}
-
-			appointment.SlotID = &slot.ID
-			c.Append("X-Slot-Remaining", strconv.Itoa(remaining-1))
-
-			// Set end time to 15 minutes for clinic appointments if not already set
-			if appointment.EndAt == nil {
-				endTime := appointment.StartAt.Add(15 * time.Minute)
-				appointment.EndAt = &endTime
-			}
-		} else {
-			// Not a clinic appointment, clear slot
-			appointment.SlotID = nil
-		}
-	}
-
 	// Allow changing patient association with permission check
 	if payload.PatientID != 0 && payload.PatientID != appointment.PatientID {
 		allowed, accessErr := canAccessPatient(userRole, userID, payload.PatientID)
@@ -521,10 +393,24 @@ func UpdateAppointment(c *fiber.Ctx) error {
 			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied for new patient"})
 		}
 		appointment.PatientID = payload.PatientID
+		patientChanged = true
 	}
 
-	if err := models.UpdateAppointment(appointment); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update appointment"})
+	// Moving, relocating or (un)cancelling the appointment changes its slot booking, and a
+	// different patient may need different resources
+	cancelledChanged := (oldStatus == models.AppointmentStatusCancelled) != (appointment.Status == models.AppointmentStatusCancelled)
+	rebook := locationChanged || timeChanged || cancelledChanged || patientChanged
+	previousSlotID := appointment.SlotID
+	remaining, err := models.SaveAppointmentBooking(appointment, rebook)
+	if err != nil {
+		return slotBookingError(c, err, "Failed to update appointment")
+	}
+	if remaining >= 0 {
+		c.Append("X-Slot-Remaining", strconv.Itoa(remaining))
+	}
+	if rebook {
+		// A place given up by the move or cancellation goes to the waitlist
+		offerFreedSlot(previousSlotID, appointment.SlotID)
 	}
 
 	updated, _ := models.GetAppointmentByID(appointment.ID)
@@ -561,67 +447,32 @@ func GetAvailableSlots(c *fiber.Ctx) error {
 		})
 	}
 
+	// Slots that have already started can no longer be booked
+	if now := time.Now(); start.Before(now) {
+		start = now
+	}
+
 	slots, err := models.GetAvailableSlots(start, end, location)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch available slots"})
 	}
 
-	// Create a map of existing slots by time for quick lookup
-	slotMap := make(map[string]models.AppointmentSlot)
-	for _, slot := range slots {
-		key := slot.SlotTime.Format(time.RFC3339)
-		slotMap[key] = slot
-	}
-
-	// Generate all possible 15-minute slots for the date range
 	type SlotResponse struct {
 		SlotTime  time.Time `json:"slotTime"`
+		EndTime   time.Time `json:"endTime"`
 		Remaining int       `json:"remaining"`
 		Total     int       `json:"total"`
 	}
 
-	var response []SlotResponse
-	current := models.RoundToNearestSlot(start)
-
-	// Load Sydney timezone for validation
-	sydneyLoc, err := time.LoadLocation("Australia/Sydney")
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load timezone"})
-	}
-
-	for current.Before(end) {
-		// Restrict clinic slots to 8:00 AM - 11:30 AM (Sydney time)
-		localTime := current.In(sydneyLoc)
-		hour := localTime.Hour()
-		minute := localTime.Minute()
-
-		// Skip slots outside 8:00-11:30 time window
-		if hour < 8 || hour > 11 || (hour == 11 && minute > 30) {
-			current = current.Add(15 * time.Minute)
-			continue
-		}
-
-		key := current.Format(time.RFC3339)
-
-		if slot, exists := slotMap[key]; exists {
-			// Slot exists in database - use actual data
-			remaining := slot.MaxCapacity - slot.BookedCount
-			// Return all slots, even if full, so frontend can show appropriate message
-			response = append(response, SlotResponse{
-				SlotTime:  slot.SlotTime,
-				Remaining: remaining,
-				Total:     slot.MaxCapacity,
-			})
-		} else {
-			// Slot doesn't exist yet - all 4 available
-			response = append(response, SlotResponse{
-				SlotTime:  current,
-				Remaining: 4,
-				Total:     4,
-			})
-		}
-
-		current = current.Add(15 * time.Minute)
+	// Return all scheduled slots, even if full, so frontend can show appropriate message
+	response := make([]SlotResponse, 0, len(slots))
+	for _, slot := range slots {
+		response = append(response, SlotResponse{
+			SlotTime:  slot.SlotTime,
+			EndTime:   slot.EndTime,
+			Remaining: slot.Remaining,
+			Total:     slot.Capacity,
+		})
 	}
 
 	return c.JSON(response)
@@ -660,18 +511,42 @@ func DeleteAppointment(c *fiber.Ctx) error {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
 	}
 
-	// Release slot if this was a clinic appointment
-	if appointment.Location == models.AppointmentLocationClinic && appointment.SlotID != nil {
-		_ = models.DecrementSlotBooking(*appointment.SlotID)
-	}
-
-	if err := models.DeleteAppointment(appointment.ID); err != nil {
+	// Release slot in the same transaction as the delete
+	if err := models.DeleteAppointmentBooking(appointment.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Appointment not found"})
+		}
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete appointment"})
 	}
+	offerFreedSlot(appointment.SlotID, nil)
 
 	return c.SendStatus(http.StatusNoContent)
 }
 
+// slotBookingError responds to a failed appointment save, telling slot problems apart.
+func slotBookingError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, models.ErrSlotNotScheduled):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "No clinic session is scheduled at this time",
+			"code":  "INVALID_TIME",
+		})
+	case errors.Is(err, models.ErrSlotFull):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error": "No available slots for this time",
+			"code":  "SLOT_FULL",
+		})
+	case errors.Is(err, models.ErrResourceUnavailable):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error": "Resource unavailable: " + err.Error(),
+			"code":  "RESOURCE_UNAVAILABLE",
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Appointment not found"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": message})
+}
+
 func resolveUserContext(c *fiber.Ctx) (uint, string, error) {
 	userIDVal := c.Locals("user_id")
 	userRoleVal := c.Locals("user_role")
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func setupBookingTestApp(t *testing.T) (*fiber.App, *models.Patient) {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+
+	if err := config.DB.AutoMigrate(
+		&models.Appointment{},
+		&models.AppointmentSlot{},
+		&models.ClinicSession{},
+		&models.ClinicClosure{},
+		&models.ClinicSessionOverride{},
+		&models.WaitlistEntry{},
+		&models.WaitlistOffer{},
+		&models.ClinicResource{},
+		&models.AppointmentResource{},
+	); err != nil {
+		t.Fatalf("failed to migrate appointment models: %v", err)
+	}
+	if err := models.SeedDefaultClinicSessions(config.DB); err != nil {
+		t.Fatalf("failed to seed clinic sessions: %v", err)
+	}
+
+	patient, user := seedAppointmentFixtures(t)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", user.ID)
+		c.Locals("user_role", user.Role)
+		return c.Next()
+	})
+	app.Post("/api/appointments", CreateAppointment)
+	app.Put("/api/appointments/:id", UpdateAppointment)
+	app.Delete("/api/appointments/:id", DeleteAppointment)
+	return app, patient
+}
+
+// nextClinicSlot returns a slot start in the default sessions: 9:00 on the next Monday,
+// clinic time, plus the given number of 15-minute slots.
+func nextClinicSlot(t *testing.T, offset int) time.Time {
+	t.Helper()
+	tz, err := models.ClinicTimeLocation()
+	if err != nil {
+		t.Fatalf("failed to load clinic timezone: %v", err)
+	}
+	day := time.Now().In(tz).AddDate(0, 0, 1)
+	for day.Weekday() != time.Monday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 9, 15*offset, 0, 0, tz)
+}
+
+func doBookingRequest(t *testing.T, app *fiber.App, method, url string, body interface{}) *http.Response {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Errorf("request failed: %v", err)
+		return nil
+	}
+	return resp
+}
+
+func bookClinicAppointment(t *testing.T, app *fiber.App, patientID uint, at time.Time) uint {
+	t.Helper()
+	resp := doBookingRequest(t, app, http.MethodPost, "/api/appointments", map[string]interface{}{
+		"title":     "Device check",
+		"patientId": patientID,
+		"location":  "clinic",
+		"startAt":   at.UTC().Format(time.RFC3339),
+	})
+	if resp == nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 booking appointment, got %v", resp)
+	}
+	var created appointmentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode appointment: %v", err)
+	}
+	return created.ID
+}
+
+func slotBookedCount(t *testing.T, at time.Time) int {
+	t.Helper()
+	var slot models.AppointmentSlot
+	err := config.DB.Where("slot_time = ? AND location = ?", at.UTC(), models.AppointmentLocationClinic).
+		Limit(1).Find(&slot).Error
+	if err != nil {
+		t.Fatalf("failed to load slot: %v", err)
+	}
+	return slot.BookedCount
+}
+
+func TestCreateAppointment_ConcurrentBookingsDoNotOverbook(t *testing.T) {
+	app, patient := setupBookingTestApp(t)
+	at := nextClinicSlot(t, 0)
+
+	const attempts = 12
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := doBookingRequest(t, app, http.MethodPost, "/api/appointments", map[string]interface{}{
+				"title":     "Device check",
+				"patientId": patient.ID,
+				"location":  "clinic",
+				"startAt":   at.UTC().Format(time.RFC3339),
+			})
+			if resp != nil {
+				statuses <- resp.StatusCode
+			}
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created, full := 0, 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			full++
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if created != 4 || full != attempts-4 {
+		t.Fatalf("expected 4 bookings and %d SLOT_FULL, got %d and %d", attempts-4, created, full)
+	}
+
+	if booked := slotBookedCount(t, at); booked != 4 {
+		t.Fatalf("expected booked count 4, got %d", booked)
+	}
+	var appointments int64
+	config.DB.Model(&models.Appointment{}).Count(&appointments)
+	if appointments != 4 {
+		t.Fatalf("expected 4 appointments, got %d", appointments)
+	}
+}
+
+func TestUpdateAppointment_ConcurrentMovesIntoLastPlace(t *testing.T) {
+	app, patient := setupBookingTestApp(t)
+	target := nextClinicSlot(t, 0)
+
+	// Fill all but one place of the target slot
+	for i := 0; i < 3; i++ {
+		bookClinicAppointment(t, app, patient.ID, target)
+	}
+	var ids []uint
+	for i := 1; i <= 5; i++ {
+		ids = append(ids, bookClinicAppointment(t, app, patient.ID, nextClinicSlot(t, i)))
+	}
+
+	statuses := make(chan int, len(ids))
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			resp := doBookingRequest(t, app, http.MethodPut, fmt.Sprintf("/api/appointments/%d", id), map[string]interface{}{
+				"startAt": target.UTC().Format(time.RFC3339),
+			})
+			if resp != nil {
+				statuses <- resp.StatusCode
+			}
+		}(id)
+	}
+	wg.Wait()
+	close(statuses)
+
+	moved := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			moved++
+		} else if status != http.StatusConflict {
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if moved != 1 {
+		t.Fatalf("expected exactly 1 move into the last place, got %d", moved)
+	}
+	if booked := slotBookedCount(t, target); booked != 4 {
+		t.Fatalf("expected target booked count 4, got %d", booked)
+	}
+
+	// The moved appointment released its old slot; the others kept theirs
+	released := 0
+	for i := 1; i <= 5; i++ {
+		switch slotBookedCount(t, nextClinicSlot(t, i)) {
+		case 0:
+			released++
+		case 1:
+		default:
+			t.Fatalf("unexpected booked count in slot %d", i)
+		}
+	}
+	if released != 1 {
+		t.Fatalf("expected 1 released slot, got %d", released)
+	}
+}
+
+func TestDeleteAppointment_ConcurrentDeletesReleaseOnce(t *testing.T) {
+	app, patient := setupBookingTestApp(t)
+	at := nextClinicSlot(t, 0)
+
+	bookClinicAppointment(t, app, patient.ID, at)
+	id := bookClinicAppointment(t, app, patient.ID, at)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			doBookingRequest(t, app, http.MethodDelete, fmt.Sprintf("/api/appointments/%d", id), nil)
+		}()
+	}
+	wg.Wait()
+
+	if booked := slotBookedCount(t, at); booked != 1 {
+		t.Fatalf("expected booked count 1 after deleting one of two, got %d", booked)
+	}
+}
+
+func TestUpdateAppointment_CancelReleasesSlot(t *testing.T) {
+	app, patient := setupBookingTestApp(t)
+	at := nextClinicSlot(t, 0)
+	id := bookClinicAppointment(t, app, patient.ID, at)
+
+	resp := doBookingRequest(t, app, http.MethodPut, fmt.Sprintf("/api/appointments/%d", id), map[string]interface{}{
+		"status": "cancelled",
+	})
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 cancelling appointment, got %v", resp)
+	}
+	if booked := slotBookedCount(t, at); booked != 0 {
+		t.Fatalf("expected cancelled appointment to release its slot, got %d", booked)
+	}
+
+	// Title edits do not touch the booking
+	resp = doBookingRequest(t, app, http.MethodPut, fmt.Sprintf("/api/appointments/%d", id), map[string]interface{}{
+		"title": "Renamed",
+	})
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 renaming appointment, got %v", resp)
+	}
+	if booked := slotBookedCount(t, at); booked != 0 {
+		t.Fatalf("expected booked count to stay 0, got %d", booked)
+	}
+}
+
+func TestReconcileSlotBookings_RecomputesFromLiveAppointments(t *testing.T) {
+	app, patient := setupBookingTestApp(t)
+	first := nextClinicSlot(t, 0)
+	second := nextClinicSlot(t, 1)
+
+	bookClinicAppointment(t, app, patient.ID, first)
+	bookClinicAppointment(t, app, patient.ID, first)
+	cancelled := bookClinicAppointment(t, app, patient.ID, second)
+
+	// Drift the counts the way the old booking code could
+	config.DB.Model(&models.AppointmentSlot{}).Where("slot_time = ?", first.UTC()).Update("booked_count", 4)
+	config.DB.Model(&models.Appointment{}).Where("id = ?", cancelled).Update("status", models.AppointmentStatusCancelled)
+
+	fixed, err := models.ReconcileSlotBookings()
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if fixed != 2 {
+		t.Fatalf("expected 2 corrected slots, got %d", fixed)
+	}
+	if booked := slotBookedCount(t, first); booked != 2 {
+		t.Fatalf("expected first slot booked count 2, got %d", booked)
+	}
+	if booked := slotBookedCount(t, second); booked != 0 {
+		t.Fatalf("expected second slot booked count 0, got %d", booked)
+	}
+
+	if fixed, err := models.ReconcileSlotBookings(); err != nil || fixed != 0 {
+		t.Fatalf("expected nothing left to reconcile, got %d (%v)", fixed, err)
+	}
+}
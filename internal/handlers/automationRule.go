@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type automationRuleRequest struct {
+	Name           string                      `json:"name"`
+	Description    string                      `json:"description"`
+	Enabled        *bool                       `json:"enabled"`
+	DryRun         bool                        `json:"dryRun"`
+	Event          models.WebhookEvent         `json:"event"`
+	Conditions     models.AutomationConditions `json:"conditions"`
+	TemplateID     uint                        `json:"templateId"`
+	AssignToUserID *uint                       `json:"assignToUserId"`
+	AssignToTeamID *uint                       `json:"assignToTeamId"`
+	DueInDays      *int                        `json:"dueInDays"`
+}
+
+// apply copies the request onto rule and validates the result.
+func (r *automationRuleRequest) apply(rule *models.AutomationRule) error {
+	rule.Name = r.Name
+	rule.Description = r.Description
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+	rule.DryRun = r.DryRun
+	rule.Event = r.Event
+	rule.Conditions = r.Conditions
+	rule.TemplateID = r.TemplateID
+	rule.AssignToUserID = r.AssignToUserID
+	rule.AssignToTeamID = r.AssignToTeamID
+	rule.DueInDays = r.DueInDays
+	if err := rule.Normalize(); err != nil {
+		return err
+	}
+
+	var count int64
+	config.DB.Model(&models.TaskTemplate{}).Where("id = ?", rule.TemplateID).Count(&count)
+	if count == 0 {
+		return errors.New("template not found")
+	}
+	if rule.AssignToUserID != nil {
+		config.DB.Model(&models.User{}).Where("id = ?", *rule.AssignToUserID).Count(&count)
+		if count == 0 {
+			return errors.New("assigned user not found")
+		}
+	}
+	if rule.AssignToTeamID != nil {
+		config.DB.Model(&models.Team{}).Where("id = ?", *rule.AssignToTeamID).Count(&count)
+		if count == 0 {
+			return errors.New("assigned team not found")
+		}
+	}
+	return nil
+}
+
+// GetAutomationRules lists automation rules and the events they can react to.
+func GetAutomationRules(c *fiber.Ctx) error {
+	rules, err := models.GetAutomationRules()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load automation rules"})
+	}
+	return c.JSON(fiber.Map{
+		"rules":  rules,
+		"events": models.AutomationEvents,
+	})
+}
+
+// CreateAutomationRule adds a rule. Its tasks are created as the admin who created it.
+func CreateAutomationRule(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var input automationRuleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	rule := models.AutomationRule{Enabled: true, CreatedByID: userID}
+	if err := input.apply(&rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := config.DB.Create(&rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create automation rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User created automation rule %s", rule.Name),
+		"INFO",
+		map[string]interface{}{"ruleId": rule.ID, "event": rule.Event, "templateId": rule.TemplateID, "dryRun": rule.DryRun},
+	)
+
+	return c.Status(http.StatusCreated).JSON(rule)
+}
+
+// UpdateAutomationRule replaces a rule's trigger, conditions and action.
+func UpdateAutomationRule(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rule ID"})
+	}
+	rule, err := models.GetAutomationRule(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load automation rule"})
+	}
+	if rule == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Automation rule not found"})
+	}
+
+	var input automationRuleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.apply(rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	rule.Template = nil
+
+	if err := config.DB.Select("*").Omit("CreatedAt", "CreatedByID").Save(rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update automation rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User updated automation rule %s", rule.Name),
+		"INFO",
+		map[string]interface{}{"ruleId": rule.ID, "event": rule.Event, "enabled": rule.Enabled, "dryRun": rule.DryRun},
+	)
+
+	return c.JSON(rule)
+}
+
+// DeleteAutomationRule removes a rule. Its execution log is kept.
+func DeleteAutomationRule(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rule ID"})
+	}
+	if err := models.DeleteAutomationRule(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Automation rule not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete automation rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion,
+		fmt.Sprintf("User deleted automation rule %d", id),
+		"WARNING",
+		map[string]interface{}{"ruleId": id},
+	)
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// DryRunAutomationRule evaluates a rule against a sample event payload without creating
+// anything or writing to the execution log.
+func DryRunAutomationRule(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rule ID"})
+	}
+	rule, err := models.GetAutomationRule(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load automation rule"})
+	}
+	if rule == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Automation rule not found"})
+	}
+
+	var input struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Data == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "data is required"})
+	}
+
+	// Report which conditions failed so admins can tune the rule.
+	var failed []models.AutomationCondition
+	for _, condition := range rule.Conditions {
+		if !condition.Matches(input.Data) {
+			failed = append(failed, condition)
+		}
+	}
+	if len(failed) > 0 {
+		return c.JSON(fiber.Map{
+			"matched":          false,
+			"failedConditions": failed,
+		})
+	}
+
+	execution, task := services.ExecuteAutomationRule(rule, rule.Event, input.Data, true)
+	return c.JSON(fiber.Map{
+		"matched":   true,
+		"execution": execution,
+		"task":      task,
+	})
+}
+
+// GetAutomationExecutions returns the execution log, newest first. ?ruleId= limits it to
+// one rule.
+func GetAutomationExecutions(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+
+	var ruleID *uint
+	if raw := c.QueryInt("ruleId", 0); raw > 0 {
+		id := uint(raw)
+		ruleID = &id
+	}
+
+	executions, total, err := models.GetAutomationExecutions(ruleID, limit, offset)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load automation log"})
+	}
+
+	return c.JSON(fiber.Map{
+		"executions": executions,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
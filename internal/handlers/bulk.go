@@ -0,0 +1,828 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+// Background jobs save their counters after this many items.
+const bulkProgressInterval = 25
+
+// bulkActor is the user running a bulk action, captured from the request so that a
+// background job can check each item after the request has ended.
+type bulkActor struct {
+	ID   uint
+	Role string
+	User *models.User
+}
+
+func bulkActorFromContext(c *fiber.Ctx) *bulkActor {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return nil
+	}
+	return &bulkActor{ID: user.ID, Role: user.Role, User: user}
+}
+
+// bulkOp is one kind of bulk action. apply checks and changes a single item, in its own
+// transaction, and reports the outcome. finish, when set, runs once every item is done.
+type bulkOp struct {
+	action    string
+	eventType security.EventType
+	params    map[string]interface{} // Logged with the audit event
+	apply     func(id uint) models.BulkItemResult
+	finish    func(job *models.BulkJob) error
+}
+
+func bulkSucceeded() models.BulkItemResult {
+	return models.BulkItemResult{Status: models.BulkItemSucceeded}
+}
+
+func bulkSkipped(message string) models.BulkItemResult {
+	return models.BulkItemResult{Status: models.BulkItemSkipped, Message: message}
+}
+
+func bulkFailed(message string) models.BulkItemResult {
+	return models.BulkItemResult{Status: models.BulkItemFailed, Message: message}
+}
+
+// startBulkJob records a job for op and runs it. Up to BULK_SYNC_LIMIT items are processed
+// before responding; larger batches run in the background and the caller polls the job.
+func startBulkJob(c *fiber.Ctx, actor *bulkActor, ids []uint, op *bulkOp) error {
+	cfg := config.LoadConfig()
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "ids is required"})
+	}
+	if len(ids) > cfg.BulkMaxItems {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("At most %d items can be changed at once", cfg.BulkMaxItems)})
+	}
+
+	job := models.BulkJob{
+		Action:  op.action,
+		UserID:  actor.ID,
+		Status:  models.BulkJobQueued,
+		Total:   len(ids),
+		Results: models.BulkItemResults{},
+	}
+	if err := config.DB.Create(&job).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start bulk action"})
+	}
+	audit := security.EventFromContext(c, op.eventType, "", "INFO", nil)
+
+	if len(ids) <= cfg.BulkSyncLimit {
+		runBulkJob(&job, ids, op, audit, false)
+		return c.JSON(job)
+	}
+
+	queued := job
+	go runBulkJob(&job, ids, op, audit, true)
+	return c.Status(http.StatusAccepted).JSON(queued)
+}
+
+// runBulkJob applies op to each item, keeps the job's progress up to date and, at the end,
+// logs one audit event listing the items affected.
+func runBulkJob(job *models.BulkJob, ids []uint, op *bulkOp, audit security.SecurityEvent, background bool) {
+	started := time.Now()
+	job.Status = models.BulkJobRunning
+	job.StartedAt = &started
+	if err := models.SaveBulkJobProgress(job); err != nil {
+		log.Printf("Error saving progress of bulk job %d: %v", job.ID, err)
+	}
+
+	results := make(models.BulkItemResults, 0, len(ids))
+	var affected, skipped, failed []uint
+	for _, id := range ids {
+		result := applyBulkItem(op, id)
+		results = append(results, result)
+		switch result.Status {
+		case models.BulkItemSucceeded:
+			job.Succeeded++
+			affected = append(affected, id)
+		case models.BulkItemSkipped:
+			job.Skipped++
+			skipped = append(skipped, id)
+		default:
+			job.Failed++
+			failed = append(failed, id)
+		}
+		job.Processed++
+		if background && job.Processed%bulkProgressInterval == 0 && job.Processed < job.Total {
+			if err := models.SaveBulkJobProgress(job); err != nil {
+				log.Printf("Error saving progress of bulk job %d: %v", job.ID, err)
+			}
+		}
+	}
+
+	job.Results = results
+	job.Status = models.BulkJobCompleted
+	if op.finish != nil {
+		if err := op.finish(job); err != nil {
+			log.Printf("Error finishing bulk job %d: %v", job.ID, err)
+			job.Status = models.BulkJobFailed
+			job.Error = "Failed to finish bulk action"
+		}
+	}
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err := models.SaveBulkJobProgress(job); err != nil {
+		log.Printf("Error saving bulk job %d: %v", job.ID, err)
+	}
+
+	details := map[string]interface{}{
+		"jobId":       job.ID,
+		"action":      op.action,
+		"affectedIds": affected,
+		"skippedIds":  skipped,
+		"failedIds":   failed,
+	}
+	for key, value := range op.params {
+		details[key] = value
+	}
+	audit.Message = fmt.Sprintf("Bulk %s on %d items: %d succeeded, %d skipped, %d failed",
+		op.action, job.Total, job.Succeeded, job.Skipped, job.Failed)
+	audit.Details = details
+	if job.Failed > 0 {
+		audit.Severity = "WARNING"
+	}
+	security.LogEvent(audit)
+
+	if background {
+		severity := ""
+		if job.Status == models.BulkJobFailed || job.Failed > 0 {
+			severity = "warning"
+		}
+		services.NotificationsHub.SendToUser(job.UserID, services.NotificationEvent{
+			Type:     "bulk.completed",
+			Title:    "Bulk action finished",
+			Message:  fmt.Sprintf("%s: %d of %d items succeeded", op.action, job.Succeeded, job.Total),
+			Severity: severity,
+		})
+	}
+}
+
+// applyBulkItem runs op on one item. A panic fails the item rather than the server.
+func applyBulkItem(op *bulkOp, id uint) (result models.BulkItemResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Bulk %s panicked on item %d: %v", op.action, id, r)
+			result = bulkFailed("Unexpected error")
+			result.ID = id
+		}
+	}()
+	result = op.apply(id)
+	result.ID = id
+	return result
+}
+
+// loadBulkTags returns the tags of the given type, or a message naming an ID that is not one.
+func loadBulkTags(ids []uint, tagType string) ([]models.Tag, string, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+	var tags []models.Tag
+	if err := config.DB.Where("id IN ? AND type = ?", ids, tagType).Find(&tags).Error; err != nil {
+		return nil, "", err
+	}
+	found := make(map[uint]bool, len(tags))
+	for _, tag := range tags {
+		found[tag.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, fmt.Sprintf("Tag %d is not a %s tag", id, tagType), nil
+		}
+	}
+	return tags, "", nil
+}
+
+// tagChanges works out which of add and remove actually change the current tags, and the
+// resulting set.
+func tagChanges(current, add, remove []models.Tag) (added, removed, after []models.Tag) {
+	has := make(map[uint]bool, len(current))
+	for _, tag := range current {
+		has[tag.ID] = true
+	}
+	dropping := make(map[uint]bool, len(remove))
+	for _, tag := range remove {
+		if has[tag.ID] {
+			dropping[tag.ID] = true
+			removed = append(removed, tag)
+		}
+	}
+	for _, tag := range current {
+		if !dropping[tag.ID] {
+			after = append(after, tag)
+		}
+	}
+	for _, tag := range add {
+		if !has[tag.ID] {
+			added = append(added, tag)
+			after = append(after, tag)
+		}
+	}
+	return added, removed, after
+}
+
+type bulkTagRequest struct {
+	IDs    []uint `json:"ids"`
+	Add    []uint `json:"add"`
+	Remove []uint `json:"remove"`
+}
+
+// parseBulkTagRequest reads and checks a tag change and loads the tags to add and remove.
+// On a bad request it returns the status and message to respond with.
+func parseBulkTagRequest(c *fiber.Ctx, tagType string) (input bulkTagRequest, add, remove []models.Tag, status int, msg string) {
+	if err := c.BodyParser(&input); err != nil {
+		return input, nil, nil, http.StatusBadRequest, "Invalid request body"
+	}
+	if len(input.Add) == 0 && len(input.Remove) == 0 {
+		return input, nil, nil, http.StatusBadRequest, "add or remove is required"
+	}
+	adding := make(map[uint]bool, len(input.Add))
+	for _, id := range input.Add {
+		adding[id] = true
+	}
+	for _, id := range input.Remove {
+		if adding[id] {
+			return input, nil, nil, http.StatusBadRequest, fmt.Sprintf("Tag %d cannot be both added and removed", id)
+		}
+	}
+
+	add, msg, err := loadBulkTags(input.Add, tagType)
+	if err == nil && msg == "" {
+		remove, msg, err = loadBulkTags(input.Remove, tagType)
+	}
+	if err != nil {
+		return input, nil, nil, http.StatusInternalServerError, "Failed to load tags"
+	}
+	if msg != "" {
+		return input, nil, nil, http.StatusBadRequest, msg
+	}
+	return input, add, remove, 0, ""
+}
+
+func tagIDs(tags []models.Tag) []uint {
+	ids := make([]uint, 0, len(tags))
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+	}
+	return ids
+}
+
+// BulkReassignTasks assigns many tasks to one user or team. Tasks given to a team that
+// auto-assigns are handed to a member as if reassigned one by one.
+func BulkReassignTasks(c *fiber.Ctx) error {
+	actor := bulkActorFromContext(c)
+	if actor == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input struct {
+		IDs              []uint `json:"ids"`
+		AssignedToID     *uint  `json:"assignedToId"`
+		AssignedToTeamID *uint  `json:"assignedToTeamId"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if (input.AssignedToID == nil) == (input.AssignedToTeamID == nil) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Provide exactly one of assignedToId or assignedToTeamId"})
+	}
+	var count int64
+	if input.AssignedToID != nil {
+		config.DB.Model(&models.User{}).Where("id = ?", *input.AssignedToID).Count(&count)
+		if count == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "User not found"})
+		}
+	} else {
+		config.DB.Model(&models.Team{}).Where("id = ?", *input.AssignedToTeamID).Count(&count)
+		if count == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Team not found"})
+		}
+	}
+
+	op := &bulkOp{
+		action:    "tasks.reassign",
+		eventType: security.EventDataModification,
+		params:    map[string]interface{}{"assignedToId": input.AssignedToID, "assignedToTeamId": input.AssignedToTeamID},
+		apply: func(id uint) models.BulkItemResult {
+			var task models.Task
+			if err := config.DB.Limit(1).Find(&task, id).Error; err != nil {
+				return bulkFailed("Failed to load task")
+			}
+			if task.ID == 0 {
+				return bulkFailed("Task not found")
+			}
+			// Matches UpdateTask, where only admins may reassign
+			if actor.Role != "admin" || !canUpdateTask(&task, actor.ID, actor.Role) {
+				return bulkFailed("You don't have permission to reassign this task")
+			}
+			if input.AssignedToID != nil {
+				if task.AssignedToID != nil && *task.AssignedToID == *input.AssignedToID && task.AssignedToTeamID == nil {
+					return bulkSkipped("Already assigned to this user")
+				}
+				task.AssignedToID = input.AssignedToID
+				task.AssignedToTeamID = nil
+			} else {
+				if task.AssignedToTeamID != nil && *task.AssignedToTeamID == *input.AssignedToTeamID {
+					return bulkSkipped("Already assigned to this team")
+				}
+				task.AssignedToTeamID = input.AssignedToTeamID
+				task.AssignedToID = nil
+			}
+			task.AssignmentReason = ""
+
+			err := config.DB.Transaction(func(tx *gorm.DB) error {
+				if task.AssignedToTeamID != nil {
+					var tags []models.Tag
+					if err := tx.Model(&task).Association("Tags").Find(&tags); err != nil {
+						return err
+					}
+					if err := models.AutoAssignTask(tx, &task, tags); err != nil {
+						return err
+					}
+				}
+				return tx.Model(&task).
+					Select("assigned_to_id", "assigned_to_team_id", "assignment_reason").
+					Updates(&task).Error
+			})
+			if err != nil {
+				return bulkFailed("Failed to reassign task")
+			}
+			notifyAutoAssigned(&task)
+			return bulkSucceeded()
+		},
+	}
+	return startBulkJob(c, actor, input.IDs, op)
+}
+
+// BulkUpdateTaskStatus sets the status of many tasks. Tasks blocked by unfinished
+// prerequisites are not completed. Completing an occurrence of a recurring task creates
+// the next one, as it does for a single task.
+func BulkUpdateTaskStatus(c *fiber.Ctx) error {
+	actor := bulkActorFromContext(c)
+	if actor == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input struct {
+		IDs    []uint `json:"ids"`
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	status := models.TaskStatus(input.Status)
+	switch status {
+	case models.TaskStatusPending, models.TaskStatusInProgress, models.TaskStatusCompleted, models.TaskStatusCancelled:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "status must be pending, in_progress, completed or cancelled"})
+	}
+
+	var completed []uint
+	username, _ := c.Locals("username").(string)
+	op := &bulkOp{
+		action:    "tasks.status",
+		eventType: security.EventDataModification,
+		params:    map[string]interface{}{"status": status},
+		apply: func(id uint) models.BulkItemResult {
+			var task models.Task
+			if err := config.DB.Limit(1).Find(&task, id).Error; err != nil {
+				return bulkFailed("Failed to load task")
+			}
+			if task.ID == 0 {
+				return bulkFailed("Task not found")
+			}
+			if actor.Role == "doctor" || !canUpdateTask(&task, actor.ID, actor.Role) {
+				return bulkFailed("You don't have permission to update this task")
+			}
+			if task.Status == status {
+				return bulkSkipped("Task already has this status")
+			}
+
+			completing := status == models.TaskStatusCompleted
+			if completing {
+				blockers, err := models.GetOpenPrerequisites(task.ID)
+				if err != nil {
+					return bulkFailed("Failed to check prerequisites")
+				}
+				if len(blockers) > 0 {
+					names := make([]string, 0, len(blockers))
+					for _, blocker := range blockers {
+						names = append(names, fmt.Sprintf("#%d %s", blocker.ID, blocker.Title))
+					}
+					return bulkFailed("Task is blocked by unfinished prerequisites: " + strings.Join(names, ", "))
+				}
+			}
+
+			updates := map[string]interface{}{"status": status}
+			if completing && task.CompletedAt == nil {
+				updates["completed_at"] = time.Now()
+			}
+			if err := config.DB.Model(&task).Updates(updates).Error; err != nil {
+				return bulkFailed("Failed to update task")
+			}
+
+			if completing {
+				completed = append(completed, task.ID)
+				if task.SeriesID != nil {
+					if _, err := services.CreateNextTaskOccurrence(*task.SeriesID, task.SeriesIndex+1); err != nil {
+						log.Printf("Error creating next occurrence of task series %d: %v", *task.SeriesID, err)
+					}
+				}
+			}
+			return bulkSucceeded()
+		},
+		// One notification for the batch rather than one per task
+		finish: func(job *models.BulkJob) error {
+			if len(completed) == 0 {
+				return nil
+			}
+			event := services.NotificationEvent{
+				Type:        "task.completed",
+				Title:       "Tasks completed",
+				Message:     fmt.Sprintf("%s marked %d tasks complete", username, len(completed)),
+				CompletedBy: username,
+			}
+			if len(completed) == 1 {
+				event.TaskID = &completed[0]
+			}
+			services.NotificationsHub.BroadcastToAdmins(event)
+			return nil
+		},
+	}
+	return startBulkJob(c, actor, input.IDs, op)
+}
+
+// BulkTagPatients adds and removes patient tags on many patients. Tag changes are recorded in
+// each patient's timeline.
+func BulkTagPatients(c *fiber.Ctx) error {
+	actor := bulkActorFromContext(c)
+	if actor == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	input, add, remove, status, msg := parseBulkTagRequest(c, "patient")
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	userName := reviewUserName(actor.User)
+
+	op := &bulkOp{
+		action:    "patients.tags",
+		eventType: security.EventDataModification,
+		params:    map[string]interface{}{"addTagIds": tagIDs(add), "removeTagIds": tagIDs(remove)},
+		apply: func(id uint) models.BulkItemResult {
+			var patient models.Patient
+			if err := config.DB.Preload("Tags").Limit(1).Find(&patient, id).Error; err != nil {
+				return bulkFailed("Failed to load patient")
+			}
+			if patient.ID == 0 {
+				return bulkFailed("Patient not found")
+			}
+			if result, ok := bulkPatientAccess(actor, patient.ID); !ok {
+				return result
+			}
+
+			// Appending updates patient.Tags, so keep the tags from before for the history
+			before := append([]models.Tag(nil), patient.Tags...)
+			added, removed, after := tagChanges(before, add, remove)
+			if len(added) == 0 && len(removed) == 0 {
+				return bulkSkipped("Tags already up to date")
+			}
+			err := config.DB.Transaction(func(tx *gorm.DB) error {
+				if len(added) > 0 {
+					if err := tx.Model(&patient).Association("Tags").Append(added); err != nil {
+						return err
+					}
+				}
+				if len(removed) > 0 {
+					if err := tx.Model(&patient).Association("Tags").Delete(removed); err != nil {
+						return err
+					}
+				}
+				return models.RecordPatientTagChanges(tx, patient.ID, before, after, &actor.ID, userName)
+			})
+			if err != nil {
+				return bulkFailed("Failed to update tags")
+			}
+			return bulkSucceeded()
+		},
+	}
+	return startBulkJob(c, actor, input.IDs, op)
+}
+
+// BulkTagReports adds and removes report tags on many reports.
+func BulkTagReports(c *fiber.Ctx) error {
+	actor := bulkActorFromContext(c)
+	if actor == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	input, add, remove, status, msg := parseBulkTagRequest(c, "report")
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	op := &bulkOp{
+		action:    "reports.tags",
+		eventType: security.EventDataModification,
+		params:    map[string]interface{}{"addTagIds": tagIDs(add), "removeTagIds": tagIDs(remove)},
+		apply: func(id uint) models.BulkItemResult {
+			var report models.Report
+			if err := config.DB.Preload("Tags").Limit(1).Find(&report, id).Error; err != nil {
+				return bulkFailed("Failed to load report")
+			}
+			if report.ID == 0 {
+				return bulkFailed("Report not found")
+			}
+			if result, ok := bulkPatientAccess(actor, report.PatientID); !ok {
+				return result
+			}
+
+			added, removed, _ := tagChanges(report.Tags, add, remove)
+			if len(added) == 0 && len(removed) == 0 {
+				return bulkSkipped("Tags already up to date")
+			}
+			err := config.DB.Transaction(func(tx *gorm.DB) error {
+				if len(added) > 0 {
+					if err := tx.Model(&report).Association("Tags").Append(added); err != nil {
+						return err
+					}
+				}
+				if len(removed) > 0 {
+					return tx.Model(&report).Association("Tags").Delete(removed)
+				}
+				return nil
+			})
+			if err != nil {
+				return bulkFailed("Failed to update tags")
+			}
+			return bulkSucceeded()
+		},
+	}
+	return startBulkJob(c, actor, input.IDs, op)
+}
+
+// BulkReviewReports signs many reports awaiting physician sign-off, marking them reviewed.
+// Each report must be one the user could sign individually.
+func BulkReviewReports(c *fiber.Ctx) error {
+	actor := bulkActorFromContext(c)
+	if actor == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input struct {
+		IDs       []uint `json:"ids"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	signature := strings.TrimSpace(input.Signature)
+
+	op := &bulkOp{
+		action:    "reports.review",
+		eventType: security.EventDataModification,
+		apply: func(id uint) models.BulkItemResult {
+			report, err := models.GetReportByID(id)
+			if err != nil {
+				return bulkFailed("Report not found")
+			}
+			if report.SignoffStatus == models.SignoffSigned {
+				return bulkSkipped("Report is already signed")
+			}
+			if report.SignoffStatus != models.SignoffAwaitingPhysician {
+				return bulkFailed(models.ErrSignoffNotAwaiting.Error())
+			}
+			if status, msg := checkReportSigner(actor.User, report); status != 0 {
+				return bulkFailed(msg)
+			}
+			if err := applyReportSignature(report, actor.User, signature); err != nil {
+				return bulkFailed("Failed to sign report")
+			}
+			if updated, err := models.GetReportByID(id); err == nil {
+				syncReportReview(updated)
+			}
+			return bulkSucceeded()
+		},
+	}
+	return startBulkJob(c, actor, input.IDs, op)
+}
+
+// bulkExporters write one CSV row per item the user may see, keyed by entity.
+var bulkExporters = map[string]struct {
+	header []string
+	row    func(actor *bulkActor, id uint) ([]string, models.BulkItemResult)
+}{
+	"patients": {
+		header: []string{"ID", "MRN", "First Name", "Last Name", "Date of Birth", "Tags"},
+		row: func(actor *bulkActor, id uint) ([]string, models.BulkItemResult) {
+			var patient models.Patient
+			if err := config.DB.Preload("Tags").Limit(1).Find(&patient, id).Error; err != nil {
+				return nil, bulkFailed("Failed to load patient")
+			}
+			if patient.ID == 0 {
+				return nil, bulkFailed("Patient not found")
+			}
+			if result, ok := bulkPatientAccess(actor, patient.ID); !ok {
+				return nil, result
+			}
+			names := make([]string, 0, len(patient.Tags))
+			for _, tag := range patient.Tags {
+				names = append(names, tag.Name)
+			}
+			return []string{
+				strconv.Itoa(int(patient.ID)), strconv.Itoa(patient.MRN), patient.FirstName, patient.LastName,
+				patient.DOB, strings.Join(names, "; "),
+			}, bulkSucceeded()
+		},
+	},
+	"reports": {
+		header: []string{"ID", "Patient MRN", "Patient Name", "Report Date", "Report Type", "Status", "Completed"},
+		row: func(actor *bulkActor, id uint) ([]string, models.BulkItemResult) {
+			var report models.Report
+			if err := config.DB.Preload("Patient").Limit(1).Find(&report, id).Error; err != nil {
+				return nil, bulkFailed("Failed to load report")
+			}
+			if report.ID == 0 {
+				return nil, bulkFailed("Report not found")
+			}
+			if result, ok := bulkPatientAccess(actor, report.PatientID); !ok {
+				return nil, result
+			}
+			return []string{
+				strconv.Itoa(int(report.ID)), strconv.Itoa(report.Patient.MRN),
+				strings.TrimSpace(report.Patient.FirstName + " " + report.Patient.LastName),
+				report.ReportDate.Format("2006-01-02"), report.ReportType, report.ReportStatus,
+				strconv.FormatBool(report.IsCompleted != nil && *report.IsCompleted),
+			}, bulkSucceeded()
+		},
+	},
+	"tasks": {
+		header: []string{"ID", "Title", "Status", "Priority", "Due Date", "Patient MRN", "Assigned To", "Team"},
+		row: func(actor *bulkActor, id uint) ([]string, models.BulkItemResult) {
+			var task models.Task
+			if err := config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").
+				Limit(1).Find(&task, id).Error; err != nil {
+				return nil, bulkFailed("Failed to load task")
+			}
+			if task.ID == 0 {
+				return nil, bulkFailed("Task not found")
+			}
+			if !canViewTask(&task, actor.ID, actor.Role) {
+				return nil, bulkFailed("Access denied")
+			}
+			row := []string{strconv.Itoa(int(task.ID)), task.Title, string(task.Status), string(task.Priority), "", "", "", ""}
+			if task.DueDate != nil {
+				row[4] = task.DueDate.Format("2006-01-02")
+			}
+			if task.Patient != nil {
+				row[5] = strconv.Itoa(task.Patient.MRN)
+			}
+			if task.AssignedTo != nil {
+				row[6] = reviewUserName(task.AssignedTo)
+			}
+			if task.AssignedToTeam != nil {
+				row[7] = task.AssignedToTeam.Name
+			}
+			return row, bulkSucceeded()
+		},
+	},
+}
+
+func bulkPatientAccess(actor *bulkActor, patientID uint) (models.BulkItemResult, bool) {
+	allowed, err := models.CanAccessPatient(actor.User, patientID)
+	if err != nil {
+		return bulkFailed("Failed to verify access"), false
+	}
+	if !allowed {
+		return bulkFailed("Access denied"), false
+	}
+	return models.BulkItemResult{}, true
+}
+
+// BulkExport exports a selection of patients, reports or tasks as CSV. Items the user may
+// not see are left out and reported as failed. The file is downloaded from the job.
+func BulkExport(c *fiber.Ctx) error {
+	actor := bulkActorFromContext(c)
+	if actor == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input struct {
+		Entity string `json:"entity"`
+		IDs    []uint `json:"ids"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	exporter, ok := bulkExporters[input.Entity]
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "entity must be patients, reports or tasks"})
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write(exporter.header)
+	op := &bulkOp{
+		action:    input.Entity + ".export",
+		eventType: security.EventDataAccess,
+		apply: func(id uint) models.BulkItemResult {
+			row, result := exporter.row(actor, id)
+			if row != nil {
+				_ = writer.Write(row)
+			}
+			return result
+		},
+		finish: func(job *models.BulkJob) error {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+			job.Output = buf.Bytes()
+			job.OutputName = fmt.Sprintf("%s_export_%s.csv", input.Entity, time.Now().Format("20060102_150405"))
+			return nil
+		},
+	}
+	return startBulkJob(c, actor, input.IDs, op)
+}
+
+// GetBulkJobs lists the current user's recent bulk jobs, without their results.
+func GetBulkJobs(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	jobs, err := models.GetUserBulkJobs(userID, 50)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load bulk jobs"})
+	}
+	return c.JSON(jobs)
+}
+
+// loadBulkJobForUser returns the job if it belongs to the user, or sends an error response.
+func loadBulkJobForUser(c *fiber.Ctx) (*models.BulkJob, error) {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return nil, c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID"})
+	}
+	job, err := models.GetBulkJob(id)
+	if err != nil {
+		return nil, c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load bulk job"})
+	}
+	if job == nil || job.UserID != userID {
+		return nil, c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Bulk job not found"})
+	}
+	return job, nil
+}
+
+// GetBulkJob returns a bulk job's progress, and its per-item results once it is done.
+func GetBulkJob(c *fiber.Ctx) error {
+	job, err := loadBulkJobForUser(c)
+	if job == nil {
+		return err
+	}
+	return c.JSON(job)
+}
+
+// DownloadBulkJobExport sends the CSV produced by a finished export job.
+func DownloadBulkJobExport(c *fiber.Ctx) error {
+	job, err := loadBulkJobForUser(c)
+	if job == nil {
+		return err
+	}
+	if !job.Done() {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Export is still running"})
+	}
+	if job.OutputName == "" {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Bulk job has no export"})
+	}
+	output, err := models.GetBulkJobOutput(job.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load export"})
+	}
+
+	security.LogEventFromContext(c, security.EventFileDownload,
+		fmt.Sprintf("User downloaded bulk export %d", job.ID),
+		"INFO",
+		map[string]interface{}{"jobId": job.ID, "action": job.Action},
+	)
+
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", job.OutputName))
+	return c.Send(output)
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+)
+
+type calendarFeedInput struct {
+	Name                       *string `json:"name"`
+	PrivacyLevel               *string `json:"privacyLevel"`
+	Appointments               *string `json:"appointments"`
+	IncludePatientAppointments *bool   `json:"includePatientAppointments"`
+	IncludeTasks               *bool   `json:"includeTasks"`
+}
+
+// apply copies the given fields onto the feed and returns a message if one is invalid.
+func (in *calendarFeedInput) apply(feed *models.CalendarFeed, user *models.User) string {
+	if in.Name != nil {
+		feed.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.PrivacyLevel != nil {
+		feed.PrivacyLevel = *in.PrivacyLevel
+	}
+	if in.Appointments != nil {
+		feed.Appointments = *in.Appointments
+	}
+	if in.IncludePatientAppointments != nil {
+		feed.IncludePatientAppointments = *in.IncludePatientAppointments
+	}
+	if in.IncludeTasks != nil {
+		feed.IncludeTasks = *in.IncludeTasks
+	}
+
+	if feed.Name == "" || len(feed.Name) > 100 {
+		return "Name is required and must be at most 100 characters"
+	}
+	if !models.IsFeedPrivacyLevel(feed.PrivacyLevel) {
+		return "privacyLevel must be busy, limited or full"
+	}
+	if models.FeedPrivacyRank(feed.PrivacyLevel) > models.FeedPrivacyRank(services.CalendarFeedMaxPrivacy()) {
+		return fmt.Sprintf("privacyLevel cannot be more detailed than %s", services.CalendarFeedMaxPrivacy())
+	}
+	switch feed.Appointments {
+	case models.FeedAppointmentsNone, models.FeedAppointmentsMine:
+	case models.FeedAppointmentsClinic:
+		if user.Role == "doctor" {
+			return "Doctors can only subscribe to their own and their patients' appointments"
+		}
+	default:
+		return "appointments must be none, mine or clinic"
+	}
+	if feed.IncludePatientAppointments && user.Role != "doctor" {
+		return "includePatientAppointments is only available to doctors"
+	}
+	return ""
+}
+
+// calendarFeedURL is the subscription URL for a feed token. Tokens are only shown when a
+// feed is created or rotated.
+func calendarFeedURL(c *fiber.Ctx, token string) string {
+	return fmt.Sprintf("%s/api/calendar/feed/%s.ics", c.BaseURL(), token)
+}
+
+// GetCalendarFeeds lists the current user's active calendar feeds.
+func GetCalendarFeeds(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	feeds, err := models.GetUserCalendarFeeds(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load calendar feeds"})
+	}
+	return c.JSON(fiber.Map{
+		"feeds":      feeds,
+		"maxPrivacy": services.CalendarFeedMaxPrivacy(),
+	})
+}
+
+// CreateCalendarFeed creates a calendar feed for the current user and returns its
+// subscription URL. The URL contains the feed's secret and is not shown again.
+func CreateCalendarFeed(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input calendarFeedInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	feed := models.CalendarFeed{
+		UserID:       user.ID,
+		Name:         "goReporter",
+		PrivacyLevel: models.FeedPrivacyBusy,
+		Appointments: models.FeedAppointmentsMine,
+		IncludeTasks: true,
+	}
+	if msg := input.apply(&feed, user); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	token, hash, err := models.NewCalendarFeedToken()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create calendar feed"})
+	}
+	feed.TokenHash = hash
+	feed.TokenHint = token[:8]
+	if err := config.DB.Create(&feed).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create calendar feed"})
+	}
+
+	security.LogEventFromContext(c, security.EventTokenIssued, "Calendar feed created", "INFO", map[string]interface{}{
+		"feedId":       feed.ID,
+		"privacyLevel": feed.PrivacyLevel,
+	})
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"feed": feed,
+		"url":  calendarFeedURL(c, token),
+	})
+}
+
+// UpdateCalendarFeed changes a feed's name, privacy level or contents. The URL stays the
+// same.
+func UpdateCalendarFeed(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	feed, status, msg := loadCalendarFeed(c, user.ID)
+	if feed == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	var input calendarFeedInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := input.apply(feed, user); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	err := config.DB.Model(feed).Select("name", "privacy_level", "appointments", "include_patient_appointments", "include_tasks").
+		Updates(feed).Error
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update calendar feed"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Calendar feed updated", "INFO", map[string]interface{}{
+		"feedId":       feed.ID,
+		"privacyLevel": feed.PrivacyLevel,
+	})
+	return c.JSON(feed)
+}
+
+// RotateCalendarFeed replaces a feed's secret. Calendars subscribed with the old URL stop
+// updating; the new URL is returned once.
+func RotateCalendarFeed(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	feed, status, msg := loadCalendarFeed(c, userID)
+	if feed == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	token, err := models.RotateCalendarFeedToken(feed)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rotate calendar feed"})
+	}
+
+	security.LogEventFromContext(c, security.EventTokenRefreshed, "Calendar feed token rotated", "INFO", map[string]interface{}{
+		"feedId": feed.ID,
+	})
+	return c.JSON(fiber.Map{
+		"feed": feed,
+		"url":  calendarFeedURL(c, token),
+	})
+}
+
+// RevokeCalendarFeed revokes one of the current user's feeds.
+func RevokeCalendarFeed(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	feed, status, msg := loadCalendarFeed(c, userID)
+	if feed == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if _, err := models.RevokeCalendarFeeds(userID, &feed.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke calendar feed"})
+	}
+
+	security.LogEventFromContext(c, security.EventTokenRevoked, "Calendar feed revoked", "INFO", map[string]interface{}{
+		"feedId": feed.ID,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// RevokeUserCalendarFeeds lets an admin revoke every feed a user has, e.g. when a device
+// with the user's calendar is lost.
+func RevokeUserCalendarFeeds(c *fiber.Ctx) error {
+	userID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	revoked, err := models.RevokeCalendarFeeds(userID, nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke calendar feeds"})
+	}
+
+	security.LogEventFromContext(c, security.EventTokenRevoked, "Calendar feeds revoked by admin", "WARNING", map[string]interface{}{
+		"targetUserId": userID,
+		"revoked":      revoked,
+	})
+	return c.JSON(fiber.Map{"revoked": revoked})
+}
+
+// GetCalendarFeedICS serves a feed to calendar apps. It is public: the token in the URL is
+// the only credential, so every failure looks the same.
+func GetCalendarFeedICS(c *fiber.Ctx) error {
+	token := strings.TrimSuffix(c.Params("token"), ".ics")
+	notFound := func() error {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Calendar feed not found"})
+	}
+	if token == "" {
+		return notFound()
+	}
+
+	feed, err := models.GetCalendarFeedByToken(token)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load calendar feed"})
+	}
+	if feed == nil {
+		return notFound()
+	}
+	user, err := models.GetUserByID(strconv.FormatUint(uint64(feed.UserID), 10))
+	if err != nil || user.IsTemporaryExpired() {
+		return notFound()
+	}
+
+	now := time.Now()
+	body, err := services.BuildCalendarFeed(feed, user, now)
+	if err != nil {
+		log.Printf("Error building calendar feed %d: %v", feed.ID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build calendar feed"})
+	}
+	if err := models.TouchCalendarFeed(feed.ID, now); err != nil {
+		log.Printf("Error recording calendar feed %d access: %v", feed.ID, err)
+	}
+
+	security.LogEventWithUser(c, security.EventDataAccess, "Calendar feed fetched", "INFO",
+		strconv.FormatUint(uint64(user.ID), 10), user.Username, map[string]interface{}{
+			"feedId":       feed.ID,
+			"privacyLevel": services.CalendarFeedPrivacy(feed),
+		})
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="calendar.ics"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(body)
+}
+
+// loadCalendarFeed returns the current user's feed named by the :id param, or a status and
+// message to respond with.
+func loadCalendarFeed(c *fiber.Ctx, userID uint) (*models.CalendarFeed, int, string) {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid calendar feed ID"
+	}
+	feed, err := models.GetCalendarFeed(userID, id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to load calendar feed"
+	}
+	if feed == nil {
+		return nil, http.StatusNotFound, "Calendar feed not found"
+	}
+	return feed, 0, ""
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"gorm.io/gorm"
+)
+
+type clinicSessionRequest struct {
+	Name        *string `json:"name"`
+	Location    *string `json:"location"`
+	Weekday     *int    `json:"weekday"`
+	StartTime   *string `json:"startTime"`
+	EndTime     *string `json:"endTime"`
+	SlotMinutes *int    `json:"slotMinutes"`
+	Capacity    *int    `json:"capacity"`
+	Active      *bool   `json:"active"`
+}
+
+// apply copies the given fields onto the session, validates it and checks that it does not
+// overlap another session. It returns a status and message when the session is rejected.
+func (in *clinicSessionRequest) apply(session *models.ClinicSession) (int, string) {
+	if in.Name != nil {
+		session.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Location != nil {
+		session.Location = normalizeAppointmentLocation(*in.Location)
+	}
+	if in.Weekday != nil {
+		session.Weekday = time.Weekday(*in.Weekday)
+	}
+	if in.StartTime != nil {
+		session.StartTime = strings.TrimSpace(*in.StartTime)
+	}
+	if in.EndTime != nil {
+		session.EndTime = strings.TrimSpace(*in.EndTime)
+	}
+	if in.SlotMinutes != nil {
+		session.SlotMinutes = *in.SlotMinutes
+	}
+	if in.Capacity != nil {
+		session.Capacity = *in.Capacity
+	}
+	if in.Active != nil {
+		session.Active = *in.Active
+	}
+
+	if err := session.Validate(); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if !session.Active {
+		return 0, ""
+	}
+	overlap, err := models.FindOverlappingSession(session)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to check clinic sessions"
+	}
+	if overlap != nil {
+		return http.StatusConflict, "Session overlaps " + overlap.StartTime + "-" + overlap.EndTime + " on the same day"
+	}
+	return 0, ""
+}
+
+// GetClinicSessions lists the weekly session templates. ?location= limits it to one location.
+func GetClinicSessions(c *fiber.Ctx) error {
+	var location models.AppointmentLocation
+	if value := c.Query("location"); value != "" {
+		location = normalizeAppointmentLocation(value)
+	}
+	sessions, err := models.GetClinicSessions(location)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load clinic sessions"})
+	}
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+		"timezone": config.LoadConfig().ClinicTimezone,
+	})
+}
+
+// CreateClinicSession adds a weekly session template.
+func CreateClinicSession(c *fiber.Ctx) error {
+	var input clinicSessionRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.Weekday == nil || input.StartTime == nil || input.EndTime == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "weekday, startTime and endTime are required"})
+	}
+
+	session := models.ClinicSession{
+		Location:    models.AppointmentLocationClinic,
+		SlotMinutes: 15,
+		Capacity:    4,
+		Active:      true,
+	}
+	if status, msg := input.apply(&session); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create clinic session"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Clinic session created", "INFO", map[string]interface{}{
+		"sessionId": session.ID,
+		"weekday":   session.Weekday,
+	})
+	return c.Status(http.StatusCreated).JSON(session)
+}
+
+// UpdateClinicSession changes a session template. Appointments already booked keep their
+// slots; the new hours and capacity apply to bookings made from now on.
+func UpdateClinicSession(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+	var session models.ClinicSession
+	if err := config.DB.First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Clinic session not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load clinic session"})
+	}
+
+	var input clinicSessionRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if status, msg := input.apply(&session); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Save(&session).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update clinic session"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Clinic session updated", "INFO", map[string]interface{}{
+		"sessionId": session.ID,
+	})
+	return c.JSON(session)
+}
+
+// DeleteClinicSession removes a session template and its overrides.
+func DeleteClinicSession(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+	var deleted int64
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", id).Delete(&models.ClinicSessionOverride{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.ClinicSession{}, id)
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete clinic session"})
+	}
+	if deleted == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Clinic session not found"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Clinic session deleted", "INFO", map[string]interface{}{
+		"sessionId": id,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// GetClinicClosures lists holidays and blackouts ending on or after ?from= (default today).
+func GetClinicClosures(c *fiber.Ctx) error {
+	from, msg := scheduleFromDate(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	closures, err := models.GetClinicClosures(from)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load clinic closures"})
+	}
+	return c.JSON(closures)
+}
+
+// CreateClinicClosure closes a location, or all of them, for one or more days. Appointments
+// already booked on those days are not cancelled; the response counts them.
+func CreateClinicClosure(c *fiber.Ctx) error {
+	var input struct {
+		Location  string `json:"location"`
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+		Kind      string `json:"kind"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.EndDate == "" {
+		input.EndDate = input.StartDate
+	}
+	start, err := time.Parse("2006-01-02", input.StartDate)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "startDate must be YYYY-MM-DD"})
+	}
+	end, err := time.Parse("2006-01-02", input.EndDate)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "endDate must be YYYY-MM-DD"})
+	}
+	if end.Before(start) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "endDate must not be before startDate"})
+	}
+
+	closure := models.ClinicClosure{
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+		Kind:      models.ClinicClosureBlackout,
+		Reason:    strings.TrimSpace(input.Reason),
+	}
+	if strings.TrimSpace(input.Location) != "" {
+		closure.Location = normalizeAppointmentLocation(input.Location)
+	}
+	switch input.Kind {
+	case "", models.ClinicClosureBlackout:
+	case models.ClinicClosureHoliday:
+		closure.Kind = models.ClinicClosureHoliday
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "kind must be holiday or blackout"})
+	}
+
+	if err := config.DB.Create(&closure).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create clinic closure"})
+	}
+	booked, err := countBookedAppointments(closure.Location, closure.StartDate, closure.EndDate)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count booked appointments"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Clinic closure created", "INFO", map[string]interface{}{
+		"closureId": closure.ID,
+		"startDate": closure.StartDate,
+		"endDate":   closure.EndDate,
+	})
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"closure":            closure,
+		"bookedAppointments": booked,
+	})
+}
+
+// DeleteClinicClosure reopens the days a closure covered.
+func DeleteClinicClosure(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid closure ID"})
+	}
+	result := config.DB.Delete(&models.ClinicClosure{}, id)
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete clinic closure"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Clinic closure not found"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Clinic closure deleted", "INFO", map[string]interface{}{
+		"closureId": id,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// GetClinicSessionOverrides lists overrides dated on or after ?from= (default today).
+func GetClinicSessionOverrides(c *fiber.Ctx) error {
+	from, msg := scheduleFromDate(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	overrides, err := models.GetClinicSessionOverrides(from)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load session overrides"})
+	}
+	return c.JSON(overrides)
+}
+
+// CreateClinicSessionOverride changes one session on one date, or adds an extra session
+// when no sessionId is given.
+func CreateClinicSessionOverride(c *fiber.Ctx) error {
+	var input models.ClinicSessionOverride
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	date, err := time.Parse("2006-01-02", input.Date)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+
+	override := models.ClinicSessionOverride{
+		Date:        input.Date,
+		Location:    normalizeAppointmentLocation(string(input.Location)),
+		SessionID:   input.SessionID,
+		Cancelled:   input.Cancelled,
+		StartTime:   input.StartTime,
+		EndTime:     input.EndTime,
+		SlotMinutes: input.SlotMinutes,
+		Capacity:    input.Capacity,
+		Reason:      strings.TrimSpace(input.Reason),
+	}
+
+	// The session as it will run on the date, to validate the result
+	hours := models.ClinicSession{Weekday: date.Weekday(), SlotMinutes: 15, Capacity: 4}
+	if override.SessionID != nil {
+		var session models.ClinicSession
+		if err := config.DB.First(&session, *override.SessionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Clinic session not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load clinic session"})
+		}
+		if session.Weekday != date.Weekday() {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "The session does not run on " + date.Weekday().String()})
+		}
+		var existing int64
+		err := config.DB.Model(&models.ClinicSessionOverride{}).
+			Where("session_id = ? AND date = ?", session.ID, override.Date).
+			Count(&existing).Error
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check session overrides"})
+		}
+		if existing > 0 {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The session already has an override on this date"})
+		}
+		override.Location = session.Location
+		hours = session
+	} else if override.Cancelled || override.StartTime == nil || override.EndTime == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "startTime and endTime are required for an extra session"})
+	}
+
+	if !override.Cancelled {
+		if override.StartTime != nil {
+			hours.StartTime = *override.StartTime
+		}
+		if override.EndTime != nil {
+			hours.EndTime = *override.EndTime
+		}
+		if override.SlotMinutes != nil {
+			hours.SlotMinutes = *override.SlotMinutes
+		}
+		if override.Capacity != nil {
+			hours.Capacity = *override.Capacity
+		}
+		if err := hours.Validate(); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	if err := config.DB.Create(&override).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create session override"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Clinic session override created", "INFO", map[string]interface{}{
+		"overrideId": override.ID,
+		"date":       override.Date,
+		"sessionId":  override.SessionID,
+	})
+	return c.Status(http.StatusCreated).JSON(override)
+}
+
+// DeleteClinicSessionOverride restores the template schedule on the override's date.
+func DeleteClinicSessionOverride(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid override ID"})
+	}
+	result := config.DB.Delete(&models.ClinicSessionOverride{}, id)
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete session override"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Session override not found"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Clinic session override deleted", "INFO", map[string]interface{}{
+		"overrideId": id,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// scheduleFromDate reads ?from= as a date, defaulting to today in the clinic timezone.
+func scheduleFromDate(c *fiber.Ctx) (string, string) {
+	if from := c.Query("from"); from != "" {
+		if _, err := time.Parse("2006-01-02", from); err != nil {
+			return "", "from must be YYYY-MM-DD"
+		}
+		return from, ""
+	}
+	now := time.Now()
+	if tz, err := models.ClinicTimeLocation(); err == nil {
+		now = now.In(tz)
+	}
+	return now.Format("2006-01-02"), ""
+}
+
+// countBookedAppointments counts scheduled appointments at a location, or at any location
+// when it is empty, between two dates in the clinic timezone.
+func countBookedAppointments(location models.AppointmentLocation, startDate, endDate string) (int64, error) {
+	tz, err := models.ClinicTimeLocation()
+	if err != nil {
+		return 0, err
+	}
+	start, _ := time.ParseInLocation("2006-01-02", startDate, tz)
+	end, _ := time.ParseInLocation("2006-01-02", endDate, tz)
+
+	query := config.DB.Model(&models.Appointment{}).
+		Where("status = ? AND start_at >= ? AND start_at < ?", models.AppointmentStatusScheduled, start.UTC(), end.AddDate(0, 0, 1).UTC())
+	if location != "" {
+		query = query.Where("location = ?", location)
+	}
+	var count int64
+	err = query.Count(&count).Error
+	return count, err
+}
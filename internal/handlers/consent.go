@@ -373,6 +373,14 @@ func RevokeConsent(c *fiber.Ctx) error {
 		})
 	}
 
+	TriggerWebhook(models.EventConsentRevoked, map[string]interface{}{
+		"consentId":   consent.ID,
+		"patientId":   consent.PatientID,
+		"consentType": consent.ConsentType,
+		"status":      models.ConsentRevoked,
+		"revokedAt":   time.Now(),
+	})
+
 	// Log event
 	security.LogEventFromContext(c, security.EventDataModification,
 		"Patient consent revoked",
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type duplicatePatientSummary struct {
+	ID     uint   `json:"id"`
+	MRN    int    `json:"mrn"`
+	Fname  string `json:"fname"`
+	Lname  string `json:"lname"`
+	DOB    string `json:"dob"`
+	Phone  string `json:"phone,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Postal string `json:"postal,omitempty"`
+}
+
+type duplicateCandidateResponse struct {
+	ID           uint                    `json:"id"`
+	Score        float64                 `json:"score"`
+	Reasons      []string                `json:"reasons"`
+	Status       string                  `json:"status"`
+	PatientA     duplicatePatientSummary `json:"patientA"`
+	PatientB     duplicatePatientSummary `json:"patientB"`
+	ReviewedByID *uint                   `json:"reviewedById,omitempty"`
+	ReviewedBy   string                  `json:"reviewedBy,omitempty"`
+	ReviewedAt   *time.Time              `json:"reviewedAt,omitempty"`
+	ReviewNote   string                  `json:"reviewNote,omitempty"`
+	CreatedAt    time.Time               `json:"createdAt"`
+	UpdatedAt    time.Time               `json:"updatedAt"`
+}
+
+type resolveDuplicateRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+func toDuplicatePatientSummary(p models.Patient) duplicatePatientSummary {
+	return duplicatePatientSummary{
+		ID:     p.ID,
+		MRN:    p.MRN,
+		Fname:  p.FirstName,
+		Lname:  p.LastName,
+		DOB:    p.DOB,
+		Phone:  p.Phone,
+		Email:  p.Email,
+		Postal: p.Postal,
+	}
+}
+
+func toDuplicateCandidateResponse(c models.DuplicatePatientCandidate) duplicateCandidateResponse {
+	resp := duplicateCandidateResponse{
+		ID:           c.ID,
+		Score:        c.Score,
+		Reasons:      []string(c.Reasons),
+		Status:       c.Status,
+		PatientA:     toDuplicatePatientSummary(c.PatientA),
+		PatientB:     toDuplicatePatientSummary(c.PatientB),
+		ReviewedByID: c.ReviewedByID,
+		ReviewedAt:   c.ReviewedAt,
+		ReviewNote:   c.ReviewNote,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+	}
+	if resp.Reasons == nil {
+		resp.Reasons = []string{}
+	}
+	if c.ReviewedBy != nil {
+		resp.ReviewedBy = c.ReviewedBy.Username
+	}
+	return resp
+}
+
+// GetDuplicatePatientCandidates returns the duplicate review queue, highest score first.
+func GetDuplicatePatientCandidates(c *fiber.Ctx) error {
+	page := parsePositiveInt(c.Query("page"), 1)
+	limit := parsePositiveInt(c.Query("limit"), 25)
+	if limit > 200 {
+		limit = 200
+	}
+	status := strings.ToLower(strings.TrimSpace(c.Query("status", models.DuplicateStatusPending)))
+	minScore, _ := strconv.ParseFloat(c.Query("minScore"), 64)
+
+	candidates, total, err := models.ListDuplicateCandidates(status, minScore, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load duplicate candidates"})
+	}
+
+	data := make([]duplicateCandidateResponse, 0, len(candidates))
+	for _, cand := range candidates {
+		data = append(data, toDuplicateCandidateResponse(cand))
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+		"pagination": fiber.Map{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+// GetDuplicatePatientCandidate returns a single candidate pair.
+func GetDuplicatePatientCandidate(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid candidate ID"})
+	}
+
+	candidate, err := models.GetDuplicateCandidateByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Candidate not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load candidate"})
+	}
+
+	return c.JSON(toDuplicateCandidateResponse(*candidate))
+}
+
+// ResolveDuplicatePatientCandidate confirms or dismisses a candidate pair.
+func ResolveDuplicatePatientCandidate(c *fiber.Ctx) error {
+	reviewerID := safeUserID(c)
+	if reviewerID == 0 {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+	}
+
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid candidate ID"})
+	}
+
+	var input resolveDuplicateRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	status := strings.ToLower(strings.TrimSpace(input.Status))
+
+	if err := models.ResolveDuplicateCandidate(id, status, reviewerID, strings.TrimSpace(input.Note)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Candidate not found"})
+		}
+		if errors.Is(err, models.ErrInvalidDuplicateStatus) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "status must be confirmed, dismissed or pending"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update candidate"})
+	}
+
+	candidate, err := models.GetDuplicateCandidateByID(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load candidate"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User marked duplicate candidate %d as %s", id, status),
+		"INFO",
+		map[string]interface{}{"candidateId": id, "patientAId": candidate.PatientAID, "patientBId": candidate.PatientBID, "status": status},
+	)
+
+	return c.JSON(toDuplicateCandidateResponse(*candidate))
+}
+
+// RunDuplicatePatientScan runs the duplicate detector on demand.
+func RunDuplicatePatientScan(c *fiber.Ctx) error {
+	result, err := services.NewDuplicatePatientDetector().Scan()
+	if err != nil {
+		if errors.Is(err, services.ErrDuplicateScanRunning) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A duplicate scan is already running"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Duplicate scan failed"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataAccess,
+		"User ran duplicate patient scan",
+		"INFO",
+		map[string]interface{}{"patientsScanned": result.PatientsScanned, "candidatesFound": result.CandidatesFound},
+	)
+
+	return c.JSON(result)
+}
+
+// CheckPatientDuplicates scores the supplied demographics against existing patients so the
+// UI can warn before a patient is created.
+func CheckPatientDuplicates(c *fiber.Ctx) error {
+	candidate := models.Patient{
+		FirstName: strings.TrimSpace(c.Query("fname")),
+		LastName:  strings.TrimSpace(c.Query("lname")),
+		DOB:       strings.TrimSpace(c.Query("dob")),
+		Phone:     strings.TrimSpace(c.Query("phone")),
+		Email:     strings.TrimSpace(c.Query("email")),
+		Postal:    strings.TrimSpace(c.Query("postal")),
+	}
+	var serials []string
+	if serial := strings.TrimSpace(c.Query("serial")); serial != "" {
+		serials = strings.Split(serial, ",")
+	}
+
+	detector := services.NewDuplicatePatientDetector()
+	matches, err := services.FindPossibleDuplicates(candidate, serials, detector.Threshold())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check for duplicates"})
+	}
+	if matches == nil {
+		matches = []services.DuplicateMatch{}
+	}
+
+	return c.JSON(fiber.Map{
+		"matches":   matches,
+		"threshold": detector.Threshold(),
+	})
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type followUpRuleRequest struct {
+	Name         *string `json:"name"`
+	DeviceType   *string `json:"deviceType"`
+	ReportType   *string `json:"reportType"`
+	Location     *string `json:"location"`
+	IntervalDays *int    `json:"intervalDays"`
+	Mode         *string `json:"mode"`
+	Active       *bool   `json:"active"`
+}
+
+// apply copies the given fields onto the rule and returns a message if it is invalid.
+func (in *followUpRuleRequest) apply(rule *models.FollowUpRule) string {
+	if in.Name != nil {
+		rule.Name = *in.Name
+	}
+	if in.DeviceType != nil {
+		rule.DeviceType = *in.DeviceType
+	}
+	if in.ReportType != nil {
+		rule.ReportType = *in.ReportType
+	}
+	if in.Location != nil {
+		rule.Location = models.AppointmentLocation(strings.ToLower(strings.TrimSpace(*in.Location)))
+	}
+	if in.IntervalDays != nil {
+		rule.IntervalDays = *in.IntervalDays
+	}
+	if in.Mode != nil {
+		rule.Mode = strings.ToLower(strings.TrimSpace(*in.Mode))
+	}
+	if in.Active != nil {
+		rule.Active = *in.Active
+	}
+	return rule.Validate()
+}
+
+// GetFollowUpRules lists the follow-up scheduling rules.
+func GetFollowUpRules(c *fiber.Ctx) error {
+	rules, err := models.GetFollowUpRules()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load follow-up rules"})
+	}
+	return c.JSON(rules)
+}
+
+// CreateFollowUpRule adds a follow-up scheduling rule.
+func CreateFollowUpRule(c *fiber.Ctx) error {
+	var input followUpRuleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	rule := models.FollowUpRule{Mode: models.FollowUpModePropose, Active: true}
+	if msg := input.apply(&rule); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Create(&rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create follow-up rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Follow-up rule created", "INFO", map[string]interface{}{
+		"ruleId":       rule.ID,
+		"intervalDays": rule.IntervalDays,
+	})
+	return c.Status(http.StatusCreated).JSON(rule)
+}
+
+// UpdateFollowUpRule changes a rule. Follow-ups already planned are not recalculated.
+func UpdateFollowUpRule(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rule ID"})
+	}
+	rule, err := models.GetFollowUpRule(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load follow-up rule"})
+	}
+	if rule == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Follow-up rule not found"})
+	}
+
+	var input followUpRuleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := input.apply(rule); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Save(rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update follow-up rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Follow-up rule updated", "INFO", map[string]interface{}{
+		"ruleId": rule.ID,
+	})
+	return c.JSON(rule)
+}
+
+// DeleteFollowUpRule removes a rule.
+func DeleteFollowUpRule(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rule ID"})
+	}
+	result := config.DB.Delete(&models.FollowUpRule{}, id)
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete follow-up rule"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Follow-up rule not found"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Follow-up rule deleted", "INFO", map[string]interface{}{
+		"ruleId": id,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// GetReportFollowUp returns the follow-up planned for a report, or null if none was.
+func GetReportFollowUp(c *fiber.Ctx) error {
+	report, status, msg := loadFollowUpReport(c)
+	if report == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	followUp, err := models.GetReportFollowUp(report.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load follow-up"})
+	}
+	return c.JSON(fiber.Map{"followUp": followUp})
+}
+
+type bookFollowUpRequest struct {
+	StartAt  *time.Time `json:"startAt"`
+	Location *string    `json:"location"`
+}
+
+// BookReportFollowUp confirms a proposed follow-up by booking its appointment. Without a
+// startAt, clinic follow-ups take the first free slot from the due date. The location can be
+// changed, e.g. to see the patient in clinic instead of remotely.
+func BookReportFollowUp(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	report, status, msg := loadFollowUpReport(c)
+	if report == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var input bookFollowUpRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	followUp, err := models.GetReportFollowUp(report.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load follow-up"})
+	}
+	if followUp == nil {
+		// No rule matched when the report was completed, so the clinician books it directly
+		if input.Location == nil && input.StartAt == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "No follow-up was proposed; give a location or startAt"})
+		}
+		followUp = &models.ReportFollowUp{
+			ReportID:  report.ID,
+			PatientID: report.PatientID,
+			Location:  models.AppointmentLocationClinic,
+			DueAt:     time.Now(),
+			Status:    models.FollowUpProposed,
+		}
+	}
+	if followUp.Status != models.FollowUpProposed {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Follow-up has already been " + followUp.Status})
+	}
+	if input.Location != nil {
+		followUp.Location = normalizeAppointmentLocation(*input.Location)
+	}
+	if followUp.ID == 0 {
+		err = config.DB.Omit("Rule", "Appointment").Create(followUp).Error
+	} else {
+		err = config.DB.Model(&models.ReportFollowUp{}).
+			Where("id = ? AND status = ?", followUp.ID, models.FollowUpProposed).
+			Update("location", followUp.Location).Error
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to book follow-up"})
+	}
+
+	appointment, err := services.BookReportFollowUp(followUp, input.StartAt, userID, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrFollowUpResolved):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Follow-up has already been resolved"})
+		case errors.Is(err, services.ErrNoFollowUpSlot):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{
+				"error": "No clinic slot is free near the due date; choose a time",
+				"code":  "SLOT_FULL",
+			})
+		}
+		return slotBookingError(c, err, "Failed to book follow-up")
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User booked follow-up for report %d", report.ID), "INFO", map[string]interface{}{
+			"reportId":      report.ID,
+			"patientId":     report.PatientID,
+			"appointmentId": appointment.ID,
+		})
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"followUp": followUp})
+}
+
+type dismissFollowUpRequest struct {
+	Note string `json:"note"`
+}
+
+// DismissReportFollowUp closes a proposed follow-up without booking it.
+func DismissReportFollowUp(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	report, status, msg := loadFollowUpReport(c)
+	if report == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	var input dismissFollowUpRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	followUp, err := models.GetReportFollowUp(report.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load follow-up"})
+	}
+	if followUp == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No follow-up for this report"})
+	}
+	note := strings.TrimSpace(input.Note)
+	if len(note) > 255 {
+		note = note[:255]
+	}
+	if err := services.DismissReportFollowUp(followUp, userID, note, time.Now()); err != nil {
+		if errors.Is(err, models.ErrFollowUpResolved) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Follow-up has already been resolved"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to dismiss follow-up"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User dismissed follow-up for report %d", report.ID), "INFO", map[string]interface{}{
+			"reportId":  report.ID,
+			"patientId": report.PatientID,
+		})
+	return c.JSON(fiber.Map{"followUp": followUp})
+}
+
+// GetFollowUpWorklist lists patients with an active device and no upcoming appointment, so
+// nobody drops out of follow-up. Supports ?search=, ?doctorId=, ?page= and ?limit=.
+func GetFollowUpWorklist(c *fiber.Ctx) error {
+	page := parsePositiveInt(c.Query("page"), 1)
+	limit := parsePositiveInt(c.Query("limit"), 25)
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := models.FollowUpWorklistFilter{Search: c.Query("search")}
+	if value := c.Query("doctorId"); value != "" {
+		id := uint(parsePositiveInt(value, 0))
+		if id == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid doctorId"})
+		}
+		filter.DoctorID = &id
+	}
+
+	entries, total, err := models.GetFollowUpWorklist(filter, time.Now(), limit, (page-1)*limit)
+	if err != nil {
+		log.Printf("Error loading follow-up worklist: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load follow-up worklist"})
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	return c.JSON(fiber.Map{
+		"data": entries,
+		"pagination": fiber.Map{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+// planReportFollowUp runs the follow-up rules for a report that was just completed. Failures
+// are logged; the report itself is already saved.
+func planReportFollowUp(c *fiber.Ctx, report *models.Report) *models.ReportFollowUp {
+	userID, _ := c.Locals("user_id").(uint)
+	followUp, err := services.PlanReportFollowUp(report, userID, time.Now())
+	if err != nil {
+		log.Printf("Error planning follow-up for report %d: %v", report.ID, err)
+	}
+	if followUp != nil && followUp.AppointmentID != nil {
+		security.LogEventFromContext(c, security.EventDataModification,
+			fmt.Sprintf("Follow-up booked automatically for report %d", report.ID), "INFO", map[string]interface{}{
+				"reportId":      report.ID,
+				"patientId":     report.PatientID,
+				"appointmentId": *followUp.AppointmentID,
+			})
+	}
+	return followUp
+}
+
+// withdrawReportFollowUp drops a proposed follow-up when its report is no longer completed.
+func withdrawReportFollowUp(report *models.Report) {
+	if err := models.DeleteProposedFollowUp(report.ID); err != nil {
+		log.Printf("Error withdrawing follow-up for report %d: %v", report.ID, err)
+	}
+}
+
+// loadFollowUpReport loads the report named in the path, checking that the user may see
+// its patient.
+func loadFollowUpReport(c *fiber.Ctx) (*models.Report, int, string) {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return nil, http.StatusUnauthorized, "Invalid user session"
+	}
+	userRole, _ := c.Locals("user_role").(string)
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid report ID"
+	}
+	var report models.Report
+	if err := config.DB.Select("id", "patient_id", "report_date", "report_type", "is_completed").First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, http.StatusNotFound, "Report not found"
+		}
+		return nil, http.StatusInternalServerError, "Failed to load report"
+	}
+	allowed, err := canAccessPatient(userRole, userID, report.PatientID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to verify permissions"
+	}
+	if !allowed {
+		return nil, http.StatusForbidden, "Access denied"
+	}
+	return &report, 0, ""
+}
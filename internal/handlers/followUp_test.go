@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func setupFollowUpTestApp(t *testing.T) (*fiber.App, *actAs, *models.ReportFollowUp) {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.Appointment{}, &models.FollowUpRule{}, &models.ReportFollowUp{}); err != nil {
+		t.Fatalf("failed to migrate follow-up models: %v", err)
+	}
+	patient, admin := seedAppointmentFixtures(t)
+
+	report := models.Report{PatientID: patient.ID, UserID: admin.ID, ReportDate: time.Now(), ReportType: "Scheduled"}
+	if err := config.DB.Create(&report).Error; err != nil {
+		t.Fatalf("failed to seed report: %v", err)
+	}
+	followUp := &models.ReportFollowUp{
+		ReportID:  report.ID,
+		PatientID: patient.ID,
+		Location:  models.AppointmentLocationRemote,
+		DueAt:     time.Now().AddDate(0, 3, 0),
+		Status:    models.FollowUpProposed,
+	}
+	if err := config.DB.Create(followUp).Error; err != nil {
+		t.Fatalf("failed to seed follow-up: %v", err)
+	}
+
+	as := &actAs{user: admin}
+	app := fiber.New()
+	app.Use(as.middleware)
+	app.Get("/api/reports/:id/follow-up", GetReportFollowUp)
+	app.Post("/api/reports/:id/follow-up/book", BookReportFollowUp)
+	app.Post("/api/reports/:id/follow-up/dismiss", DismissReportFollowUp)
+	return app, as, followUp
+}
+
+func TestReportFollowUp_RequiresPatientAccess(t *testing.T) {
+	app, as, followUp := setupFollowUpTestApp(t)
+	linked, linkedDoctor := seedDoctorUser(t, "linked")
+	linkDoctorToPatient(t, linkedDoctor.ID, followUp.PatientID, nil)
+	other, _ := seedDoctorUser(t, "other")
+
+	base := fmt.Sprintf("/api/reports/%d/follow-up", followUp.ReportID)
+	cases := []struct {
+		name   string
+		user   *models.User
+		method string
+		url    string
+		want   int
+	}{
+		{"associated doctor views", linked, http.MethodGet, base, http.StatusOK},
+		{"unrelated doctor views", other, http.MethodGet, base, http.StatusForbidden},
+		{"unrelated doctor books", other, http.MethodPost, base + "/book", http.StatusForbidden},
+		{"unrelated doctor dismisses", other, http.MethodPost, base + "/dismiss", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			as.user = tc.user
+			resp := doBookingRequest(t, app, tc.method, tc.url, nil)
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, resp.StatusCode)
+			}
+		})
+	}
+
+	var stored models.ReportFollowUp
+	if err := config.DB.First(&stored, followUp.ID).Error; err != nil {
+		t.Fatalf("failed to reload follow-up: %v", err)
+	}
+	if stored.Status != models.FollowUpProposed || stored.AppointmentID != nil {
+		t.Fatalf("expected the follow-up to be untouched, got status %q", stored.Status)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/rogerhendricks/goReporter/internal/config"
 	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/services"
 )
 
 // GlobalSearchResult represents a unified search result across all entities
@@ -259,45 +260,7 @@ func searchTasks(query string, userID, userRole string, limit int) ([]GlobalSear
 // calculateScore provides a simple relevance scoring
 // More sophisticated algorithms (Levenshtein distance, etc.) can be added
 func calculateScore(query, target string) float64 {
-	query = strings.ToLower(query)
-	target = strings.ToLower(target)
-
-	// Exact match scores highest
-	if query == target {
-		return 100.0
-	}
-
-	// Starts with query scores high
-	if strings.HasPrefix(target, query) {
-		return 80.0
-	}
-
-	// Contains query scores medium
-	if strings.Contains(target, query) {
-		return 60.0
-	}
-
-	// Word boundary match
-	words := strings.Fields(target)
-	for _, word := range words {
-		if strings.HasPrefix(word, query) {
-			return 70.0
-		}
-		if strings.Contains(word, query) {
-			return 50.0
-		}
-	}
-
-	// Fuzzy match (simple character overlap)
-	overlap := 0
-	for _, char := range query {
-		if strings.ContainsRune(target, char) {
-			overlap++
-		}
-	}
-	fuzzyScore := (float64(overlap) / float64(len(query))) * 40.0
-
-	return fuzzyScore
+	return services.FuzzyMatchScore(query, target)
 }
 
 // sortByScore sorts results by score in descending order
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+)
+
+type letterTemplateRequest struct {
+	Name                  *string `json:"name"`
+	Subject               *string `json:"subject"`
+	Body                  *string `json:"body"`
+	RebookingInstructions *string `json:"rebookingInstructions"`
+	IsDefault             *bool   `json:"isDefault"`
+}
+
+// apply copies the given fields onto the template and returns a message if it is invalid.
+func (in *letterTemplateRequest) apply(template *models.LetterTemplate) string {
+	if in.Name != nil {
+		template.Name = *in.Name
+	}
+	if in.Subject != nil {
+		template.Subject = strings.TrimSpace(*in.Subject)
+	}
+	if in.Body != nil {
+		template.Body = *in.Body
+	}
+	if in.RebookingInstructions != nil {
+		template.RebookingInstructions = *in.RebookingInstructions
+	}
+	if in.IsDefault != nil {
+		template.IsDefault = *in.IsDefault
+	}
+	return template.Validate()
+}
+
+// GetLetterTemplates lists letter templates and the merge fields they can use.
+func GetLetterTemplates(c *fiber.Ctx) error {
+	templates, err := models.GetLetterTemplates(c.Query("kind"))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load letter templates"})
+	}
+	return c.JSON(fiber.Map{
+		"templates":   templates,
+		"mergeFields": models.LetterMergeFields,
+	})
+}
+
+// CreateLetterTemplate adds a letter template.
+func CreateLetterTemplate(c *fiber.Ctx) error {
+	var input letterTemplateRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	template := models.LetterTemplate{Kind: models.LetterKindMissedAppointment}
+	if msg := input.apply(&template); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := models.SaveLetterTemplate(&template); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create letter template"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Letter template created", "INFO", map[string]interface{}{
+		"templateId": template.ID,
+	})
+	return c.Status(http.StatusCreated).JSON(template)
+}
+
+// UpdateLetterTemplate changes a template. Letters already generated keep their wording.
+func UpdateLetterTemplate(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid template ID"})
+	}
+	var template models.LetterTemplate
+	result := config.DB.Limit(1).Find(&template, id)
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load letter template"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Letter template not found"})
+	}
+
+	var input letterTemplateRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := input.apply(&template); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := models.SaveLetterTemplate(&template); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update letter template"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Letter template updated", "INFO", map[string]interface{}{
+		"templateId": template.ID,
+	})
+	return c.JSON(template)
+}
+
+// DeleteLetterTemplate removes a template. Archived letters are kept.
+func DeleteLetterTemplate(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid template ID"})
+	}
+	result := config.DB.Delete(&models.LetterTemplate{}, id)
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete letter template"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Letter template not found"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Letter template deleted", "INFO", map[string]interface{}{
+		"templateId": id,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+type generateMissedLettersRequest struct {
+	AppointmentIDs []uint `json:"appointmentIds"`
+	TemplateID     uint   `json:"templateId"`
+	Resend         bool   `json:"resend"`
+}
+
+// GenerateMissedLetters returns one PDF with a letter for each selected missed appointment.
+// The letters are archived against their patients and the appointments marked as sent in
+// the same step; if the batch is rejected nothing is recorded.
+func GenerateMissedLetters(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input generateMissedLettersRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	if len(input.AppointmentIDs) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "appointmentIds required"})
+	}
+	if limit := config.LoadConfig().BulkMaxItems; len(input.AppointmentIDs) > limit {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("At most %d letters can be generated at once", limit)})
+	}
+
+	batch, err := services.GenerateMissedLetters(input.AppointmentIDs, input.TemplateID, input.Resend, userID, time.Now().UTC())
+	if err != nil {
+		var batchErr *services.MissedLetterBatchError
+		switch {
+		case errors.As(err, &batchErr):
+			status := http.StatusBadRequest
+			if batchErr.AlreadySent {
+				status = http.StatusConflict
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error":          "Cannot generate letters: " + batchErr.Reason,
+				"appointmentIds": batchErr.AppointmentIDs,
+			})
+		case errors.Is(err, services.ErrLetterTemplateNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Letter template not found"})
+		}
+		log.Printf("Error generating missed appointment letters: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate letters"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Missed appointment letters generated", "INFO", map[string]interface{}{
+		"batchId":        batch.BatchID,
+		"appointmentIds": input.AppointmentIDs,
+		"resend":         input.Resend,
+	})
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="missed-letters-%s.pdf"`, time.Now().Format("2006-01-02")))
+	c.Set("X-Letter-Batch", batch.BatchID)
+	c.Set("X-Letters-Generated", fmt.Sprintf("%d", len(batch.Letters)))
+	return c.Send(batch.PDF)
+}
+
+// GetPatientLetters lists the letters archived for a patient.
+func GetPatientLetters(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+	letters, err := models.GetPatientLetters(patientID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load letters"})
+	}
+	return c.JSON(letters)
+}
+
+// GetPatientLetterPDF returns an archived letter as it was sent.
+func GetPatientLetterPDF(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+	id, err := getUintParam(c, "letterId")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid letter ID"})
+	}
+	letter, err := models.GetPatientLetter(patientID, id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load letter"})
+	}
+	if letter == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Letter not found"})
+	}
+
+	pdf, err := services.RenderLettersPDF([]models.PatientLetter{*letter})
+	if err != nil {
+		log.Printf("Error rendering letter %d: %v", letter.ID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to render letter"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataAccess, fmt.Sprintf("User viewed letter %d", letter.ID), "INFO", map[string]interface{}{
+		"letterId":  letter.ID,
+		"patientId": patientID,
+	})
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="letter-%d.pdf"`, letter.ID))
+	return c.Send(pdf)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/services"
+)
+
+// noteMentions finds the users @mentioned in a note. For a note about a patient it checks
+// that each of them may see the patient, and returns a message naming one who may not.
+func noteMentions(content string, patientID *uint) ([]models.User, string, error) {
+	users, err := models.FindMentionedUsers(content)
+	if err != nil || patientID == nil {
+		return users, "", err
+	}
+	for i := range users {
+		allowed, err := models.CanAccessPatient(&users[i], *patientID)
+		if err != nil {
+			return nil, "", err
+		}
+		if !allowed {
+			return nil, fmt.Sprintf("@%s cannot be mentioned: they have no access to this patient", users[i].Username), nil
+		}
+	}
+	return users, "", nil
+}
+
+// recordMentions saves the note's new mentions, filled in from mention, and notifies the
+// mentioned users. Authors mentioning themselves are ignored. It returns who was notified.
+func recordMentions(users []models.User, mention models.NoteMention) []uint {
+	mentions := make([]models.NoteMention, 0, len(users))
+	for _, user := range users {
+		if user.ID == mention.MentionedByID {
+			continue
+		}
+		m := mention
+		m.UserID = user.ID
+		mentions = append(mentions, m)
+	}
+	created, err := models.CreateNoteMentions(mentions)
+	if err != nil {
+		log.Printf("Error saving mentions for %s %d: %v", mention.NoteType, mention.NoteID, err)
+	}
+
+	notified := make([]uint, 0, len(created))
+	author := mentionAuthor(mention.MentionedByID)
+	for _, m := range created {
+		services.NotificationsHub.SendToUser(m.UserID, services.NotificationEvent{
+			Type:      "note.mention",
+			Title:     "You were mentioned",
+			Message:   fmt.Sprintf("%s mentioned you: %s", author, m.Excerpt),
+			ActionURL: noteActionURL(m.PatientID, m.TaskID),
+			TaskID:    m.TaskID,
+		})
+		notified = append(notified, m.UserID)
+	}
+	return notified
+}
+
+// notifyThreadReply tells whoever started a thread about a reply, unless they wrote it or
+// were already notified of a mention in it.
+func notifyThreadReply(starterID, authorID uint, notified []uint, excerpt string, patientID, taskID *uint) {
+	if starterID == authorID {
+		return
+	}
+	for _, id := range notified {
+		if id == starterID {
+			return
+		}
+	}
+	services.NotificationsHub.SendToUser(starterID, services.NotificationEvent{
+		Type:      "note.reply",
+		Title:     "New reply to your note",
+		Message:   fmt.Sprintf("%s replied: %s", mentionAuthor(authorID), excerpt),
+		ActionURL: noteActionURL(patientID, taskID),
+		TaskID:    taskID,
+	})
+}
+
+func mentionAuthor(userID uint) string {
+	var user models.User
+	if err := config.DB.Select("id", "username", "full_name").First(&user, userID).Error; err != nil {
+		return "Someone"
+	}
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return user.Username
+}
+
+func noteActionURL(patientID, taskID *uint) string {
+	if taskID != nil {
+		return fmt.Sprintf("/tasks/%d", *taskID)
+	}
+	if patientID != nil {
+		return fmt.Sprintf("/patients/%d", *patientID)
+	}
+	return ""
+}
+
+// GetMyMentions lists the current user's mentions, newest first. ?unread=true limits it to
+// unread ones.
+func GetMyMentions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	mentions, total, err := models.GetUserMentions(userID, c.QueryBool("unread", false), limit, offset)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load mentions"})
+	}
+	unread, err := models.CountUnreadMentions(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count mentions"})
+	}
+
+	return c.JSON(fiber.Map{
+		"mentions": mentions,
+		"total":    total,
+		"unread":   unread,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// GetUnreadMentionCount returns how many unread mentions the current user has.
+func GetUnreadMentionCount(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	count, err := models.CountUnreadMentions(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count mentions"})
+	}
+	return c.JSON(fiber.Map{"count": count})
+}
+
+// MarkMentionsRead marks the current user's mentions read: the listed ids, or all of them
+// when none are given.
+func MarkMentionsRead(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input struct {
+		IDs []uint `json:"ids"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	updated, err := models.MarkMentionsRead(userID, input.IDs)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark mentions read"})
+	}
+	return c.JSON(fiber.Map{"updated": updated})
+}
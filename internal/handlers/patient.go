@@ -17,6 +17,7 @@ import (
 	"github.com/rogerhendricks/goReporter/internal/config"
 	"github.com/rogerhendricks/goReporter/internal/models"
 	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
 	"github.com/rogerhendricks/goReporter/internal/utils"
 	"gorm.io/gorm"
 )
@@ -453,6 +454,8 @@ func CreatePatient(c *fiber.Ctx) error {
 		} `json:"leads"`
 		Medications []interface{} `json:"medications"`
 		Tags        []uint        `json:"tags"` // Array of Tag IDs
+		// Set after the user has reviewed the possible-duplicate warning and wants to proceed.
+		IgnoreDuplicateWarning bool `json:"ignoreDuplicateWarning"`
 	}
 
 	// 2. Parse the request body into the temporary struct
@@ -483,6 +486,24 @@ func CreatePatient(c *fiber.Ctx) error {
 
 	sanitizePatient(&newPatient)
 
+	// Warn about possible existing patients before inserting
+	var deviceSerials []string
+	for _, d := range input.Devices {
+		deviceSerials = append(deviceSerials, d.Serial)
+	}
+	duplicateThreshold := services.NewDuplicatePatientDetector().Threshold()
+	possibleDuplicates, err := services.FindPossibleDuplicates(newPatient, deviceSerials, duplicateThreshold)
+	if err != nil {
+		log.Printf("Error checking for duplicate patients: %v", err)
+	}
+	if len(possibleDuplicates) > 0 && !input.IgnoreDuplicateWarning {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error":   "Possible existing patient",
+			"code":    "POSSIBLE_DUPLICATE",
+			"matches": possibleDuplicates,
+		})
+	}
+
 	// Create patient first to get an ID
 	// if err := models.CreatePatient(&newPatient); err != nil {
 	//     log.Printf("Error creating patient: %v", err)
@@ -612,6 +633,13 @@ func CreatePatient(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create patient"})
 	}
 
+	if len(newPatient.Tags) > 0 {
+		userID, userName := tagEventUser(c)
+		if err := models.RecordPatientTagChanges(config.DB, newPatient.ID, nil, newPatient.Tags, userID, userName); err != nil {
+			log.Printf("Warning: failed to record tags for patient %d: %v", newPatient.ID, err)
+		}
+	}
+
 	// Fetch the complete patient with all relationships to return
 	createdPatient, err := models.GetPatientByID(newPatient.ID)
 	if err != nil {
@@ -619,6 +647,13 @@ func CreatePatient(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Patient created but failed to fetch complete data"})
 	}
 
+	// Queue overridden warnings for review so the pair is not lost
+	for _, match := range possibleDuplicates {
+		if err := models.UpsertDuplicateCandidate(newPatient.ID, match.PatientID, match.Score, match.Reasons); err != nil {
+			log.Printf("Error recording duplicate candidate %d/%d: %v", newPatient.ID, match.PatientID, err)
+		}
+	}
+
 	security.LogEventFromContext(c, security.EventDataModification,
 		fmt.Sprintf("User created patient record: %d", newPatient.ID),
 		"INFO",
@@ -852,12 +887,17 @@ func UpdatePatient(c *fiber.Ctx) error {
 
 	// Handle Tags
 	if input.Tags != nil {
+		var previousTags []models.Tag
+		if err := tx.Model(&existingPatient).Association("Tags").Find(&previousTags); err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch tags"})
+		}
 		if err := tx.Model(&existingPatient).Association("Tags").Clear(); err != nil {
 			tx.Rollback()
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to clear tags"})
 		}
+		var tags []models.Tag
 		if len(*input.Tags) > 0 {
-			var tags []models.Tag
 			if err := tx.Where("id IN ?", *input.Tags).Find(&tags).Error; err != nil {
 				tx.Rollback()
 				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch tags"})
@@ -867,6 +907,11 @@ func UpdatePatient(c *fiber.Ctx) error {
 				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update tags"})
 			}
 		}
+		userID, userName := tagEventUser(c)
+		if err := models.RecordPatientTagChanges(tx, existingPatient.ID, previousTags, tags, userID, userName); err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record tag changes"})
+		}
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -1229,3 +1274,12 @@ func GetOverduePatients(c *fiber.Ctx) error {
 		"totalPages": totalPages,
 	})
 }
+
+// tagEventUser returns the current user for tag change history.
+func tagEventUser(c *fiber.Ctx) (*uint, string) {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return nil, ""
+	}
+	return &user.ID, reviewUserName(user)
+}
@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"gorm.io/gorm"
+)
+
+type patientMedicationRequest struct {
+	MedicationID   uint    `json:"medicationId"`
+	Dose           string  `json:"dose"`
+	Frequency      string  `json:"frequency"`
+	Route          string  `json:"route"`
+	StartDate      string  `json:"startDate"`
+	StopDate       *string `json:"stopDate"`
+	PrescriberID   *uint   `json:"prescriberId"`
+	PrescriberName string  `json:"prescriberName"`
+	ReasonStopped  string  `json:"reasonStopped"`
+	Notes          string  `json:"notes"`
+}
+
+type changePatientMedicationRequest struct {
+	Dose           *string `json:"dose"`
+	Frequency      *string `json:"frequency"`
+	Route          *string `json:"route"`
+	EffectiveDate  string  `json:"effectiveDate"`
+	PrescriberID   *uint   `json:"prescriberId"`
+	PrescriberName *string `json:"prescriberName"`
+	Reason         string  `json:"reason"`
+	Notes          string  `json:"notes"`
+}
+
+type stopPatientMedicationRequest struct {
+	StopDate      string `json:"stopDate"`
+	ReasonStopped string `json:"reasonStopped"`
+}
+
+type patientMedicationResponse struct {
+	ID             uint       `json:"id"`
+	PatientID      uint       `json:"patientId"`
+	MedicationID   uint       `json:"medicationId"`
+	MedicationName string     `json:"medicationName"`
+	Category       string     `json:"category,omitempty"`
+	Class          string     `json:"class,omitempty"`
+	Dose           string     `json:"dose"`
+	Frequency      string     `json:"frequency"`
+	Route          string     `json:"route"`
+	StartDate      *time.Time `json:"startDate"`
+	StopDate       *time.Time `json:"stopDate"`
+	Active         bool       `json:"active"`
+	ReasonStopped  string     `json:"reasonStopped,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+	PrescriberID   *uint      `json:"prescriberId,omitempty"`
+	PrescriberName string     `json:"prescriberName,omitempty"`
+	PreviousID     *uint      `json:"previousId,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+type medicationHistoryGroup struct {
+	MedicationID   uint                        `json:"medicationId"`
+	MedicationName string                      `json:"medicationName"`
+	Class          string                      `json:"class,omitempty"`
+	Active         bool                        `json:"active"`
+	Regimens       []patientMedicationResponse `json:"regimens"`
+}
+
+// medicationTimelineEntry is the payload of a "medication" timeline event.
+type medicationTimelineEntry struct {
+	Action  string                    `json:"action"` // "started", "changed" or "stopped"
+	Regimen patientMedicationResponse `json:"regimen"`
+}
+
+func toPatientMedicationResponse(pm models.PatientMedication) patientMedicationResponse {
+	resp := patientMedicationResponse{
+		ID:             pm.ID,
+		PatientID:      pm.PatientID,
+		MedicationID:   pm.MedicationID,
+		MedicationName: pm.Medication.Name,
+		Category:       pm.Medication.Category,
+		Class:          models.MedicationClass(pm.Medication),
+		Dose:           pm.Dose,
+		Frequency:      pm.Frequency,
+		Route:          pm.Route,
+		StartDate:      pm.StartDate,
+		StopDate:       pm.StopDate,
+		Active:         pm.IsActive(time.Now()),
+		ReasonStopped:  pm.ReasonStopped,
+		Notes:          pm.Notes,
+		PrescriberID:   pm.PrescriberID,
+		PrescriberName: pm.PrescriberName,
+		PreviousID:     pm.PreviousID,
+		CreatedAt:      pm.CreatedAt,
+		UpdatedAt:      pm.UpdatedAt,
+	}
+	if resp.PrescriberName == "" && pm.Prescriber != nil {
+		resp.PrescriberName = pm.Prescriber.FullName
+	}
+	return resp
+}
+
+// GetPatientMedicationRegimens lists a patient's medication regimens.
+// Optional ?status=active|stopped narrows the list.
+func GetPatientMedicationRegimens(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+
+	status := strings.ToLower(strings.TrimSpace(c.Query("status")))
+	regimens, err := models.GetPatientMedications(patientID, status)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load medications"})
+	}
+
+	resp := make([]patientMedicationResponse, 0, len(regimens))
+	for _, r := range regimens {
+		resp = append(resp, toPatientMedicationResponse(r))
+	}
+	return c.JSON(resp)
+}
+
+// GetPatientMedicationHistory groups every regimen by medication, oldest first, so the
+// UI can draw a history of starts, changes and stops.
+func GetPatientMedicationHistory(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+
+	regimens, err := models.GetPatientMedications(patientID, "")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load medication history"})
+	}
+
+	groups := make(map[uint]*medicationHistoryGroup)
+	var order []uint
+	for _, r := range regimens {
+		group, ok := groups[r.MedicationID]
+		if !ok {
+			group = &medicationHistoryGroup{
+				MedicationID:   r.MedicationID,
+				MedicationName: r.Medication.Name,
+				Class:          models.MedicationClass(r.Medication),
+				Regimens:       []patientMedicationResponse{},
+			}
+			groups[r.MedicationID] = group
+			order = append(order, r.MedicationID)
+		}
+		entry := toPatientMedicationResponse(r)
+		if entry.Active {
+			group.Active = true
+		}
+		group.Regimens = append(group.Regimens, entry)
+	}
+
+	resp := make([]medicationHistoryGroup, 0, len(order))
+	for _, id := range order {
+		group := groups[id]
+		sort.SliceStable(group.Regimens, func(i, j int) bool {
+			return regimenSortDate(group.Regimens[i]).Before(regimenSortDate(group.Regimens[j]))
+		})
+		resp = append(resp, *group)
+	}
+	// Active medications first, then alphabetical
+	sort.SliceStable(resp, func(i, j int) bool {
+		if resp[i].Active != resp[j].Active {
+			return resp[i].Active
+		}
+		return strings.ToLower(resp[i].MedicationName) < strings.ToLower(resp[j].MedicationName)
+	})
+
+	return c.JSON(resp)
+}
+
+// CreatePatientMedicationRegimen starts a medication for a patient.
+func CreatePatientMedicationRegimen(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+
+	var input patientMedicationRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.MedicationID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "medicationId is required"})
+	}
+	if _, err := models.GetMedicationByID(input.MedicationID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Medication not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load medication"})
+	}
+	if err := config.DB.Select("id").First(&models.Patient{}, patientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Patient not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load patient"})
+	}
+
+	regimen := models.PatientMedication{
+		PatientID:      patientID,
+		MedicationID:   input.MedicationID,
+		Dose:           sanitizeText(input.Dose),
+		Frequency:      sanitizeText(input.Frequency),
+		Route:          sanitizeText(input.Route),
+		PrescriberID:   input.PrescriberID,
+		PrescriberName: sanitizeText(input.PrescriberName),
+		ReasonStopped:  sanitizeText(input.ReasonStopped),
+		Notes:          sanitizeText(input.Notes),
+	}
+	if userID := safeUserID(c); userID != 0 {
+		regimen.CreatedByID = &userID
+	}
+
+	if strings.TrimSpace(input.StartDate) != "" {
+		start, err := parseRFC3339OrDate(input.StartDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "startDate must be a valid date"})
+		}
+		regimen.StartDate = &start
+	} else {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		regimen.StartDate = &today
+	}
+	if input.StopDate != nil && strings.TrimSpace(*input.StopDate) != "" {
+		stop, err := parseRFC3339OrDate(*input.StopDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stopDate must be a valid date"})
+		}
+		if stop.Before(*regimen.StartDate) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stopDate must be after startDate"})
+		}
+		regimen.StopDate = &stop
+	}
+
+	if err := models.CreatePatientMedication(&regimen); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add medication"})
+	}
+
+	created, err := models.GetPatientMedicationByID(patientID, regimen.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Medication added but failed to reload"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User added medication %d for patient %d", regimen.MedicationID, patientID),
+		"INFO",
+		map[string]interface{}{"patientId": patientID, "regimenId": regimen.ID, "medicationId": regimen.MedicationID},
+	)
+
+	return c.Status(http.StatusCreated).JSON(toPatientMedicationResponse(*created))
+}
+
+// UpdatePatientMedicationRegimen corrects a regimen in place. Use the change endpoint to
+// record a real dose or frequency change so the previous regimen stays in the history.
+func UpdatePatientMedicationRegimen(c *fiber.Ctx) error {
+	patientID, regimen, status, msg := loadPatientMedicationRegimen(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var input patientMedicationRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if input.Dose != "" {
+		regimen.Dose = sanitizeText(input.Dose)
+	}
+	if input.Frequency != "" {
+		regimen.Frequency = sanitizeText(input.Frequency)
+	}
+	if input.Route != "" {
+		regimen.Route = sanitizeText(input.Route)
+	}
+	if input.PrescriberID != nil {
+		regimen.PrescriberID = input.PrescriberID
+	}
+	if input.PrescriberName != "" {
+		regimen.PrescriberName = sanitizeText(input.PrescriberName)
+	}
+	if input.Notes != "" {
+		regimen.Notes = sanitizeText(input.Notes)
+	}
+	if input.ReasonStopped != "" {
+		regimen.ReasonStopped = sanitizeText(input.ReasonStopped)
+	}
+	if strings.TrimSpace(input.StartDate) != "" {
+		start, err := parseRFC3339OrDate(input.StartDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "startDate must be a valid date"})
+		}
+		regimen.StartDate = &start
+	}
+	if input.StopDate != nil {
+		if strings.TrimSpace(*input.StopDate) == "" {
+			regimen.StopDate = nil
+		} else {
+			stop, err := parseRFC3339OrDate(*input.StopDate)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stopDate must be a valid date"})
+			}
+			regimen.StopDate = &stop
+		}
+	}
+	if regimen.StartDate != nil && regimen.StopDate != nil && regimen.StopDate.Before(*regimen.StartDate) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stopDate must be after startDate"})
+	}
+
+	if err := models.UpdatePatientMedication(regimen); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update medication"})
+	}
+
+	updated, err := models.GetPatientMedicationByID(patientID, regimen.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Medication updated but failed to reload"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User corrected medication regimen %d for patient %d", regimen.ID, patientID),
+		"INFO",
+		map[string]interface{}{"patientId": patientID, "regimenId": regimen.ID},
+	)
+
+	return c.JSON(toPatientMedicationResponse(*updated))
+}
+
+// ChangePatientMedicationRegimen ends the current regimen and starts a new one with the
+// updated dose, frequency or route from the effective date.
+func ChangePatientMedicationRegimen(c *fiber.Ctx) error {
+	patientID, current, status, msg := loadPatientMedicationRegimen(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if !current.IsActive(time.Now()) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Only active medications can be changed"})
+	}
+
+	var input changePatientMedicationRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	effective := time.Now().UTC()
+	if strings.TrimSpace(input.EffectiveDate) != "" {
+		parsed, err := parseRFC3339OrDate(input.EffectiveDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "effectiveDate must be a valid date"})
+		}
+		effective = parsed
+	}
+	if current.StartDate != nil && effective.Before(*current.StartDate) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "effectiveDate must be after the current regimen started"})
+	}
+
+	next := models.PatientMedication{
+		MedicationID:   current.MedicationID,
+		Dose:           current.Dose,
+		Frequency:      current.Frequency,
+		Route:          current.Route,
+		PrescriberID:   current.PrescriberID,
+		PrescriberName: current.PrescriberName,
+		Notes:          sanitizeText(input.Notes),
+	}
+	if input.Dose != nil {
+		next.Dose = sanitizeText(*input.Dose)
+	}
+	if input.Frequency != nil {
+		next.Frequency = sanitizeText(*input.Frequency)
+	}
+	if input.Route != nil {
+		next.Route = sanitizeText(*input.Route)
+	}
+	if input.PrescriberID != nil {
+		next.PrescriberID = input.PrescriberID
+	}
+	if input.PrescriberName != nil {
+		next.PrescriberName = sanitizeText(*input.PrescriberName)
+	}
+	if next.Dose == current.Dose && next.Frequency == current.Frequency && next.Route == current.Route {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "No change to dose, frequency or route"})
+	}
+	if userID := safeUserID(c); userID != 0 {
+		next.CreatedByID = &userID
+	}
+
+	current.ReasonStopped = sanitizeText(input.Reason)
+	if err := models.ChangePatientMedication(current, &next, effective); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to change medication"})
+	}
+
+	created, err := models.GetPatientMedicationByID(patientID, next.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Medication changed but failed to reload"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User changed medication regimen %d for patient %d", current.ID, patientID),
+		"INFO",
+		map[string]interface{}{"patientId": patientID, "previousRegimenId": current.ID, "regimenId": next.ID},
+	)
+
+	return c.Status(http.StatusCreated).JSON(toPatientMedicationResponse(*created))
+}
+
+// StopPatientMedicationRegimen records that a patient stopped a medication, or moves a
+// stop date that has not been reached yet.
+func StopPatientMedicationRegimen(c *fiber.Ctx) error {
+	patientID, regimen, status, msg := loadPatientMedicationRegimen(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	// A stop date still in the future can be changed; one on or before today is final
+	now := time.Now().UTC()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	if regimen.StopDate != nil && regimen.StopDate.Before(tomorrow) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Medication is already stopped"})
+	}
+
+	var input stopPatientMedicationRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	stop := now
+	if strings.TrimSpace(input.StopDate) != "" {
+		parsed, err := parseRFC3339OrDate(input.StopDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stopDate must be a valid date"})
+		}
+		stop = parsed
+	}
+	if regimen.StartDate != nil && stop.Before(*regimen.StartDate) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stopDate must be after startDate"})
+	}
+
+	regimen.StopDate = &stop
+	if reason := sanitizeText(input.ReasonStopped); reason != "" || regimen.ReasonStopped == "" {
+		regimen.ReasonStopped = reason
+	}
+	if err := models.UpdatePatientMedication(regimen); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to stop medication"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User stopped medication regimen %d for patient %d", regimen.ID, patientID),
+		"INFO",
+		map[string]interface{}{"patientId": patientID, "regimenId": regimen.ID, "reason": regimen.ReasonStopped},
+	)
+
+	return c.JSON(toPatientMedicationResponse(*regimen))
+}
+
+// DeletePatientMedicationRegimen removes a regimen that was entered in error.
+func DeletePatientMedicationRegimen(c *fiber.Ctx) error {
+	patientID, regimen, status, msg := loadPatientMedicationRegimen(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := models.DeletePatientMedication(regimen); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete medication"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion,
+		fmt.Sprintf("User deleted medication regimen %d for patient %d", regimen.ID, patientID),
+		"WARNING",
+		map[string]interface{}{"patientId": patientID, "regimenId": regimen.ID},
+	)
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// loadPatientMedicationRegimen resolves :id and :regimenId. A non-zero status means the
+// lookup failed and msg describes why.
+func loadPatientMedicationRegimen(c *fiber.Ctx) (uint, *models.PatientMedication, int, string) {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return 0, nil, http.StatusBadRequest, "Invalid patient ID"
+	}
+	regimenID, err := getUintParam(c, "regimenId")
+	if err != nil {
+		return 0, nil, http.StatusBadRequest, "Invalid medication ID"
+	}
+
+	regimen, err := models.GetPatientMedicationByID(patientID, regimenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil, http.StatusNotFound, "Medication not found"
+		}
+		return 0, nil, http.StatusInternalServerError, "Failed to load medication"
+	}
+	return patientID, regimen, 0, ""
+}
+
+// medicationTimelineEvents returns start, change and stop events for anticoagulant and
+// antiarrhythmic regimens within the optional date range.
+func medicationTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	regimens, err := models.GetPatientMedications(patientID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	superseded := make(map[uint]bool)
+	for _, r := range regimens {
+		if r.PreviousID != nil {
+			superseded[*r.PreviousID] = true
+		}
+	}
+
+	var events []TimelineEvent
+	for _, r := range regimens {
+		if models.MedicationClass(r.Medication) == "" {
+			continue
+		}
+		entry := toPatientMedicationResponse(r)
+
+		started := r.CreatedAt
+		if r.StartDate != nil {
+			started = *r.StartDate
+		}
+		action := "started"
+		if r.PreviousID != nil {
+			action = "changed"
+		}
+		if timelineInRange(started, startDate, endDate) {
+			events = append(events, TimelineEvent{
+				ID:   fmt.Sprintf("medication-%d-%s", r.ID, action),
+				Type: "medication",
+				Date: started,
+				Data: medicationTimelineEntry{Action: action, Regimen: entry},
+			})
+		}
+
+		// A superseded regimen's stop is shown by its successor's "changed" event
+		if r.StopDate != nil && !superseded[r.ID] && timelineInRange(*r.StopDate, startDate, endDate) {
+			events = append(events, TimelineEvent{
+				ID:   fmt.Sprintf("medication-%d-stopped", r.ID),
+				Type: "medication",
+				Date: *r.StopDate,
+				Data: medicationTimelineEntry{Action: "stopped", Regimen: entry},
+			})
+		}
+	}
+	return events, nil
+}
+
+func regimenSortDate(r patientMedicationResponse) time.Time {
+	if r.StartDate != nil {
+		return *r.StartDate
+	}
+	return r.CreatedAt
+}
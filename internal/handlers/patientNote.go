@@ -7,6 +7,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/rogerhendricks/goReporter/internal/config"
 	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
 )
 
 type PatientNoteResponse struct {
@@ -21,6 +22,10 @@ type PatientNoteResponse struct {
 		FullName string `json:"fullName"`
 		Email    string `json:"email"`
 	} `json:"user"`
+
+	// Replies to a note that starts a thread, oldest first
+	ParentID *uint                 `json:"parentId"`
+	Replies  []PatientNoteResponse `json:"replies,omitempty"`
 }
 
 func toPatientNoteResponse(note models.PatientNote) PatientNoteResponse {
@@ -37,10 +42,16 @@ func toPatientNoteResponse(note models.PatientNote) PatientNoteResponse {
 	resp.User.FullName = note.User.FullName
 	resp.User.Email = note.User.Email
 
+	resp.ParentID = note.ParentID
+	for _, reply := range note.Replies {
+		resp.Replies = append(resp.Replies, toPatientNoteResponse(reply))
+	}
+
 	return resp
 }
 
-// GetPatientNotes retrieves notes for a specific patient with pagination
+// GetPatientNotes retrieves notes for a specific patient with pagination. Pages hold
+// threads: each note comes with its replies.
 func GetPatientNotes(c *fiber.Ctx) error {
 	patientID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -77,7 +88,7 @@ func GetPatientNotes(c *fiber.Ctx) error {
 
 	// Get total count
 	var total int64
-	if err := config.DB.Model(&models.PatientNote{}).Where("patient_id = ?", patientID).Count(&total).Error; err != nil {
+	if err := config.DB.Model(&models.PatientNote{}).Where("patient_id = ? AND parent_id IS NULL", patientID).Count(&total).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to count notes",
 		})
@@ -85,8 +96,10 @@ func GetPatientNotes(c *fiber.Ctx) error {
 
 	// Get paginated notes
 	var notes []models.PatientNote
-	if err := config.DB.Where("patient_id = ?", patientID).
+	if err := config.DB.Where("patient_id = ? AND parent_id IS NULL", patientID).
 		Preload("User").
+		Preload("Replies", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Replies.User").
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -110,7 +123,8 @@ func GetPatientNotes(c *fiber.Ctx) error {
 	})
 }
 
-// CreatePatientNote creates a new note for a patient
+// CreatePatientNote creates a new note for a patient, or a reply with parentId. Users
+// @mentioned in it are notified.
 func CreatePatientNote(c *fiber.Ctx) error {
 	patientID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -128,7 +142,8 @@ func CreatePatientNote(c *fiber.Ctx) error {
 	}
 
 	var input struct {
-		Content string `json:"content"`
+		Content  string `json:"content"`
+		ParentID *uint  `json:"parentId"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -143,10 +158,40 @@ func CreatePatientNote(c *fiber.Ctx) error {
 		})
 	}
 
+	pid := uint(patientID)
+	var parentID *uint
+	if input.ParentID != nil {
+		root, err := models.PatientNoteThreadRoot(pid, *input.ParentID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load parent note",
+			})
+		}
+		if root == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Parent note not found",
+			})
+		}
+		parentID = root
+	}
+
+	mentioned, msg, err := noteMentions(input.Content, &pid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check mentions",
+		})
+	}
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
 	note := models.PatientNote{
-		PatientID: uint(patientID),
+		PatientID: pid,
 		UserID:    userID.(uint),
 		Content:   input.Content,
+		ParentID:  parentID,
 	}
 
 	if err := config.DB.Create(&note).Error; err != nil {
@@ -155,6 +200,21 @@ func CreatePatientNote(c *fiber.Ctx) error {
 		})
 	}
 
+	excerpt := models.MentionExcerpt(note.Content)
+	notified := recordMentions(mentioned, models.NoteMention{
+		NoteType:      models.MentionPatientNote,
+		NoteID:        note.ID,
+		PatientID:     &pid,
+		MentionedByID: note.UserID,
+		Excerpt:       excerpt,
+	})
+	if parentID != nil {
+		var starter models.PatientNote
+		if err := config.DB.Select("id", "user_id").First(&starter, *parentID).Error; err == nil {
+			notifyThreadReply(starter.UserID, note.UserID, notified, excerpt, &pid, nil)
+		}
+	}
+
 	// Load the user relationship
 	if err := config.DB.Preload("User").First(&note, note.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -212,6 +272,18 @@ func UpdatePatientNote(c *fiber.Ctx) error {
 		})
 	}
 
+	mentioned, msg, err := noteMentions(input.Content, &note.PatientID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check mentions",
+		})
+	}
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
 	note.Content = input.Content
 	if err := config.DB.Save(&note).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -219,6 +291,15 @@ func UpdatePatientNote(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only users newly mentioned by the edit are notified
+	recordMentions(mentioned, models.NoteMention{
+		NoteType:      models.MentionPatientNote,
+		NoteID:        note.ID,
+		PatientID:     &note.PatientID,
+		MentionedByID: note.UserID,
+		Excerpt:       models.MentionExcerpt(note.Content),
+	})
+
 	// Load the user relationship
 	if err := config.DB.Preload("User").First(&note, note.ID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -229,7 +310,7 @@ func UpdatePatientNote(c *fiber.Ctx) error {
 	return c.JSON(toPatientNoteResponse(note))
 }
 
-// DeletePatientNote deletes a note
+// DeletePatientNote deletes a note, with its replies when it starts a thread
 func DeletePatientNote(c *fiber.Ctx) error {
 	noteID, err := strconv.Atoi(c.Params("noteId"))
 	if err != nil {
@@ -260,7 +341,7 @@ func DeletePatientNote(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := config.DB.Delete(&note).Error; err != nil {
+	if err := models.DeleteNoteThread(&models.PatientNote{}, models.MentionPatientNote, note.ID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete note",
 		})
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+// loadPatientSummary builds the face sheet for the :id patient and logs the access.
+func loadPatientSummary(c *fiber.Ctx, format string) (*services.PatientSummary, error) {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+
+	summary, err := services.BuildPatientSummary(patientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Patient not found"})
+		}
+		log.Printf("Error building summary for patient %d: %v", patientID, err)
+		return nil, c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build patient summary"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataAccess,
+		fmt.Sprintf("User viewed summary for patient %d", patientID),
+		"INFO",
+		map[string]interface{}{"patientId": patientID, "format": format},
+	)
+	return summary, nil
+}
+
+// GetPatientSummary returns the pre-visit face sheet for a patient.
+func GetPatientSummary(c *fiber.Ctx) error {
+	summary, err := loadPatientSummary(c, "json")
+	if summary == nil {
+		return err
+	}
+	return c.JSON(summary)
+}
+
+// GetPatientSummaryPDF returns the face sheet as a one-page PDF.
+func GetPatientSummaryPDF(c *fiber.Ctx) error {
+	summary, err := loadPatientSummary(c, "pdf")
+	if summary == nil {
+		return err
+	}
+
+	pdf, err := services.RenderPatientSummaryPDF(summary)
+	if err != nil {
+		log.Printf("Error rendering summary PDF for patient %d: %v", summary.Patient.ID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to render patient summary"})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"patient_summary_%d_%s.pdf\"", summary.Patient.MRN, summary.GeneratedAt.Format("20060102")))
+	return c.Send(pdf)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+)
+
+type programmingChangeResponse struct {
+	ID                            uint                      `json:"id"`
+	ReportID                      uint                      `json:"reportId"`
+	PreviousReportID              uint                      `json:"previousReportId"`
+	PatientID                     uint                      `json:"patientId"`
+	ImplantedDeviceID             *uint                     `json:"implantedDeviceId"`
+	ReportDate                    time.Time                 `json:"reportDate"`
+	Changes                       models.ProgrammingChanges `json:"changes"`
+	ChangeCount                   int                       `json:"changeCount"`
+	TherapyDisabled               bool                      `json:"therapyDisabled"`
+	TherapyDisabledWithoutComment bool                      `json:"therapyDisabledWithoutComment"`
+}
+
+func toProgrammingChangeResponse(change models.ReportProgrammingChange) programmingChangeResponse {
+	return programmingChangeResponse{
+		ID:                            change.ID,
+		ReportID:                      change.ReportID,
+		PreviousReportID:              change.PreviousReportID,
+		PatientID:                     change.PatientID,
+		ImplantedDeviceID:             change.ImplantedDeviceID,
+		ReportDate:                    change.ReportDate,
+		Changes:                       change.Changes,
+		ChangeCount:                   change.ChangeCount,
+		TherapyDisabled:               change.TherapyDisabled,
+		TherapyDisabledWithoutComment: change.TherapyDisabledWithoutComment,
+	}
+}
+
+// detectProgrammingChanges records the settings changed since the previous report for the
+// device and refreshes the following report's comparison. A therapy disabled without a
+// comment notifies admins the first time it is seen. Failures are logged so they never
+// block the report save.
+func detectProgrammingChanges(c *fiber.Ctx, report *models.Report) *models.ReportProgrammingChange {
+	change, newlyFlagged, err := services.DetectProgrammingChanges(report)
+	if err != nil {
+		log.Printf("Error detecting programming changes for report %d: %v", report.ID, err)
+		return nil
+	}
+	if err := services.RefreshNextProgrammingChange(report); err != nil {
+		log.Printf("Error refreshing programming changes after report %d: %v", report.ID, err)
+	}
+	if change == nil || !newlyFlagged {
+		return change
+	}
+
+	reportID := report.ID
+	services.NotificationsHub.BroadcastToAdmins(services.NotificationEvent{
+		Type:     "report.therapy_disabled",
+		Title:    "Therapy disabled without comment",
+		Message:  fmt.Sprintf("Report #%d disables tachy therapy compared with the previous report but has no comment", report.ID),
+		Severity: "warning",
+		ReportID: &reportID,
+	})
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("Therapy disabled without comment on report %d", report.ID),
+		"WARNING",
+		map[string]interface{}{"reportId": report.ID, "patientId": report.PatientID, "previousReportId": change.PreviousReportID},
+	)
+	return change
+}
+
+// programmingTimelineEvents returns a timeline event for each report that changed the device programming.
+func programmingTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	changes, err := models.GetPatientProgrammingChanges(patientID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]TimelineEvent, 0, len(changes))
+	for _, change := range changes {
+		events = append(events, TimelineEvent{
+			ID:   fmt.Sprintf("programming-%d", change.ID),
+			Type: "programming",
+			Date: change.ReportDate,
+			Data: toProgrammingChangeResponse(change),
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type reminderRuleRequest struct {
+	Name        *string `json:"name"`
+	HoursBefore *int    `json:"hoursBefore"`
+	Channel     *string `json:"channel"`
+	Location    *string `json:"location"`
+	Subject     *string `json:"subject"`
+	Body        *string `json:"body"`
+	Active      *bool   `json:"active"`
+}
+
+// apply copies the given fields onto the rule and returns a message if it is invalid.
+func (in *reminderRuleRequest) apply(rule *models.ReminderRule) string {
+	if in.Name != nil {
+		rule.Name = *in.Name
+	}
+	if in.HoursBefore != nil {
+		rule.HoursBefore = *in.HoursBefore
+	}
+	if in.Channel != nil {
+		rule.Channel = models.ReminderChannel(strings.ToLower(strings.TrimSpace(*in.Channel)))
+	}
+	if in.Location != nil {
+		rule.Location = models.AppointmentLocation(strings.ToLower(strings.TrimSpace(*in.Location)))
+	}
+	if in.Subject != nil {
+		rule.Subject = strings.TrimSpace(*in.Subject)
+	}
+	if in.Body != nil {
+		rule.Body = strings.TrimSpace(*in.Body)
+	}
+	if in.Active != nil {
+		rule.Active = *in.Active
+	}
+	return rule.Validate()
+}
+
+// GetReminderRules lists reminder rules and the merge fields their templates can use.
+func GetReminderRules(c *fiber.Ctx) error {
+	rules, err := models.GetReminderRules()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load reminder rules"})
+	}
+	return c.JSON(fiber.Map{
+		"rules":       rules,
+		"mergeFields": models.ReminderMergeFields,
+	})
+}
+
+// CreateReminderRule adds a reminder rule.
+func CreateReminderRule(c *fiber.Ctx) error {
+	var input reminderRuleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	rule := models.ReminderRule{Active: true}
+	if msg := input.apply(&rule); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Create(&rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create reminder rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Reminder rule created", "INFO", map[string]interface{}{
+		"reminderRuleId": rule.ID,
+	})
+	return c.Status(http.StatusCreated).JSON(rule)
+}
+
+// UpdateReminderRule changes a rule. Reminders already sent keep their wording; pending ones
+// are sent with the new wording.
+func UpdateReminderRule(c *fiber.Ctx) error {
+	rule, status, msg := loadReminderRule(c)
+	if rule == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var input reminderRuleRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := input.apply(rule); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Save(rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update reminder rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Reminder rule updated", "INFO", map[string]interface{}{
+		"reminderRuleId": rule.ID,
+	})
+	return c.JSON(rule)
+}
+
+// DeleteReminderRule removes a rule that has never scheduled a reminder. A rule with
+// reminders is kept for their history and should be switched off instead.
+func DeleteReminderRule(c *fiber.Ctx) error {
+	rule, status, msg := loadReminderRule(c)
+	if rule == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.AppointmentReminder{}).Where("rule_id = ?", rule.ID).Count(&count).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete reminder rule"})
+	}
+	if count > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Reminder rule has reminders; switch it off instead"})
+	}
+	if err := config.DB.Delete(rule).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete reminder rule"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Reminder rule deleted", "INFO", map[string]interface{}{
+		"reminderRuleId": rule.ID,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+type reminderPreviewRequest struct {
+	Channel       string `json:"channel"`
+	Subject       string `json:"subject"`
+	Body          string `json:"body"`
+	AppointmentID uint   `json:"appointmentId"`
+}
+
+// PreviewReminder renders a reminder template as the patient would receive it, for an
+// appointment if one is given and otherwise with sample values.
+func PreviewReminder(c *fiber.Ctx) error {
+	var input reminderPreviewRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	channel := models.ReminderChannel(strings.ToLower(strings.TrimSpace(input.Channel)))
+	if msg := models.ValidateReminderTemplate(channel, input.Subject, input.Body); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var appointment *models.Appointment
+	if input.AppointmentID != 0 {
+		var err error
+		appointment, err = models.GetAppointmentByID(input.AppointmentID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Appointment not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load appointment"})
+		}
+	}
+
+	msg, err := services.RenderReminder(channel, input.Subject, input.Body, appointment, time.Now())
+	if err != nil {
+		log.Printf("Error rendering reminder preview: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to render reminder"})
+	}
+	preview := fiber.Map{
+		"channel":   channel,
+		"recipient": msg.To,
+		"subject":   msg.Subject,
+		"body":      msg.Body,
+	}
+	if channel == models.ReminderChannelSMS {
+		preview["segments"] = services.SMSSegments(msg.Body)
+	}
+	return c.JSON(preview)
+}
+
+// GetReminders lists reminders and their delivery status, most recently due first.
+func GetReminders(c *fiber.Ctx) error {
+	page := parsePositiveInt(c.Query("page"), 1)
+	limit := parsePositiveInt(c.Query("limit"), 25)
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := models.ReminderFilter{Status: models.ReminderStatus(c.Query("status"))}
+	for name, target := range map[string]*uint{"appointmentId": &filter.AppointmentID, "patientId": &filter.PatientID} {
+		if param := c.Query(name); param != "" {
+			id, err := strconv.ParseUint(param, 10, 64)
+			if err != nil || id == 0 {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + name})
+			}
+			*target = uint(id)
+		}
+	}
+
+	reminders, total, err := models.GetReminders(filter, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load reminders"})
+	}
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	return c.JSON(fiber.Map{
+		"data": reminders,
+		"pagination": fiber.Map{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+// GetAppointmentReminders lists the reminders scheduled for an appointment.
+func GetAppointmentReminders(c *fiber.Ctx) error {
+	userID, userRole, err := resolveUserContext(c)
+	if err != nil {
+		return err
+	}
+	appointmentID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid appointment id"})
+	}
+	appointment, err := models.GetAppointmentByID(appointmentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Appointment not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load appointment"})
+	}
+	allowed, accessErr := canAccessPatient(userRole, userID, appointment.PatientID)
+	if accessErr != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify permissions"})
+	}
+	if !allowed {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+
+	reminders, _, err := models.GetReminders(models.ReminderFilter{AppointmentID: appointmentID}, 100, 0)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load reminders"})
+	}
+	return c.JSON(reminders)
+}
+
+// RetryReminder queues a failed reminder to be sent again on the scheduler's next cycle.
+func RetryReminder(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid reminder ID"})
+	}
+	queued, err := models.RetryReminder(id, time.Now())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retry reminder"})
+	}
+	if !queued {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Only failed reminders can be retried"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Reminder queued for retry", "INFO", map[string]interface{}{
+		"reminderId": id,
+	})
+	return c.SendStatus(http.StatusAccepted)
+}
+
+func loadReminderRule(c *fiber.Ctx) (*models.ReminderRule, int, string) {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid reminder rule ID"
+	}
+	rule, err := models.GetReminderRule(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to load reminder rule"
+	}
+	if rule == nil {
+		return nil, http.StatusNotFound, "Reminder rule not found"
+	}
+	return rule, 0, ""
+}
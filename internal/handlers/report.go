@@ -37,6 +37,12 @@ type ReportResponse struct {
 	CompletedByUserID                              *uint                `json:"completedByUserId"`
 	CompletedByName                                *string              `json:"completedByName"`
 	CompletedBySignature                           *string              `json:"completedBySignature"`
+	SignoffStatus                                  string               `json:"signoffStatus"`
+	SignoffDoctorID                                *uint                `json:"signoffDoctorId"`
+	CosignedByUserID                               *uint                `json:"cosignedByUserId"`
+	CosignedByName                                 *string              `json:"cosignedByName"`
+	CosignSignature                                *string              `json:"cosignSignature"`
+	CosignedAt                                     *time.Time           `json:"cosignedAt"`
 	ReportDate                                     time.Time            `json:"reportDate"`
 	ReportType                                     string               `json:"reportType"`
 	ReportStatus                                   string               `json:"reportStatus"`
@@ -118,8 +124,15 @@ type ReportResponse struct {
 	FileUrl                                        *string              `json:"file_url"`
 	Arrhythmias                                    []ArrhythmiaResponse `json:"arrhythmias"`
 	Tags                                           []models.Tag         `json:"tags"`
+	AFRiskAlert                                    *afRiskAlertResponse `json:"afRiskAlert,omitempty"`
 	CreatedAt                                      time.Time            `json:"createdAt"`
 	UpdatedAt                                      time.Time            `json:"updatedAt"`
+
+	// Settings changed since the previous report for the same device
+	ProgrammingChange *programmingChangeResponse `json:"programmingChange,omitempty"`
+
+	// The next appointment booked or proposed when the report was completed
+	FollowUp *models.ReportFollowUp `json:"followUp,omitempty"`
 }
 
 type RecentReportItem struct {
@@ -154,6 +167,12 @@ func toReportResponse(report models.Report) ReportResponse {
 		CompletedByUserID:                    report.CompletedByUserID,
 		CompletedByName:                      report.CompletedByName,
 		CompletedBySignature:                 report.CompletedBySignature,
+		SignoffStatus:                        report.SignoffStatus,
+		SignoffDoctorID:                      report.SignoffDoctorID,
+		CosignedByUserID:                     report.CosignedByUserID,
+		CosignedByName:                       report.CosignedByName,
+		CosignSignature:                      report.CosignSignature,
+		CosignedAt:                           report.CosignedAt,
 		ReportDate:                           report.ReportDate,
 		ReportType:                           report.ReportType,
 		ReportStatus:                         report.ReportStatus,
@@ -580,13 +599,36 @@ func CreateReport(c *fiber.Ctx) error {
 		}
 	}
 
+	var followUp *models.ReportFollowUp
+	if createdReport.IsCompleted != nil && *createdReport.IsCompleted {
+		startReportSignoff(c, createdReport)
+		followUp = planReportFollowUp(c, createdReport)
+		if refreshed, err := models.GetReportByID(createdReport.ID); err == nil {
+			createdReport = refreshed
+		}
+	}
+
+	afAlert := evaluateReportAFRisk(c, createdReport)
+	programmingChange := detectProgrammingChanges(c, createdReport)
+	syncReportReview(createdReport)
+
 	security.LogEventFromContext(c, security.EventDataModification,
 		fmt.Sprintf("User created report: %d", createdReport.ID),
 		"INFO",
 		map[string]interface{}{"reportId": createdReport.ID, "patientId": createdReport.PatientID},
 	)
 
-	return c.Status(http.StatusCreated).JSON(toReportResponse(*createdReport))
+	resp := toReportResponse(*createdReport)
+	if afAlert != nil {
+		alertResp := toAFRiskAlertResponse(*afAlert)
+		resp.AFRiskAlert = &alertResp
+	}
+	if programmingChange != nil {
+		changeResp := toProgrammingChangeResponse(*programmingChange)
+		resp.ProgrammingChange = &changeResp
+	}
+	resp.FollowUp = followUp
+	return c.Status(http.StatusCreated).JSON(resp)
 }
 
 // UpdateReport updates an existing report with a potential file upload
@@ -606,6 +648,7 @@ func UpdateReport(c *fiber.Ctx) error {
 	}
 
 	wasCompleted := existingReport.IsCompleted != nil && *existingReport.IsCompleted
+	originalReportDate := existingReport.ReportDate
 
 	// Parse the incoming form data
 	updatedData, err := parseReportForm(c)
@@ -614,6 +657,19 @@ func UpdateReport(c *fiber.Ctx) error {
 	}
 
 	userRole, _ := c.Locals("userRole").(string)
+
+	// Signed reports are final; only admins can amend them
+	if existingReport.SignoffStatus == models.SignoffSigned && userRole != "admin" {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Report has been signed by the physician and can no longer be edited"})
+	}
+
+	// Another reviewer holding the report blocks edits until they release it or the claim expires
+	if review, err := models.GetReportReviewItem(uint(reportID)); err == nil && userRole != "admin" && review.IsClaimedByOther(safeUserID(c), time.Now()) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error":     "Report is being reviewed by another user",
+			"claimedBy": reviewUserName(review.ClaimedBy),
+		})
+	}
 	user, _ := c.Locals("user").(*models.User)
 	allowedCompleter := userRole == "staff_doctor" || userRole == "admin"
 
@@ -814,13 +870,51 @@ func UpdateReport(c *fiber.Ctx) error {
 		}
 	}
 
+	nowCompleted := finalReport.IsCompleted != nil && *finalReport.IsCompleted
+	var followUp *models.ReportFollowUp
+	if nowCompleted && !wasCompleted {
+		startReportSignoff(c, finalReport)
+		followUp = planReportFollowUp(c, finalReport)
+	} else if !nowCompleted && wasCompleted {
+		withdrawReportSignoff(finalReport)
+		withdrawReportFollowUp(finalReport)
+	}
+	if refreshed, err := models.GetReportByID(finalReport.ID); err == nil {
+		finalReport = refreshed
+	}
+
+	afAlert := evaluateReportAFRisk(c, finalReport)
+	programmingChange := detectProgrammingChanges(c, finalReport)
+	if !finalReport.ReportDate.Equal(originalReportDate) {
+		// The report moved, so the report that used to follow it needs a new baseline
+		moved := *finalReport
+		moved.ReportDate = originalReportDate
+		if err := services.RefreshNextProgrammingChange(&moved); err != nil {
+			log.Printf("Error refreshing programming changes after report %d: %v", finalReport.ID, err)
+		}
+	}
+	syncReportReview(finalReport)
+
 	security.LogEventFromContext(c, security.EventDataModification,
 		fmt.Sprintf("User updated report: %d", finalReport.ID),
 		"INFO",
 		map[string]interface{}{"reportId": finalReport.ID, "patientId": finalReport.PatientID},
 	)
 
-	return c.Status(http.StatusOK).JSON(toReportResponse(*finalReport))
+	resp := toReportResponse(*finalReport)
+	if afAlert != nil {
+		alertResp := toAFRiskAlertResponse(*afAlert)
+		resp.AFRiskAlert = &alertResp
+	}
+	if programmingChange != nil {
+		changeResp := toProgrammingChangeResponse(*programmingChange)
+		resp.ProgrammingChange = &changeResp
+	}
+	if followUp == nil {
+		followUp, _ = models.GetReportFollowUp(finalReport.ID)
+	}
+	resp.FollowUp = followUp
+	return c.Status(http.StatusOK).JSON(resp)
 }
 
 // GetReportsByPatient retrieves all reports for a specific patient
@@ -979,7 +1073,19 @@ func GetReport(c *fiber.Ctx) error {
 		map[string]interface{}{"reportId": reportID, "patientId": report.PatientID},
 	)
 
-	return c.JSON(toReportResponse(*report))
+	resp := toReportResponse(*report)
+	if afAlert, err := models.GetAFRiskAlertByReportID(report.ID); err == nil && afAlert != nil {
+		alertResp := toAFRiskAlertResponse(*afAlert)
+		resp.AFRiskAlert = &alertResp
+	}
+	if change, err := models.GetReportProgrammingChange(report.ID); err == nil && change != nil {
+		changeResp := toProgrammingChangeResponse(*change)
+		resp.ProgrammingChange = &changeResp
+	}
+	if followUp, err := models.GetReportFollowUp(report.ID); err == nil {
+		resp.FollowUp = followUp
+	}
+	return c.JSON(resp)
 }
 
 // DeleteReport handles the request for deleting a report
@@ -1009,6 +1115,18 @@ func DeleteReport(c *fiber.Ctx) error {
 		log.Printf("Error deleting report %d: %v", reportID, err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete report"})
 	}
+	if err := models.DeleteReportReviewItem(uint(reportID)); err != nil {
+		log.Printf("Warning: failed to remove report %d from review queue: %v", reportID, err)
+	}
+	if err := models.DeleteReportProgrammingChange(uint(reportID)); err != nil {
+		log.Printf("Warning: failed to remove programming changes for report %d: %v", reportID, err)
+	}
+	if err := models.DeleteProposedFollowUp(uint(reportID)); err != nil {
+		log.Printf("Warning: failed to withdraw follow-up for report %d: %v", reportID, err)
+	}
+	if err := services.RefreshNextProgrammingChange(report); err != nil {
+		log.Printf("Warning: failed to refresh programming changes after report %d: %v", reportID, err)
+	}
 
 	security.LogEventFromContext(c, security.EventDataDeletion,
 		fmt.Sprintf("User deleted report: %d", reportID),
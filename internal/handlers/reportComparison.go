@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type reportComparisonThresholdRequest struct {
+	Metric        string   `json:"metric"`
+	AbsoluteDelta *float64 `json:"absoluteDelta"`
+	PercentDelta  *float64 `json:"percentDelta"`
+}
+
+type reportComparisonThresholdResponse struct {
+	Metric        string   `json:"metric"`
+	AbsoluteDelta *float64 `json:"absoluteDelta"`
+	PercentDelta  *float64 `json:"percentDelta"`
+	Configured    bool     `json:"configured"`
+}
+
+// loadComparedReport fetches a report for comparison and checks the caller may see its patient.
+func loadComparedReport(c *fiber.Ctx, param string, userID uint, role string) (*models.Report, int, string) {
+	id, err := strconv.ParseUint(c.Query(param), 10, 32)
+	if err != nil || id == 0 {
+		return nil, http.StatusBadRequest, fmt.Sprintf("%s must be a valid report ID", param)
+	}
+	report, err := models.GetReportByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, http.StatusNotFound, fmt.Sprintf("Report %d not found", id)
+		}
+		return nil, http.StatusInternalServerError, "Failed to fetch report"
+	}
+	allowed, err := canAccessPatient(role, userID, report.PatientID)
+	if err != nil {
+		log.Printf("Error checking patient access for report %d: %v", id, err)
+		return nil, http.StatusInternalServerError, "Could not verify patient access"
+	}
+	if !allowed {
+		return nil, http.StatusForbidden, "Access denied: You are not authorized to view this patient's data"
+	}
+	return report, 0, ""
+}
+
+// CompareReports returns a grouped comparison of any two reports for the same patient.
+func CompareReports(c *fiber.Ctx) error {
+	userID, role, err := resolveUserContext(c)
+	if err != nil {
+		return err
+	}
+
+	baseline, status, msg := loadComparedReport(c, "baseline", userID, role)
+	if baseline == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	current, status, msg := loadComparedReport(c, "current", userID, role)
+	if current == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if baseline.PatientID != current.PatientID {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Reports belong to different patients"})
+	}
+
+	comparison, err := services.CompareReports(baseline, current)
+	if err != nil {
+		log.Printf("Error comparing reports %d and %d: %v", baseline.ID, current.ID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compare reports"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataAccess,
+		fmt.Sprintf("User compared reports %d and %d", baseline.ID, current.ID),
+		"INFO",
+		map[string]interface{}{"baselineReportId": baseline.ID, "currentReportId": current.ID, "patientId": current.PatientID},
+	)
+
+	return c.JSON(comparison)
+}
+
+// GetReportComparisonThresholds lists the significance threshold for every compared metric.
+func GetReportComparisonThresholds(c *fiber.Ctx) error {
+	configured, err := models.GetReportComparisonThresholds()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load comparison thresholds"})
+	}
+
+	metrics := make([]string, 0, len(services.DefaultComparisonThresholds))
+	for metric := range services.DefaultComparisonThresholds {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	resp := make([]reportComparisonThresholdResponse, 0, len(metrics))
+	for _, metric := range metrics {
+		item := reportComparisonThresholdResponse{Metric: metric}
+		if t, ok := configured[metric]; ok {
+			item.AbsoluteDelta, item.PercentDelta, item.Configured = t.AbsoluteDelta, t.PercentDelta, true
+		} else {
+			def := services.DefaultComparisonThresholds[metric]
+			item.AbsoluteDelta, item.PercentDelta = def.AbsoluteDelta, def.PercentDelta
+		}
+		resp = append(resp, item)
+	}
+	return c.JSON(resp)
+}
+
+// UpsertReportComparisonThreshold overrides the significance threshold for a metric.
+func UpsertReportComparisonThreshold(c *fiber.Ctx) error {
+	var input reportComparisonThresholdRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	input.Metric = strings.TrimSpace(input.Metric)
+	if !services.IsComparisonMetric(input.Metric) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown comparison metric"})
+	}
+	if input.AbsoluteDelta == nil && input.PercentDelta == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "absoluteDelta or percentDelta is required"})
+	}
+	if (input.AbsoluteDelta != nil && *input.AbsoluteDelta <= 0) || (input.PercentDelta != nil && *input.PercentDelta <= 0) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Thresholds must be positive"})
+	}
+
+	threshold, err := models.UpsertReportComparisonThreshold(input.Metric, input.AbsoluteDelta, input.PercentDelta)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save comparison threshold"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User set comparison threshold for %s", threshold.Metric),
+		"INFO",
+		map[string]interface{}{"metric": threshold.Metric, "absoluteDelta": threshold.AbsoluteDelta, "percentDelta": threshold.PercentDelta},
+	)
+
+	return c.JSON(reportComparisonThresholdResponse{
+		Metric:        threshold.Metric,
+		AbsoluteDelta: threshold.AbsoluteDelta,
+		PercentDelta:  threshold.PercentDelta,
+		Configured:    true,
+	})
+}
+
+// DeleteReportComparisonThreshold removes an override so the default threshold applies.
+func DeleteReportComparisonThreshold(c *fiber.Ctx) error {
+	metric := c.Params("metric")
+	if err := models.DeleteReportComparisonThreshold(metric); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No threshold configured for this metric"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete comparison threshold"})
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type reportReviewItemResponse struct {
+	ID              uint       `json:"id"`
+	ReportID        uint       `json:"reportId"`
+	PatientID       uint       `json:"patientId"`
+	PatientName     string     `json:"patientName"`
+	PatientMRN      int        `json:"patientMrn"`
+	ReportType      string     `json:"reportType"`
+	ReportDate      time.Time  `json:"reportDate"`
+	Priority        string     `json:"priority"`
+	PriorityReasons []string   `json:"priorityReasons"`
+	DueBy           time.Time  `json:"dueBy"`
+	Overdue         bool       `json:"overdue"`
+	Status          string     `json:"status"`
+	AssigneeID      *uint      `json:"assigneeId"`
+	Assignee        string     `json:"assignee,omitempty"`
+	TeamID          *uint      `json:"teamId"`
+	Team            string     `json:"team,omitempty"`
+	ClaimedByID     *uint      `json:"claimedById"`
+	ClaimedBy       string     `json:"claimedBy,omitempty"`
+	ClaimedAt       *time.Time `json:"claimedAt,omitempty"`
+	ClaimExpiresAt  *time.Time `json:"claimExpiresAt,omitempty"`
+	CompletedByID   *uint      `json:"completedById,omitempty"`
+	CompletedBy     string     `json:"completedBy,omitempty"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+	TurnaroundHours *float64   `json:"turnaroundHours,omitempty"`
+}
+
+type assignReportReviewRequest struct {
+	AssigneeID *uint `json:"assigneeId"`
+	TeamID     *uint `json:"teamId"`
+}
+
+type reportTurnaroundTargetRequest struct {
+	ReportType  string `json:"reportType"`
+	TargetHours int    `json:"targetHours"`
+}
+
+func reviewUserName(u *models.User) string {
+	if u == nil {
+		return ""
+	}
+	if u.FullName != "" {
+		return u.FullName
+	}
+	return u.Username
+}
+
+func toReportReviewItemResponse(item models.ReportReviewItem) reportReviewItemResponse {
+	resp := reportReviewItemResponse{
+		ID:              item.ID,
+		ReportID:        item.ReportID,
+		PatientID:       item.PatientID,
+		PatientName:     strings.TrimSpace(item.Patient.FirstName + " " + item.Patient.LastName),
+		PatientMRN:      item.Patient.MRN,
+		ReportType:      item.Report.ReportType,
+		ReportDate:      item.Report.ReportDate,
+		Priority:        string(item.Priority),
+		PriorityReasons: []string(item.PriorityReasons),
+		DueBy:           item.DueBy,
+		Overdue:         item.Status != models.ReportReviewCompleted && time.Now().After(item.DueBy),
+		Status:          item.Status,
+		AssigneeID:      item.AssigneeID,
+		Assignee:        reviewUserName(item.Assignee),
+		TeamID:          item.TeamID,
+		ClaimedByID:     item.ClaimedByID,
+		ClaimedBy:       reviewUserName(item.ClaimedBy),
+		ClaimedAt:       item.ClaimedAt,
+		ClaimExpiresAt:  item.ClaimExpiresAt,
+		CompletedByID:   item.CompletedByID,
+		CompletedBy:     reviewUserName(item.CompletedBy),
+		CompletedAt:     item.CompletedAt,
+		TurnaroundHours: item.TurnaroundHours,
+	}
+	if resp.PriorityReasons == nil {
+		resp.PriorityReasons = []string{}
+	}
+	if item.Team != nil {
+		resp.Team = item.Team.Name
+	}
+	return resp
+}
+
+func parseOptionalUintQuery(c *fiber.Ctx, key string) *uint {
+	raw := strings.TrimSpace(c.Query(key))
+	if raw == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return nil
+	}
+	val := uint(parsed)
+	return &val
+}
+
+// GetReportReviewQueue lists reports awaiting review, most urgent and earliest due first.
+// Filters: status (pending|in_review|completed|all), priority, assigneeId, teamId,
+// mine=true (assigned to me), claimed=mine and overdue=true.
+func GetReportReviewQueue(c *fiber.Ctx) error {
+	page := parsePositiveInt(c.Query("page"), 1)
+	limit := parsePositiveInt(c.Query("limit"), 25)
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := models.ReportReviewFilter{
+		Status:     strings.ToLower(strings.TrimSpace(c.Query("status"))),
+		Priority:   strings.ToLower(strings.TrimSpace(c.Query("priority"))),
+		AssigneeID: parseOptionalUintQuery(c, "assigneeId"),
+		TeamID:     parseOptionalUintQuery(c, "teamId"),
+		Overdue:    c.Query("overdue") == "true",
+	}
+	userID := safeUserID(c)
+	if c.Query("mine") == "true" && userID != 0 {
+		filter.AssigneeID = &userID
+	}
+	if c.Query("claimed") == "mine" && userID != 0 {
+		filter.ClaimedBy = &userID
+	}
+
+	if userRole, _ := c.Locals("userRole").(string); userRole == "doctor" {
+		userIDStr, _ := c.Locals("userID").(string)
+		user, err := models.GetUserWithDoctor(userIDStr)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve doctor"})
+		}
+		if user.DoctorID == nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Doctor profile not found"})
+		}
+		filter.DoctorID = user.DoctorID
+	}
+
+	items, total, err := models.ListReportReviewItems(filter, limit, (page-1)*limit)
+	if err != nil {
+		log.Printf("Error loading report review queue: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review queue"})
+	}
+
+	data := make([]reportReviewItemResponse, 0, len(items))
+	for _, item := range items {
+		data = append(data, toReportReviewItemResponse(item))
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+		"pagination": fiber.Map{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+// GetReportReview returns the review queue entry for a report.
+func GetReportReview(c *fiber.Ctx) error {
+	userID, userRole, err := resolveUserContext(c)
+	if err != nil {
+		return err
+	}
+	reportID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	item, err := models.GetReportReviewItem(reportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report is not in the review queue"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review"})
+	}
+	allowed, accessErr := canAccessPatient(userRole, userID, item.PatientID)
+	if accessErr != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify permissions"})
+	}
+	if !allowed {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+	return c.JSON(toReportReviewItemResponse(*item))
+}
+
+// ClaimReportReview claims a report so no one else reviews it at the same time. Claims
+// expire after REPORT_REVIEW_CLAIM_TTL and can be renewed by the same user.
+func ClaimReportReview(c *fiber.Ctx) error {
+	userID := safeUserID(c)
+	if userID == 0 {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+	}
+	reportID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	if err := models.ClaimReportReview(reportID, userID, services.ReportClaimTTL()); err != nil {
+		return reportReviewError(c, err)
+	}
+
+	item, err := models.GetReportReviewItem(reportID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User claimed report %d for review", reportID),
+		"INFO",
+		map[string]interface{}{"reportId": reportID, "patientId": item.PatientID},
+	)
+
+	return c.JSON(toReportReviewItemResponse(*item))
+}
+
+// ReleaseReportReview returns a claimed report to the queue. Admins can release any claim.
+func ReleaseReportReview(c *fiber.Ctx) error {
+	userID := safeUserID(c)
+	if userID == 0 {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+	}
+	reportID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+	userRole, _ := c.Locals("userRole").(string)
+
+	if err := models.ReleaseReportReview(reportID, userID, userRole == "admin"); err != nil {
+		return reportReviewError(c, err)
+	}
+
+	item, err := models.GetReportReviewItem(reportID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User released report %d from review", reportID),
+		"INFO",
+		map[string]interface{}{"reportId": reportID, "patientId": item.PatientID},
+	)
+
+	return c.JSON(toReportReviewItemResponse(*item))
+}
+
+// AssignReportReview sets the clinician and/or team responsible for reviewing a report.
+func AssignReportReview(c *fiber.Ctx) error {
+	reportID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	var input assignReportReviewRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.AssigneeID != nil {
+		if err := config.DB.Select("id").First(&models.User{}, *input.AssigneeID).Error; err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Assignee not found"})
+		}
+	}
+	if input.TeamID != nil {
+		if err := config.DB.Select("id").First(&models.Team{}, *input.TeamID).Error; err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Team not found"})
+		}
+	}
+
+	if err := models.AssignReportReview(reportID, input.AssigneeID, input.TeamID); err != nil {
+		return reportReviewError(c, err)
+	}
+
+	item, err := models.GetReportReviewItem(reportID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load review"})
+	}
+
+	if input.AssigneeID != nil {
+		services.NotificationsHub.SendToUser(*input.AssigneeID, services.NotificationEvent{
+			Type:     "report.assigned",
+			Title:    "Report assigned for review",
+			Message:  fmt.Sprintf("Report #%d for %s is due by %s", reportID, toReportReviewItemResponse(*item).PatientName, item.DueBy.Format("02 Jan 15:04")),
+			ReportID: &reportID,
+		})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User assigned report %d for review", reportID),
+		"INFO",
+		map[string]interface{}{"reportId": reportID, "assigneeId": input.AssigneeID, "teamId": input.TeamID},
+	)
+
+	return c.JSON(toReportReviewItemResponse(*item))
+}
+
+// GetReportTurnaroundMetrics reports time from ReportDate to completion per user and team.
+// Optional ?from=&to= (dates); defaults to the last 30 days.
+func GetReportTurnaroundMetrics(c *fiber.Ctx) error {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		parsed, err := parseRFC3339OrDate(raw)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "from must be a valid date"})
+		}
+		from = parsed
+	}
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		parsed, err := parseRFC3339OrDate(raw)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "to must be a valid date"})
+		}
+		to = parsed
+	}
+	if !to.After(from) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "to must be after from"})
+	}
+
+	metrics, err := services.ReportTurnaroundMetrics(from, to)
+	if err != nil {
+		log.Printf("Error calculating turnaround metrics: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to calculate turnaround metrics"})
+	}
+	return c.JSON(metrics)
+}
+
+// GetReportTurnaroundTargets lists configured turnaround targets per report type.
+func GetReportTurnaroundTargets(c *fiber.Ctx) error {
+	targets, err := models.GetReportTurnaroundTargets()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load turnaround targets"})
+	}
+	return c.JSON(fiber.Map{
+		"targets":      targets,
+		"defaultHours": models.DefaultReportTurnaroundHours,
+	})
+}
+
+// UpsertReportTurnaroundTarget sets the turnaround target for a report type.
+func UpsertReportTurnaroundTarget(c *fiber.Ctx) error {
+	var input reportTurnaroundTargetRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if strings.TrimSpace(input.ReportType) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "reportType is required"})
+	}
+	if input.TargetHours <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "targetHours must be positive"})
+	}
+
+	target, err := models.UpsertReportTurnaroundTarget(input.ReportType, input.TargetHours)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save turnaround target"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User set turnaround target for %s to %dh", target.ReportType, target.TargetHours),
+		"INFO",
+		map[string]interface{}{"reportType": target.ReportType, "targetHours": target.TargetHours},
+	)
+
+	return c.JSON(target)
+}
+
+// DeleteReportTurnaroundTarget removes a turnaround target so the default applies.
+func DeleteReportTurnaroundTarget(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid target ID"})
+	}
+	if err := models.DeleteReportTurnaroundTarget(id); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete turnaround target"})
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func reportReviewError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report is not in the review queue"})
+	case errors.Is(err, models.ErrReportReviewClaimed):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Report is being reviewed by another user"})
+	case errors.Is(err, models.ErrReportReviewCompleted):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Report review is already completed"})
+	case errors.Is(err, models.ErrReportReviewNotOwner):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Report is claimed by another user"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update review"})
+}
+
+// syncReportReview refreshes the review queue entry after a report is saved. Failures are
+// logged so they never block the report save.
+func syncReportReview(report *models.Report) {
+	if err := services.SyncReportReview(report); err != nil {
+		log.Printf("Error syncing review queue for report %d: %v", report.ID, err)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+// actAs sets the user the test app authenticates each request as.
+type actAs struct{ user *models.User }
+
+func (a *actAs) middleware(c *fiber.Ctx) error {
+	c.Locals("user", a.user)
+	c.Locals("user_id", a.user.ID)
+	c.Locals("user_role", a.user.Role)
+	c.Locals("userID", fmt.Sprint(a.user.ID))
+	c.Locals("userRole", a.user.Role)
+	return c.Next()
+}
+
+// seedDoctorUser creates a doctor profile and the doctor-role user linked to it.
+func seedDoctorUser(t *testing.T, name string) (*models.User, *models.Doctor) {
+	t.Helper()
+	doctor := &models.Doctor{FullName: "Dr " + name, Email: name + "@clinic.example.com"}
+	if err := config.DB.Create(doctor).Error; err != nil {
+		t.Fatalf("failed to seed doctor: %v", err)
+	}
+	user := &models.User{
+		Username: name,
+		Email:    name + "@example.com",
+		Password: "secret",
+		Role:     "doctor",
+		DoctorID: &doctor.ID,
+	}
+	if err := config.DB.Create(user).Error; err != nil {
+		t.Fatalf("failed to seed doctor user: %v", err)
+	}
+	if err := config.DB.Model(doctor).Update("user_id", user.ID).Error; err != nil {
+		t.Fatalf("failed to link doctor user: %v", err)
+	}
+	return user, doctor
+}
+
+// linkDoctorToPatient associates a doctor with a patient, optionally until expiresAt.
+func linkDoctorToPatient(t *testing.T, doctorID, patientID uint, expiresAt *time.Time) {
+	t.Helper()
+	link := models.PatientDoctor{PatientID: patientID, DoctorID: doctorID, AccessExpiresAt: expiresAt}
+	if err := config.DB.Create(&link).Error; err != nil {
+		t.Fatalf("failed to link doctor to patient: %v", err)
+	}
+}
+
+// seedQueuedReport creates a report for the patient with a pending review queue entry.
+func seedQueuedReport(t *testing.T, patientID, userID uint) *models.Report {
+	t.Helper()
+	report := &models.Report{PatientID: patientID, UserID: userID, ReportDate: time.Now(), ReportType: "Scheduled"}
+	if err := config.DB.Create(report).Error; err != nil {
+		t.Fatalf("failed to seed report: %v", err)
+	}
+	item := models.ReportReviewItem{
+		ReportID:  report.ID,
+		PatientID: patientID,
+		Priority:  models.TaskPriority("medium"),
+		DueBy:     time.Now().Add(72 * time.Hour),
+		Status:    models.ReportReviewPending,
+	}
+	if err := config.DB.Create(&item).Error; err != nil {
+		t.Fatalf("failed to seed review item: %v", err)
+	}
+	return report
+}
+
+func setupReportReviewTestApp(t *testing.T) (*fiber.App, *actAs, *models.Patient, *models.User) {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.ReportReviewItem{}, &models.Team{}); err != nil {
+		t.Fatalf("failed to migrate review models: %v", err)
+	}
+	patient, admin := seedAppointmentFixtures(t)
+
+	as := &actAs{user: admin}
+	app := fiber.New()
+	app.Use(as.middleware)
+	app.Get("/api/report-reviews", GetReportReviewQueue)
+	app.Get("/api/reports/:id/review", GetReportReview)
+	return app, as, patient, admin
+}
+
+func TestGetReportReview_RequiresPatientAccess(t *testing.T) {
+	app, as, patient, admin := setupReportReviewTestApp(t)
+	report := seedQueuedReport(t, patient.ID, admin.ID)
+
+	linked, linkedDoctor := seedDoctorUser(t, "linked")
+	linkDoctorToPatient(t, linkedDoctor.ID, patient.ID, nil)
+	expired, expiredDoctor := seedDoctorUser(t, "expired")
+	lapsed := time.Now().Add(-time.Hour)
+	linkDoctorToPatient(t, expiredDoctor.ID, patient.ID, &lapsed)
+	other, _ := seedDoctorUser(t, "other")
+
+	url := fmt.Sprintf("/api/reports/%d/review", report.ID)
+	cases := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{"admin", admin, http.StatusOK},
+		{"associated doctor", linked, http.StatusOK},
+		{"doctor whose access has expired", expired, http.StatusForbidden},
+		{"unrelated doctor", other, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			as.user = tc.user
+			resp := doBookingRequest(t, app, http.MethodGet, url, nil)
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGetReportReviewQueue_DoctorSeesOnlyCurrentPatients(t *testing.T) {
+	app, as, patient, admin := setupReportReviewTestApp(t)
+	seedQueuedReport(t, patient.ID, admin.ID)
+
+	linked, linkedDoctor := seedDoctorUser(t, "linked")
+	linkDoctorToPatient(t, linkedDoctor.ID, patient.ID, nil)
+	expired, expiredDoctor := seedDoctorUser(t, "expired")
+	lapsed := time.Now().Add(-time.Hour)
+	linkDoctorToPatient(t, expiredDoctor.ID, patient.ID, &lapsed)
+
+	cases := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{"associated doctor", linked, 1},
+		{"doctor whose access has expired", expired, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			as.user = tc.user
+			resp := doBookingRequest(t, app, http.MethodGet, "/api/report-reviews", nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200, got %d", resp.StatusCode)
+			}
+			var body struct {
+				Data []reportReviewItemResponse `json:"data"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode queue: %v", err)
+			}
+			if len(body.Data) != tc.want {
+				t.Fatalf("expected %d queue entries, got %d", tc.want, len(body.Data))
+			}
+		})
+	}
+}
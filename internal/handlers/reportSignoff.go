@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type reportSignoffRequest struct {
+	Action    string `json:"action"` // "approve" or "return"
+	Comments  string `json:"comments"`
+	Signature string `json:"signature"`
+}
+
+type awaitingSignoffItem struct {
+	ID              uint      `json:"id"`
+	ReportDate      time.Time `json:"reportDate"`
+	ReportType      string    `json:"reportType"`
+	PatientID       uint      `json:"patientId"`
+	PatientName     string    `json:"patientName"`
+	PatientMRN      int       `json:"patientMrn"`
+	CompletedByName string    `json:"completedByName,omitempty"`
+	SignoffDoctorID *uint     `json:"signoffDoctorId"`
+	DoctorName      string    `json:"doctorName,omitempty"`
+}
+
+// startReportSignoff moves a newly completed report to awaiting physician sign-off and
+// notifies the responsible physician. When the completer is that physician the report is
+// signed straight away.
+func startReportSignoff(c *fiber.Ctx, report *models.Report) {
+	user, _ := c.Locals("user").(*models.User)
+
+	doctorID, err := models.ResponsibleDoctorID(report)
+	if err != nil {
+		log.Printf("Error resolving physician for report %d: %v", report.ID, err)
+		return
+	}
+
+	if user != nil && user.DoctorID != nil && doctorID != nil && *user.DoctorID == *doctorID {
+		if err := signReport(c, report, user, ""); err != nil {
+			log.Printf("Error signing report %d: %v", report.ID, err)
+		}
+		return
+	}
+
+	event := models.ReportSignoffEvent{Action: models.SignoffActionSubmitted, UserName: reviewUserName(user)}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	err = models.RecordReportSignoff(report.ID, map[string]interface{}{
+		"signoff_status":      models.SignoffAwaitingPhysician,
+		"signoff_doctor_id":   doctorID,
+		"cosigned_by_user_id": nil,
+		"cosigned_by_name":    nil,
+		"cosign_signature":    nil,
+		"cosigned_at":         nil,
+	}, &event)
+	if err != nil {
+		log.Printf("Error starting sign-off for report %d: %v", report.ID, err)
+		return
+	}
+	report.SignoffStatus = models.SignoffAwaitingPhysician
+	report.SignoffDoctorID = doctorID
+
+	reportID := report.ID
+	notification := services.NotificationEvent{
+		Type:      "report.signoff_requested",
+		Title:     "Report awaiting your signature",
+		Message:   fmt.Sprintf("%s completed report #%d and it needs your co-signature", event.UserName, report.ID),
+		ActionURL: fmt.Sprintf("/reports/%d", report.ID),
+		ReportID:  &reportID,
+	}
+
+	notified := 0
+	if doctorID != nil {
+		physicians, err := models.GetPhysicianUsers(*doctorID)
+		if err != nil {
+			log.Printf("Error loading physician accounts for doctor %d: %v", *doctorID, err)
+		}
+		for _, physician := range physicians {
+			services.NotificationsHub.SendToUser(physician.ID, notification)
+			notified++
+		}
+	}
+	if notified == 0 {
+		services.NotificationsHub.BroadcastToAdmins(services.NotificationEvent{
+			Type:     "report.signoff_unassigned",
+			Title:    "No physician to co-sign report",
+			Message:  fmt.Sprintf("Report #%d is awaiting sign-off but no physician account is linked to it", report.ID),
+			Severity: "warning",
+			ReportID: &reportID,
+		})
+	}
+}
+
+// withdrawReportSignoff clears a pending sign-off when the report is marked incomplete again.
+func withdrawReportSignoff(report *models.Report) {
+	if report.SignoffStatus != models.SignoffAwaitingPhysician {
+		return
+	}
+	if err := config.DB.Model(&models.Report{}).Where("id = ?", report.ID).Update("signoff_status", "").Error; err != nil {
+		log.Printf("Error withdrawing sign-off for report %d: %v", report.ID, err)
+		return
+	}
+	report.SignoffStatus = ""
+}
+
+// signReport records the physician's signature, marks the report reviewed and fires the
+// report.reviewed webhook.
+func signReport(c *fiber.Ctx, report *models.Report, signer *models.User, signature string) error {
+	if err := applyReportSignature(report, signer, signature); err != nil {
+		return err
+	}
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("Physician signed report: %d", report.ID),
+		"INFO",
+		map[string]interface{}{"reportId": report.ID, "patientId": report.PatientID, "signedBy": signer.ID},
+	)
+	return nil
+}
+
+// applyReportSignature does the work of signReport without the audit event, for callers
+// that log their own.
+func applyReportSignature(report *models.Report, signer *models.User, signature string) error {
+	now := time.Now()
+	name := reviewUserName(signer)
+	updates := map[string]interface{}{
+		"signoff_status":      models.SignoffSigned,
+		"cosigned_by_user_id": signer.ID,
+		"cosigned_by_name":    name,
+		"cosigned_at":         now,
+		"report_status":       models.ReportStatusReviewed,
+	}
+	if signature != "" {
+		updates["cosign_signature"] = signature
+	} else {
+		updates["cosign_signature"] = nil
+	}
+	event := models.ReportSignoffEvent{Action: models.SignoffActionApproved, UserID: &signer.ID, UserName: name}
+	if err := models.RecordReportSignoff(report.ID, updates, &event); err != nil {
+		return err
+	}
+
+	var patient models.Patient
+	config.DB.Select("id", "mrn", "first_name", "last_name").First(&patient, report.PatientID)
+
+	TriggerWebhook(models.EventReportReviewed, map[string]interface{}{
+		"reportId":    report.ID,
+		"patientId":   report.PatientID,
+		"patientMRN":  patient.MRN,
+		"patientName": fmt.Sprintf("%s %s", patient.FirstName, patient.LastName),
+		"reportDate":  report.ReportDate.Format(time.RFC3339),
+		"reportType":  report.ReportType,
+		"completedBy": getStringPointer(report.CompletedByName),
+		"cosignedBy":  name,
+		"cosignedAt":  now.Format(time.RFC3339),
+		"reportUrl":   getReportURL(report.ID),
+	})
+
+	reportID := report.ID
+	signed := services.NotificationEvent{
+		Type:     "report.reviewed",
+		Title:    "Report signed",
+		Message:  fmt.Sprintf("%s co-signed report #%d", name, report.ID),
+		ReportID: &reportID,
+	}
+	services.NotificationsHub.BroadcastToAdmins(signed)
+	if report.CompletedByUserID != nil && *report.CompletedByUserID != signer.ID {
+		services.NotificationsHub.SendToUser(*report.CompletedByUserID, signed)
+	}
+	return nil
+}
+
+// checkReportSigner returns a status and message when the user may not co-sign the report.
+// Only the physician expected to sign may do so, and never the person who completed the
+// report. Admins can sign on the physician's behalf only when no physician account is
+// linked to the report.
+func checkReportSigner(user *models.User, report *models.Report) (int, string) {
+	if report.CompletedByUserID != nil && *report.CompletedByUserID == user.ID {
+		return http.StatusForbidden, "You cannot co-sign a report you completed"
+	}
+	switch user.Role {
+	case "doctor", "staff_doctor":
+		if user.DoctorID != nil && report.SignoffDoctorID != nil && *user.DoctorID == *report.SignoffDoctorID {
+			return 0, ""
+		}
+	case "admin":
+		if report.SignoffDoctorID == nil {
+			return 0, ""
+		}
+		physicians, err := models.GetPhysicianUsers(*report.SignoffDoctorID)
+		if err != nil {
+			return http.StatusInternalServerError, "Failed to verify permissions"
+		}
+		if len(physicians) == 0 {
+			return 0, ""
+		}
+	}
+	return http.StatusForbidden, "Only the responsible physician can sign this report"
+}
+
+// SignoffReport lets the responsible physician approve a completed report, which makes it
+// final, or return it to device staff with comments.
+func SignoffReport(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+	}
+	reportID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	var input reportSignoffRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	action := strings.ToLower(strings.TrimSpace(input.Action))
+	comments := sanitizeText(input.Comments)
+
+	report, err := models.GetReportByID(reportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch report"})
+	}
+	if report.SignoffStatus != models.SignoffAwaitingPhysician {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": models.ErrSignoffNotAwaiting.Error()})
+	}
+	if status, msg := checkReportSigner(user, report); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	switch action {
+	case "approve":
+		if err := signReport(c, report, user, strings.TrimSpace(input.Signature)); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign report"})
+		}
+
+	case "return":
+		if comments == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "comments are required when returning a report"})
+		}
+		completedBy := report.CompletedByUserID
+		event := models.ReportSignoffEvent{
+			Action:   models.SignoffActionReturned,
+			UserID:   &user.ID,
+			UserName: reviewUserName(user),
+			Comments: comments,
+		}
+		err := models.RecordReportSignoff(report.ID, map[string]interface{}{
+			"signoff_status":         models.SignoffReturned,
+			"is_completed":           false,
+			"completed_by_user_id":   nil,
+			"completed_by_name":      nil,
+			"completed_by_signature": nil,
+		}, &event)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to return report"})
+		}
+		// Like reopening a report, returning it drops the follow-up proposed on completion
+		withdrawReportFollowUp(report)
+
+		notification := services.NotificationEvent{
+			Type:      "report.returned",
+			Title:     "Report returned by physician",
+			Message:   fmt.Sprintf("%s returned report #%d: %s", event.UserName, report.ID, comments),
+			Severity:  "warning",
+			ActionURL: fmt.Sprintf("/reports/%d", report.ID),
+			ReportID:  &reportID,
+		}
+		if completedBy != nil {
+			services.NotificationsHub.SendToUser(*completedBy, notification)
+		} else {
+			services.NotificationsHub.BroadcastToAdmins(notification)
+		}
+
+		security.LogEventFromContext(c, security.EventDataModification,
+			fmt.Sprintf("Physician returned report: %d", report.ID),
+			"INFO",
+			map[string]interface{}{"reportId": report.ID, "patientId": report.PatientID, "returnedBy": user.ID},
+		)
+
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "action must be approve or return"})
+	}
+
+	updated, err := models.GetReportByID(reportID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch updated report"})
+	}
+	syncReportReview(updated)
+	return c.JSON(toReportResponse(*updated))
+}
+
+// GetReportSignoffHistory returns the sign-off steps recorded for a report.
+func GetReportSignoffHistory(c *fiber.Ctx) error {
+	userID, userRole, err := resolveUserContext(c)
+	if err != nil {
+		return err
+	}
+	reportID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid report ID"})
+	}
+
+	var report models.Report
+	if err := config.DB.Select("id", "patient_id").First(&report, reportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch report"})
+	}
+	allowed, accessErr := canAccessPatient(userRole, userID, report.PatientID)
+	if accessErr != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify permissions"})
+	}
+	if !allowed {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+	events, err := models.GetReportSignoffEvents(reportID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load sign-off history"})
+	}
+	return c.JSON(events)
+}
+
+// GetReportsAwaitingSignoff is the physician's co-signature worklist. Physicians see their
+// own reports; admins see all and may filter with ?doctorId=.
+func GetReportsAwaitingSignoff(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+	}
+	page := parsePositiveInt(c.Query("page"), 1)
+	limit := parsePositiveInt(c.Query("limit"), 25)
+	if limit > 200 {
+		limit = 200
+	}
+
+	var doctorID *uint
+	if user.Role == "admin" {
+		doctorID = parseOptionalUintQuery(c, "doctorId")
+	} else {
+		if user.DoctorID == nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Doctor profile not found"})
+		}
+		doctorID = user.DoctorID
+	}
+
+	reports, total, err := models.GetReportsAwaitingSignoff(doctorID, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load reports awaiting sign-off"})
+	}
+
+	doctorIDs := make([]uint, 0, len(reports))
+	for _, r := range reports {
+		if r.SignoffDoctorID != nil {
+			doctorIDs = append(doctorIDs, *r.SignoffDoctorID)
+		}
+	}
+	doctorNames := make(map[uint]string)
+	if len(doctorIDs) > 0 {
+		var doctors []models.Doctor
+		if err := config.DB.Select("id", "full_name").Where("id IN ?", doctorIDs).Find(&doctors).Error; err == nil {
+			for _, d := range doctors {
+				doctorNames[d.ID] = d.FullName
+			}
+		}
+	}
+
+	data := make([]awaitingSignoffItem, 0, len(reports))
+	for _, r := range reports {
+		item := awaitingSignoffItem{
+			ID:              r.ID,
+			ReportDate:      r.ReportDate,
+			ReportType:      r.ReportType,
+			PatientID:       r.PatientID,
+			PatientName:     strings.TrimSpace(r.Patient.FirstName + " " + r.Patient.LastName),
+			PatientMRN:      r.Patient.MRN,
+			CompletedByName: getStringPointer(r.CompletedByName),
+			SignoffDoctorID: r.SignoffDoctorID,
+		}
+		if r.SignoffDoctorID != nil {
+			item.DoctorName = doctorNames[*r.SignoffDoctorID]
+		}
+		data = append(data, item)
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+		"pagination": fiber.Map{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func setupReportSignoffTestApp(t *testing.T) (*fiber.App, *actAs, *models.Patient, *models.User) {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.ReportSignoffEvent{}, &models.Arrhythmia{}, &models.Tag{},
+		&models.Appointment{}, &models.FollowUpRule{}, &models.ReportFollowUp{}); err != nil {
+		t.Fatalf("failed to migrate sign-off models: %v", err)
+	}
+	patient, admin := seedAppointmentFixtures(t)
+
+	as := &actAs{user: admin}
+	app := fiber.New()
+	app.Use(as.middleware)
+	app.Post("/api/reports/:id/signoff", SignoffReport)
+	app.Get("/api/reports/:id/signoff", GetReportSignoffHistory)
+	return app, as, patient, admin
+}
+
+// seedAwaitingSignoff creates a completed report waiting for the doctor's co-signature.
+func seedAwaitingSignoff(t *testing.T, patientID uint, completedBy *models.User, doctorID *uint) *models.Report {
+	t.Helper()
+	report := &models.Report{
+		PatientID:         patientID,
+		UserID:            completedBy.ID,
+		CompletedByUserID: &completedBy.ID,
+		ReportDate:        time.Now(),
+		ReportType:        "Scheduled",
+		SignoffStatus:     models.SignoffAwaitingPhysician,
+		SignoffDoctorID:   doctorID,
+	}
+	if err := config.DB.Create(report).Error; err != nil {
+		t.Fatalf("failed to seed report: %v", err)
+	}
+	return report
+}
+
+func TestSignoffReport_RejectsAdminWhenPhysicianIsLinked(t *testing.T) {
+	app, as, patient, admin := setupReportSignoffTestApp(t)
+	tech := &models.User{Username: "tech", Email: "tech@example.com", Password: "secret", Role: "user"}
+	if err := config.DB.Create(tech).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	_, doctor := seedDoctorUser(t, "signer")
+	report := seedAwaitingSignoff(t, patient.ID, tech, &doctor.ID)
+
+	as.user = admin
+	resp := doBookingRequest(t, app, http.MethodPost, fmt.Sprintf("/api/reports/%d/signoff", report.ID),
+		map[string]string{"action": "approve"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for an admin signing a linked physician's report, got %d", resp.StatusCode)
+	}
+
+	var stored models.Report
+	if err := config.DB.First(&stored, report.ID).Error; err != nil {
+		t.Fatalf("failed to reload report: %v", err)
+	}
+	if stored.SignoffStatus != models.SignoffAwaitingPhysician {
+		t.Fatalf("expected report to stay awaiting sign-off, got %q", stored.SignoffStatus)
+	}
+}
+
+func TestSignoffReport_RejectsCompleter(t *testing.T) {
+	app, as, patient, _ := setupReportSignoffTestApp(t)
+	physician, doctor := seedDoctorUser(t, "signer")
+	// Completed by the physician's own account but still awaiting sign-off, e.g. after
+	// the responsible doctor changed
+	report := seedAwaitingSignoff(t, patient.ID, physician, &doctor.ID)
+
+	as.user = physician
+	resp := doBookingRequest(t, app, http.MethodPost, fmt.Sprintf("/api/reports/%d/signoff", report.ID),
+		map[string]string{"action": "approve"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for the completer co-signing, got %d", resp.StatusCode)
+	}
+}
+
+func TestSignoffReport_ReturnWithdrawsProposedFollowUp(t *testing.T) {
+	app, as, patient, _ := setupReportSignoffTestApp(t)
+	tech := &models.User{Username: "tech", Email: "tech@example.com", Password: "secret", Role: "user"}
+	if err := config.DB.Create(tech).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	physician, doctor := seedDoctorUser(t, "signer")
+	report := seedAwaitingSignoff(t, patient.ID, tech, &doctor.ID)
+	followUp := models.ReportFollowUp{
+		ReportID:  report.ID,
+		PatientID: patient.ID,
+		Location:  models.AppointmentLocationRemote,
+		DueAt:     time.Now().AddDate(0, 3, 0),
+		Status:    models.FollowUpProposed,
+	}
+	if err := config.DB.Create(&followUp).Error; err != nil {
+		t.Fatalf("failed to seed follow-up: %v", err)
+	}
+
+	as.user = physician
+	resp := doBookingRequest(t, app, http.MethodPost, fmt.Sprintf("/api/reports/%d/signoff", report.ID),
+		map[string]string{"action": "return", "comments": "Please recheck the lead impedance"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var count int64
+	config.DB.Model(&models.ReportFollowUp{}).Where("report_id = ?", report.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected the proposed follow-up to be withdrawn, found %d", count)
+	}
+}
+
+func TestCheckReportSigner(t *testing.T) {
+	_, _, patient, admin := setupReportSignoffTestApp(t)
+	tech := &models.User{Username: "tech", Email: "tech@example.com", Password: "secret", Role: "user"}
+	if err := config.DB.Create(tech).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	physician, linkedDoctor := seedDoctorUser(t, "signer")
+	other, _ := seedDoctorUser(t, "other")
+	unlinkedDoctor := &models.Doctor{FullName: "Dr Unlinked", Email: "unlinked@clinic.example.com"}
+	if err := config.DB.Create(unlinkedDoctor).Error; err != nil {
+		t.Fatalf("failed to seed doctor: %v", err)
+	}
+
+	linked := seedAwaitingSignoff(t, patient.ID, tech, &linkedDoctor.ID)
+	unlinked := seedAwaitingSignoff(t, patient.ID, tech, &unlinkedDoctor.ID)
+	unassigned := seedAwaitingSignoff(t, patient.ID, tech, nil)
+	byAdmin := seedAwaitingSignoff(t, patient.ID, admin, nil)
+
+	cases := []struct {
+		name   string
+		user   *models.User
+		report *models.Report
+		want   int
+	}{
+		{"responsible physician", physician, linked, 0},
+		{"another physician", other, linked, http.StatusForbidden},
+		{"admin with a linked physician", admin, linked, http.StatusForbidden},
+		{"admin when the physician has no account", admin, unlinked, 0},
+		{"admin when no physician is assigned", admin, unassigned, 0},
+		{"admin who completed the report", admin, byAdmin, http.StatusForbidden},
+		{"device staff", tech, unassigned, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, msg := checkReportSigner(tc.user, tc.report); status != tc.want {
+				t.Fatalf("expected %d, got %d (%s)", tc.want, status, msg)
+			}
+		})
+	}
+}
+
+func TestGetReportSignoffHistory_RequiresPatientAccess(t *testing.T) {
+	app, as, patient, admin := setupReportSignoffTestApp(t)
+	report := seedAwaitingSignoff(t, patient.ID, admin, nil)
+	linked, linkedDoctor := seedDoctorUser(t, "linked")
+	linkDoctorToPatient(t, linkedDoctor.ID, patient.ID, nil)
+	other, _ := seedDoctorUser(t, "other")
+
+	url := fmt.Sprintf("/api/reports/%d/signoff", report.ID)
+	cases := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{"admin", admin, http.StatusOK},
+		{"associated doctor", linked, http.StatusOK},
+		{"unrelated doctor", other, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			as.user = tc.user
+			resp := doBookingRequest(t, app, http.MethodGet, url, nil)
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"gorm.io/gorm"
+)
+
+type clinicResourceRequest struct {
+	Name         *string `json:"name"`
+	Kind         *string `json:"kind"`
+	Manufacturer *string `json:"manufacturer"`
+	UserID       *uint   `json:"userId"` // 0 clears it
+	Active       *bool   `json:"active"`
+	Notes        *string `json:"notes"`
+}
+
+// apply copies the given fields onto the resource and returns a message if it is invalid.
+func (in *clinicResourceRequest) apply(resource *models.ClinicResource) string {
+	if in.Name != nil {
+		resource.Name = *in.Name
+	}
+	if in.Kind != nil {
+		resource.Kind = models.ResourceKind(strings.ToLower(strings.TrimSpace(*in.Kind)))
+	}
+	if in.Manufacturer != nil {
+		resource.Manufacturer = *in.Manufacturer
+	}
+	if in.UserID != nil {
+		resource.UserID = nil
+		if *in.UserID != 0 {
+			id := *in.UserID
+			resource.UserID = &id
+		}
+	}
+	if in.Active != nil {
+		resource.Active = *in.Active
+	}
+	if in.Notes != nil {
+		resource.Notes = strings.TrimSpace(*in.Notes)
+	}
+	if msg := resource.Validate(); msg != "" {
+		return msg
+	}
+
+	if resource.UserID != nil {
+		var count int64
+		if err := config.DB.Model(&models.User{}).Where("id = ?", *resource.UserID).Count(&count).Error; err != nil || count == 0 {
+			return "User not found"
+		}
+	}
+	return ""
+}
+
+// GetClinicResources lists rooms, programmers and staff. Filter with kind, and with
+// active=true for resources that can be booked.
+func GetClinicResources(c *fiber.Ctx) error {
+	resources, err := models.GetClinicResources(models.ResourceKind(c.Query("kind")), c.QueryBool("active"))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load resources"})
+	}
+	return c.JSON(resources)
+}
+
+// CreateClinicResource adds a resource. It is active unless told otherwise.
+func CreateClinicResource(c *fiber.Ctx) error {
+	var input clinicResourceRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	resource := models.ClinicResource{Active: true}
+	if msg := input.apply(&resource); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Create(&resource).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create resource"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Clinic resource created", "INFO", map[string]interface{}{
+		"resourceId": resource.ID,
+		"kind":       resource.Kind,
+	})
+	return c.Status(http.StatusCreated).JSON(resource)
+}
+
+// UpdateClinicResource changes a resource. Appointments already allocated to it keep it;
+// switching it off only stops new allocations.
+func UpdateClinicResource(c *fiber.Ctx) error {
+	resource, status, msg := loadClinicResource(c)
+	if resource == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var input clinicResourceRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := input.apply(resource); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Save(resource).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update resource"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Clinic resource updated", "INFO", map[string]interface{}{
+		"resourceId": resource.ID,
+	})
+	return c.JSON(resource)
+}
+
+// DeleteClinicResource removes a resource that has never been allocated. One with
+// allocations is kept for the schedule's history and should be switched off instead.
+func DeleteClinicResource(c *fiber.Ctx) error {
+	resource, status, msg := loadClinicResource(c)
+	if resource == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.AppointmentResource{}).Where("resource_id = ?", resource.ID).Count(&count).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete resource"})
+	}
+	if count > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Resource has been allocated to appointments; switch it off instead"})
+	}
+	if err := config.DB.Delete(resource).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete resource"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Clinic resource deleted", "INFO", map[string]interface{}{
+		"resourceId": resource.ID,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// GetResourceSchedule returns each resource's appointments on a day (date=YYYY-MM-DD in
+// clinic time, default today).
+func GetResourceSchedule(c *fiber.Ctx) error {
+	tz, err := models.ClinicTimeLocation()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Invalid clinic timezone"})
+	}
+	day := time.Now().In(tz)
+	if dateParam := c.Query("date"); dateParam != "" {
+		if day, err = time.ParseInLocation("2006-01-02", dateParam, tz); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+		}
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, tz)
+	to := from.AddDate(0, 0, 1)
+
+	schedule, err := models.GetResourceSchedule(from.UTC(), to.UTC())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load resource schedule"})
+	}
+	return c.JSON(fiber.Map{
+		"date":      from.Format("2006-01-02"),
+		"resources": schedule,
+	})
+}
+
+// GetAppointmentResources lists the rooms, staff and programmers allocated to an
+// appointment.
+func GetAppointmentResources(c *fiber.Ctx) error {
+	userID, userRole, err := resolveUserContext(c)
+	if err != nil {
+		return err
+	}
+	appointmentID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid appointment id"})
+	}
+	appointment, err := models.GetAppointmentByID(appointmentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Appointment not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load appointment"})
+	}
+	allowed, accessErr := canAccessPatient(userRole, userID, appointment.PatientID)
+	if accessErr != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify permissions"})
+	}
+	if !allowed {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+
+	allocations, err := models.GetAppointmentResources(appointmentID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load appointment resources"})
+	}
+	return c.JSON(allocations)
+}
+
+// GetPatientResourceRequirements returns what a clinic appointment for the patient would
+// need, from the resources set up and the patient's active devices.
+func GetPatientResourceRequirements(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+	requirements, err := models.GetResourceRequirements(config.DB, patientID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load resource requirements"})
+	}
+	if requirements == nil {
+		requirements = []models.ResourceRequirement{}
+	}
+	return c.JSON(requirements)
+}
+
+func loadClinicResource(c *fiber.Ctx) (*models.ClinicResource, int, string) {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid resource ID"
+	}
+	resource, err := models.GetClinicResource(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to load resource"
+	}
+	if resource == nil {
+		return nil, http.StatusNotFound, "Resource not found"
+	}
+	return resource, 0, ""
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
+)
+
+type patientRiskFactorsRequest struct {
+	CongestiveHeartFailure   bool   `json:"congestiveHeartFailure"`
+	Hypertension             bool   `json:"hypertension"`
+	Diabetes                 bool   `json:"diabetes"`
+	StrokeTIA                bool   `json:"strokeTia"`
+	VascularDisease          bool   `json:"vascularDisease"`
+	UncontrolledHypertension bool   `json:"uncontrolledHypertension"`
+	AbnormalRenalFunction    bool   `json:"abnormalRenalFunction"`
+	AbnormalLiverFunction    bool   `json:"abnormalLiverFunction"`
+	BleedingHistory          bool   `json:"bleedingHistory"`
+	LabileINR                bool   `json:"labileInr"`
+	AntiplateletOrNSAID      bool   `json:"antiplateletOrNsaid"`
+	AlcoholExcess            bool   `json:"alcoholExcess"`
+	Notes                    string `json:"notes"`
+}
+
+type afRiskAlertResponse struct {
+	ID                    uint       `json:"id"`
+	ReportID              uint       `json:"reportId"`
+	PatientID             uint       `json:"patientId"`
+	PatientName           string     `json:"patientName,omitempty"`
+	PatientMRN            int        `json:"patientMrn,omitempty"`
+	BurdenPercent         float64    `json:"burdenPercent"`
+	PreviousBurdenPercent *float64   `json:"previousBurdenPercent"`
+	ThresholdPercent      float64    `json:"thresholdPercent"`
+	CHA2DS2VASc           int        `json:"cha2ds2vasc"`
+	HASBLED               int        `json:"hasbled"`
+	Reasons               []string   `json:"reasons"`
+	Status                string     `json:"status"`
+	AcknowledgedBy        string     `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt        *time.Time `json:"acknowledgedAt,omitempty"`
+	AcknowledgeNote       string     `json:"acknowledgeNote,omitempty"`
+	CreatedAt             time.Time  `json:"createdAt"`
+}
+
+type acknowledgeAFRiskAlertRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+func toAFRiskAlertResponse(a models.AFRiskAlert) afRiskAlertResponse {
+	resp := afRiskAlertResponse{
+		ID:                    a.ID,
+		ReportID:              a.ReportID,
+		PatientID:             a.PatientID,
+		BurdenPercent:         a.BurdenPercent,
+		PreviousBurdenPercent: a.PreviousBurdenPercent,
+		ThresholdPercent:      a.ThresholdPercent,
+		CHA2DS2VASc:           a.CHA2DS2VASc,
+		HASBLED:               a.HASBLED,
+		Reasons:               []string(a.Reasons),
+		Status:                a.Status,
+		AcknowledgedAt:        a.AcknowledgedAt,
+		AcknowledgeNote:       a.AcknowledgeNote,
+		CreatedAt:             a.CreatedAt,
+	}
+	if resp.Reasons == nil {
+		resp.Reasons = []string{}
+	}
+	if a.Patient.ID != 0 {
+		resp.PatientName = strings.TrimSpace(a.Patient.FirstName + " " + a.Patient.LastName)
+		resp.PatientMRN = a.Patient.MRN
+	}
+	if a.AcknowledgedBy != nil {
+		resp.AcknowledgedBy = a.AcknowledgedBy.Username
+	}
+	return resp
+}
+
+// GetPatientRiskProfile returns the patient's risk factors with computed CHA2DS2-VASc and
+// HAS-BLED scores and current anticoagulation status.
+func GetPatientRiskProfile(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+
+	assessment, err := services.AssessPatientRisk(patientID, time.Now())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Patient not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to calculate risk scores"})
+	}
+
+	return c.JSON(assessment)
+}
+
+// UpdatePatientRiskFactors stores the patient's risk factors and re-checks their latest
+// report for an AF risk alert.
+func UpdatePatientRiskFactors(c *fiber.Ctx) error {
+	patientID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patient ID"})
+	}
+
+	var input patientRiskFactorsRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := config.DB.Select("id").First(&models.Patient{}, patientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Patient not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load patient"})
+	}
+
+	factors := models.PatientRiskFactors{
+		PatientID:                patientID,
+		CongestiveHeartFailure:   input.CongestiveHeartFailure,
+		Hypertension:             input.Hypertension,
+		Diabetes:                 input.Diabetes,
+		StrokeTIA:                input.StrokeTIA,
+		VascularDisease:          input.VascularDisease,
+		UncontrolledHypertension: input.UncontrolledHypertension,
+		AbnormalRenalFunction:    input.AbnormalRenalFunction,
+		AbnormalLiverFunction:    input.AbnormalLiverFunction,
+		BleedingHistory:          input.BleedingHistory,
+		LabileINR:                input.LabileINR,
+		AntiplateletOrNSAID:      input.AntiplateletOrNSAID,
+		AlcoholExcess:            input.AlcoholExcess,
+		Notes:                    sanitizeText(input.Notes),
+	}
+	if userID := safeUserID(c); userID != 0 {
+		factors.UpdatedByID = &userID
+	}
+
+	if err := models.SavePatientRiskFactors(&factors); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save risk factors"})
+	}
+
+	var latest models.Report
+	if err := config.DB.Where("patient_id = ?", patientID).Order("report_date DESC, id DESC").First(&latest).Error; err == nil {
+		evaluateReportAFRisk(c, &latest)
+	}
+
+	assessment, err := services.AssessPatientRisk(patientID, time.Now())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Risk factors saved but scores could not be calculated"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User updated risk factors for patient %d", patientID),
+		"INFO",
+		map[string]interface{}{"patientId": patientID, "cha2ds2vasc": assessment.CHA2DS2VASc.Score, "hasbled": assessment.HASBLED.Score},
+	)
+
+	return c.JSON(assessment)
+}
+
+// GetAFRiskAlerts lists AF risk alerts. Doctors only see alerts for their own patients.
+// Optional ?status=open|acknowledged|all (default open).
+func GetAFRiskAlerts(c *fiber.Ctx) error {
+	page := parsePositiveInt(c.Query("page"), 1)
+	limit := parsePositiveInt(c.Query("limit"), 25)
+	if limit > 200 {
+		limit = 200
+	}
+	status := strings.ToLower(strings.TrimSpace(c.Query("status", models.AFRiskAlertOpen)))
+	if status == "all" {
+		status = ""
+	}
+
+	var doctorID *uint
+	if userRole, _ := c.Locals("userRole").(string); userRole == "doctor" {
+		userIDStr, _ := c.Locals("userID").(string)
+		user, err := models.GetUserWithDoctor(userIDStr)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve doctor"})
+		}
+		if user.DoctorID == nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Doctor profile not found"})
+		}
+		doctorID = user.DoctorID
+	}
+
+	alerts, total, err := models.ListAFRiskAlerts(status, doctorID, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load AF risk alerts"})
+	}
+
+	data := make([]afRiskAlertResponse, 0, len(alerts))
+	for _, a := range alerts {
+		data = append(data, toAFRiskAlertResponse(a))
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+		"pagination": fiber.Map{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+// AcknowledgeAFRiskAlert marks an alert as acknowledged, or reopens it.
+func AcknowledgeAFRiskAlert(c *fiber.Ctx) error {
+	userID := safeUserID(c)
+	if userID == 0 {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+	}
+
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid alert ID"})
+	}
+
+	var input acknowledgeAFRiskAlertRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	status := strings.ToLower(strings.TrimSpace(input.Status))
+	if status == "" {
+		status = models.AFRiskAlertAcknowledged
+	}
+
+	if err := models.AcknowledgeAFRiskAlert(id, status, userID, sanitizeText(input.Note)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Alert not found"})
+		}
+		if errors.Is(err, models.ErrInvalidAFRiskAlertStatus) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "status must be acknowledged or open"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update alert"})
+	}
+
+	alert, err := models.GetAFRiskAlertByID(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load alert"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User marked AF risk alert %d as %s", id, status),
+		"INFO",
+		map[string]interface{}{"alertId": id, "reportId": alert.ReportID, "patientId": alert.PatientID, "status": status},
+	)
+
+	return c.JSON(toAFRiskAlertResponse(*alert))
+}
+
+// evaluateReportAFRisk checks a saved report for an AF risk alert and, when a new alert is
+// raised, notifies admins and fires the report.af_risk webhook. Failures are logged so they
+// never block the report save.
+func evaluateReportAFRisk(c *fiber.Ctx, report *models.Report) *models.AFRiskAlert {
+	alert, created, err := services.EvaluateReportAFRisk(report)
+	if err != nil {
+		log.Printf("Error evaluating AF risk for report %d: %v", report.ID, err)
+		return nil
+	}
+	if alert == nil || !created {
+		return alert
+	}
+
+	TriggerWebhook(models.EventReportAFRisk, map[string]interface{}{
+		"reportId":              report.ID,
+		"patientId":             report.PatientID,
+		"burdenPercent":         alert.BurdenPercent,
+		"previousBurdenPercent": alert.PreviousBurdenPercent,
+		"cha2ds2vasc":           alert.CHA2DS2VASc,
+		"hasbled":               alert.HASBLED,
+		"reportUrl":             getReportURL(report.ID),
+	})
+
+	reportID := report.ID
+	services.NotificationsHub.BroadcastToAdmins(services.NotificationEvent{
+		Type:     "report.af_risk",
+		Title:    "New AF without anticoagulation",
+		Message:  fmt.Sprintf("Report #%d shows AF burden %.1f%% with CHA2DS2-VASc %d and no active anticoagulant", report.ID, alert.BurdenPercent, alert.CHA2DS2VASc),
+		Severity: "warning",
+		ReportID: &reportID,
+	})
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("AF risk alert raised for report %d", report.ID),
+		"WARNING",
+		map[string]interface{}{"reportId": report.ID, "patientId": report.PatientID, "alertId": alert.ID},
+	)
+	return alert
+}
@@ -0,0 +1,11 @@
+package handlers
+
+import (
+	"html"
+	"strings"
+)
+
+// sanitizeText trims free text from a request and escapes HTML before it is stored.
+func sanitizeText(s string) string {
+	return html.EscapeString(strings.TrimSpace(s))
+}
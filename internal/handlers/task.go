@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"strconv"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/rogerhendricks/goReporter/internal/config"
 	"github.com/rogerhendricks/goReporter/internal/models"
 	"github.com/rogerhendricks/goReporter/internal/services"
+	"gorm.io/gorm"
 )
 
 type CreateTaskRequest struct {
@@ -21,6 +23,13 @@ type CreateTaskRequest struct {
 	AssignedToID     *uint      `json:"assignedToId"`
 	AssignedToTeamID *uint      `json:"assignedToTeamId"`
 	TagIDs           []uint     `json:"tagIds"`
+
+	// Repeats the task on this schedule, starting from DueDate
+	Recurrence *models.RecurrenceRule `json:"recurrence"`
+
+	// Checklist item titles, and tasks that must be completed before this one
+	Checklist []string `json:"checklist"`
+	DependsOn []uint   `json:"dependsOn"`
 }
 
 type UpdateTaskRequest struct {
@@ -32,10 +41,19 @@ type UpdateTaskRequest struct {
 	AssignedToID     *uint      `json:"assignedToId"`
 	AssignedToTeamID *uint      `json:"assignedToTeamId"`
 	TagIDs           []uint     `json:"tagIds"`
+
+	// For recurring tasks: "this" (default) edits only this occurrence, "future" also edits
+	// the series and its later open occurrences. Recurrence changes the schedule and needs
+	// "future", or makes a one-off task recurring.
+	Scope      string                 `json:"scope"`
+	Recurrence *models.RecurrenceRule `json:"recurrence"`
 }
 
 type AddTaskNoteRequest struct {
 	Content string `json:"content" validate:"required"`
+
+	// Replies join the thread of the note they answer
+	ParentID *uint `json:"parentId"`
 }
 
 type CreateTaskTemplateRequest struct {
@@ -46,6 +64,12 @@ type CreateTaskTemplateRequest struct {
 	Priority        string `json:"priority"`
 	DaysUntilDue    *int   `json:"daysUntilDue"`
 	TagIDs          []uint `json:"tagIds"`
+
+	Recurrence *models.RecurrenceRule `json:"recurrence"`
+
+	// Checklist copied into each task; Steps make the template a multi-task workflow
+	Checklist models.ChecklistTitles `json:"checklist"`
+	Steps     models.TemplateSteps   `json:"steps"`
 }
 
 type UpdateTaskTemplateRequest struct {
@@ -56,6 +80,13 @@ type UpdateTaskTemplateRequest struct {
 	Priority        *string `json:"priority"`
 	DaysUntilDue    *int    `json:"daysUntilDue"`
 	TagIDs          []uint  `json:"tagIds"`
+
+	// An empty frequency removes the schedule
+	Recurrence *models.RecurrenceRule `json:"recurrence"`
+
+	// Omitted fields are left unchanged; an empty list clears them
+	Checklist models.ChecklistTitles `json:"checklist"`
+	Steps     models.TemplateSteps   `json:"steps"`
 }
 
 type CreateTaskFromTemplateRequest struct {
@@ -228,7 +259,7 @@ func GetTask(c *fiber.Ctx) error {
 	}
 
 	var task models.Task
-	query := config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").Preload("CreatedBy").Preload("Tags").Preload("Notes.CreatedBy")
+	query := config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").Preload("CreatedBy").Preload("Tags").Preload("Notes.CreatedBy").Preload("Series").Preload("Checklist", orderChecklist).Preload("BlockedBy")
 
 	if err := query.First(&task, id).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -237,38 +268,54 @@ func GetTask(c *fiber.Ctx) error {
 	}
 
 	// Check permissions
-	if userRole != "admin" && userRole != "doctor" && userRole != "viewer" {
-		hasAccess := false
-
-		// Check if assigned to user
-		if task.AssignedToID != nil && *task.AssignedToID == userID {
-			hasAccess = true
-		}
-
-		// Check if created by user
-		if task.CreatedByID == userID {
-			hasAccess = true
-		}
+	if !canViewTask(&task, userID, userRole) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to view this task",
+		})
+	}
 
-		// Check if user is member of assigned team
-		if task.AssignedToTeamID != nil {
-			var isMember int64
-			config.DB.Table("team_members").
-				Where("team_id = ? AND user_id = ?", *task.AssignedToTeamID, userID).
-				Count(&isMember)
-			if isMember > 0 {
-				hasAccess = true
-			}
-		}
+	return c.JSON(task)
+}
 
-		if !hasAccess {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "You don't have permission to view this task",
-			})
+// canViewTask reports whether a user may view a task: admins, doctors and viewers see all
+// tasks, others only those assigned to them or their team, that they created, or that
+// mention them in a note.
+func canViewTask(task *models.Task, userID uint, userRole string) bool {
+	if userRole == "admin" || userRole == "doctor" || userRole == "viewer" {
+		return true
+	}
+	if task.AssignedToID != nil && *task.AssignedToID == userID {
+		return true
+	}
+	if task.CreatedByID == userID {
+		return true
+	}
+	if task.AssignedToTeamID != nil {
+		var isMember int64
+		config.DB.Table("team_members").
+			Where("team_id = ? AND user_id = ?", *task.AssignedToTeamID, userID).
+			Count(&isMember)
+		if isMember > 0 {
+			return true
 		}
 	}
+	return models.IsMentionedOnTask(userID, task.ID)
+}
 
-	return c.JSON(task)
+// canUpdateTask reports whether a user may change a task: admins, its creator and its
+// assignee or assigned team's members. Doctors are checked separately.
+func canUpdateTask(task *models.Task, userID uint, userRole string) bool {
+	if userRole == "admin" || task.CreatedByID == userID || (task.AssignedToID != nil && *task.AssignedToID == userID) {
+		return true
+	}
+	if task.AssignedToTeamID != nil {
+		var isMember int64
+		config.DB.Table("team_members").
+			Where("team_id = ? AND user_id = ?", *task.AssignedToTeamID, userID).
+			Count(&isMember)
+		return isMember > 0
+	}
+	return false
 }
 
 // CreateTask creates a new task
@@ -355,21 +402,49 @@ func CreateTask(c *fiber.Ctx) error {
 		task.Priority = models.TaskPriorityMedium
 	}
 
-	if err := config.DB.Create(&task).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create task",
+	if req.Recurrence != nil {
+		if msg := validateRecurrence(req.Recurrence, task.DueDate); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+	}
+
+	if msg := validateTaskPrerequisites(req.DependsOn, task.Status); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
 		})
 	}
 
-	// Add tags if provided
+	var tags []models.Tag
 	if len(req.TagIDs) > 0 {
-		var tags []models.Tag
 		config.DB.Find(&tags, req.TagIDs)
-		config.DB.Model(&task).Association("Tags").Append(tags)
+	}
+
+	// The task, its checklist and its prerequisites are saved together
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.CreateTask(tx, &task, req.Recurrence, tags); err != nil {
+			return err
+		}
+		if err := models.CreateChecklistItems(tx, task.ID, req.Checklist); err != nil {
+			return err
+		}
+		for _, dependsOnID := range req.DependsOn {
+			if err := models.AddTaskDependency(tx, task.ID, dependsOnID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create task",
+		})
 	}
 
 	// Reload with associations
-	config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").Preload("CreatedBy").Preload("Tags").First(&task, task.ID)
+	config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").Preload("CreatedBy").Preload("Tags").Preload("Checklist", orderChecklist).Preload("BlockedBy").First(&task, task.ID)
+	notifyAutoAssigned(&task)
 
 	// Trigger webhook for task creation
 	TriggerWebhook(models.EventTaskCreated, map[string]interface{}{
@@ -439,22 +514,7 @@ func UpdateTask(c *fiber.Ctx) error {
 	}
 
 	// Check permissions - Allow admins, task creator, or assigned user/team member
-	canUpdate := userRole == "admin" ||
-		task.CreatedByID == userID ||
-		(task.AssignedToID != nil && *task.AssignedToID == userID)
-
-	// Check if user is member of assigned team
-	if !canUpdate && task.AssignedToTeamID != nil {
-		var isMember int64
-		config.DB.Table("team_members").
-			Where("team_id = ? AND user_id = ?", *task.AssignedToTeamID, userID).
-			Count(&isMember)
-		if isMember > 0 {
-			canUpdate = true
-		}
-	}
-
-	if !canUpdate {
+	if !canUpdateTask(&task, userID, userRole) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "You don't have permission to update this task",
 		})
@@ -467,6 +527,24 @@ func UpdateTask(c *fiber.Ctx) error {
 		})
 	}
 
+	scope, ok := parseTaskScope(req.Scope)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "scope must be \"this\" or \"future\"",
+		})
+	}
+	if scope == taskScopeFuture && task.SeriesID == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Task is not part of a recurring series",
+		})
+	}
+	if req.Recurrence != nil && task.SeriesID != nil && scope != taskScopeFuture {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Changing the schedule applies to all future occurrences; set scope to \"future\"",
+		})
+	}
+	previousDueDate := task.DueDate
+
 	// Update fields
 	if req.Title != nil {
 		task.Title = *req.Title
@@ -488,6 +566,7 @@ func UpdateTask(c *fiber.Ctx) error {
 		task.DueDate = req.DueDate
 	}
 	// Only admins and doctors can reassign tasks
+	autoAssigned := false
 	if userRole == "admin" || userRole == "doctor" {
 		if req.AssignedToID != nil && req.AssignedToTeamID != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -497,31 +576,133 @@ func UpdateTask(c *fiber.Ctx) error {
 		if req.AssignedToID != nil {
 			task.AssignedToID = req.AssignedToID
 			task.AssignedToTeamID = nil // Clear team assignment
+			task.AssignmentReason = ""
 		}
 		if req.AssignedToTeamID != nil {
 			task.AssignedToTeamID = req.AssignedToTeamID
 			task.AssignedToID = nil // Clear user assignment
+			task.AssignmentReason = ""
+
+			// Hand the task to a member if the team auto-assigns
+			var tags []models.Tag
+			config.DB.Model(&task).Association("Tags").Find(&tags)
+			if err := models.AutoAssignTask(config.DB, &task, tags); err != nil {
+				log.Printf("Error auto-assigning task %d: %v", task.ID, err)
+			}
+			autoAssigned = task.AssignedToID != nil
 		}
 	}
 
-	if err := config.DB.Save(&task).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update task",
-		})
+	if req.Recurrence != nil {
+		if msg := validateRecurrence(req.Recurrence, task.DueDate); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+	}
+
+	// A blocked task cannot be completed until its prerequisites are done
+	if !wasCompleted && task.Status == models.TaskStatusCompleted {
+		blockers, err := models.GetOpenPrerequisites(task.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check prerequisites",
+			})
+		}
+		if len(blockers) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":     "Task is blocked by unfinished prerequisites",
+				"blockedBy": blockers,
+			})
+		}
 	}
 
 	// Update tags if provided (only admins and doctors can change tags)
-	if req.TagIDs != nil && (userRole == "admin" || userRole == "doctor") {
-		var tags []models.Tag
+	var tags []models.Tag
+	canChangeTags := req.TagIDs != nil && (userRole == "admin" || userRole == "doctor")
+	if canChangeTags {
 		config.DB.Find(&tags, req.TagIDs)
-		config.DB.Model(&task).Association("Tags").Replace(tags)
+	}
+
+	var changes *models.TaskSeriesChanges
+	if scope == taskScopeFuture {
+		changes = &models.TaskSeriesChanges{
+			Fields: map[string]interface{}{},
+			Rule:   req.Recurrence,
+		}
+		if req.Title != nil {
+			changes.Fields["title"] = task.Title
+		}
+		if req.Description != nil {
+			changes.Fields["description"] = task.Description
+		}
+		if req.Priority != nil {
+			changes.Fields["priority"] = task.Priority
+		}
+		if req.AssignedToID != nil {
+			changes.Fields["assigned_to_id"] = task.AssignedToID
+			changes.Fields["assigned_to_team_id"] = nil
+		}
+		if req.AssignedToTeamID != nil {
+			// The series keeps only the team so later occurrences are auto-assigned afresh
+			changes.Fields["assigned_to_id"] = nil
+			changes.Fields["assigned_to_team_id"] = task.AssignedToTeamID
+		}
+		if previousDueDate != nil && task.DueDate != nil {
+			changes.DueShift = task.DueDate.Sub(*previousDueDate)
+		}
+		if canChangeTags {
+			changes.Tags = tags
+		}
+	}
+
+	// The task and, with scope=future, the rest of its series are saved together
+	failure := "Failed to update task"
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&task).Error; err != nil {
+			return err
+		}
+		if canChangeTags {
+			if err := tx.Model(&task).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+		if changes != nil {
+			failure = "Failed to update future occurrences"
+			return models.UpdateFutureOccurrences(tx, &task, *changes)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": failure,
+		})
+	}
+
+	if scope != taskScopeFuture && req.Recurrence != nil {
+		config.DB.Preload("Tags").First(&task, task.ID)
+		if _, err := models.CreateTaskSeries(config.DB, *req.Recurrence, &task, task.Tags); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to make task recurring",
+			})
+		}
 	}
 
 	// Reload with associations
-	config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").Preload("CreatedBy").Preload("Tags").Preload("Notes.CreatedBy").First(&task, task.ID)
+	config.DB.Preload("Patient").Preload("AssignedTo").Preload("AssignedToTeam").Preload("CreatedBy").Preload("Tags").Preload("Notes.CreatedBy").Preload("Series").Preload("Checklist", orderChecklist).Preload("BlockedBy").First(&task, task.ID)
+	if autoAssigned {
+		notifyAutoAssigned(&task)
+	}
 
 	// Notify admins if task transitioned to completed.
 	if !wasCompleted && task.Status == models.TaskStatusCompleted {
+		// Completing an occurrence creates the next one unless the scheduler already has.
+		if task.SeriesID != nil {
+			if _, err := services.CreateNextTaskOccurrence(*task.SeriesID, task.SeriesIndex+1); err != nil {
+				log.Printf("Error creating next occurrence of task series %d: %v", *task.SeriesID, err)
+			}
+		}
+
 		username, _ := c.Locals("username").(string)
 		taskID := task.ID
 		services.NotificationsHub.BroadcastToAdmins(services.NotificationEvent{
@@ -593,6 +774,27 @@ func DeleteTask(c *fiber.Ctx) error {
 		})
 	}
 
+	// scope=future deletes this and later open occurrences and stops the series
+	scope, ok := parseTaskScope(c.Query("scope"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "scope must be \"this\" or \"future\"",
+		})
+	}
+	if scope == taskScopeFuture {
+		if task.SeriesID == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Task is not part of a recurring series",
+			})
+		}
+		if err := models.EndTaskSeriesFrom(&task); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete future occurrences",
+			})
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
 	if err := config.DB.Delete(&task).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete task",
@@ -602,7 +804,8 @@ func DeleteTask(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// AddTaskNote adds a note to a task
+// AddTaskNote adds a note to a task, or a reply with parentId. Users @mentioned in it are
+// notified.
 func AddTaskNote(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -639,10 +842,39 @@ func AddTaskNote(c *fiber.Ctx) error {
 		})
 	}
 
+	var parentID *uint
+	if req.ParentID != nil {
+		root, err := models.TaskNoteThreadRoot(task.ID, *req.ParentID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load parent note",
+			})
+		}
+		if root == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Parent note not found",
+			})
+		}
+		parentID = root
+	}
+
+	mentioned, msg, err := noteMentions(req.Content, task.PatientID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check mentions",
+		})
+	}
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
 	note := models.TaskNote{
 		TaskID:      task.ID,
 		Content:     req.Content,
 		CreatedByID: userID,
+		ParentID:    parentID,
 	}
 
 	if err := config.DB.Create(&note).Error; err != nil {
@@ -651,6 +883,22 @@ func AddTaskNote(c *fiber.Ctx) error {
 		})
 	}
 
+	excerpt := models.MentionExcerpt(note.Content)
+	notified := recordMentions(mentioned, models.NoteMention{
+		NoteType:      models.MentionTaskNote,
+		NoteID:        note.ID,
+		PatientID:     task.PatientID,
+		TaskID:        &task.ID,
+		MentionedByID: userID,
+		Excerpt:       excerpt,
+	})
+	if parentID != nil {
+		var starter models.TaskNote
+		if err := config.DB.Select("id", "created_by_id").First(&starter, *parentID).Error; err == nil {
+			notifyThreadReply(starter.CreatedByID, userID, notified, excerpt, task.PatientID, &task.ID)
+		}
+	}
+
 	// Reload with creator
 	config.DB.Preload("CreatedBy").First(&note, note.ID)
 
@@ -712,6 +960,24 @@ func UpdateTaskNote(c *fiber.Ctx) error {
 		})
 	}
 
+	var task models.Task
+	if err := config.DB.Select("id", "patient_id").First(&task, note.TaskID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+	mentioned, msg, err := noteMentions(input.Content, task.PatientID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check mentions",
+		})
+	}
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
 	// Update note
 	note.Content = input.Content
 	note.UpdatedBy = &userID
@@ -723,13 +989,23 @@ func UpdateTaskNote(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only users newly mentioned by the edit are notified
+	recordMentions(mentioned, models.NoteMention{
+		NoteType:      models.MentionTaskNote,
+		NoteID:        note.ID,
+		PatientID:     task.PatientID,
+		TaskID:        &task.ID,
+		MentionedByID: userID,
+		Excerpt:       models.MentionExcerpt(note.Content),
+	})
+
 	// Load relationships
 	config.DB.Preload("CreatedBy").Preload("UpdatedBy").First(&note, note.ID)
 
 	return c.JSON(note)
 }
 
-// DeleteTaskNote deletes a task note (only by creator)
+// DeleteTaskNote deletes a task note and its replies (only by creator)
 func DeleteTaskNote(c *fiber.Ctx) error {
 	taskID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -774,8 +1050,8 @@ func DeleteTaskNote(c *fiber.Ctx) error {
 		})
 	}
 
-	// Soft delete the note
-	if err := config.DB.Delete(&note).Error; err != nil {
+	// Soft delete the note, and its replies when it starts a thread
+	if err := models.DeleteNoteThread(&models.TaskNote{}, models.MentionTaskNote, note.ID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete note",
 		})
@@ -892,6 +1168,22 @@ func CreateTaskTemplate(c *fiber.Ctx) error {
 		template.Priority = models.TaskPriorityMedium
 	}
 
+	if req.Recurrence != nil {
+		if err := req.Recurrence.Normalize(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid recurrence: " + err.Error(),
+			})
+		}
+		template.Recurrence = req.Recurrence
+	}
+	template.Checklist = req.Checklist
+	template.Steps = req.Steps
+	if msg := validateTemplateWorkflow(&template); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
 	if err := config.DB.Create(&template).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create template",
@@ -958,6 +1250,29 @@ func UpdateTaskTemplate(c *fiber.Ctx) error {
 	if req.DaysUntilDue != nil {
 		template.DaysUntilDue = req.DaysUntilDue
 	}
+	if req.Recurrence != nil {
+		if req.Recurrence.Frequency == "" {
+			template.Recurrence = nil
+		} else {
+			if err := req.Recurrence.Normalize(); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid recurrence: " + err.Error(),
+				})
+			}
+			template.Recurrence = req.Recurrence
+		}
+	}
+	if req.Checklist != nil {
+		template.Checklist = req.Checklist
+	}
+	if req.Steps != nil {
+		template.Steps = req.Steps
+	}
+	if msg := validateTemplateWorkflow(&template); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
 
 	if err := config.DB.Save(&template).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -1081,18 +1396,19 @@ func CreateTaskFromTemplate(c *fiber.Ctx) error {
 		dueDate := time.Now().AddDate(0, 0, *template.DaysUntilDue)
 		task.DueDate = &dueDate
 	}
+	// Recurring templates start their series today when no due date is set
+	if template.Recurrence != nil && task.DueDate == nil {
+		dueDate := time.Now()
+		task.DueDate = &dueDate
+	}
 
-	if err := config.DB.Create(&task).Error; err != nil {
+	// Create the task with the template's tags
+	if err := models.CreateTask(config.DB, &task, template.Recurrence, template.Tags); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create task",
 		})
 	}
 
-	// Copy tags from template
-	if len(template.Tags) > 0 {
-		config.DB.Model(&task).Association("Tags").Append(template.Tags)
-	}
-
 	config.DB.Preload("Patient").Preload("AssignedTo").Preload("CreatedBy").Preload("Tags").First(&task, task.ID)
 
 	return c.Status(fiber.StatusCreated).JSON(task)
@@ -1136,16 +1452,21 @@ func AssignTemplateToPatient(c *fiber.Ctx) error {
 		})
 	}
 
-	// Calculate due date
+	// Calculate due date. For a workflow it is the start date the steps count from.
 	var dueDate *time.Time
+	start := time.Now()
 	if req.DueDate != "" {
 		parsed, err := time.Parse("2006-01-02", req.DueDate)
 		if err == nil {
 			dueDate = &parsed
+			start = parsed
 		}
 	} else if template.DaysUntilDue != nil {
 		calculated := time.Now().AddDate(0, 0, *template.DaysUntilDue)
 		dueDate = &calculated
+	} else if template.Recurrence != nil {
+		calculated := time.Now()
+		dueDate = &calculated
 	}
 
 	// Create task from template
@@ -1168,23 +1489,22 @@ func AssignTemplateToPatient(c *fiber.Ctx) error {
 		TemplateID:  &templateIDUint,
 	}
 
-	if err := config.DB.Create(&task).Error; err != nil {
+	// Create the task, or every step of a workflow, with the template's tags and checklists
+	tasks, err := models.CreateTasksFromTemplate(&template, &task, start)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create task",
 		})
 	}
 
-	// Associate tags
-	if len(template.Tags) > 0 {
-		if err := config.DB.Model(&task).Association("Tags").Append(template.Tags); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to associate tags",
-			})
-		}
+	if len(template.Steps) > 0 {
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"tasks": tasks,
+		})
 	}
 
 	// Load the created task with associations
-	config.DB.Preload("Patient").Preload("AssignedTo").Preload("CreatedBy").Preload("Tags").First(&task, task.ID)
+	config.DB.Preload("Patient").Preload("AssignedTo").Preload("CreatedBy").Preload("Tags").Preload("Checklist", orderChecklist).First(&task, task.ID)
 
 	return c.Status(fiber.StatusCreated).JSON(task)
 }
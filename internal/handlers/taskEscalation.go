@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"gorm.io/gorm"
+)
+
+type taskEscalationPolicyRequest struct {
+	Name       string                 `json:"name"`
+	Enabled    *bool                  `json:"enabled"`
+	Priority   *models.TaskPriority   `json:"priority"`
+	TagID      *uint                  `json:"tagId"`
+	TemplateID *uint                  `json:"templateId"`
+	Steps      models.EscalationSteps `json:"steps"`
+}
+
+// apply copies the request onto policy and validates the result.
+func (r *taskEscalationPolicyRequest) apply(policy *models.TaskEscalationPolicy) error {
+	policy.Name = r.Name
+	if r.Enabled != nil {
+		policy.Enabled = *r.Enabled
+	}
+	policy.Priority = r.Priority
+	if policy.Priority != nil && *policy.Priority == "" {
+		policy.Priority = nil
+	}
+	policy.TagID = r.TagID
+	policy.TemplateID = r.TemplateID
+	policy.Steps = r.Steps
+	if err := policy.Normalize(); err != nil {
+		return err
+	}
+	if policy.TagID != nil {
+		var count int64
+		config.DB.Model(&models.Tag{}).Where("id = ?", *policy.TagID).Count(&count)
+		if count == 0 {
+			return errors.New("tag not found")
+		}
+	}
+	if policy.TemplateID != nil {
+		var count int64
+		config.DB.Model(&models.TaskTemplate{}).Where("id = ?", *policy.TemplateID).Count(&count)
+		if count == 0 {
+			return errors.New("template not found")
+		}
+	}
+	return nil
+}
+
+// GetTaskEscalationPolicies lists the configured escalation policies.
+func GetTaskEscalationPolicies(c *fiber.Ctx) error {
+	policies, err := models.GetTaskEscalationPolicies()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load escalation policies"})
+	}
+	return c.JSON(policies)
+}
+
+// CreateTaskEscalationPolicy adds an escalation policy. Its notes are written as the creator.
+func CreateTaskEscalationPolicy(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var input taskEscalationPolicyRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	policy := models.TaskEscalationPolicy{Enabled: true, CreatedByID: userID}
+	if err := input.apply(&policy); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := config.DB.Create(&policy).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create escalation policy"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User created task escalation policy %s", policy.Name),
+		"INFO",
+		map[string]interface{}{"policyId": policy.ID, "steps": len(policy.Steps)},
+	)
+
+	return c.Status(http.StatusCreated).JSON(policy)
+}
+
+// UpdateTaskEscalationPolicy replaces an escalation policy's criteria and steps.
+func UpdateTaskEscalationPolicy(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy ID"})
+	}
+	policy, err := models.GetTaskEscalationPolicy(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load escalation policy"})
+	}
+	if policy == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Escalation policy not found"})
+	}
+
+	var input taskEscalationPolicyRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := input.apply(policy); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := config.DB.Select("*").Omit("CreatedAt", "CreatedByID").Save(policy).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update escalation policy"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User updated task escalation policy %s", policy.Name),
+		"INFO",
+		map[string]interface{}{"policyId": policy.ID, "enabled": policy.Enabled, "steps": len(policy.Steps)},
+	)
+
+	return c.JSON(policy)
+}
+
+// DeleteTaskEscalationPolicy removes an escalation policy. Its history is kept.
+func DeleteTaskEscalationPolicy(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy ID"})
+	}
+	if err := models.DeleteTaskEscalationPolicy(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Escalation policy not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete escalation policy"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion,
+		fmt.Sprintf("User deleted task escalation policy %d", id),
+		"WARNING",
+		map[string]interface{}{"policyId": id},
+	)
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// GetTaskEscalationHistory lists the escalation steps applied to a task.
+func GetTaskEscalationHistory(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid task ID"})
+	}
+	userID, _ := c.Locals("user_id").(uint)
+	userRole, _ := c.Locals("user_role").(string)
+
+	var task models.Task
+	if err := config.DB.First(&task, id).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	}
+	if !canViewTask(&task, userID, userRole) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "You don't have permission to view this task"})
+	}
+
+	escalations, err := models.GetTaskEscalations(task.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load escalation history"})
+	}
+	return c.JSON(escalations)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+const (
+	taskScopeThis   = "this"
+	taskScopeFuture = "future"
+)
+
+// validateRecurrence normalizes a requested schedule and returns a message when it is
+// unusable. Recurring tasks are anchored on their due date, so one is required.
+func validateRecurrence(rule *models.RecurrenceRule, dueDate *time.Time) string {
+	if err := rule.Normalize(); err != nil {
+		return "Invalid recurrence: " + err.Error()
+	}
+	if dueDate == nil {
+		return "A recurring task needs a due date"
+	}
+	return ""
+}
+
+// parseTaskScope reads which occurrences of a recurring task an edit applies to.
+func parseTaskScope(scope string) (string, bool) {
+	switch scope {
+	case "", taskScopeThis:
+		return taskScopeThis, true
+	case taskScopeFuture:
+		return taskScopeFuture, true
+	}
+	return "", false
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"gorm.io/gorm"
+)
+
+// orderChecklist preloads checklist items in their display order.
+func orderChecklist(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC, id ASC")
+}
+
+// validateTaskPrerequisites checks the prerequisites requested for a new task and returns a
+// message when they are unusable.
+func validateTaskPrerequisites(ids []uint, status models.TaskStatus) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	var tasks []models.Task
+	if err := config.DB.Select("id", "status").Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		return "Failed to load prerequisites"
+	}
+	if len(tasks) != len(ids) {
+		return "Prerequisite task not found"
+	}
+	if status == models.TaskStatusCompleted {
+		for _, task := range tasks {
+			if task.Status == models.TaskStatusPending || task.Status == models.TaskStatusInProgress {
+				return "A task with unfinished prerequisites cannot be created as completed"
+			}
+		}
+	}
+	return ""
+}
+
+// validateTemplateWorkflow checks a template's checklist and workflow steps.
+func validateTemplateWorkflow(template *models.TaskTemplate) string {
+	if len(template.Steps) == 0 {
+		return ""
+	}
+	if template.Recurrence != nil {
+		return "A workflow template cannot recur"
+	}
+	if err := template.Steps.Normalize(); err != nil {
+		return "Invalid workflow: " + err.Error()
+	}
+	return ""
+}
+
+// loadTaskForChange loads the task in the :id param and checks the user may change it. It
+// writes the error response and returns nil when not.
+func loadTaskForChange(c *fiber.Ctx) (*models.Task, error) {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid task ID"})
+	}
+	userID, _ := c.Locals("user_id").(uint)
+	userRole, _ := c.Locals("user_role").(string)
+
+	var task models.Task
+	if err := config.DB.First(&task, id).Error; err != nil {
+		return nil, c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	}
+	if userRole == "doctor" || !canUpdateTask(&task, userID, userRole) {
+		return nil, c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "You don't have permission to update this task"})
+	}
+	return &task, nil
+}
+
+// AddTaskChecklistItem appends an item to a task's checklist.
+func AddTaskChecklistItem(c *fiber.Ctx) error {
+	task, err := loadTaskForChange(c)
+	if task == nil {
+		return err
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+	if err := c.BodyParser(&input); err != nil || strings.TrimSpace(input.Title) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "title is required"})
+	}
+
+	if err := models.CreateChecklistItems(config.DB, task.ID, []string{input.Title}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add checklist item"})
+	}
+
+	var items []models.TaskChecklistItem
+	config.DB.Scopes(orderChecklist).Where("task_id = ?", task.ID).Find(&items)
+	return c.Status(http.StatusCreated).JSON(items)
+}
+
+// UpdateTaskChecklistItem renames, ticks or unticks a checklist item.
+func UpdateTaskChecklistItem(c *fiber.Ctx) error {
+	task, err := loadTaskForChange(c)
+	if task == nil {
+		return err
+	}
+	itemID, err := getUintParam(c, "itemId")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid checklist item ID"})
+	}
+	item, err := models.GetTaskChecklistItem(task.ID, itemID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load checklist item"})
+	}
+	if item == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Checklist item not found"})
+	}
+
+	var input struct {
+		Title *string `json:"title"`
+		Done  *bool   `json:"done"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.Title != nil {
+		title := strings.TrimSpace(*input.Title)
+		if title == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "title cannot be empty"})
+		}
+		item.Title = title
+	}
+	if input.Done != nil && *input.Done != item.Done {
+		item.Done = *input.Done
+		item.DoneAt, item.DoneByID = nil, nil
+		if item.Done {
+			now := time.Now()
+			userID, _ := c.Locals("user_id").(uint)
+			item.DoneAt, item.DoneByID = &now, &userID
+		}
+	}
+
+	if err := config.DB.Save(item).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update checklist item"})
+	}
+	return c.JSON(item)
+}
+
+// DeleteTaskChecklistItem removes an item from a task's checklist.
+func DeleteTaskChecklistItem(c *fiber.Ctx) error {
+	task, err := loadTaskForChange(c)
+	if task == nil {
+		return err
+	}
+	itemID, err := getUintParam(c, "itemId")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid checklist item ID"})
+	}
+	result := config.DB.Where("id = ? AND task_id = ?", itemID, task.ID).Delete(&models.TaskChecklistItem{})
+	if result.Error != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete checklist item"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Checklist item not found"})
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// AddTaskDependency makes another task a prerequisite of the task.
+func AddTaskDependency(c *fiber.Ctx) error {
+	task, err := loadTaskForChange(c)
+	if task == nil {
+		return err
+	}
+
+	var input struct {
+		DependsOnID uint `json:"dependsOnId"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.DependsOnID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "dependsOnId is required"})
+	}
+	var prerequisite models.Task
+	if err := config.DB.Select("id", "title").First(&prerequisite, input.DependsOnID).Error; err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Prerequisite task not found"})
+	}
+
+	if err := models.AddTaskDependency(config.DB, task.ID, prerequisite.ID); err != nil {
+		if errors.Is(err, models.ErrTaskDependencySelf) || errors.Is(err, models.ErrTaskDependencyCycle) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add prerequisite"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User made task %d a prerequisite of task %d", prerequisite.ID, task.ID),
+		"INFO",
+		map[string]interface{}{"taskId": task.ID, "dependsOnId": prerequisite.ID},
+	)
+
+	config.DB.Preload("BlockedBy").First(task, task.ID)
+	return c.JSON(task.BlockedBy)
+}
+
+// RemoveTaskDependency removes a prerequisite from the task.
+func RemoveTaskDependency(c *fiber.Ctx) error {
+	task, err := loadTaskForChange(c)
+	if task == nil {
+		return err
+	}
+	dependsOnID, err := getUintParam(c, "dependsOnId")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid prerequisite ID"})
+	}
+	if err := models.RemoveTaskDependency(task.ID, dependsOnID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove prerequisite"})
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func setupTaskTestApp(t *testing.T) (*fiber.App, *models.Task) {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.Tag{}, &models.TaskChecklistItem{}); err != nil {
+		t.Fatalf("failed to migrate task models: %v", err)
+	}
+	user := &models.User{Username: "tasker", Email: "tasker@example.com", Password: "secret", Role: "user"}
+	if err := config.DB.Create(user).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	prerequisite := &models.Task{Title: "Request records", Status: models.TaskStatusPending, Priority: models.TaskPriorityMedium, CreatedByID: user.ID}
+	if err := config.DB.Create(prerequisite).Error; err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+
+	as := &actAs{user: user}
+	app := fiber.New()
+	app.Use(as.middleware)
+	app.Post("/api/tasks", CreateTask)
+	return app, prerequisite
+}
+
+func TestCreateTask_SavesChecklistAndPrerequisites(t *testing.T) {
+	app, prerequisite := setupTaskTestApp(t)
+
+	resp := doBookingRequest(t, app, http.MethodPost, "/api/tasks", map[string]interface{}{
+		"title":     "Review device clinic letter",
+		"checklist": []string{"Check battery", "Sign letter"},
+		"dependsOn": []uint{prerequisite.ID},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	var task models.Task
+	if err := config.DB.Preload("Checklist").Preload("BlockedBy").Where("title = ?", "Review device clinic letter").First(&task).Error; err != nil {
+		t.Fatalf("task was not created: %v", err)
+	}
+	if len(task.Checklist) != 2 {
+		t.Fatalf("expected 2 checklist items, got %d", len(task.Checklist))
+	}
+	if len(task.BlockedBy) != 1 || task.BlockedBy[0].ID != prerequisite.ID {
+		t.Fatalf("expected task %d as the prerequisite, got %+v", prerequisite.ID, task.BlockedBy)
+	}
+}
+
+func TestCreateTask_ChecklistFailureRollsBackTask(t *testing.T) {
+	app, _ := setupTaskTestApp(t)
+	if err := config.DB.Migrator().DropTable(&models.TaskChecklistItem{}); err != nil {
+		t.Fatalf("failed to drop checklist table: %v", err)
+	}
+
+	resp := doBookingRequest(t, app, http.MethodPost, "/api/tasks", map[string]interface{}{
+		"title":     "Review device clinic letter",
+		"checklist": []string{"Check battery"},
+	})
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.StatusCode)
+	}
+
+	var count int64
+	config.DB.Model(&models.Task{}).Where("title = ?", "Review device clinic letter").Count(&count)
+	if count != 0 {
+		t.Fatalf("expected the task to be rolled back, found %d", count)
+	}
+}
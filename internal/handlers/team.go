@@ -55,6 +55,8 @@ func CreateTeam(c *fiber.Ctx) error {
 		Color       *string `json:"color"`
 		ManagerID   *uint   `json:"managerId"`
 		MemberIDs   []uint  `json:"memberIds"`
+
+		AssignmentStrategy string `json:"assignmentStrategy"`
 	}
 
 	if err := c.BodyParser(&reqBody); err != nil {
@@ -65,6 +67,13 @@ func CreateTeam(c *fiber.Ctx) error {
 	team.Description = reqBody.Description
 	team.Color = reqBody.Color
 	team.ManagerID = reqBody.ManagerID
+	team.AssignmentStrategy = models.AssignmentManual
+	if reqBody.AssignmentStrategy != "" {
+		if !models.IsAssignmentStrategy(reqBody.AssignmentStrategy) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment strategy"})
+		}
+		team.AssignmentStrategy = reqBody.AssignmentStrategy
+	}
 
 	// Load members if provided
 	if len(reqBody.MemberIDs) > 0 {
@@ -106,6 +115,9 @@ func UpdateTeam(c *fiber.Ctx) error {
 		Color       *string `json:"color"`
 		ManagerID   *uint   `json:"managerId"`
 		MemberIDs   []uint  `json:"memberIds"`
+
+		// Left unchanged when omitted
+		AssignmentStrategy *string `json:"assignmentStrategy"`
 	}
 
 	if err := c.BodyParser(&reqBody); err != nil {
@@ -116,6 +128,12 @@ func UpdateTeam(c *fiber.Ctx) error {
 	existingTeam.Description = reqBody.Description
 	existingTeam.Color = reqBody.Color
 	existingTeam.ManagerID = reqBody.ManagerID
+	if reqBody.AssignmentStrategy != nil {
+		if !models.IsAssignmentStrategy(*reqBody.AssignmentStrategy) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment strategy"})
+		}
+		existingTeam.AssignmentStrategy = *reqBody.AssignmentStrategy
+	}
 
 	// Update members if provided
 	if reqBody.MemberIDs != nil {
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+)
+
+// notifyAutoAssigned tells the member team auto-assignment picked about their new task.
+func notifyAutoAssigned(task *models.Task) {
+	if task.AssignedToID == nil || task.AssignedToTeamID == nil || task.AssignmentReason == "" {
+		return
+	}
+	taskID := task.ID
+	services.NotificationsHub.SendToUser(*task.AssignedToID, services.NotificationEvent{
+		Type:    "task.assigned",
+		Title:   "Task assigned to you",
+		Message: fmt.Sprintf("'%s' was auto-assigned to you", task.Title),
+		TaskID:  &taskID,
+	})
+}
+
+// GetUserSkills returns the tags a user is matched on by skill-based team assignment.
+func GetUserSkills(c *fiber.Ctx) error {
+	userID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	skills, err := models.GetUserSkills(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load skills"})
+	}
+	return c.JSON(skills)
+}
+
+// SetUserSkills replaces a user's skills with the given tags.
+func SetUserSkills(c *fiber.Ctx) error {
+	userID, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	var input struct {
+		TagIDs []uint `json:"tagIds"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("id = ?", userID).Count(&count)
+	if count == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if len(input.TagIDs) > 0 {
+		config.DB.Model(&models.Tag{}).Where("id IN ?", input.TagIDs).Count(&count)
+		if int(count) != len(uniqueIDs(input.TagIDs)) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Tag not found"})
+		}
+	}
+
+	if err := models.SetUserSkills(userID, input.TagIDs); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update skills"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User updated the skills of user %d", userID),
+		"INFO",
+		map[string]interface{}{"userId": userID, "tagIds": input.TagIDs},
+	)
+
+	skills, _ := models.GetUserSkills(userID)
+	return c.JSON(skills)
+}
+
+// GetUserAbsences lists current and upcoming out-of-office periods. Admins see everyone's,
+// or one user's with ?userId=; other users see their own.
+func GetUserAbsences(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(uint)
+	userRole, _ := c.Locals("user_role").(string)
+
+	filter := &userID
+	if userRole == "admin" {
+		filter = nil
+		if raw := c.QueryInt("userId", 0); raw > 0 {
+			id := uint(raw)
+			filter = &id
+		}
+	}
+
+	absences, err := models.GetUserAbsences(filter, time.Now())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load absences"})
+	}
+	return c.JSON(absences)
+}
+
+// CreateUserAbsence records an out-of-office period. Admins may record one for any user.
+func CreateUserAbsence(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	userRole, _ := c.Locals("user_role").(string)
+
+	var input struct {
+		UserID   *uint     `json:"userId"`
+		StartsAt time.Time `json:"startsAt"`
+		EndsAt   time.Time `json:"endsAt"`
+		Reason   string    `json:"reason"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if input.StartsAt.IsZero() || !input.EndsAt.After(input.StartsAt) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "endsAt must be after startsAt"})
+	}
+
+	absence := models.UserAbsence{
+		UserID:      userID,
+		StartsAt:    input.StartsAt,
+		EndsAt:      input.EndsAt,
+		Reason:      input.Reason,
+		CreatedByID: userID,
+	}
+	if input.UserID != nil && *input.UserID != userID {
+		if userRole != "admin" {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Only admins can record absences for other users"})
+		}
+		var count int64
+		config.DB.Model(&models.User{}).Where("id = ?", *input.UserID).Count(&count)
+		if count == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "User not found"})
+		}
+		absence.UserID = *input.UserID
+	}
+
+	if err := config.DB.Create(&absence).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record absence"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification,
+		fmt.Sprintf("User recorded an absence for user %d", absence.UserID),
+		"INFO",
+		map[string]interface{}{"absenceId": absence.ID, "userId": absence.UserID, "startsAt": absence.StartsAt, "endsAt": absence.EndsAt},
+	)
+
+	return c.Status(http.StatusCreated).JSON(absence)
+}
+
+// DeleteUserAbsence removes an out-of-office period. Users may remove their own.
+func DeleteUserAbsence(c *fiber.Ctx) error {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid absence ID"})
+	}
+	userID, _ := c.Locals("user_id").(uint)
+	userRole, _ := c.Locals("user_role").(string)
+
+	absence, err := models.GetUserAbsence(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load absence"})
+	}
+	if absence == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Absence not found"})
+	}
+	if userRole != "admin" && absence.UserID != userID {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "You can only remove your own absences"})
+	}
+
+	if err := config.DB.Delete(absence).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove absence"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion,
+		fmt.Sprintf("User removed absence %d of user %d", absence.ID, absence.UserID),
+		"INFO",
+		map[string]interface{}{"absenceId": absence.ID, "userId": absence.UserID},
+	)
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
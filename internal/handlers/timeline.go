@@ -1,17 +1,18 @@
 package handlers
 
 import (
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/rogerhendricks/goReporter/internal/config"
 	"github.com/rogerhendricks/goReporter/internal/models"
 )
 
 type TimelineEvent struct {
 	ID   string      `json:"id"`
-	Type string      `json:"type"` // "task", "note", or "report"
+	Type string      `json:"type"` // Type of the source that produced the event, e.g. "task" or "implant"
 	Date time.Time   `json:"date"`
 	Data interface{} `json:"data"`
 }
@@ -25,10 +26,33 @@ type TimelineResponse struct {
 	HasMore    bool            `json:"hasMore"`
 }
 
+// TimelineStats counts events per source. The named counts are kept for existing clients;
+// Counts covers every registered source.
 type TimelineStats struct {
-	TaskCount   int64 `json:"taskCount"`
-	NoteCount   int64 `json:"noteCount"`
-	ReportCount int64 `json:"reportCount"`
+	TaskCount        int64            `json:"taskCount"`
+	NoteCount        int64            `json:"noteCount"`
+	ReportCount      int64            `json:"reportCount"`
+	MedicationCount  int64            `json:"medicationCount"`
+	ProgrammingCount int64            `json:"programmingCount"`
+	Counts           map[string]int64 `json:"counts"`
+	Total            int64            `json:"total"`
+}
+
+// TimelineSource supplies one type of event for the patient timeline.
+type TimelineSource interface {
+	// Type is the event type the source produces and the value used to filter on it.
+	Type() string
+	// Events returns the patient's events dated within [startDate, endDate); either bound may be nil.
+	Events(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error)
+	// Count returns the number of events the source holds for the patient.
+	Count(patientID uint) (int64, error)
+}
+
+var timelineSources []TimelineSource
+
+// RegisterTimelineSource adds a source to the patient timeline.
+func RegisterTimelineSource(source TimelineSource) {
+	timelineSources = append(timelineSources, source)
 }
 
 // GetPatientTimeline retrieves timeline events for a patient with pagination and filtering
@@ -40,19 +64,8 @@ func GetPatientTimeline(c *fiber.Ctx) error {
 		})
 	}
 
-	if role, ok := c.Locals("userRole").(string); ok && role == "doctor" {
-		userIDVal := c.Locals("user_id")
-		userID, ok := userIDVal.(uint)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user session"})
-		}
-		allowed, accessErr := models.IsDoctorAssociatedWithPatient(userID, uint(patientID))
-		if accessErr != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify access"})
-		}
-		if !allowed {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
-		}
+	if err := checkTimelineAccess(c, uint(patientID)); err != nil {
+		return err
 	}
 
 	// Pagination parameters
@@ -65,8 +78,14 @@ func GetPatientTimeline(c *fiber.Ctx) error {
 		limit = 20
 	}
 
-	// Filter parameters
-	eventType := c.Query("type", "all") // "all", "task", "note", "report"
+	// Filter parameters: "all" or a comma-separated list of source types
+	sources, unknown := selectTimelineSources(c.Query("type", "all"))
+	if unknown != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown timeline event type: " + unknown,
+			"types": timelineSourceTypes(),
+		})
+	}
 
 	// Date range parameters
 	var startDate, endDate *time.Time
@@ -83,84 +102,11 @@ func GetPatientTimeline(c *fiber.Ctx) error {
 		}
 	}
 
-	// Collect all events
+	// Collect events from every selected source
 	var allEvents []TimelineEvent
-
-	// Fetch tasks if needed
-	if eventType == "all" || eventType == "task" {
-		var tasks []models.Task
-		query := config.DB.Where("patient_id = ?", patientID).
-			Preload("Patient").
-			Preload("AssignedTo").
-			Preload("CreatedBy").
-			Preload("Tags")
-
-		if startDate != nil {
-			query = query.Where("created_at >= ?", startDate)
-		}
-		if endDate != nil {
-			query = query.Where("created_at < ?", endDate)
-		}
-
-		if err := query.Find(&tasks).Error; err == nil {
-			for _, task := range tasks {
-				allEvents = append(allEvents, TimelineEvent{
-					ID:   "task-" + strconv.Itoa(int(task.ID)),
-					Type: "task",
-					Date: task.CreatedAt,
-					Data: task,
-				})
-			}
-		}
-	}
-
-	// Fetch notes if needed
-	if eventType == "all" || eventType == "note" {
-		var notes []models.PatientNote
-		query := config.DB.Where("patient_id = ?", patientID).
-			Preload("User")
-
-		if startDate != nil {
-			query = query.Where("created_at >= ?", startDate)
-		}
-		if endDate != nil {
-			query = query.Where("created_at < ?", endDate)
-		}
-
-		if err := query.Find(&notes).Error; err == nil {
-			for _, note := range notes {
-				allEvents = append(allEvents, TimelineEvent{
-					ID:   "note-" + strconv.Itoa(int(note.ID)),
-					Type: "note",
-					Date: note.CreatedAt,
-					Data: note,
-				})
-			}
-		}
-	}
-
-	// Fetch reports if needed
-	if eventType == "all" || eventType == "report" {
-		var reports []models.Report
-		query := config.DB.Where("patient_id = ?", patientID).
-			Preload("Tags")
-
-		if startDate != nil {
-			query = query.Where("report_date >= ?", startDate)
-		}
-		if endDate != nil {
-			query = query.Where("report_date < ?", endDate)
-		}
-
-		if err := query.Find(&reports).Error; err == nil {
-			for _, report := range reports {
-				allEvents = append(allEvents, TimelineEvent{
-					ID:   "report-" + strconv.Itoa(int(report.ID)),
-					Type: "report",
-					Date: report.ReportDate,
-					Data: report,
-				})
-			}
+	for _, source := range sources {
+		if events, err := source.Events(uint(patientID), startDate, endDate); err == nil {
+			allEvents = append(allEvents, events...)
 		}
 	}
 
@@ -173,7 +119,7 @@ func GetPatientTimeline(c *fiber.Ctx) error {
 	offset := (page - 1) * limit
 
 	// Apply pagination
-	var paginatedEvents []TimelineEvent
+	paginatedEvents := []TimelineEvent{}
 	if offset < len(allEvents) {
 		end := offset + limit
 		if end > len(allEvents) {
@@ -203,13 +149,38 @@ func GetPatientTimelineStats(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := checkTimelineAccess(c, uint(patientID)); err != nil {
+		return err
+	}
+
+	stats := TimelineStats{Counts: make(map[string]int64, len(timelineSources))}
+	for _, source := range timelineSources {
+		count, err := source.Count(uint(patientID))
+		if err != nil {
+			continue
+		}
+		stats.Counts[source.Type()] = count
+		stats.Total += count
+	}
+	stats.TaskCount = stats.Counts["task"]
+	stats.NoteCount = stats.Counts["note"]
+	stats.ReportCount = stats.Counts["report"]
+	stats.MedicationCount = stats.Counts["medication"]
+	stats.ProgrammingCount = stats.Counts["programming"]
+
+	return c.JSON(stats)
+}
+
+// checkTimelineAccess limits doctors to their own patients. It returns the error response
+// already written to c when access is refused.
+func checkTimelineAccess(c *fiber.Ctx, patientID uint) error {
 	if role, ok := c.Locals("userRole").(string); ok && role == "doctor" {
 		userIDVal := c.Locals("user_id")
 		userID, ok := userIDVal.(uint)
 		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user session"})
 		}
-		allowed, accessErr := models.IsDoctorAssociatedWithPatient(userID, uint(patientID))
+		allowed, accessErr := models.IsDoctorAssociatedWithPatient(userID, patientID)
 		if accessErr != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify access"})
 		}
@@ -217,28 +188,50 @@ func GetPatientTimelineStats(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
 		}
 	}
+	return nil
+}
 
-	var stats TimelineStats
-
-	// Count tasks
-	config.DB.Model(&models.Task{}).Where("patient_id = ?", patientID).Count(&stats.TaskCount)
-
-	// Count notes
-	config.DB.Model(&models.PatientNote{}).Where("patient_id = ?", patientID).Count(&stats.NoteCount)
-
-	// Count reports
-	config.DB.Model(&models.Report{}).Where("patient_id = ?", patientID).Count(&stats.ReportCount)
+// selectTimelineSources resolves the type filter to sources. unknown holds the first type
+// that matches no source.
+func selectTimelineSources(filter string) (sources []TimelineSource, unknown string) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" || filter == "all" {
+		return timelineSources, ""
+	}
+	byType := make(map[string]TimelineSource, len(timelineSources))
+	for _, source := range timelineSources {
+		byType[source.Type()] = source
+	}
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(filter, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		source, ok := byType[t]
+		if !ok {
+			return nil, t
+		}
+		seen[t] = true
+		sources = append(sources, source)
+	}
+	return sources, ""
+}
 
-	return c.JSON(stats)
+func timelineSourceTypes() []string {
+	types := make([]string, 0, len(timelineSources))
+	for _, source := range timelineSources {
+		types = append(types, source.Type())
+	}
+	return types
 }
 
 // sortEventsByDate sorts timeline events by date descending
 func sortEventsByDate(events []TimelineEvent) {
-	for i := 0; i < len(events)-1; i++ {
-		for j := i + 1; j < len(events); j++ {
-			if events[i].Date.Before(events[j].Date) {
-				events[i], events[j] = events[j], events[i]
-			}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Date.Equal(events[j].Date) {
+			return events[i].Date.After(events[j].Date)
 		}
-	}
+		return events[i].ID < events[j].ID
+	})
 }
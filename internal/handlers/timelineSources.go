@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterTimelineSource(timelineSourceFuncs{"task", taskTimelineEvents, countPatientRows(&models.Task{})})
+	RegisterTimelineSource(timelineSourceFuncs{"note", noteTimelineEvents, countPatientRows(&models.PatientNote{})})
+	RegisterTimelineSource(timelineSourceFuncs{"report", reportTimelineEvents, countPatientRows(&models.Report{})})
+	RegisterTimelineSource(timelineSourceFuncs{"medication", medicationTimelineEvents, nil})
+	RegisterTimelineSource(timelineSourceFuncs{"programming", programmingTimelineEvents, nil})
+	RegisterTimelineSource(timelineSourceFuncs{"implant", implantTimelineEvents, nil})
+	RegisterTimelineSource(timelineSourceFuncs{"appointment", appointmentTimelineEvents, countPatientRows(&models.Appointment{})})
+	RegisterTimelineSource(timelineSourceFuncs{"consent", consentTimelineEvents, nil})
+	RegisterTimelineSource(timelineSourceFuncs{"access", accessTimelineEvents, nil})
+	RegisterTimelineSource(timelineSourceFuncs{"tag", tagTimelineEvents, countPatientRows(&models.PatientTagEvent{})})
+}
+
+// timelineSourceFuncs adapts plain functions to TimelineSource. Without a count function
+// the source's events are counted.
+type timelineSourceFuncs struct {
+	eventType string
+	events    func(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error)
+	count     func(patientID uint) (int64, error)
+}
+
+func (s timelineSourceFuncs) Type() string { return s.eventType }
+
+func (s timelineSourceFuncs) Events(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	return s.events(patientID, startDate, endDate)
+}
+
+func (s timelineSourceFuncs) Count(patientID uint) (int64, error) {
+	if s.count != nil {
+		return s.count(patientID)
+	}
+	events, err := s.events(patientID, nil, nil)
+	return int64(len(events)), err
+}
+
+// countPatientRows counts the rows of model belonging to the patient, one event per row.
+func countPatientRows(model interface{}) func(patientID uint) (int64, error) {
+	return func(patientID uint) (int64, error) {
+		var count int64
+		err := config.DB.Model(model).Where("patient_id = ?", patientID).Count(&count).Error
+		return count, err
+	}
+}
+
+// withDateRange limits query to rows whose column falls within [startDate, endDate).
+func withDateRange(query *gorm.DB, column string, startDate, endDate *time.Time) *gorm.DB {
+	if startDate != nil {
+		query = query.Where(column+" >= ?", *startDate)
+	}
+	if endDate != nil {
+		query = query.Where(column+" < ?", *endDate)
+	}
+	return query
+}
+
+func timelineInRange(t time.Time, startDate, endDate *time.Time) bool {
+	if startDate != nil && t.Before(*startDate) {
+		return false
+	}
+	if endDate != nil && !t.Before(*endDate) {
+		return false
+	}
+	return true
+}
+
+func taskTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	var tasks []models.Task
+	query := config.DB.Where("patient_id = ?", patientID).
+		Preload("Patient").
+		Preload("AssignedTo").
+		Preload("CreatedBy").
+		Preload("Tags")
+	if err := withDateRange(query, "created_at", startDate, endDate).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]TimelineEvent, 0, len(tasks))
+	for _, task := range tasks {
+		events = append(events, TimelineEvent{
+			ID:   "task-" + strconv.Itoa(int(task.ID)),
+			Type: "task",
+			Date: task.CreatedAt,
+			Data: task,
+		})
+	}
+	return events, nil
+}
+
+func noteTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	var notes []models.PatientNote
+	query := config.DB.Where("patient_id = ?", patientID).
+		Preload("User")
+	if err := withDateRange(query, "created_at", startDate, endDate).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]TimelineEvent, 0, len(notes))
+	for _, note := range notes {
+		events = append(events, TimelineEvent{
+			ID:   "note-" + strconv.Itoa(int(note.ID)),
+			Type: "note",
+			Date: note.CreatedAt,
+			Data: note,
+		})
+	}
+	return events, nil
+}
+
+func reportTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	var reports []models.Report
+	query := config.DB.Where("patient_id = ?", patientID).
+		Preload("Tags")
+	if err := withDateRange(query, "report_date", startDate, endDate).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]TimelineEvent, 0, len(reports))
+	for _, report := range reports {
+		events = append(events, TimelineEvent{
+			ID:   "report-" + strconv.Itoa(int(report.ID)),
+			Type: "report",
+			Date: report.ReportDate,
+			Data: report,
+		})
+	}
+	return events, nil
+}
+
+type implantTimelineEntry struct {
+	Action       string `json:"action"` // "implanted" or "explanted"
+	Kind         string `json:"kind"`   // "device" or "lead"
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+	Serial       string `json:"serial"`
+	Chamber      string `json:"chamber,omitempty"`
+	Status       string `json:"status"`
+}
+
+func implantTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	var devices []models.ImplantedDevice
+	if err := config.DB.Where("patient_id = ?", patientID).Preload("Device").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	var leads []models.ImplantedLead
+	if err := config.DB.Where("patient_id = ?", patientID).Preload("Lead").Find(&leads).Error; err != nil {
+		return nil, err
+	}
+
+	var events []TimelineEvent
+	add := func(entry implantTimelineEntry, implantedAt time.Time, explantedAt *time.Time) {
+		if timelineInRange(implantedAt, startDate, endDate) {
+			e := entry
+			e.Action = "implanted"
+			events = append(events, TimelineEvent{
+				ID:   fmt.Sprintf("implant-%s-%d-implanted", entry.Kind, entry.ID),
+				Type: "implant",
+				Date: implantedAt,
+				Data: e,
+			})
+		}
+		if explantedAt != nil && timelineInRange(*explantedAt, startDate, endDate) {
+			e := entry
+			e.Action = "explanted"
+			events = append(events, TimelineEvent{
+				ID:   fmt.Sprintf("implant-%s-%d-explanted", entry.Kind, entry.ID),
+				Type: "implant",
+				Date: *explantedAt,
+				Data: e,
+			})
+		}
+	}
+
+	for _, d := range devices {
+		add(implantTimelineEntry{
+			Kind:         "device",
+			ID:           d.ID,
+			Name:         d.Device.Name,
+			Manufacturer: d.Device.Manufacturer,
+			Model:        d.Device.DevModel,
+			Serial:       d.Serial,
+			Status:       d.Status,
+		}, d.ImplantedAt, d.ExplantedAt)
+	}
+	for _, l := range leads {
+		add(implantTimelineEntry{
+			Kind:         "lead",
+			ID:           l.ID,
+			Name:         l.Lead.Name,
+			Manufacturer: l.Lead.Manufacturer,
+			Model:        l.Lead.LeadModel,
+			Serial:       l.Serial,
+			Chamber:      l.Chamber,
+			Status:       l.Status,
+		}, l.ImplantedAt, l.ExplantedAt)
+	}
+	return events, nil
+}
+
+type appointmentTimelineEntry struct {
+	Outcome     string              `json:"outcome"` // "scheduled", "completed", "cancelled" or "missed"
+	Appointment appointmentResponse `json:"appointment"`
+}
+
+// appointmentOutcome reports a scheduled appointment as missed once its start time is past
+// the grace window used by the missed appointments list.
+func appointmentOutcome(appt models.Appointment, now time.Time) string {
+	if appt.Status == models.AppointmentStatusScheduled {
+		grace := time.Duration(config.LoadConfig().MissedGraceMinutes) * time.Minute
+		if appt.StartAt.Before(now.Add(-grace)) {
+			return "missed"
+		}
+	}
+	return string(appt.Status)
+}
+
+func appointmentTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	var appts []models.Appointment
+	query := config.DB.Where("patient_id = ?", patientID).Preload("CreatedBy")
+	if err := withDateRange(query, "start_at", startDate, endDate).Find(&appts).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	events := make([]TimelineEvent, 0, len(appts))
+	for _, appt := range appts {
+		events = append(events, TimelineEvent{
+			ID:   "appointment-" + strconv.Itoa(int(appt.ID)),
+			Type: "appointment",
+			Date: appt.StartAt,
+			Data: appointmentTimelineEntry{Outcome: appointmentOutcome(appt, now), Appointment: toAppointmentResponse(appt)},
+		})
+	}
+	return events, nil
+}
+
+type consentTimelineEntry struct {
+	Action      string               `json:"action"` // "granted", "revoked" or "expired"
+	ConsentID   uint                 `json:"consentId"`
+	ConsentType models.ConsentType   `json:"consentType"`
+	Status      models.ConsentStatus `json:"status"`
+	GrantedBy   string               `json:"grantedBy,omitempty"`
+	RevokedBy   string               `json:"revokedBy,omitempty"`
+	ExpiryDate  *time.Time           `json:"expiryDate,omitempty"`
+	Notes       string               `json:"notes,omitempty"`
+}
+
+func consentTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	consents, err := models.GetPatientConsents(patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var events []TimelineEvent
+	add := func(consent models.PatientConsent, action string, at time.Time) {
+		if !timelineInRange(at, startDate, endDate) {
+			return
+		}
+		events = append(events, TimelineEvent{
+			ID:   fmt.Sprintf("consent-%d-%s", consent.ID, action),
+			Type: "consent",
+			Date: at,
+			Data: consentTimelineEntry{
+				Action:      action,
+				ConsentID:   consent.ID,
+				ConsentType: consent.ConsentType,
+				Status:      consent.Status,
+				GrantedBy:   consent.GrantedBy,
+				RevokedBy:   consent.RevokedBy,
+				ExpiryDate:  consent.ExpiryDate,
+				Notes:       consent.Notes,
+			},
+		})
+	}
+
+	for _, consent := range consents {
+		add(consent, "granted", consent.GrantedDate)
+		if consent.RevokedDate != nil {
+			add(consent, "revoked", *consent.RevokedDate)
+		}
+		// A consent revoked before its expiry never expired
+		if consent.ExpiryDate != nil && consent.ExpiryDate.Before(now) &&
+			(consent.RevokedDate == nil || consent.RevokedDate.After(*consent.ExpiryDate)) {
+			add(consent, "expired", *consent.ExpiryDate)
+		}
+	}
+	return events, nil
+}
+
+type accessTimelineEntry struct {
+	Action           string     `json:"action"` // "approved", "denied" or "expired"
+	RequestID        uint       `json:"requestId"`
+	Scope            string     `json:"scope"`
+	RequesterUserID  uint       `json:"requesterUserId"`
+	RequesterName    string     `json:"requesterName"`
+	ResolvedByUserID *uint      `json:"resolvedByUserId,omitempty"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+	Reason           string     `json:"reason,omitempty"`
+	ResolutionNote   string     `json:"resolutionNote,omitempty"`
+}
+
+func accessTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	var requests []models.AccessRequest
+	err := config.DB.Where("patient_id = ? AND status IN ? AND resolved_at IS NOT NULL", patientID,
+		[]string{models.AccessRequestStatusApproved, models.AccessRequestStatusDenied}).
+		Preload("RequesterUser").
+		Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var events []TimelineEvent
+	add := func(req models.AccessRequest, action string, at time.Time) {
+		if !timelineInRange(at, startDate, endDate) {
+			return
+		}
+		events = append(events, TimelineEvent{
+			ID:   fmt.Sprintf("access-%d-%s", req.ID, action),
+			Type: "access",
+			Date: at,
+			Data: accessTimelineEntry{
+				Action:           action,
+				RequestID:        req.ID,
+				Scope:            req.Scope,
+				RequesterUserID:  req.RequesterUserID,
+				RequesterName:    reviewUserName(&req.RequesterUser),
+				ResolvedByUserID: req.ResolvedByUserID,
+				ExpiresAt:        req.ExpiresAt,
+				Reason:           req.Reason,
+				ResolutionNote:   req.ResolutionNote,
+			},
+		})
+	}
+
+	for _, req := range requests {
+		add(req, req.Status, *req.ResolvedAt)
+		if req.Status == models.AccessRequestStatusApproved && req.ExpiresAt != nil && req.ExpiresAt.Before(now) {
+			add(req, "expired", *req.ExpiresAt)
+		}
+	}
+	return events, nil
+}
+
+func tagTimelineEvents(patientID uint, startDate, endDate *time.Time) ([]TimelineEvent, error) {
+	changes, err := models.GetPatientTagEvents(patientID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]TimelineEvent, 0, len(changes))
+	for _, change := range changes {
+		events = append(events, TimelineEvent{
+			ID:   "tag-" + strconv.Itoa(int(change.ID)),
+			Type: "tag",
+			Date: change.CreatedAt,
+			Data: change,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/security"
+	"github.com/rogerhendricks/goReporter/internal/services"
+)
+
+type waitlistEntryRequest struct {
+	PatientID     *uint   `json:"patientId"`
+	AppointmentID *uint   `json:"appointmentId"` // 0 clears it
+	EarliestDate  *string `json:"earliestDate"`
+	LatestDate    *string `json:"latestDate"`
+	Location      *string `json:"location"`
+	Priority      *string `json:"priority"`
+	Note          *string `json:"note"`
+}
+
+// apply copies the given fields onto the entry and returns a message if it is invalid.
+func (in *waitlistEntryRequest) apply(entry *models.WaitlistEntry) string {
+	if in.PatientID != nil {
+		entry.PatientID = *in.PatientID
+	}
+	if in.AppointmentID != nil {
+		entry.AppointmentID = nil
+		if *in.AppointmentID != 0 {
+			id := *in.AppointmentID
+			entry.AppointmentID = &id
+		}
+	}
+	if in.EarliestDate != nil {
+		entry.EarliestDate = strings.TrimSpace(*in.EarliestDate)
+	}
+	if in.LatestDate != nil {
+		entry.LatestDate = strings.TrimSpace(*in.LatestDate)
+	}
+	if in.Location != nil {
+		entry.Location = models.AppointmentLocation(strings.ToLower(strings.TrimSpace(*in.Location)))
+	}
+	if in.Priority != nil {
+		entry.Priority = models.TaskPriority(strings.ToLower(strings.TrimSpace(*in.Priority)))
+	}
+	if in.Note != nil {
+		entry.Note = strings.TrimSpace(*in.Note)
+	}
+	if msg := entry.Validate(); msg != "" {
+		return msg
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.Patient{}).Where("id = ?", entry.PatientID).Count(&count).Error; err != nil || count == 0 {
+		return "Patient not found"
+	}
+	if entry.AppointmentID != nil {
+		err := config.DB.Model(&models.Appointment{}).
+			Where("id = ? AND patient_id = ? AND status = ?", *entry.AppointmentID, entry.PatientID, models.AppointmentStatusScheduled).
+			Count(&count).Error
+		if err != nil || count == 0 {
+			return "appointmentId must be a scheduled appointment of the patient"
+		}
+	}
+	return ""
+}
+
+// GetWaitlist lists patients waiting for an earlier place, most urgent first. By default
+// only open entries (waiting or offered) are listed.
+func GetWaitlist(c *fiber.Ctx) error {
+	filter := models.WaitlistFilter{
+		Status:   models.WaitlistStatus(c.Query("status")),
+		Location: models.AppointmentLocation(c.Query("location")),
+	}
+	if patientParam := c.Query("patientId"); patientParam != "" {
+		patientID, err := strconv.ParseUint(patientParam, 10, 64)
+		if err != nil || patientID == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patientId"})
+		}
+		filter.PatientID = uint(patientID)
+	}
+
+	entries, err := models.GetWaitlistEntries(filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load waitlist"})
+	}
+	return c.JSON(entries)
+}
+
+// GetWaitlistEntry returns an entry with every offer made to it.
+func GetWaitlistEntry(c *fiber.Ctx) error {
+	entry, status, msg := loadWaitlistEntry(c)
+	if entry == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	return c.JSON(entry)
+}
+
+// CreateWaitlistEntry puts a patient on the waitlist.
+func CreateWaitlistEntry(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	var input waitlistEntryRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	today := time.Now()
+	if tz, err := models.ClinicTimeLocation(); err == nil {
+		today = today.In(tz)
+	}
+	entry := models.WaitlistEntry{
+		EarliestDate: today.Format("2006-01-02"),
+		Location:     models.AppointmentLocationClinic,
+		Priority:     models.TaskPriorityMedium,
+		Status:       models.WaitlistWaiting,
+		CreatedByID:  userID,
+	}
+	if msg := input.apply(&entry); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err := config.DB.Create(&entry).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add to waitlist"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Patient added to waitlist", "INFO", map[string]interface{}{
+		"waitlistEntryId": entry.ID,
+		"patientId":       entry.PatientID,
+	})
+	return c.Status(http.StatusCreated).JSON(entry)
+}
+
+// UpdateWaitlistEntry changes an open entry. An offer already made is not affected.
+func UpdateWaitlistEntry(c *fiber.Ctx) error {
+	entry, status, msg := loadWaitlistEntry(c)
+	if entry == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if entry.Status != models.WaitlistWaiting && entry.Status != models.WaitlistOffered {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Waitlist entry is closed"})
+	}
+
+	var input waitlistEntryRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if msg := input.apply(entry); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	err := config.DB.Model(&models.WaitlistEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+		"patient_id":     entry.PatientID,
+		"appointment_id": entry.AppointmentID,
+		"earliest_date":  entry.EarliestDate,
+		"latest_date":    entry.LatestDate,
+		"location":       entry.Location,
+		"priority":       entry.Priority,
+		"note":           entry.Note,
+	}).Error
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update waitlist entry"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Waitlist entry updated", "INFO", map[string]interface{}{
+		"waitlistEntryId": entry.ID,
+	})
+	updated, _ := models.GetWaitlistEntry(entry.ID)
+	return c.JSON(updated)
+}
+
+// DeleteWaitlistEntry takes a patient off the waitlist. A place held for them is offered to
+// the next patient.
+func DeleteWaitlistEntry(c *fiber.Ctx) error {
+	entry, status, msg := loadWaitlistEntry(c)
+	if entry == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if entry.Status != models.WaitlistWaiting && entry.Status != models.WaitlistOffered {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Waitlist entry is closed"})
+	}
+	if err := services.RemoveWaitlistEntry(entry, time.Now()); err != nil {
+		log.Printf("Error removing waitlist entry %d: %v", entry.ID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove waitlist entry"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataDeletion, "Patient removed from waitlist", "INFO", map[string]interface{}{
+		"waitlistEntryId": entry.ID,
+		"patientId":       entry.PatientID,
+	})
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// AcceptWaitlistOffer books the held place for the patient and returns the appointment.
+func AcceptWaitlistOffer(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	offer, status, msg := loadWaitlistOffer(c)
+	if offer == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	appointment, err := services.AcceptWaitlistOffer(offer, userID, time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrWaitlistOfferClosed) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Offer has already been answered or has expired"})
+		}
+		log.Printf("Error accepting waitlist offer %d: %v", offer.ID, err)
+		return slotBookingError(c, err, "Failed to book waitlist offer")
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Waitlist offer accepted", "INFO", map[string]interface{}{
+		"waitlistOfferId": offer.ID,
+		"appointmentId":   appointment.ID,
+	})
+	booked, err := models.GetAppointmentByID(appointment.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load appointment"})
+	}
+	return c.JSON(toAppointmentResponse(*booked))
+}
+
+// DeclineWaitlistOffer releases the held place to the next patient and puts this one back
+// on the waitlist.
+func DeclineWaitlistOffer(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+	offer, status, msg := loadWaitlistOffer(c)
+	if offer == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := services.DeclineWaitlistOffer(offer, userID, time.Now()); err != nil {
+		if errors.Is(err, models.ErrWaitlistOfferClosed) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Offer has already been answered or has expired"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decline waitlist offer"})
+	}
+
+	security.LogEventFromContext(c, security.EventDataModification, "Waitlist offer declined", "INFO", map[string]interface{}{
+		"waitlistOfferId": offer.ID,
+	})
+	offer.Entry = nil
+	return c.JSON(offer)
+}
+
+// offerFreedSlot offers a place released by an appointment change to the waitlist. The
+// change has already been saved, so failures are only logged.
+func offerFreedSlot(previousSlotID, currentSlotID *uint) {
+	if previousSlotID == nil || (currentSlotID != nil && *currentSlotID == *previousSlotID) {
+		return
+	}
+	if _, err := services.OfferFreedSlot(*previousSlotID, time.Now()); err != nil {
+		log.Printf("Error offering slot %d to the waitlist: %v", *previousSlotID, err)
+	}
+}
+
+func loadWaitlistEntry(c *fiber.Ctx) (*models.WaitlistEntry, int, string) {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid waitlist entry ID"
+	}
+	entry, err := models.GetWaitlistEntry(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to load waitlist entry"
+	}
+	if entry == nil {
+		return nil, http.StatusNotFound, "Waitlist entry not found"
+	}
+	return entry, 0, ""
+}
+
+func loadWaitlistOffer(c *fiber.Ctx) (*models.WaitlistOffer, int, string) {
+	id, err := getUintParam(c, "id")
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid offer ID"
+	}
+	offer, err := models.GetWaitlistOffer(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to load offer"
+	}
+	if offer == nil {
+		return nil, http.StatusNotFound, "Offer not found"
+	}
+	return offer, 0, ""
+}
@@ -243,4 +243,9 @@ func TriggerWebhook(event models.WebhookEvent, data map[string]interface{}) {
 	} else {
 		fmt.Println("Warning: Webhook service not initialized, skipping webhook trigger")
 	}
+
+	// Automation rules react to the same events
+	if models.IsAutomationEvent(event) {
+		go services.RunAutomationRules(event, data, TriggerWebhook)
+	}
 }
@@ -30,6 +30,11 @@ func AuthenticateJWT(c *fiber.Ctx) error {
 		}
 	}
 
+	// Calendar feeds are fetched by calendar apps and authenticated by the token in the URL
+	if strings.HasPrefix(path, "/api/calendar/feed/") {
+		return c.Next()
+	}
+
 	// Skip auth for static files
 	if strings.HasPrefix(path, "/assets/") ||
 		path == "/" || path == "/index.html" {
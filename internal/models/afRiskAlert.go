@@ -0,0 +1,112 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	AFRiskAlertOpen         = "open"
+	AFRiskAlertAcknowledged = "acknowledged"
+)
+
+var ErrInvalidAFRiskAlertStatus = errors.New("invalid AF risk alert status")
+
+// AFRiskAlert flags a report showing new device-detected AF in a patient with an elevated
+// CHA2DS2-VASc score who is not on an anticoagulant.
+type AFRiskAlert struct {
+	gorm.Model
+	ReportID              uint        `json:"reportId" gorm:"not null;uniqueIndex"`
+	PatientID             uint        `json:"patientId" gorm:"not null;index"`
+	BurdenPercent         float64     `json:"burdenPercent"`
+	PreviousBurdenPercent *float64    `json:"previousBurdenPercent"`
+	ThresholdPercent      float64     `json:"thresholdPercent"`
+	CHA2DS2VASc           int         `json:"cha2ds2vasc" gorm:"column:cha2ds2_vasc"`
+	HASBLED               int         `json:"hasbled" gorm:"column:has_bled"`
+	Reasons               StringArray `json:"reasons" gorm:"type:text"`
+	Status                string      `json:"status" gorm:"type:varchar(20);not null;default:'open';index"`
+	AcknowledgedByID      *uint       `json:"acknowledgedById"`
+	AcknowledgedAt        *time.Time  `json:"acknowledgedAt"`
+	AcknowledgeNote       string      `json:"acknowledgeNote" gorm:"type:text"`
+
+	Patient        Patient `json:"-" gorm:"foreignKey:PatientID;constraint:OnDelete:CASCADE"`
+	Report         Report  `json:"-" gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE"`
+	AcknowledgedBy *User   `json:"-" gorm:"foreignKey:AcknowledgedByID"`
+}
+
+// GetAFRiskAlertByReportID returns the alert raised for a report, or nil if there is none.
+func GetAFRiskAlertByReportID(reportID uint) (*AFRiskAlert, error) {
+	var alert AFRiskAlert
+	err := config.DB.Where("report_id = ?", reportID).First(&alert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// GetAFRiskAlertByID retrieves an alert with its patient and acknowledging user.
+func GetAFRiskAlertByID(id uint) (*AFRiskAlert, error) {
+	var alert AFRiskAlert
+	err := config.DB.Preload("Patient").Preload("AcknowledgedBy").First(&alert, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// ListAFRiskAlerts returns alerts newest first. An empty status returns every alert; a
+// non-nil doctorID limits results to that doctor's patients.
+func ListAFRiskAlerts(status string, doctorID *uint, limit, offset int) ([]AFRiskAlert, int64, error) {
+	query := config.DB.Model(&AFRiskAlert{})
+	if status != "" {
+		query = query.Where("af_risk_alerts.status = ?", status)
+	}
+	if doctorID != nil {
+		query = query.Where("af_risk_alerts.patient_id IN (?)",
+			config.DB.Table("patient_doctors").Select("patient_id").
+				Where("doctor_id = ? AND deleted_at IS NULL", *doctorID))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var alerts []AFRiskAlert
+	err := query.Preload("Patient").Preload("AcknowledgedBy").
+		Order("af_risk_alerts.created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&alerts).Error
+	return alerts, total, err
+}
+
+// AcknowledgeAFRiskAlert records that a clinician has reviewed the alert, or reopens it.
+func AcknowledgeAFRiskAlert(id uint, status string, userID uint, note string) error {
+	updates := map[string]interface{}{"status": status, "acknowledge_note": note}
+	switch status {
+	case AFRiskAlertAcknowledged:
+		now := time.Now()
+		updates["acknowledged_by_id"] = userID
+		updates["acknowledged_at"] = now
+	case AFRiskAlertOpen:
+		updates["acknowledged_by_id"] = nil
+		updates["acknowledged_at"] = nil
+	default:
+		return ErrInvalidAFRiskAlertStatus
+	}
+
+	result := config.DB.Model(&AFRiskAlert{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -33,6 +33,7 @@ type AppointmentSlot struct {
 	Location    AppointmentLocation `json:"location" gorm:"type:varchar(32);not null;default:'clinic';uniqueIndex:idx_slot_time_location"`
 	MaxCapacity int                 `json:"maxCapacity" gorm:"not null;default:4"`
 	BookedCount int                 `json:"bookedCount" gorm:"not null;default:0"`
+	FreedAt     *time.Time          `json:"freedAt,omitempty" gorm:"index"` // Last time a booking gave up a place
 	CreatedAt   time.Time           `json:"createdAt"`
 	UpdatedAt   time.Time           `json:"updatedAt"`
 }
@@ -67,6 +68,12 @@ type AppointmentFilter struct {
 	PatientID *uint
 	StartAt   *time.Time
 	EndAt     *time.Time
+
+	// Calendar feeds: appointments booked by a user, those of a doctor's patients (by the
+	// doctor's user ID), and deleted ones so they can be shown as cancelled
+	CreatedByID    *uint
+	DoctorUserID   *uint
+	IncludeDeleted bool
 }
 
 // ListAppointments returns appointments matching the filter criteria.
@@ -74,7 +81,7 @@ func ListAppointments(filter AppointmentFilter) ([]Appointment, error) {
 	query := config.DB.Preload("Patient").Preload("CreatedBy")
 
 	if filter.PatientID != nil {
-		query = query.Where("patient_id = ?", *filter.PatientID)
+		query = query.Where("appointments.patient_id = ?", *filter.PatientID)
 	}
 
 	if filter.StartAt != nil {
@@ -85,6 +92,22 @@ func ListAppointments(filter AppointmentFilter) ([]Appointment, error) {
 		query = query.Where("start_at <= ?", *filter.EndAt)
 	}
 
+	if filter.CreatedByID != nil {
+		query = query.Where("appointments.created_by_id = ?", *filter.CreatedByID)
+	}
+
+	if filter.DoctorUserID != nil {
+		query = query.Select("DISTINCT appointments.*").
+			Joins("JOIN patient_doctors pd ON pd.patient_id = appointments.patient_id AND pd.deleted_at IS NULL").
+			Joins("JOIN doctors d ON d.id = pd.doctor_id").
+			Where("d.user_id = ?", *filter.DoctorUserID).
+			Where("pd.access_expires_at IS NULL OR pd.access_expires_at > ?", time.Now())
+	}
+
+	if filter.IncludeDeleted {
+		query = query.Unscoped()
+	}
+
 	var appointments []Appointment
 	if err := query.Order("start_at ASC").Find(&appointments).Error; err != nil {
 		return nil, err
@@ -116,94 +139,90 @@ func DeleteAppointment(id uint) error {
 	return config.DB.Delete(&Appointment{}, id).Error
 }
 
-// GetOrCreateSlot finds or creates a slot for the given time and location.
-func GetOrCreateSlot(slotTime time.Time, location AppointmentLocation) (*AppointmentSlot, error) {
-	// Round to nearest 15-minute interval
-	roundedTime := roundToNearestSlot(slotTime)
-
-	var slot AppointmentSlot
-	err := config.DB.Where("slot_time = ? AND location = ?", roundedTime, location).First(&slot).Error
-
-	if err == nil {
-		return &slot, nil
-	}
-
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
-	}
-
-	// Create new slot
-	slot = AppointmentSlot{
-		SlotTime:    roundedTime,
-		Location:    location,
-		MaxCapacity: 4,
-		BookedCount: 0,
-	}
-
-	if err := config.DB.Create(&slot).Error; err != nil {
-		return nil, err
-	}
-
-	return &slot, nil
-}
-
-// CheckSlotAvailability checks if a slot has available capacity.
+// CheckSlotAvailability checks if the scheduled slot at the given time has capacity left.
+// Times outside the clinic schedule are unavailable.
 func CheckSlotAvailability(slotTime time.Time, location AppointmentLocation) (bool, int, error) {
 	if location != AppointmentLocationClinic {
 		// Non-clinic locations don't use slots
 		return true, -1, nil
 	}
 
-	roundedTime := roundToNearestSlot(slotTime)
+	scheduled, err := FindScheduledSlot(slotTime, location)
+	if err != nil || scheduled == nil {
+		return false, 0, err
+	}
 
 	var slot AppointmentSlot
-	err := config.DB.Where("slot_time = ? AND location = ?", roundedTime, location).First(&slot).Error
+	err = config.DB.Where("slot_time = ? AND location = ?", scheduled.SlotTime.UTC(), location).First(&slot).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Slot doesn't exist yet, so it's available
-		return true, 4, nil
+		return true, scheduled.Capacity, nil
 	}
 
+	if err != nil {
+		return false, 0, err
+	}
+	held, err := countHeldPlaces(config.DB, []uint{slot.ID}, time.Now(), 0)
 	if err != nil {
 		return false, 0, err
 	}
 
-	available := slot.BookedCount < slot.MaxCapacity
-	remaining := slot.MaxCapacity - slot.BookedCount
-	return available, remaining, nil
+	remaining := scheduled.Capacity - slot.BookedCount - held[slot.ID]
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining > 0, remaining, nil
 }
 
-// IncrementSlotBooking increments the booked count for a slot.
-func IncrementSlotBooking(slotID uint) error {
-	return config.DB.Model(&AppointmentSlot{}).
-		Where("id = ? AND booked_count < max_capacity", slotID).
-		Update("booked_count", gorm.Expr("booked_count + 1")).Error
+// SlotAvailability is a scheduled slot with its bookings.
+type SlotAvailability struct {
+	ScheduledSlot
+	Booked    int `json:"booked"`
+	Held      int `json:"held"` // Places held for waitlist offers
+	Remaining int `json:"remaining"`
 }
 
-// DecrementSlotBooking decrements the booked count for a slot.
-func DecrementSlotBooking(slotID uint) error {
-	return config.DB.Model(&AppointmentSlot{}).
-		Where("id = ? AND booked_count > 0", slotID).
-		Update("booked_count", gorm.Expr("booked_count - 1")).Error
-}
+// GetAvailableSlots returns the scheduled slots in a date range with their remaining
+// capacity, including full ones. Places held for waitlist offers are not available.
+func GetAvailableSlots(start, end time.Time, location AppointmentLocation) ([]SlotAvailability, error) {
+	scheduled, err := ScheduleSlots(location, start, end)
+	if err != nil || len(scheduled) == 0 {
+		return nil, err
+	}
 
-// GetAvailableSlots returns available slots for a date range.
-func GetAvailableSlots(start, end time.Time, location AppointmentLocation) ([]AppointmentSlot, error) {
 	var slots []AppointmentSlot
-	err := config.DB.Where("slot_time >= ? AND slot_time < ? AND location = ?", start, end, location).
-		Order("slot_time ASC").
+	err = config.DB.Where("slot_time >= ? AND slot_time < ? AND location = ?", start.UTC(), end.UTC(), location).
 		Find(&slots).Error
-	return slots, err
-}
-
-// RoundToNearestSlot rounds a time to the nearest 15-minute interval.
-func RoundToNearestSlot(t time.Time) time.Time {
-	minutes := t.Minute()
-	roundedMinutes := (minutes / 15) * 15
-	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), roundedMinutes, 0, 0, t.Location())
-}
+	if err != nil {
+		return nil, err
+	}
+	slotIDs := make([]uint, 0, len(slots))
+	for _, slot := range slots {
+		slotIDs = append(slotIDs, slot.ID)
+	}
+	held, err := countHeldPlaces(config.DB, slotIDs, time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[int64]AppointmentSlot, len(slots))
+	for _, slot := range slots {
+		stored[slot.SlotTime.Unix()] = slot
+	}
 
-// roundToNearestSlot is the internal version (kept for backwards compatibility)
-func roundToNearestSlot(t time.Time) time.Time {
-	return RoundToNearestSlot(t)
+	result := make([]SlotAvailability, 0, len(scheduled))
+	for _, s := range scheduled {
+		slot := stored[s.SlotTime.Unix()]
+		remaining := s.Capacity - slot.BookedCount - held[slot.ID]
+		if remaining < 0 {
+			remaining = 0
+		}
+		result = append(result, SlotAvailability{
+			ScheduledSlot: s,
+			Booked:        slot.BookedCount,
+			Held:          held[slot.ID],
+			Remaining:     remaining,
+		})
+	}
+	return result, nil
 }
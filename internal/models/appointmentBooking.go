@@ -0,0 +1,298 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSlotFull is returned when the slot an appointment needs has no places left.
+var ErrSlotFull = errors.New("no available places in this slot")
+
+// slotBookingMu serialises slot bookings on SQLite. It has no row locks, and two write
+// transactions that both read first fail with "database is locked" instead of waiting.
+var slotBookingMu sync.Mutex
+
+func lockSlotBooking(db *gorm.DB) func() {
+	if db.Dialector.Name() != "sqlite" {
+		return func() {}
+	}
+	slotBookingMu.Lock()
+	return slotBookingMu.Unlock
+}
+
+// forUpdate locks the rows the query reads until the transaction ends. Only Postgres needs
+// it; on SQLite lockSlotBooking already keeps other bookings out.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() == "postgres" {
+		return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return tx
+}
+
+// HoldsSlot reports whether the appointment takes a place in a clinic slot.
+func (a *Appointment) HoldsSlot() bool {
+	return a.Location == AppointmentLocationClinic && a.Status != AppointmentStatusCancelled
+}
+
+// SaveAppointmentBooking creates or updates an appointment together with its slot booking,
+// in one transaction. With rebook set, a clinic appointment is booked into the scheduled
+// slot its start falls in and any slot it held before is released; cancelled and
+// non-clinic appointments hold no slot. Without it only the appointment is saved, so
+// editing its details never fails on a schedule that changed since it was booked.
+//
+// A slot's count is only raised while it has a place that is neither booked nor held for a
+// waitlist offer, and the appointment and slot rows are locked first, so concurrent
+// bookings cannot overbook a slot or release one twice. A clinic appointment is also
+// allocated the rooms, staff and programmers it needs, failing with a
+// ResourceUnavailableError if one is taken. It returns the places left in the
+// appointment's slot, or -1 when it holds none.
+func SaveAppointmentBooking(appointment *Appointment, rebook bool) (int, error) {
+	if !rebook {
+		return -1, config.DB.Omit(clause.Associations).Save(appointment).Error
+	}
+	return saveAppointmentBooking(appointment, nil, time.Now())
+}
+
+// saveAppointmentBooking books the appointment into its slot. When offer is set the
+// appointment takes the place held for it, and the offer is accepted in the same
+// transaction.
+func saveAppointmentBooking(appointment *Appointment, offer *WaitlistOffer, now time.Time) (int, error) {
+	var acceptingID uint
+	if offer != nil {
+		acceptingID = offer.ID
+	}
+
+	var scheduled *ScheduledSlot
+	if appointment.HoldsSlot() {
+		var err error
+		if scheduled, err = FindScheduledSlot(appointment.StartAt, appointment.Location); err != nil {
+			return 0, err
+		}
+		if scheduled == nil {
+			return 0, ErrSlotNotScheduled
+		}
+		// Clinic appointments without an end time end with their slot
+		if appointment.EndAt == nil {
+			end := scheduled.EndTime.UTC()
+			appointment.EndAt = &end
+		}
+	}
+
+	unlock := lockSlotBooking(config.DB)
+	defer unlock()
+
+	remaining := -1
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// The slot the appointment holds now, which a concurrent change may have moved
+		var previousSlotID *uint
+		if appointment.ID != 0 {
+			var current Appointment
+			if err := forUpdate(tx).Select("id", "slot_id").First(&current, appointment.ID).Error; err != nil {
+				return err
+			}
+			previousSlotID = current.SlotID
+		}
+
+		var slot *AppointmentSlot
+		if scheduled != nil {
+			var err error
+			if slot, err = lockSlot(tx, scheduled, appointment.Location); err != nil {
+				return err
+			}
+		}
+
+		if slot == nil || previousSlotID == nil || *previousSlotID != slot.ID {
+			if previousSlotID != nil {
+				if err := releaseSlot(tx, *previousSlotID); err != nil {
+					return err
+				}
+			}
+			if slot != nil {
+				result := tx.Model(&AppointmentSlot{}).
+					Where("id = ? AND booked_count + "+heldSlotPlaces+" < max_capacity",
+						slot.ID, WaitlistOfferPending, now, acceptingID).
+					Update("booked_count", gorm.Expr("booked_count + 1"))
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return ErrSlotFull
+				}
+				slot.BookedCount++
+			}
+		}
+
+		appointment.SlotID = nil
+		if slot != nil {
+			held, err := countHeldPlaces(tx, []uint{slot.ID}, now, acceptingID)
+			if err != nil {
+				return err
+			}
+			appointment.SlotID = &slot.ID
+			remaining = slot.MaxCapacity - slot.BookedCount - held[slot.ID]
+			if remaining < 0 {
+				remaining = 0
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(appointment).Error; err != nil {
+			return err
+		}
+		if err := allocateResources(tx, appointment); err != nil {
+			return err
+		}
+		if offer != nil {
+			return acceptWaitlistOffer(tx, offer, appointment.ID, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return remaining, nil
+}
+
+// DeleteAppointmentBooking deletes an appointment and releases its slot and resources in one
+// transaction. Deleting an appointment that is already gone releases nothing.
+func DeleteAppointmentBooking(id uint) error {
+	unlock := lockSlotBooking(config.DB)
+	defer unlock()
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var appointment Appointment
+		if err := forUpdate(tx).Select("id", "slot_id").First(&appointment, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Appointment{}, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("appointment_id = ?", id).Delete(&AppointmentResource{}).Error; err != nil {
+			return err
+		}
+		if appointment.SlotID == nil {
+			return nil
+		}
+		return releaseSlot(tx, *appointment.SlotID)
+	})
+}
+
+// lockSlot returns the stored slot for a scheduled one, creating it if needed, locked for
+// the rest of the transaction. Its capacity follows the schedule, which may have changed
+// since the slot was created.
+func lockSlot(tx *gorm.DB, scheduled *ScheduledSlot, location AppointmentLocation) (*AppointmentSlot, error) {
+	slotTime := scheduled.SlotTime.UTC()
+
+	// Concurrent first bookings may both create the slot; the unique index keeps one
+	created := AppointmentSlot{SlotTime: slotTime, Location: location, MaxCapacity: scheduled.Capacity}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&created).Error; err != nil {
+		return nil, err
+	}
+
+	var slot AppointmentSlot
+	if err := forUpdate(tx).Where("slot_time = ? AND location = ?", slotTime, location).First(&slot).Error; err != nil {
+		return nil, err
+	}
+	if slot.MaxCapacity != scheduled.Capacity {
+		if err := tx.Model(&slot).Update("max_capacity", scheduled.Capacity).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &slot, nil
+}
+
+// heldSlotPlaces counts the places in the slot of the outer query held for open waitlist
+// offers, other than the offer being accepted. Holds lapse when their offer expires.
+const heldSlotPlaces = `(SELECT COUNT(*) FROM waitlist_offers o
+	WHERE o.slot_id = appointment_slots.id AND o.status = ? AND o.expires_at > ? AND o.id <> ?)`
+
+// countHeldPlaces returns the places held for open waitlist offers in each of the slots,
+// ignoring the offer with exceptOfferID.
+func countHeldPlaces(db *gorm.DB, slotIDs []uint, now time.Time, exceptOfferID uint) (map[uint]int, error) {
+	var rows []struct {
+		SlotID uint
+		Held   int
+	}
+	held := make(map[uint]int)
+	if len(slotIDs) == 0 {
+		return held, nil
+	}
+	err := db.Model(&WaitlistOffer{}).Select("slot_id, COUNT(*) AS held").
+		Where("slot_id IN ? AND status = ? AND expires_at > ? AND id <> ?", slotIDs, WaitlistOfferPending, now, exceptOfferID).
+		Group("slot_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		held[row.SlotID] = row.Held
+	}
+	return held, nil
+}
+
+func releaseSlot(tx *gorm.DB, slotID uint) error {
+	return tx.Model(&AppointmentSlot{}).
+		Where("id = ? AND booked_count > 0", slotID).
+		Updates(map[string]interface{}{
+			"booked_count": gorm.Expr("booked_count - 1"),
+			"freed_at":     time.Now(),
+		}).Error
+}
+
+// liveSlotBookings counts the appointments holding a place in the slot of the outer query.
+const liveSlotBookings = `(SELECT COUNT(*) FROM appointments a
+	WHERE a.slot_id = appointment_slots.id AND a.deleted_at IS NULL AND a.location = ? AND a.status <> ?)`
+
+// ReconcileSlotBookings recomputes the booked count of every slot that disagrees with the
+// live clinic appointments booked into it, and returns how many slots it corrected. Each
+// slot is fixed in its own transaction with the slot locked, so bookings made meanwhile
+// are counted correctly.
+func ReconcileSlotBookings() (int, error) {
+	var ids []uint
+	err := config.DB.Model(&AppointmentSlot{}).
+		Where("booked_count <> "+liveSlotBookings, AppointmentLocationClinic, AppointmentStatusCancelled).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	for _, id := range ids {
+		corrected, err := reconcileSlot(id)
+		if err != nil {
+			return fixed, err
+		}
+		if corrected {
+			fixed++
+		}
+	}
+	return fixed, nil
+}
+
+func reconcileSlot(id uint) (bool, error) {
+	unlock := lockSlotBooking(config.DB)
+	defer unlock()
+
+	corrected := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var slot AppointmentSlot
+		if err := forUpdate(tx).First(&slot, id).Error; err != nil {
+			return err
+		}
+		var live int64
+		err := tx.Model(&Appointment{}).
+			Where("slot_id = ? AND location = ? AND status <> ?", id, AppointmentLocationClinic, AppointmentStatusCancelled).
+			Count(&live).Error
+		if err != nil {
+			return err
+		}
+		if int(live) == slot.BookedCount {
+			return nil
+		}
+		corrected = true
+		return tx.Model(&slot).Update("booked_count", live).Error
+	})
+	return corrected, err
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// AutomationEvents are the events automation rules can react to. Task creation and
+// escalation are left out so rules cannot trigger each other in a loop.
+var AutomationEvents = []WebhookEvent{
+	EventReportCreated,
+	EventReportCompleted,
+	EventReportReviewed,
+	EventReportAFRisk,
+	EventBatteryLow,
+	EventBatteryCritical,
+	EventTaskOverdue,
+	EventTaskCompleted,
+	EventConsentExpiring,
+	EventConsentExpired,
+	EventConsentRevoked,
+	EventDeviceImplanted,
+	EventDeviceExplanted,
+}
+
+// IsAutomationEvent reports whether rules can be written for event.
+func IsAutomationEvent(event WebhookEvent) bool {
+	for _, e := range AutomationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	ConditionEquals      = "eq"
+	ConditionNotEquals   = "neq"
+	ConditionGreater     = "gt"
+	ConditionGreaterOrEq = "gte"
+	ConditionLess        = "lt"
+	ConditionLessOrEq    = "lte"
+	ConditionIn          = "in"
+	ConditionContains    = "contains"
+	ConditionExists      = "exists"
+)
+
+// AutomationCondition compares one field of the event payload with Value. Text comparisons
+// ignore case; numbers compare numerically.
+type AutomationCondition struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// AutomationConditions is stored as a JSON array.
+type AutomationConditions []AutomationCondition
+
+// Scan implements the sql.Scanner interface
+func (c *AutomationConditions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = AutomationConditions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return errors.New("failed to unmarshal AutomationConditions value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (c AutomationConditions) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// AutomationRule creates a task from a template when its event occurs and every condition
+// matches. In dry-run mode it only logs what it would have done.
+type AutomationRule struct {
+	gorm.Model
+	Name           string               `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Description    string               `json:"description" gorm:"type:text"`
+	Enabled        bool                 `json:"enabled" gorm:"default:true"`
+	DryRun         bool                 `json:"dryRun" gorm:"default:false"`
+	Event          WebhookEvent         `json:"event" gorm:"type:varchar(50);not null;index"`
+	Conditions     AutomationConditions `json:"conditions" gorm:"type:text"`
+	TemplateID     uint                 `json:"templateId" gorm:"not null"`
+	Template       *TaskTemplate        `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
+	AssignToUserID *uint                `json:"assignToUserId"`
+	AssignToTeamID *uint                `json:"assignToTeamId"`
+	DueInDays      *int                 `json:"dueInDays"`                   // Overrides the template's DaysUntilDue
+	CreatedByID    uint                 `json:"createdById" gorm:"not null"` // Tasks are created as this user
+}
+
+const (
+	AutomationCreated     = "created"
+	AutomationWouldCreate = "would_create" // Dry run
+	AutomationSkipped     = "skipped"
+	AutomationFailed      = "failed"
+)
+
+// AutomationExecution logs a rule whose conditions matched an event.
+type AutomationExecution struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	RuleID    uint         `json:"ruleId" gorm:"not null;index"`
+	Event     WebhookEvent `json:"event" gorm:"type:varchar(50);not null"`
+	PatientID *uint        `json:"patientId" gorm:"index"`
+	Status    string       `json:"status" gorm:"type:varchar(20);not null"`
+	TaskID    *uint        `json:"taskId"`
+	Message   string       `json:"message" gorm:"type:text"`
+	EventData string       `json:"eventData" gorm:"type:text"`
+	CreatedAt time.Time    `json:"createdAt" gorm:"index"`
+}
+
+// Normalize checks the rule's event, conditions and assignment.
+func (r *AutomationRule) Normalize() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if !IsAutomationEvent(r.Event) {
+		return fmt.Errorf("unsupported event %q", r.Event)
+	}
+	if r.TemplateID == 0 {
+		return errors.New("templateId is required")
+	}
+	if r.AssignToUserID != nil && r.AssignToTeamID != nil {
+		return errors.New("assign to a user or a team, not both")
+	}
+	if r.DueInDays != nil && *r.DueInDays < 0 {
+		return errors.New("dueInDays cannot be negative")
+	}
+	for i := range r.Conditions {
+		condition := &r.Conditions[i]
+		condition.Field = strings.TrimSpace(condition.Field)
+		if condition.Field == "" {
+			return errors.New("condition field is required")
+		}
+		switch condition.Operator {
+		case ConditionEquals, ConditionNotEquals, ConditionContains, ConditionExists:
+		case ConditionGreater, ConditionGreaterOrEq, ConditionLess, ConditionLessOrEq:
+			if _, ok := conditionNumber(condition.Value); !ok {
+				return fmt.Errorf("condition on %s needs a numeric value", condition.Field)
+			}
+		case ConditionIn:
+			if _, ok := condition.Value.([]interface{}); !ok {
+				return fmt.Errorf("condition on %s needs a list of values", condition.Field)
+			}
+		default:
+			return fmt.Errorf("unknown operator %q", condition.Operator)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether every condition holds for the event payload.
+func (r *AutomationRule) Matches(data map[string]interface{}) bool {
+	for _, condition := range r.Conditions {
+		if !condition.Matches(data) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches evaluates the condition against the event payload. Missing fields only match
+// "neq" and a false "exists".
+func (c AutomationCondition) Matches(data map[string]interface{}) bool {
+	actual, present := conditionField(data, c.Field)
+	switch c.Operator {
+	case ConditionExists:
+		want, ok := c.Value.(bool)
+		if !ok {
+			want = true
+		}
+		return present == want
+	case ConditionNotEquals:
+		return !present || !conditionEqual(actual, c.Value)
+	}
+	if !present {
+		return false
+	}
+
+	switch c.Operator {
+	case ConditionEquals:
+		return conditionEqual(actual, c.Value)
+	case ConditionIn:
+		values, _ := c.Value.([]interface{})
+		for _, value := range values {
+			if conditionEqual(actual, value) {
+				return true
+			}
+		}
+		return false
+	case ConditionContains:
+		return strings.Contains(strings.ToLower(fmt.Sprint(actual)), strings.ToLower(fmt.Sprint(c.Value)))
+	}
+
+	a, ok := conditionNumber(actual)
+	b, ok2 := conditionNumber(c.Value)
+	if !ok || !ok2 {
+		return false
+	}
+	switch c.Operator {
+	case ConditionGreater:
+		return a > b
+	case ConditionGreaterOrEq:
+		return a >= b
+	case ConditionLess:
+		return a < b
+	case ConditionLessOrEq:
+		return a <= b
+	}
+	return false
+}
+
+// conditionField reads a payload field, dereferencing pointers. Nil values count as missing.
+func conditionField(data map[string]interface{}, field string) (interface{}, bool) {
+	value, ok := data[field]
+	if !ok || value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	return v.Interface(), true
+}
+
+func conditionEqual(actual, expected interface{}) bool {
+	a, ok := conditionNumber(actual)
+	b, ok2 := conditionNumber(expected)
+	if ok && ok2 {
+		return a == b
+	}
+	return strings.EqualFold(fmt.Sprint(actual), fmt.Sprint(expected))
+}
+
+// conditionNumber converts numbers, and strings holding numbers, to float64.
+func conditionNumber(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// GetAutomationRules lists rules, oldest first.
+func GetAutomationRules() ([]AutomationRule, error) {
+	var rules []AutomationRule
+	err := config.DB.Preload("Template").Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetAutomationRule returns a rule, or nil if it does not exist.
+func GetAutomationRule(id uint) (*AutomationRule, error) {
+	var rule AutomationRule
+	err := config.DB.Preload("Template").First(&rule, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetEnabledAutomationRules returns the enabled rules for an event, oldest first.
+func GetEnabledAutomationRules(event WebhookEvent) ([]AutomationRule, error) {
+	var rules []AutomationRule
+	err := config.DB.Where("event = ? AND enabled = ?", event, true).Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// DeleteAutomationRule removes a rule outright so its name can be reused. Its execution log
+// is kept.
+func DeleteAutomationRule(id uint) error {
+	result := config.DB.Unscoped().Delete(&AutomationRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAutomationExecutions returns the execution log, newest first, optionally for one rule.
+func GetAutomationExecutions(ruleID *uint, limit, offset int) ([]AutomationExecution, int64, error) {
+	query := config.DB.Model(&AutomationExecution{})
+	if ruleID != nil {
+		query = query.Where("rule_id = ?", *ruleID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var executions []AutomationExecution
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&executions).Error
+	return executions, total, err
+}
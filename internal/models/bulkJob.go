@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// Bulk job states.
+const (
+	BulkJobQueued    = "queued"
+	BulkJobRunning   = "running"
+	BulkJobCompleted = "completed"
+	BulkJobFailed    = "failed"
+)
+
+// Bulk item outcomes. An item is skipped when it already had the requested state.
+const (
+	BulkItemSucceeded = "succeeded"
+	BulkItemSkipped   = "skipped"
+	BulkItemFailed    = "failed"
+)
+
+// BulkItemResult is the outcome of a bulk action for one item.
+type BulkItemResult struct {
+	ID      uint   `json:"id"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkItemResults is stored as a JSON array.
+type BulkItemResults []BulkItemResult
+
+// Scan implements the sql.Scanner interface
+func (r *BulkItemResults) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = BulkItemResults{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return errors.New("failed to unmarshal BulkItemResults value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (r BulkItemResults) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(r)
+	return string(b), err
+}
+
+// BulkJob tracks a bulk action on tasks, patients or reports. Small batches finish within
+// the request; large ones run in the background and report their progress here. Results
+// are filled in when the job finishes.
+type BulkJob struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	Action     string          `json:"action" gorm:"type:varchar(50);not null"`
+	UserID     uint            `json:"userId" gorm:"not null;index"`
+	Status     string          `json:"status" gorm:"type:varchar(20);not null;default:'queued';index"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	Succeeded  int             `json:"succeeded"`
+	Skipped    int             `json:"skipped"`
+	Failed     int             `json:"failed"`
+	Results    BulkItemResults `json:"results" gorm:"type:text"`
+	Error      string          `json:"error,omitempty" gorm:"type:text"`
+	OutputName string          `json:"outputName,omitempty" gorm:"type:varchar(255)"`
+	Output     []byte          `json:"-"` // Exported CSV
+	StartedAt  *time.Time      `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *BulkJob) Done() bool {
+	return j.Status == BulkJobCompleted || j.Status == BulkJobFailed
+}
+
+// GetBulkJob returns a job without its export output, or nil if it does not exist.
+func GetBulkJob(id uint) (*BulkJob, error) {
+	var job BulkJob
+	err := config.DB.Omit("output").First(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetBulkJobOutput returns the CSV a finished export job produced.
+func GetBulkJobOutput(id uint) ([]byte, error) {
+	var job BulkJob
+	err := config.DB.Select("id", "output").First(&job, id).Error
+	return job.Output, err
+}
+
+// GetUserBulkJobs returns a user's most recent jobs, without results or output.
+func GetUserBulkJobs(userID uint, limit int) ([]BulkJob, error) {
+	var jobs []BulkJob
+	err := config.DB.Omit("results", "output").
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// SaveBulkJobProgress stores the job's state and counters. Results and output are only
+// written once the job is done.
+func SaveBulkJobProgress(job *BulkJob) error {
+	updates := map[string]interface{}{
+		"status":      job.Status,
+		"processed":   job.Processed,
+		"succeeded":   job.Succeeded,
+		"skipped":     job.Skipped,
+		"failed":      job.Failed,
+		"error":       job.Error,
+		"started_at":  job.StartedAt,
+		"finished_at": job.FinishedAt,
+	}
+	if job.Done() {
+		updates["results"] = job.Results
+		updates["output_name"] = job.OutputName
+		updates["output"] = job.Output
+	}
+	return config.DB.Model(&BulkJob{}).Where("id = ?", job.ID).Updates(updates).Error
+}
+
+// FailInterruptedBulkJobs marks jobs left queued or running by a previous run of the server
+// as failed. Call it at startup, before any new job starts.
+func FailInterruptedBulkJobs() (int64, error) {
+	result := config.DB.Model(&BulkJob{}).
+		Where("status IN ?", []string{BulkJobQueued, BulkJobRunning}).
+		Updates(map[string]interface{}{
+			"status":      BulkJobFailed,
+			"error":       "Interrupted by a server restart",
+			"finished_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
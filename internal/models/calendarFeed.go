@@ -0,0 +1,148 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+)
+
+// Calendar feed privacy levels, from least to most detail. Busy feeds only show that the
+// time is taken; limited feeds add titles and patient initials; full feeds add patient
+// names, MRNs and descriptions.
+const (
+	FeedPrivacyBusy    = "busy"
+	FeedPrivacyLimited = "limited"
+	FeedPrivacyFull    = "full"
+)
+
+// Which appointments a calendar feed covers besides the doctor's patients.
+const (
+	FeedAppointmentsNone   = "none"
+	FeedAppointmentsMine   = "mine"   // Booked by the user
+	FeedAppointmentsClinic = "clinic" // Every appointment, for staff who see all patients
+)
+
+// FeedPrivacyRank orders privacy levels; unknown levels rank as busy.
+func FeedPrivacyRank(level string) int {
+	switch level {
+	case FeedPrivacyLimited:
+		return 1
+	case FeedPrivacyFull:
+		return 2
+	}
+	return 0
+}
+
+// IsFeedPrivacyLevel reports whether level is a known privacy level.
+func IsFeedPrivacyLevel(level string) bool {
+	return level == FeedPrivacyBusy || level == FeedPrivacyLimited || level == FeedPrivacyFull
+}
+
+// CalendarFeed is a user's iCalendar subscription. Calendar apps fetch it with a secret
+// token in the URL; only the token's hash is stored.
+type CalendarFeed struct {
+	ID                         uint       `json:"id" gorm:"primaryKey"`
+	UserID                     uint       `json:"userId" gorm:"not null;index"`
+	Name                       string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash                  string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	TokenHint                  string     `json:"tokenHint" gorm:"type:varchar(8)"` // Start of the token, to tell feeds apart
+	PrivacyLevel               string     `json:"privacyLevel" gorm:"type:varchar(20);not null;default:'busy'"`
+	Appointments               string     `json:"appointments" gorm:"type:varchar(20);not null;default:'mine'"`
+	IncludePatientAppointments bool       `json:"includePatientAppointments"`
+	IncludeTasks               bool       `json:"includeTasks"`
+	LastAccessedAt             *time.Time `json:"lastAccessedAt"`
+	RevokedAt                  *time.Time `json:"revokedAt,omitempty" gorm:"index"`
+	CreatedAt                  time.Time  `json:"createdAt"`
+	UpdatedAt                  time.Time  `json:"updatedAt"`
+}
+
+// NewCalendarFeedToken returns a random feed token and its hash.
+func NewCalendarFeedToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashCalendarFeedToken(token), nil
+}
+
+// HashCalendarFeedToken returns the stored form of a feed token.
+func HashCalendarFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetCalendarFeedByToken returns the active feed with the token, or nil.
+func GetCalendarFeedByToken(token string) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := config.DB.Where("token_hash = ? AND revoked_at IS NULL", HashCalendarFeedToken(token)).
+		Limit(1).Find(&feed).Error
+	if err != nil || feed.ID == 0 {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// GetCalendarFeed returns one of a user's active feeds, or nil.
+func GetCalendarFeed(userID, id uint) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := config.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).Limit(1).Find(&feed).Error
+	if err != nil || feed.ID == 0 {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// GetUserCalendarFeeds returns a user's active feeds.
+func GetUserCalendarFeeds(userID uint) ([]CalendarFeed, error) {
+	var feeds []CalendarFeed
+	err := config.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at ASC, id ASC").Find(&feeds).Error
+	return feeds, err
+}
+
+// RotateCalendarFeedToken gives a feed a new token, so the old URL stops working. It
+// returns the new token.
+func RotateCalendarFeedToken(feed *CalendarFeed) (string, error) {
+	token, hash, err := NewCalendarFeedToken()
+	if err != nil {
+		return "", err
+	}
+	err = config.DB.Model(feed).Updates(map[string]interface{}{
+		"token_hash": hash,
+		"token_hint": token[:8],
+	}).Error
+	return token, err
+}
+
+// RevokeCalendarFeeds revokes a user's active feeds, or only the one given. It returns how
+// many were revoked.
+func RevokeCalendarFeeds(userID uint, id *uint) (int64, error) {
+	query := config.DB.Model(&CalendarFeed{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if id != nil {
+		query = query.Where("id = ?", *id)
+	}
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// TouchCalendarFeed records that a calendar app fetched the feed.
+func TouchCalendarFeed(id uint, at time.Time) error {
+	return config.DB.Model(&CalendarFeed{}).Where("id = ?", id).UpdateColumn("last_accessed_at", at).Error
+}
+
+// GetCalendarTasks returns tasks due in [from, to) that are assigned to the user or to one
+// of the user's teams. Deleted tasks are included so feeds can show them as cancelled.
+func GetCalendarTasks(userID uint, from, to time.Time) ([]Task, error) {
+	var tasks []Task
+	err := config.DB.Unscoped().Preload("Patient").
+		Where("due_date >= ? AND due_date < ?", from, to).
+		Where("assigned_to_id = ? OR assigned_to_team_id IN (?)", userID,
+			config.DB.Table("team_members").Select("team_id").Where("user_id = ?", userID)).
+		Order("due_date ASC, id ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
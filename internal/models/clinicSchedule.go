@@ -0,0 +1,360 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// Clinic closure kinds. Both close the location for whole days; the kind is informational.
+const (
+	ClinicClosureHoliday  = "holiday"
+	ClinicClosureBlackout = "blackout"
+)
+
+// ErrSlotNotScheduled is returned when booking a time no clinic session covers.
+var ErrSlotNotScheduled = errors.New("no clinic session at this time")
+
+// ClinicSession is a weekly session template: on the given weekday the location takes
+// bookings from StartTime to EndTime in slots of SlotMinutes, each for Capacity patients.
+// Times are "15:04" in the clinic timezone. A weekday may have several sessions.
+type ClinicSession struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	Name        string              `json:"name" gorm:"type:varchar(100)"`
+	Location    AppointmentLocation `json:"location" gorm:"type:varchar(32);not null;default:'clinic';index:idx_clinic_session_day"`
+	Weekday     time.Weekday        `json:"weekday" gorm:"not null;index:idx_clinic_session_day"` // 0 = Sunday
+	StartTime   string              `json:"startTime" gorm:"type:varchar(5);not null"`
+	EndTime     string              `json:"endTime" gorm:"type:varchar(5);not null"`
+	SlotMinutes int                 `json:"slotMinutes" gorm:"not null;default:15"`
+	Capacity    int                 `json:"capacity" gorm:"not null;default:4"`
+	Active      bool                `json:"active" gorm:"not null"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// ClinicClosure closes a location, or every location when Location is empty, from
+// StartDate to EndDate inclusive. Dates are "2006-01-02" in the clinic timezone.
+type ClinicClosure struct {
+	ID        uint                `json:"id" gorm:"primaryKey"`
+	Location  AppointmentLocation `json:"location,omitempty" gorm:"type:varchar(32);index"`
+	StartDate string              `json:"startDate" gorm:"type:varchar(10);not null;index"`
+	EndDate   string              `json:"endDate" gorm:"type:varchar(10);not null;index"`
+	Kind      string              `json:"kind" gorm:"type:varchar(20);not null;default:'blackout'"`
+	Reason    string              `json:"reason" gorm:"type:varchar(255)"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+// ClinicSessionOverride changes the schedule on one date. With a SessionID it changes that
+// template session: cancels it, or replaces its hours, slot length or capacity. Without
+// one it adds an extra session at the location, which needs StartTime and EndTime.
+type ClinicSessionOverride struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	Date        string              `json:"date" gorm:"type:varchar(10);not null;index"`
+	Location    AppointmentLocation `json:"location" gorm:"type:varchar(32);not null;default:'clinic'"`
+	SessionID   *uint               `json:"sessionId,omitempty" gorm:"index"`
+	Cancelled   bool                `json:"cancelled"`
+	StartTime   *string             `json:"startTime,omitempty" gorm:"type:varchar(5)"`
+	EndTime     *string             `json:"endTime,omitempty" gorm:"type:varchar(5)"`
+	SlotMinutes *int                `json:"slotMinutes,omitempty"`
+	Capacity    *int                `json:"capacity,omitempty"`
+	Reason      string              `json:"reason" gorm:"type:varchar(255)"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// ScheduledSlot is a bookable slot derived from the session templates.
+type ScheduledSlot struct {
+	SlotTime  time.Time `json:"slotTime"`
+	EndTime   time.Time `json:"endTime"`
+	Capacity  int       `json:"capacity"`
+	SessionID *uint     `json:"sessionId,omitempty"` // Nil for extra sessions added by an override
+}
+
+// ClinicTimeLocation is the timezone session templates, closures and overrides are in.
+func ClinicTimeLocation() (*time.Location, error) {
+	return time.LoadLocation(config.LoadConfig().ClinicTimezone)
+}
+
+// ParseClockTime parses a "15:04" session time into minutes after midnight.
+func ParseClockTime(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks a session template's hours, slot length and capacity.
+func (s *ClinicSession) Validate() error {
+	if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+		return errors.New("weekday must be 0 (Sunday) to 6 (Saturday)")
+	}
+	return validateSessionHours(s.StartTime, s.EndTime, s.SlotMinutes, s.Capacity)
+}
+
+func validateSessionHours(startTime, endTime string, slotMinutes, capacity int) error {
+	start, err := ParseClockTime(startTime)
+	if err != nil {
+		return err
+	}
+	end, err := ParseClockTime(endTime)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return errors.New("endTime must be after startTime")
+	}
+	if slotMinutes < 5 || slotMinutes > 240 {
+		return errors.New("slotMinutes must be between 5 and 240")
+	}
+	if end-start < slotMinutes {
+		return errors.New("session must be at least one slot long")
+	}
+	if capacity < 1 || capacity > 100 {
+		return errors.New("capacity must be between 1 and 100")
+	}
+	return nil
+}
+
+// FindOverlappingSession returns an active session on the same location and weekday whose
+// hours overlap the given one, or nil.
+func FindOverlappingSession(s *ClinicSession) (*ClinicSession, error) {
+	var sessions []ClinicSession
+	err := config.DB.Where("location = ? AND weekday = ? AND active = ? AND id <> ?", s.Location, s.Weekday, true, s.ID).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	start, _ := ParseClockTime(s.StartTime)
+	end, _ := ParseClockTime(s.EndTime)
+	for i := range sessions {
+		otherStart, _ := ParseClockTime(sessions[i].StartTime)
+		otherEnd, _ := ParseClockTime(sessions[i].EndTime)
+		if start < otherEnd && otherStart < end {
+			return &sessions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ScheduleSlots returns the bookable slots at a location starting in [from, to), in
+// order. Closures remove whole days; overrides change or add sessions on their date.
+func ScheduleSlots(location AppointmentLocation, from, to time.Time) ([]ScheduledSlot, error) {
+	tz, err := ClinicTimeLocation()
+	if err != nil {
+		return nil, err
+	}
+	from = from.In(tz)
+	to = to.In(tz)
+	firstDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, tz)
+	if !firstDay.Before(to) {
+		return nil, nil
+	}
+	lastDate := to.Add(-time.Nanosecond).Format("2006-01-02")
+
+	var sessions []ClinicSession
+	if err := config.DB.Where("location = ? AND active = ?", location, true).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	var closures []ClinicClosure
+	err = config.DB.Where("(location = ? OR location = '' OR location IS NULL) AND start_date <= ? AND end_date >= ?",
+		location, lastDate, firstDay.Format("2006-01-02")).
+		Find(&closures).Error
+	if err != nil {
+		return nil, err
+	}
+	var overrides []ClinicSessionOverride
+	err = config.DB.Where("location = ? AND date >= ? AND date <= ?", location, firstDay.Format("2006-01-02"), lastDate).
+		Order("id ASC").
+		Find(&overrides).Error
+	if err != nil {
+		return nil, err
+	}
+
+	overridesByDate := make(map[string][]ClinicSessionOverride)
+	for _, o := range overrides {
+		overridesByDate[o.Date] = append(overridesByDate[o.Date], o)
+	}
+
+	var slots []ScheduledSlot
+	for day := firstDay; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if isClosed(closures, date) {
+			continue
+		}
+		for _, s := range daySessions(sessions, overridesByDate[date], day.Weekday()) {
+			slots = append(slots, s.slots(day, from, to)...)
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].SlotTime.Before(slots[j].SlotTime) })
+
+	// An extra session overlapping a template one could repeat a slot; keep the first
+	unique := slots[:0]
+	for i, slot := range slots {
+		if i == 0 || !slot.SlotTime.Equal(unique[len(unique)-1].SlotTime) {
+			unique = append(unique, slot)
+		}
+	}
+	return unique, nil
+}
+
+// FindScheduledSlot returns the scheduled slot at a location that t falls in, or nil when
+// no session covers t.
+func FindScheduledSlot(t time.Time, location AppointmentLocation) (*ScheduledSlot, error) {
+	// Slots are at most 240 minutes long, so one starting in the previous four hours covers t
+	slots, err := ScheduleSlots(location, t.Add(-240*time.Minute), t.Add(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	for i := len(slots) - 1; i >= 0; i-- {
+		if !t.Before(slots[i].SlotTime) && t.Before(slots[i].EndTime) {
+			return &slots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// daySession is a session as it runs on one date, after overrides.
+type daySession struct {
+	id          *uint
+	start, end  int // Minutes after midnight
+	slotMinutes int
+	capacity    int
+}
+
+func (s daySession) slots(day, from, to time.Time) []ScheduledSlot {
+	var slots []ScheduledSlot
+	for m := s.start; m+s.slotMinutes <= s.end; m += s.slotMinutes {
+		start := time.Date(day.Year(), day.Month(), day.Day(), m/60, m%60, 0, 0, day.Location())
+		if start.Before(from) || !start.Before(to) {
+			continue
+		}
+		slots = append(slots, ScheduledSlot{
+			SlotTime:  start,
+			EndTime:   start.Add(time.Duration(s.slotMinutes) * time.Minute),
+			Capacity:  s.capacity,
+			SessionID: s.id,
+		})
+	}
+	return slots
+}
+
+func daySessions(sessions []ClinicSession, overrides []ClinicSessionOverride, weekday time.Weekday) []daySession {
+	byID := make(map[uint]ClinicSessionOverride)
+	var result []daySession
+	for _, o := range overrides {
+		if o.SessionID != nil {
+			byID[*o.SessionID] = o
+			continue
+		}
+		if o.Cancelled || o.StartTime == nil || o.EndTime == nil {
+			continue
+		}
+		extra := daySession{slotMinutes: 15, capacity: 4}
+		extra.start, _ = ParseClockTime(*o.StartTime)
+		extra.end, _ = ParseClockTime(*o.EndTime)
+		if o.SlotMinutes != nil {
+			extra.slotMinutes = *o.SlotMinutes
+		}
+		if o.Capacity != nil {
+			extra.capacity = *o.Capacity
+		}
+		result = append(result, extra)
+	}
+
+	for i := range sessions {
+		s := sessions[i]
+		if s.Weekday != weekday {
+			continue
+		}
+		ds := daySession{id: &sessions[i].ID, slotMinutes: s.SlotMinutes, capacity: s.Capacity}
+		ds.start, _ = ParseClockTime(s.StartTime)
+		ds.end, _ = ParseClockTime(s.EndTime)
+		if o, ok := byID[s.ID]; ok {
+			if o.Cancelled {
+				continue
+			}
+			if o.StartTime != nil {
+				ds.start, _ = ParseClockTime(*o.StartTime)
+			}
+			if o.EndTime != nil {
+				ds.end, _ = ParseClockTime(*o.EndTime)
+			}
+			if o.SlotMinutes != nil {
+				ds.slotMinutes = *o.SlotMinutes
+			}
+			if o.Capacity != nil {
+				ds.capacity = *o.Capacity
+			}
+		}
+		result = append(result, ds)
+	}
+	return result
+}
+
+func isClosed(closures []ClinicClosure, date string) bool {
+	for _, c := range closures {
+		if c.StartDate <= date && date <= c.EndDate {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClinicSessions returns the session templates, optionally for one location.
+func GetClinicSessions(location AppointmentLocation) ([]ClinicSession, error) {
+	query := config.DB.Order("location ASC, weekday ASC, start_time ASC")
+	if location != "" {
+		query = query.Where("location = ?", location)
+	}
+	var sessions []ClinicSession
+	err := query.Find(&sessions).Error
+	return sessions, err
+}
+
+// GetClinicClosures returns closures that end on or after the given date.
+func GetClinicClosures(fromDate string) ([]ClinicClosure, error) {
+	var closures []ClinicClosure
+	err := config.DB.Where("end_date >= ?", fromDate).Order("start_date ASC").Find(&closures).Error
+	return closures, err
+}
+
+// GetClinicSessionOverrides returns overrides dated on or after the given date.
+func GetClinicSessionOverrides(fromDate string) ([]ClinicSessionOverride, error) {
+	var overrides []ClinicSessionOverride
+	err := config.DB.Where("date >= ?", fromDate).Order("date ASC, id ASC").Find(&overrides).Error
+	return overrides, err
+}
+
+// SeedDefaultClinicSessions creates the original clinic hours as templates when none
+// exist yet: Monday to Friday, 8:00 to 11:45, 15-minute slots for 4 patients.
+func SeedDefaultClinicSessions(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&ClinicSession{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for day := time.Monday; day <= time.Friday; day++ {
+		session := ClinicSession{
+			Name:        "Morning clinic",
+			Location:    AppointmentLocationClinic,
+			Weekday:     day,
+			StartTime:   "08:00",
+			EndTime:     "11:45",
+			SlotMinutes: 15,
+			Capacity:    4,
+			Active:      true,
+		}
+		if err := db.Create(&session).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
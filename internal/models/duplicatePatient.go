@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DuplicateStatusPending   = "pending"
+	DuplicateStatusConfirmed = "confirmed"
+	DuplicateStatusDismissed = "dismissed"
+)
+
+// ErrInvalidDuplicateStatus is returned when a review sets an unknown status.
+var ErrInvalidDuplicateStatus = errors.New("invalid duplicate candidate status")
+
+// DuplicatePatientCandidate is a scored pair of patients that may describe the same person.
+// PatientAID is always the lower of the two IDs so each pair is stored once.
+type DuplicatePatientCandidate struct {
+	gorm.Model
+
+	PatientAID uint        `json:"patientAId" gorm:"not null;uniqueIndex:idx_duplicate_pair"`
+	PatientBID uint        `json:"patientBId" gorm:"not null;uniqueIndex:idx_duplicate_pair"`
+	Score      float64     `json:"score" gorm:"not null;index"`
+	Reasons    StringArray `json:"reasons" gorm:"type:json"`
+	Status     string      `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
+
+	ReviewedByID *uint      `json:"reviewedById,omitempty" gorm:"index"`
+	ReviewedAt   *time.Time `json:"reviewedAt,omitempty"`
+	ReviewNote   string     `json:"reviewNote,omitempty" gorm:"type:text"`
+
+	// Relationships
+	PatientA   Patient `json:"patientA" gorm:"foreignKey:PatientAID"`
+	PatientB   Patient `json:"patientB" gorm:"foreignKey:PatientBID"`
+	ReviewedBy *User   `json:"reviewedBy,omitempty" gorm:"foreignKey:ReviewedByID"`
+}
+
+// OrderedPatientPair returns the two IDs with the lower one first.
+func OrderedPatientPair(a, b uint) (uint, uint) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// UpsertDuplicateCandidate records a scored pair. Pairs already reviewed keep their status;
+// pending pairs have their score and reasons refreshed.
+func UpsertDuplicateCandidate(patientA, patientB uint, score float64, reasons []string) error {
+	aID, bID := OrderedPatientPair(patientA, patientB)
+
+	var existing DuplicatePatientCandidate
+	err := config.DB.Where("patient_a_id = ? AND patient_b_id = ?", aID, bID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		candidate := DuplicatePatientCandidate{
+			PatientAID: aID,
+			PatientBID: bID,
+			Score:      score,
+			Reasons:    StringArray(reasons),
+			Status:     DuplicateStatusPending,
+		}
+		return config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&candidate).Error
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Status != DuplicateStatusPending {
+		return nil
+	}
+	return config.DB.Model(&existing).Updates(map[string]interface{}{
+		"score":   score,
+		"reasons": StringArray(reasons),
+	}).Error
+}
+
+// ListDuplicateCandidates returns candidates for the review queue, highest score first.
+func ListDuplicateCandidates(status string, minScore float64, limit, offset int) ([]DuplicatePatientCandidate, int64, error) {
+	query := config.DB.Model(&DuplicatePatientCandidate{})
+	if status != "" && status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if minScore > 0 {
+		query = query.Where("score >= ?", minScore)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var candidates []DuplicatePatientCandidate
+	err := query.Preload("PatientA").Preload("PatientB").Preload("ReviewedBy").
+		Order("score DESC, created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&candidates).Error
+	return candidates, total, err
+}
+
+// GetDuplicateCandidateByID retrieves a single candidate pair with both patients.
+func GetDuplicateCandidateByID(id uint) (*DuplicatePatientCandidate, error) {
+	var candidate DuplicatePatientCandidate
+	err := config.DB.Preload("PatientA").Preload("PatientB").Preload("ReviewedBy").First(&candidate, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &candidate, nil
+}
+
+// ResolveDuplicateCandidate marks a candidate as confirmed or dismissed.
+func ResolveDuplicateCandidate(id uint, status string, reviewerID uint, note string) error {
+	if status != DuplicateStatusConfirmed && status != DuplicateStatusDismissed && status != DuplicateStatusPending {
+		return ErrInvalidDuplicateStatus
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":         status,
+		"reviewed_by_id": reviewerID,
+		"reviewed_at":    now,
+		"review_note":    note,
+	}
+	if status == DuplicateStatusPending {
+		updates["reviewed_by_id"] = nil
+		updates["reviewed_at"] = nil
+	}
+	res := config.DB.Model(&DuplicatePatientCandidate{}).Where("id = ?", id).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm/clause"
+)
+
+// EventMarker records that a time-based event was emitted, so the event sweeper sends each
+// transition once even across restarts or several instances. SubjectID is the record the
+// event is about and Key what makes the transition distinct, such as the due date.
+type EventMarker struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	Event     WebhookEvent `json:"event" gorm:"type:varchar(50);not null;uniqueIndex:idx_event_marker"`
+	SubjectID uint         `json:"subjectId" gorm:"not null;uniqueIndex:idx_event_marker"`
+	Key       string       `json:"key" gorm:"type:varchar(150);not null;uniqueIndex:idx_event_marker"`
+	CreatedAt time.Time    `json:"createdAt" gorm:"index"`
+}
+
+// ClaimEventMarker records an event. It returns false when the event was already emitted.
+func ClaimEventMarker(event WebhookEvent, subjectID uint, key string) (bool, error) {
+	marker := EventMarker{Event: event, SubjectID: subjectID, Key: key}
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&marker)
+	return result.RowsAffected == 1, result.Error
+}
+
+// PruneEventMarkers deletes markers created before cutoff and returns how many were removed.
+func PruneEventMarkers(cutoff time.Time) (int64, error) {
+	result := config.DB.Where("created_at < ?", cutoff).Delete(&EventMarker{})
+	return result.RowsAffected, result.Error
+}
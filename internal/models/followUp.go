@@ -0,0 +1,262 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	// FollowUpModePropose suggests the next appointment for a clinician to confirm.
+	FollowUpModePropose = "propose"
+	// FollowUpModeAuto books the next appointment as soon as the report is completed.
+	FollowUpModeAuto = "auto"
+)
+
+const (
+	FollowUpProposed  = "proposed"
+	FollowUpScheduled = "scheduled"
+	FollowUpDismissed = "dismissed"
+)
+
+// ErrFollowUpResolved is returned when a follow-up has already been booked or dismissed.
+var ErrFollowUpResolved = errors.New("follow-up has already been resolved")
+
+// FollowUpRule sets when a patient is next seen after a completed report. Empty device and
+// report types match any; the most specific active rule applies.
+type FollowUpRule struct {
+	gorm.Model
+	Name         string              `json:"name" gorm:"type:varchar(100);not null"`
+	DeviceType   string              `json:"deviceType" gorm:"type:varchar(100);index"`
+	ReportType   string              `json:"reportType" gorm:"type:varchar(100);index"`
+	Location     AppointmentLocation `json:"location" gorm:"type:varchar(32);not null"`
+	IntervalDays int                 `json:"intervalDays" gorm:"not null"`
+	Mode         string              `json:"mode" gorm:"type:varchar(20);not null"`
+	Active       bool                `json:"active" gorm:"not null"`
+}
+
+// Validate normalises the rule and returns a message if it is invalid.
+func (r *FollowUpRule) Validate() string {
+	r.Name = strings.TrimSpace(r.Name)
+	r.DeviceType = strings.TrimSpace(r.DeviceType)
+	r.ReportType = strings.ToLower(strings.TrimSpace(r.ReportType))
+	if r.Name == "" {
+		return "name is required"
+	}
+	switch r.Location {
+	case AppointmentLocationClinic, AppointmentLocationRemote, AppointmentLocationTelevisit:
+	default:
+		return "location must be clinic, remote or televisit"
+	}
+	if r.IntervalDays < 1 || r.IntervalDays > 3650 {
+		return "intervalDays must be between 1 and 3650"
+	}
+	if r.Mode != FollowUpModePropose && r.Mode != FollowUpModeAuto {
+		return "mode must be propose or auto"
+	}
+	return ""
+}
+
+// specificity ranks rules so that device and report type together beat report type alone,
+// which beats device type alone.
+func (r *FollowUpRule) specificity() int {
+	score := 0
+	if r.ReportType != "" {
+		score += 2
+	}
+	if r.DeviceType != "" {
+		score++
+	}
+	return score
+}
+
+// ReportFollowUp links a completed report to the appointment that follows it, or to the
+// proposal for one while it waits for a clinician.
+type ReportFollowUp struct {
+	gorm.Model
+	ReportID      uint                `json:"reportId" gorm:"not null;uniqueIndex"`
+	PatientID     uint                `json:"patientId" gorm:"not null;index"`
+	RuleID        *uint               `json:"ruleId"`
+	Rule          *FollowUpRule       `json:"rule,omitempty"`
+	Location      AppointmentLocation `json:"location" gorm:"type:varchar(32);not null"`
+	DueAt         time.Time           `json:"dueAt" gorm:"not null"`
+	Status        string              `json:"status" gorm:"type:varchar(20);not null;index"`
+	Note          string              `json:"note" gorm:"type:varchar(255)"`
+	AppointmentID *uint               `json:"appointmentId" gorm:"index"`
+	Appointment   *Appointment        `json:"appointment,omitempty"`
+	ResolvedByID  *uint               `json:"resolvedById"`
+	ResolvedAt    *time.Time          `json:"resolvedAt"`
+}
+
+// GetFollowUpRules lists rules, most specific first.
+func GetFollowUpRules() ([]FollowUpRule, error) {
+	var rules []FollowUpRule
+	err := config.DB.Order("device_type DESC, report_type DESC, id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetFollowUpRule returns a rule, or nil if it does not exist.
+func GetFollowUpRule(id uint) (*FollowUpRule, error) {
+	var rule FollowUpRule
+	result := config.DB.Limit(1).Find(&rule, id)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &rule, nil
+}
+
+// MatchFollowUpRule returns the active rule for a device and report type, or nil if none
+// applies. Equally specific rules are resolved by the oldest.
+func MatchFollowUpRule(deviceType, reportType string) (*FollowUpRule, error) {
+	deviceType = strings.TrimSpace(deviceType)
+	reportType = strings.ToLower(strings.TrimSpace(reportType))
+
+	var rules []FollowUpRule
+	err := config.DB.Where("active = ?", true).
+		Where("device_type = '' OR LOWER(device_type) = LOWER(?)", deviceType).
+		Where("report_type = '' OR report_type = ?", reportType).
+		Order("id ASC").
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var best *FollowUpRule
+	for i := range rules {
+		if best == nil || rules[i].specificity() > best.specificity() {
+			best = &rules[i]
+		}
+	}
+	return best, nil
+}
+
+// GetReportFollowUp returns the follow-up for a report, or nil if it has none.
+func GetReportFollowUp(reportID uint) (*ReportFollowUp, error) {
+	var followUp ReportFollowUp
+	result := config.DB.Preload("Rule").Preload("Appointment").
+		Where("report_id = ?", reportID).Limit(1).Find(&followUp)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &followUp, nil
+}
+
+// DeleteProposedFollowUp withdraws a report's follow-up while it is still only proposed.
+// Booked appointments are left alone.
+func DeleteProposedFollowUp(reportID uint) error {
+	return config.DB.Unscoped().
+		Where("report_id = ? AND status = ?", reportID, FollowUpProposed).
+		Delete(&ReportFollowUp{}).Error
+}
+
+// FollowUpWorklistEntry is a patient with an active device and no upcoming appointment.
+type FollowUpWorklistEntry struct {
+	PatientID      uint       `json:"patientId"`
+	MRN            int        `json:"mrn"`
+	FirstName      string     `json:"firstName"`
+	LastName       string     `json:"lastName"`
+	DeviceType     string     `json:"deviceType"`
+	DeviceName     string     `json:"deviceName"`
+	LastReportID   *uint      `json:"lastReportId"`
+	LastReportDate *time.Time `json:"lastReportDate"`
+	LastSeenAt     *time.Time `json:"lastSeenAt"`
+
+	// The open proposal for the patient's latest completed report, if any
+	FollowUpID *uint      `json:"followUpId"`
+	DueAt      *time.Time `json:"dueAt"`
+}
+
+// FollowUpWorklistFilter narrows GetFollowUpWorklist.
+type FollowUpWorklistFilter struct {
+	DoctorID *uint
+	Search   string
+}
+
+// GetFollowUpWorklist lists patients with an active implanted device and no scheduled
+// appointment from now on, longest since last seen first.
+func GetFollowUpWorklist(filter FollowUpWorklistFilter, now time.Time, limit, offset int) ([]FollowUpWorklistEntry, int64, error) {
+	query := config.DB.Table("patients").
+		Where("patients.deleted_at IS NULL").
+		Where(`EXISTS (SELECT 1 FROM implanted_devices d WHERE d.patient_id = patients.id
+			AND d.deleted_at IS NULL AND d.explanted_at IS NULL)`).
+		Where(`NOT EXISTS (SELECT 1 FROM appointments a WHERE a.patient_id = patients.id
+			AND a.deleted_at IS NULL AND a.status = ? AND a.start_at >= ?)`, AppointmentStatusScheduled, now)
+
+	if filter.DoctorID != nil {
+		query = query.Where(`EXISTS (SELECT 1 FROM patient_doctors pd WHERE pd.patient_id = patients.id
+			AND pd.doctor_id = ? AND pd.deleted_at IS NULL)`, *filter.DoctorID)
+	}
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("LOWER(patients.first_name) LIKE ? OR LOWER(patients.last_name) LIKE ? OR CAST(patients.mrn AS TEXT) LIKE ?",
+			like, like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	lastSeen := `(SELECT MAX(a.start_at) FROM appointments a WHERE a.patient_id = patients.id
+		AND a.deleted_at IS NULL AND a.status <> ? AND a.start_at < ?)`
+	entries := []FollowUpWorklistEntry{}
+	err := query.
+		Select("patients.id AS patient_id, patients.mrn, patients.first_name, patients.last_name, "+lastSeen+" AS last_seen_at",
+			AppointmentStatusCancelled, now).
+		Order("last_seen_at IS NOT NULL, last_seen_at ASC, patients.id ASC").
+		Limit(limit).Offset(offset).
+		Scan(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range entries {
+		if err := fillFollowUpWorklistEntry(&entries[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return entries, total, nil
+}
+
+// fillFollowUpWorklistEntry adds the patient's device, latest completed report and any open
+// proposal for it.
+func fillFollowUpWorklistEntry(entry *FollowUpWorklistEntry) error {
+	var device ImplantedDevice
+	result := config.DB.Preload("Device").
+		Where("patient_id = ? AND explanted_at IS NULL", entry.PatientID).
+		Order("implanted_at DESC, id DESC").Limit(1).Find(&device)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		entry.DeviceType = device.Device.Type
+		entry.DeviceName = device.Device.Name
+	}
+
+	var report Report
+	result = config.DB.Select("id", "report_date").
+		Where("patient_id = ? AND is_completed = ?", entry.PatientID, true).
+		Order("report_date DESC, id DESC").Limit(1).Find(&report)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	entry.LastReportID = &report.ID
+	entry.LastReportDate = &report.ReportDate
+
+	var followUp ReportFollowUp
+	result = config.DB.Where("report_id = ? AND status = ?", report.ID, FollowUpProposed).Limit(1).Find(&followUp)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		entry.FollowUpID = &followUp.ID
+		entry.DueAt = &followUp.DueAt
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// LetterKindMissedAppointment is a letter to a patient who did not attend an appointment.
+const LetterKindMissedAppointment = "missed_appointment"
+
+// LetterMergeFields are the placeholders letter templates may use, written as
+// {{patient.firstName}}, each with a description.
+var LetterMergeFields = map[string]string{
+	"patient.firstName":       "Patient first name",
+	"patient.lastName":        "Patient last name",
+	"patient.fullName":        "Patient first and last name",
+	"patient.mrn":             "Medical record number",
+	"patient.dob":             "Date of birth",
+	"address.street":          "Street",
+	"address.city":            "City",
+	"address.state":           "State",
+	"address.postal":          "Postcode",
+	"address.country":         "Country",
+	"doctor.name":             "The patient's primary doctor",
+	"doctor.phone":            "Primary doctor's phone",
+	"appointment.date":        "Date of the missed appointment",
+	"appointment.time":        "Time of the missed appointment",
+	"appointment.location":    "clinic, remote or televisit",
+	"appointment.title":       "Appointment title",
+	"clinic.name":             "Clinic name (CLINIC_NAME)",
+	"clinic.phone":            "Clinic phone (CLINIC_PHONE)",
+	"rebooking.instructions":  "The template's rebooking instructions",
+	"rebooking.nextAvailable": "Next free clinic slot when the letter was generated",
+	"today":                   "Date the letter was generated",
+}
+
+var mergeFieldPattern = regexp.MustCompile(`\{\{\s*([A-Za-z.]+)\s*\}\}`)
+
+// LetterTemplate is the wording of a generated letter. Subject, body and rebooking
+// instructions may contain merge fields.
+type LetterTemplate struct {
+	gorm.Model
+	Name                  string `json:"name" gorm:"type:varchar(100);not null"`
+	Kind                  string `json:"kind" gorm:"type:varchar(50);not null;index"`
+	Subject               string `json:"subject" gorm:"type:varchar(255)"`
+	Body                  string `json:"body" gorm:"type:text;not null"`
+	RebookingInstructions string `json:"rebookingInstructions" gorm:"type:text"`
+	IsDefault             bool   `json:"isDefault" gorm:"not null"`
+}
+
+// Validate returns a message if the template is incomplete or uses unknown merge fields.
+func (t *LetterTemplate) Validate() string {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" || len(t.Name) > 100 {
+		return "name is required and must be at most 100 characters"
+	}
+	if t.Kind != LetterKindMissedAppointment {
+		return "kind must be " + LetterKindMissedAppointment
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return "body is required"
+	}
+	return checkMergeFields(LetterMergeFields, t.Subject, t.Body, t.RebookingInstructions)
+}
+
+// checkMergeFields returns a message naming any merge fields in texts that are not in fields.
+func checkMergeFields(fields map[string]string, texts ...string) string {
+	var unknown []string
+	for _, text := range texts {
+		for _, match := range mergeFieldPattern.FindAllStringSubmatch(text, -1) {
+			if _, ok := fields[match[1]]; !ok {
+				unknown = append(unknown, match[1])
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Sprintf("unknown merge fields: %s", strings.Join(unknown, ", "))
+	}
+	return ""
+}
+
+// MergeLetterFields replaces the merge fields in text with their values. Fields without a
+// value are left empty.
+func MergeLetterFields(text string, values map[string]string) string {
+	return mergeFieldPattern.ReplaceAllStringFunc(text, func(field string) string {
+		return values[mergeFieldPattern.FindStringSubmatch(field)[1]]
+	})
+}
+
+// GetLetterTemplates lists templates of a kind, the default first.
+func GetLetterTemplates(kind string) ([]LetterTemplate, error) {
+	var templates []LetterTemplate
+	query := config.DB.Order("is_default DESC, name ASC")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	err := query.Find(&templates).Error
+	return templates, err
+}
+
+// GetLetterTemplate returns a template by ID, or the default for the kind when id is 0. It
+// returns nil if there is none.
+func GetLetterTemplate(id uint, kind string) (*LetterTemplate, error) {
+	var template LetterTemplate
+	query := config.DB.Where("kind = ?", kind)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Order("is_default DESC, id ASC")
+	}
+	result := query.Limit(1).Find(&template)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &template, nil
+}
+
+// SaveLetterTemplate saves a template. A default template replaces the previous default of
+// its kind.
+func SaveLetterTemplate(template *LetterTemplate) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if template.IsDefault {
+			err := tx.Model(&LetterTemplate{}).
+				Where("kind = ? AND id <> ? AND is_default = ?", template.Kind, template.ID, true).
+				Update("is_default", false).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Save(template).Error
+	})
+}
+
+// PatientLetter archives a letter generated for a patient as it was sent.
+type PatientLetter struct {
+	gorm.Model
+	PatientID     uint         `json:"patientId" gorm:"not null;index"`
+	Patient       *Patient     `json:"patient,omitempty"`
+	AppointmentID *uint        `json:"appointmentId" gorm:"index"`
+	Appointment   *Appointment `json:"appointment,omitempty"`
+	TemplateID    *uint        `json:"templateId"`
+	Kind          string       `json:"kind" gorm:"type:varchar(50);not null;index"`
+	BatchID       string       `json:"batchId" gorm:"type:varchar(36);index"`
+	Recipient     string       `json:"recipient" gorm:"type:text"` // Address block, one line each
+	Subject       string       `json:"subject" gorm:"type:varchar(255)"`
+	Body          string       `json:"body" gorm:"type:text"`
+	GeneratedByID uint         `json:"generatedById" gorm:"not null"`
+	GeneratedBy   *User        `json:"generatedBy,omitempty"`
+}
+
+// GetPatientLetters lists a patient's archived letters, newest first.
+func GetPatientLetters(patientID uint) ([]PatientLetter, error) {
+	var letters []PatientLetter
+	err := config.DB.Preload("GeneratedBy").Where("patient_id = ?", patientID).
+		Order("created_at DESC, id DESC").Find(&letters).Error
+	return letters, err
+}
+
+// GetPatientLetter returns one of a patient's letters, or nil if it does not exist.
+func GetPatientLetter(patientID, id uint) (*PatientLetter, error) {
+	var letter PatientLetter
+	result := config.DB.Where("patient_id = ? AND id = ?", patientID, id).Limit(1).Find(&letter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &letter, nil
+}
+
+// SeedDefaultLetterTemplate adds a missed appointment letter so letters can be generated
+// before any template is written.
+func SeedDefaultLetterTemplate(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&LetterTemplate{}).Where("kind = ?", LetterKindMissedAppointment).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Create(&LetterTemplate{
+		Name:    "Missed appointment",
+		Kind:    LetterKindMissedAppointment,
+		Subject: "Missed appointment on {{appointment.date}}",
+		Body: `Dear {{patient.fullName}},
+
+Our records show that you were unable to attend your appointment at {{appointment.time}} on {{appointment.date}}.
+
+Regular checks of your cardiac device are important for your ongoing care. {{rebooking.instructions}}
+
+If you have already rescheduled, please disregard this letter.
+
+Yours sincerely,
+
+{{clinic.name}}`,
+		RebookingInstructions: "Please call us on {{clinic.phone}} to book a new appointment.",
+		IsDefault:             true,
+	}).Error
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MentionPatientNote = "patient_note"
+	MentionTaskNote    = "task_note"
+)
+
+// NoteMention records a user @mentioned in a patient or task note. A note mentions each
+// user once, however often the name appears or the note is edited.
+type NoteMention struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"userId" gorm:"not null;uniqueIndex:idx_note_mention;index:idx_mention_inbox"`
+	NoteType      string     `json:"noteType" gorm:"type:varchar(20);not null;uniqueIndex:idx_note_mention"`
+	NoteID        uint       `json:"noteId" gorm:"not null;uniqueIndex:idx_note_mention"`
+	PatientID     *uint      `json:"patientId" gorm:"index"`
+	TaskID        *uint      `json:"taskId" gorm:"index"`
+	MentionedByID uint       `json:"mentionedById" gorm:"not null"`
+	MentionedBy   *User      `json:"mentionedBy,omitempty" gorm:"foreignKey:MentionedByID"`
+	Excerpt       string     `json:"excerpt" gorm:"type:varchar(255)"`
+	ReadAt        *time.Time `json:"readAt" gorm:"index:idx_mention_inbox"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// Usernames are letters, digits, '_' and '-'. The mention must not follow a word character
+// so that email addresses are not read as mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@-])@([A-Za-z0-9_-]{3,50})`)
+
+// ParseMentions returns the usernames @mentioned in content, lower-cased, in order and
+// without repeats.
+func ParseMentions(content string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.ToLower(match[1])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// FindMentionedUsers returns the users @mentioned in content. Names that match no user are
+// ignored.
+func FindMentionedUsers(content string) ([]User, error) {
+	names := ParseMentions(content)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var users []User
+	err := config.DB.Where("LOWER(username) IN ?", names).Order("id ASC").Find(&users).Error
+	return users, err
+}
+
+// CanAccessPatient reports whether a user may see a patient's record, following
+// middleware.AuthorizeDoctorPatientAccess: doctors only see patients linked to them.
+func CanAccessPatient(user *User, patientID uint) (bool, error) {
+	switch user.Role {
+	case "admin", "user", "viewer", "staff_doctor":
+		return true, nil
+	case "doctor":
+		return IsDoctorAssociatedWithPatient(user.ID, patientID)
+	}
+	return false, nil
+}
+
+// MentionExcerpt shortens note content for mention lists and notifications.
+func MentionExcerpt(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(content) <= 200 {
+		return content
+	}
+	return string([]rune(content)[:197]) + "..."
+}
+
+// CreateNoteMentions saves mentions, skipping users the note already mentions. It returns
+// the mentions that are new.
+func CreateNoteMentions(mentions []NoteMention) ([]NoteMention, error) {
+	var created []NoteMention
+	for _, mention := range mentions {
+		result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&mention)
+		if result.Error != nil {
+			return created, result.Error
+		}
+		if result.RowsAffected == 1 {
+			created = append(created, mention)
+		}
+	}
+	return created, nil
+}
+
+// GetUserMentions returns a user's mentions, newest first.
+func GetUserMentions(userID uint, unreadOnly bool, limit, offset int) ([]NoteMention, int64, error) {
+	query := config.DB.Model(&NoteMention{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var mentions []NoteMention
+	err := query.Preload("MentionedBy", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "username", "full_name", "email", "role")
+	}).Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&mentions).Error
+	return mentions, total, err
+}
+
+// CountUnreadMentions returns how many of a user's mentions are unread.
+func CountUnreadMentions(userID uint) (int64, error) {
+	var count int64
+	err := config.DB.Model(&NoteMention{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// MarkMentionsRead marks a user's mentions read: the given ones, or all when ids is empty.
+// It returns how many were unread.
+func MarkMentionsRead(userID uint, ids []uint) (int64, error) {
+	query := config.DB.Model(&NoteMention{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	result := query.Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// IsMentionedOnTask reports whether any note on the task mentions the user.
+func IsMentionedOnTask(userID, taskID uint) bool {
+	var count int64
+	config.DB.Model(&NoteMention{}).Where("user_id = ? AND task_id = ?", userID, taskID).Count(&count)
+	return count > 0
+}
+
+// noteThreadRoot returns the note a reply should hang from: replies to replies join the
+// original thread, so threads stay one level deep.
+func noteThreadRoot(parentID, parentParentID *uint) *uint {
+	if parentParentID != nil {
+		return parentParentID
+	}
+	return parentID
+}
+
+// PatientNoteThreadRoot returns the thread a reply to parentID joins, or nil when the
+// parent is not a note on the patient.
+func PatientNoteThreadRoot(patientID, parentID uint) (*uint, error) {
+	var parent PatientNote
+	if err := config.DB.Select("id", "parent_id").Where("id = ? AND patient_id = ?", parentID, patientID).
+		Limit(1).Find(&parent).Error; err != nil || parent.ID == 0 {
+		return nil, err
+	}
+	return noteThreadRoot(&parent.ID, parent.ParentID), nil
+}
+
+// TaskNoteThreadRoot returns the thread a reply to parentID joins, or nil when the parent
+// is not a note on the task.
+func TaskNoteThreadRoot(taskID, parentID uint) (*uint, error) {
+	var parent TaskNote
+	if err := config.DB.Select("id", "parent_id").Where("id = ? AND task_id = ?", parentID, taskID).
+		Limit(1).Find(&parent).Error; err != nil || parent.ID == 0 {
+		return nil, err
+	}
+	return noteThreadRoot(&parent.ID, parent.ParentID), nil
+}
+
+// DeleteNoteThread deletes a note, its replies when it starts a thread, and their
+// mentions. model is &PatientNote{} or &TaskNote{}.
+func DeleteNoteThread(model interface{}, noteType string, noteID uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(model).Where("id = ? OR parent_id = ?", noteID, noteID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Where("id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+		return tx.Where("note_type = ? AND note_id IN ?", noteType, ids).Delete(&NoteMention{}).Error
+	})
+}
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	MedicationClassAnticoagulant  = "anticoagulant"
+	MedicationClassAntiarrhythmic = "antiarrhythmic"
+)
+
+// Known drug names used to classify catalog entries whose Category is missing or free text.
+var (
+	anticoagulantNames = []string{
+		"warfarin", "apixaban", "rivaroxaban", "dabigatran", "edoxaban",
+		"heparin", "enoxaparin", "dalteparin", "fondaparinux", "acenocoumarol", "phenindione",
+	}
+	antiarrhythmicNames = []string{
+		"amiodarone", "sotalol", "flecainide", "dronedarone", "dofetilide",
+		"propafenone", "mexiletine", "disopyramide", "quinidine", "procainamide", "ibutilide",
+	}
+)
+
+// PatientMedication records one regimen of a catalog medication for a patient.
+// A dose or frequency change ends the current regimen and starts a new one that
+// points back to it through PreviousID, so the full history is preserved.
+type PatientMedication struct {
+	gorm.Model
+	PatientID     uint       `json:"patientId" gorm:"not null;index"`
+	MedicationID  uint       `json:"medicationId" gorm:"not null;index"`
+	Dose          string     `json:"dose" gorm:"type:varchar(100)"`
+	Frequency     string     `json:"frequency" gorm:"type:varchar(100)"`
+	Route         string     `json:"route" gorm:"type:varchar(50)"`
+	StartDate     *time.Time `json:"startDate" gorm:"index"`
+	StopDate      *time.Time `json:"stopDate" gorm:"index"`
+	ReasonStopped string     `json:"reasonStopped" gorm:"type:text"`
+	Notes         string     `json:"notes" gorm:"type:text"`
+
+	PrescriberID   *uint  `json:"prescriberId" gorm:"index"`
+	PrescriberName string `json:"prescriberName" gorm:"type:varchar(255)"`
+	PreviousID     *uint  `json:"previousId" gorm:"index"`
+	CreatedByID    *uint  `json:"createdById"`
+
+	// Relationships
+	Patient    Patient    `json:"-" gorm:"foreignKey:PatientID;constraint:OnDelete:CASCADE"`
+	Medication Medication `json:"medication" gorm:"foreignKey:MedicationID"`
+	Prescriber *Doctor    `json:"prescriber,omitempty" gorm:"foreignKey:PrescriberID"`
+	CreatedBy  *User      `json:"-" gorm:"foreignKey:CreatedByID"`
+}
+
+// TableName keeps regimens separate from the legacy patient_medications many2many table.
+func (PatientMedication) TableName() string {
+	return "patient_medication_regimens"
+}
+
+// IsActive reports whether the regimen has no stop date or stops in the future.
+func (pm *PatientMedication) IsActive(at time.Time) bool {
+	return pm.StopDate == nil || pm.StopDate.After(at)
+}
+
+// MedicationClass returns anticoagulant, antiarrhythmic or "" for a catalog medication.
+func MedicationClass(med Medication) string {
+	category := strings.ToLower(med.Category)
+	switch {
+	case strings.Contains(category, "anticoag"):
+		return MedicationClassAnticoagulant
+	case strings.Contains(category, "antiarrhythm"):
+		return MedicationClassAntiarrhythmic
+	}
+
+	name := strings.ToLower(med.Name)
+	for _, n := range anticoagulantNames {
+		if strings.Contains(name, n) {
+			return MedicationClassAnticoagulant
+		}
+	}
+	for _, n := range antiarrhythmicNames {
+		if strings.Contains(name, n) {
+			return MedicationClassAntiarrhythmic
+		}
+	}
+	return ""
+}
+
+// GetPatientMedications lists a patient's regimens, most recent start first.
+// status may be "active", "stopped" or "" for all.
+func GetPatientMedications(patientID uint, status string) ([]PatientMedication, error) {
+	var regimens []PatientMedication
+	query := config.DB.Preload("Medication").Preload("Prescriber").
+		Where("patient_id = ?", patientID)
+
+	now := time.Now()
+	switch status {
+	case "active":
+		query = query.Where("stop_date IS NULL OR stop_date > ?", now)
+	case "stopped":
+		query = query.Where("stop_date IS NOT NULL AND stop_date <= ?", now)
+	}
+
+	err := query.Order("start_date DESC, created_at DESC").Find(&regimens).Error
+	return regimens, err
+}
+
+// GetPatientMedicationByID retrieves a single regimen scoped to a patient.
+func GetPatientMedicationByID(patientID, regimenID uint) (*PatientMedication, error) {
+	var regimen PatientMedication
+	err := config.DB.Preload("Medication").Preload("Prescriber").
+		Where("patient_id = ?", patientID).
+		First(&regimen, regimenID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &regimen, nil
+}
+
+// CreatePatientMedication stores a regimen and keeps the legacy Patient.Medications list in sync.
+func CreatePatientMedication(regimen *PatientMedication) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(regimen).Error; err != nil {
+			return err
+		}
+		return syncLegacyPatientMedication(tx, regimen.PatientID, regimen.MedicationID)
+	})
+}
+
+// UpdatePatientMedication saves corrections to a regimen.
+func UpdatePatientMedication(regimen *PatientMedication) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Medication", "Prescriber", "Patient", "CreatedBy").Save(regimen).Error; err != nil {
+			return err
+		}
+		return syncLegacyPatientMedication(tx, regimen.PatientID, regimen.MedicationID)
+	})
+}
+
+// ChangePatientMedication stops current at effective and starts next as its successor.
+func ChangePatientMedication(current *PatientMedication, next *PatientMedication, effective time.Time) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		current.StopDate = &effective
+		if current.ReasonStopped == "" {
+			current.ReasonStopped = "Regimen changed"
+		}
+		if err := tx.Omit("Medication", "Prescriber", "Patient", "CreatedBy").Save(current).Error; err != nil {
+			return err
+		}
+
+		next.PatientID = current.PatientID
+		next.PreviousID = &current.ID
+		next.StartDate = &effective
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		if next.MedicationID != current.MedicationID {
+			if err := syncLegacyPatientMedication(tx, current.PatientID, current.MedicationID); err != nil {
+				return err
+			}
+		}
+		return syncLegacyPatientMedication(tx, next.PatientID, next.MedicationID)
+	})
+}
+
+// DeletePatientMedication removes a regimen entered in error.
+func DeletePatientMedication(regimen *PatientMedication) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(regimen).Error; err != nil {
+			return err
+		}
+		return syncLegacyPatientMedication(tx, regimen.PatientID, regimen.MedicationID)
+	})
+}
+
+// legacyMedicationLink is one row of the legacy patient_medications many2many table.
+type legacyMedicationLink struct {
+	PatientID    uint
+	MedicationID uint
+}
+
+// activeRegimenAt matches regimens that have started and not yet stopped at a given time.
+const activeRegimenAt = "(start_date IS NULL OR start_date <= ?) AND (stop_date IS NULL OR stop_date > ?)"
+
+// syncLegacyPatientMedication links the medication through patient_medications while at
+// least one regimen is in effect, and unlinks it once none are. Regimens that start or
+// stop later are picked up by ReconcileLegacyPatientMedications when their dates pass.
+func syncLegacyPatientMedication(tx *gorm.DB, patientID, medicationID uint) error {
+	now := time.Now()
+	var active int64
+	if err := tx.Model(&PatientMedication{}).
+		Where("patient_id = ? AND medication_id = ?", patientID, medicationID).
+		Where(activeRegimenAt, now, now).
+		Count(&active).Error; err != nil {
+		return err
+	}
+
+	if active == 0 {
+		return tx.Exec("DELETE FROM patient_medications WHERE patient_id = ? AND medication_id = ?", patientID, medicationID).Error
+	}
+
+	var linked int64
+	if err := tx.Table("patient_medications").
+		Where("patient_id = ? AND medication_id = ?", patientID, medicationID).
+		Count(&linked).Error; err != nil {
+		return err
+	}
+	if linked > 0 {
+		return nil
+	}
+	return tx.Table("patient_medications").Create(map[string]interface{}{
+		"patient_id":    patientID,
+		"medication_id": medicationID,
+	}).Error
+}
+
+// ReconcileLegacyPatientMedications re-syncs every patient_medications link that disagrees
+// with the regimens in effect now, such as a regimen whose start date has arrived or whose
+// stop date has passed, and returns how many links it corrected. Links with no regimens at
+// all are left alone.
+func ReconcileLegacyPatientMedications() (int, error) {
+	now := time.Now()
+	var missing, stale []legacyMedicationLink
+	err := config.DB.Model(&PatientMedication{}).
+		Distinct("patient_id", "medication_id").
+		Where(activeRegimenAt, now, now).
+		Where("NOT EXISTS (SELECT 1 FROM patient_medications pm WHERE pm.patient_id = patient_medication_regimens.patient_id AND pm.medication_id = patient_medication_regimens.medication_id)").
+		Scan(&missing).Error
+	if err != nil {
+		return 0, err
+	}
+
+	regimensOfLink := "SELECT 1 FROM patient_medication_regimens r WHERE r.patient_id = patient_medications.patient_id AND r.medication_id = patient_medications.medication_id AND r.deleted_at IS NULL"
+	err = config.DB.Table("patient_medications").
+		Select("patient_medications.patient_id, patient_medications.medication_id").
+		Where("EXISTS ("+regimensOfLink+")").
+		Where("NOT EXISTS ("+regimensOfLink+" AND (r.start_date IS NULL OR r.start_date <= ?) AND (r.stop_date IS NULL OR r.stop_date > ?))", now, now).
+		Scan(&stale).Error
+	if err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	for _, link := range append(missing, stale...) {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			return syncLegacyPatientMedication(tx, link.PatientID, link.MedicationID)
+		})
+		if err != nil {
+			return fixed, err
+		}
+		fixed++
+	}
+	return fixed, nil
+}
+
+// BackfillPatientMedications creates an open-ended regimen for each legacy
+// patient_medications link that has no regimen yet.
+func BackfillPatientMedications(db *gorm.DB) error {
+	var links []legacyMedicationLink
+	err := db.Table("patient_medications").
+		Select("patient_medications.patient_id, patient_medications.medication_id").
+		Joins("LEFT JOIN patient_medication_regimens r ON r.patient_id = patient_medications.patient_id AND r.medication_id = patient_medications.medication_id AND r.deleted_at IS NULL").
+		Where("r.id IS NULL").
+		Scan(&links).Error
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		regimen := PatientMedication{PatientID: link.PatientID, MedicationID: link.MedicationID}
+		if err := db.Create(&regimen).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsPatientAnticoagulated reports whether the patient had an active anticoagulant regimen at the given time.
+func IsPatientAnticoagulated(patientID uint, at time.Time) (bool, error) {
+	var regimens []PatientMedication
+	err := config.DB.Preload("Medication").
+		Where("patient_id = ?", patientID).
+		Where(activeRegimenAt, at, at).
+		Find(&regimens).Error
+	if err != nil {
+		return false, err
+	}
+	for _, r := range regimens {
+		if MedicationClass(r.Medication) == MedicationClassAnticoagulant {
+			return true, nil
+		}
+	}
+	return false, nil
+}
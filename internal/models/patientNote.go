@@ -13,4 +13,8 @@ type PatientNote struct {
 	// Relationships
 	Patient Patient `json:"patient,omitempty" gorm:"foreignKey:PatientID;constraint:OnDelete:CASCADE"`
 	User    User    `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL"`
+
+	// Replies point at the note that starts their thread
+	ParentID *uint         `json:"parentId" gorm:"index"`
+	Replies  []PatientNote `json:"replies,omitempty" gorm:"foreignKey:ParentID"`
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	PatientTagAdded   = "added"
+	PatientTagRemoved = "removed"
+)
+
+// PatientTagEvent records a tag being added to or removed from a patient.
+type PatientTagEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PatientID uint      `json:"patientId" gorm:"not null;index"`
+	TagID     uint      `json:"tagId" gorm:"not null"`
+	TagName   string    `json:"tagName" gorm:"type:varchar(100)"`
+	TagColor  string    `json:"tagColor" gorm:"type:varchar(20)"`
+	Action    string    `json:"action" gorm:"type:varchar(20);not null"`
+	UserID    *uint     `json:"userId"`
+	UserName  string    `json:"userName" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
+
+// RecordPatientTagChanges stores an event for each tag added or removed between the before
+// and after sets. Pass the transaction that changed the tags so both commit together.
+func RecordPatientTagChanges(tx *gorm.DB, patientID uint, before, after []Tag, userID *uint, userName string) error {
+	beforeIDs := make(map[uint]bool, len(before))
+	for _, t := range before {
+		beforeIDs[t.ID] = true
+	}
+	afterIDs := make(map[uint]bool, len(after))
+	for _, t := range after {
+		afterIDs[t.ID] = true
+	}
+
+	var events []PatientTagEvent
+	for _, t := range after {
+		if !beforeIDs[t.ID] {
+			events = append(events, PatientTagEvent{PatientID: patientID, TagID: t.ID, TagName: t.Name, TagColor: t.Color, Action: PatientTagAdded, UserID: userID, UserName: userName})
+		}
+	}
+	for _, t := range before {
+		if !afterIDs[t.ID] {
+			events = append(events, PatientTagEvent{PatientID: patientID, TagID: t.ID, TagName: t.Name, TagColor: t.Color, Action: PatientTagRemoved, UserID: userID, UserName: userName})
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.Create(&events).Error
+}
+
+// GetPatientTagEvents returns a patient's tag changes, newest first, optionally limited to
+// [start, end).
+func GetPatientTagEvents(patientID uint, start, end *time.Time) ([]PatientTagEvent, error) {
+	query := config.DB.Where("patient_id = ?", patientID)
+	if start != nil {
+		query = query.Where("created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("created_at < ?", *end)
+	}
+	var events []PatientTagEvent
+	err := query.Order("created_at DESC").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	ProgrammingGroupBrady   = "brady"
+	ProgrammingGroupAVDelay = "av_delay"
+	ProgrammingGroupTachy   = "tachy"
+)
+
+// ProgrammingSettingChange is a single device setting that differs from the previous report.
+type ProgrammingSettingChange struct {
+	Group           string  `json:"group"`
+	Setting         string  `json:"setting"` // Report JSON field name
+	Label           string  `json:"label"`
+	Previous        *string `json:"previous"`
+	Current         *string `json:"current"`
+	TherapyDisabled bool    `json:"therapyDisabled,omitempty"`
+}
+
+// ProgrammingChanges is stored as a JSON array.
+type ProgrammingChanges []ProgrammingSettingChange
+
+// Scan implements the sql.Scanner interface
+func (p *ProgrammingChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = ProgrammingChanges{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return errors.New("failed to unmarshal ProgrammingChanges value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (p ProgrammingChanges) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// ReportProgrammingChange records the device settings changed between a report and the
+// previous report for the same implanted device.
+type ReportProgrammingChange struct {
+	gorm.Model
+	ReportID                      uint               `json:"reportId" gorm:"not null;uniqueIndex"`
+	PreviousReportID              uint               `json:"previousReportId" gorm:"not null"`
+	PatientID                     uint               `json:"patientId" gorm:"not null;index"`
+	ImplantedDeviceID             *uint              `json:"implantedDeviceId" gorm:"index"`
+	ReportDate                    time.Time          `json:"reportDate" gorm:"index"`
+	Changes                       ProgrammingChanges `json:"changes" gorm:"type:text"`
+	ChangeCount                   int                `json:"changeCount"`
+	TherapyDisabled               bool               `json:"therapyDisabled"`
+	TherapyDisabledWithoutComment bool               `json:"therapyDisabledWithoutComment" gorm:"index"`
+
+	Patient Patient `json:"-" gorm:"foreignKey:PatientID;constraint:OnDelete:CASCADE"`
+	Report  Report  `json:"-" gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE"`
+}
+
+// ProgrammingSetting describes one compared device setting. Therapy marks settings that
+// switch a tachy zone or therapy on and off, including shock energies that can be set to off.
+type ProgrammingSetting struct {
+	Group   string
+	Setting string
+	Label   string
+	Therapy bool
+	Value   func(r *Report) *string
+}
+
+func intSetting(f func(r *Report) *int) func(r *Report) *string {
+	return func(r *Report) *string {
+		v := f(r)
+		if v == nil {
+			return nil
+		}
+		s := strconv.Itoa(*v)
+		return &s
+	}
+}
+
+// ProgrammingSettings lists the brady, AV delay and tachy settings tracked between reports.
+var ProgrammingSettings = []ProgrammingSetting{
+	{ProgrammingGroupBrady, "mdc_idc_set_brady_mode", "Brady mode", false, func(r *Report) *string { return r.MdcIdcSetBradyMode }},
+	{ProgrammingGroupBrady, "mdc_idc_set_brady_lowrate", "Lower rate", false, intSetting(func(r *Report) *int { return r.MdcIdcSetBradyLowrate })},
+	{ProgrammingGroupBrady, "mdc_idc_set_brady_max_tracking_rate", "Max tracking rate", false, intSetting(func(r *Report) *int { return r.MdcIdcSetBradyMaxTrackingRate })},
+	{ProgrammingGroupBrady, "mdc_idc_set_brady_max_sensor_rate", "Max sensor rate", false, intSetting(func(r *Report) *int { return r.MdcIdcSetBradyMaxSensorRate })},
+
+	{ProgrammingGroupAVDelay, "mdc_idc_dev_sav", "Sensed AV delay", false, func(r *Report) *string { return r.MdcIdcDevSav }},
+	{ProgrammingGroupAVDelay, "mdc_idc_dev_pav", "Paced AV delay", false, func(r *Report) *string { return r.MdcIdcDevPav }},
+
+	{ProgrammingGroupTachy, "VT1_active", "VT1 zone", true, func(r *Report) *string { return r.Vt1Active }},
+	{ProgrammingGroupTachy, "VT1_detection_interval", "VT1 detection interval", false, func(r *Report) *string { return r.Vt1DetectionInterval }},
+	{ProgrammingGroupTachy, "VT1_therapy_1_atp", "VT1 therapy 1 ATP", true, func(r *Report) *string { return r.Vt1Therapy1Atp }},
+	{ProgrammingGroupTachy, "VT1_therapy_1_no_bursts", "VT1 therapy 1 bursts", false, func(r *Report) *string { return r.Vt1Therapy1NoBursts }},
+	{ProgrammingGroupTachy, "VT1_therapy_2_atp", "VT1 therapy 2 ATP", true, func(r *Report) *string { return r.Vt1Therapy2Atp }},
+	{ProgrammingGroupTachy, "VT1_therapy_2_no_bursts", "VT1 therapy 2 bursts", false, func(r *Report) *string { return r.Vt1Therapy2NoBursts }},
+	{ProgrammingGroupTachy, "VT1_therapy_3_cvrt", "VT1 therapy 3 CVRT", true, func(r *Report) *string { return r.Vt1Therapy3Cvrt }},
+	{ProgrammingGroupTachy, "VT1_therapy_3_energy", "VT1 therapy 3 energy", true, func(r *Report) *string { return r.Vt1Therapy3Energy }},
+	{ProgrammingGroupTachy, "VT1_therapy_4_cvrt", "VT1 therapy 4 CVRT", true, func(r *Report) *string { return r.Vt1Therapy4Cvrt }},
+	{ProgrammingGroupTachy, "VT1_therapy_4_energy", "VT1 therapy 4 energy", true, func(r *Report) *string { return r.Vt1Therapy4Energy }},
+	{ProgrammingGroupTachy, "VT1_therapy_5_cvrt", "VT1 therapy 5 CVRT", true, func(r *Report) *string { return r.Vt1Therapy5Cvrt }},
+	{ProgrammingGroupTachy, "VT1_therapy_5_energy", "VT1 therapy 5 energy", true, func(r *Report) *string { return r.Vt1Therapy5Energy }},
+	{ProgrammingGroupTachy, "VT1_therapy_5_max_num_shocks", "VT1 therapy 5 max shocks", false, func(r *Report) *string { return r.Vt1Therapy5MaxNumShocks }},
+
+	{ProgrammingGroupTachy, "VT2_active", "VT2 zone", true, func(r *Report) *string { return r.Vt2Active }},
+	{ProgrammingGroupTachy, "VT2_detection_interval", "VT2 detection interval", false, func(r *Report) *string { return r.Vt2DetectionInterval }},
+	{ProgrammingGroupTachy, "VT2_therapy_1_atp", "VT2 therapy 1 ATP", true, func(r *Report) *string { return r.Vt2Therapy1Atp }},
+	{ProgrammingGroupTachy, "VT2_therapy_1_no_bursts", "VT2 therapy 1 bursts", false, func(r *Report) *string { return r.Vt2Therapy1NoBursts }},
+	{ProgrammingGroupTachy, "VT2_therapy_2_atp", "VT2 therapy 2 ATP", true, func(r *Report) *string { return r.Vt2Therapy2Atp }},
+	{ProgrammingGroupTachy, "VT2_therapy_2_no_bursts", "VT2 therapy 2 bursts", false, func(r *Report) *string { return r.Vt2Therapy2NoBursts }},
+	{ProgrammingGroupTachy, "VT2_therapy_3_cvrt", "VT2 therapy 3 CVRT", true, func(r *Report) *string { return r.Vt2Therapy3Cvrt }},
+	{ProgrammingGroupTachy, "VT2_therapy_3_energy", "VT2 therapy 3 energy", true, func(r *Report) *string { return r.Vt2Therapy3Energy }},
+	{ProgrammingGroupTachy, "VT2_therapy_4_cvrt", "VT2 therapy 4 CVRT", true, func(r *Report) *string { return r.Vt2Therapy4Cvrt }},
+	{ProgrammingGroupTachy, "VT2_therapy_4_energy", "VT2 therapy 4 energy", true, func(r *Report) *string { return r.Vt2Therapy4Energy }},
+	{ProgrammingGroupTachy, "VT2_therapy_5_cvrt", "VT2 therapy 5 CVRT", true, func(r *Report) *string { return r.Vt2Therapy5Cvrt }},
+	{ProgrammingGroupTachy, "VT2_therapy_5_energy", "VT2 therapy 5 energy", true, func(r *Report) *string { return r.Vt2Therapy5Energy }},
+	{ProgrammingGroupTachy, "VT2_therapy_5_max_num_shocks", "VT2 therapy 5 max shocks", false, func(r *Report) *string { return r.Vt2Therapy5MaxNumShocks }},
+
+	{ProgrammingGroupTachy, "VF_active", "VF zone", true, func(r *Report) *string { return r.VfActive }},
+	{ProgrammingGroupTachy, "VF_detection_interval", "VF detection interval", false, func(r *Report) *string { return r.VfDetectionInterval }},
+	{ProgrammingGroupTachy, "VF_therapy_1_atp", "VF therapy 1 ATP", true, func(r *Report) *string { return r.VfTherapy1Atp }},
+	{ProgrammingGroupTachy, "VF_therapy_1_no_bursts", "VF therapy 1 bursts", false, func(r *Report) *string { return r.VfTherapy1NoBursts }},
+	{ProgrammingGroupTachy, "VF_therapy_2_energy", "VF therapy 2 energy", true, func(r *Report) *string { return r.VfTherapy2Energy }},
+	{ProgrammingGroupTachy, "VF_therapy_3_energy", "VF therapy 3 energy", true, func(r *Report) *string { return r.VfTherapy3Energy }},
+	{ProgrammingGroupTachy, "VF_therapy_4_energy", "VF therapy 4 energy", true, func(r *Report) *string { return r.VfTherapy4Energy }},
+	{ProgrammingGroupTachy, "VF_therapy_4_max_num_shocks", "VF therapy 4 max shocks", false, func(r *Report) *string { return r.VfTherapy4MaxNumShocks }},
+}
+
+// IsTherapyOffValue reports whether a zone or therapy setting value means it is switched off.
+func IsTherapyOffValue(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "off", "disabled", "inactive", "monitor", "monitor only", "none", "no", "false":
+		return true
+	}
+	return false
+}
+
+func settingText(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return strings.TrimSpace(*v)
+}
+
+// CompareProgrammingSettings lists the brady, AV delay and tachy settings that differ between
+// two reports. Settings left blank on either report are not compared, since a blank value
+// means it was not recorded rather than changed.
+func CompareProgrammingSettings(previous, current *Report) ProgrammingChanges {
+	changes := ProgrammingChanges{}
+	for _, s := range ProgrammingSettings {
+		prev := settingText(s.Value(previous))
+		curr := settingText(s.Value(current))
+		if prev == "" || curr == "" || strings.EqualFold(prev, curr) {
+			continue
+		}
+		changes = append(changes, ProgrammingSettingChange{
+			Group:           s.Group,
+			Setting:         s.Setting,
+			Label:           s.Label,
+			Previous:        &prev,
+			Current:         &curr,
+			TherapyDisabled: s.Therapy && !IsTherapyOffValue(prev) && IsTherapyOffValue(curr),
+		})
+	}
+	return changes
+}
+
+// GetReportImplantedDevice returns the device implanted in the patient on the report date,
+// preferring the most recent implant, or nil if none is recorded.
+func GetReportImplantedDevice(report *Report) (*ImplantedDevice, error) {
+	var device ImplantedDevice
+	err := config.DB.
+		Where("patient_id = ? AND implanted_at <= ?", report.PatientID, report.ReportDate).
+		Where("explanted_at IS NULL OR explanted_at >= ?", report.ReportDate).
+		Order("implanted_at DESC, id DESC").
+		First(&device).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// deviceReportsQuery scopes reports to the patient and, when known, the implant period of device.
+func deviceReportsQuery(report *Report, device *ImplantedDevice) *gorm.DB {
+	query := config.DB.Where("patient_id = ? AND id <> ?", report.PatientID, report.ID)
+	if device != nil {
+		query = query.Where("report_date >= ?", device.ImplantedAt)
+		if device.ExplantedAt != nil {
+			query = query.Where("report_date <= ?", *device.ExplantedAt)
+		}
+	}
+	return query
+}
+
+// GetPreviousDeviceReport returns the report before this one for the same implanted device,
+// or nil if this is the first. Without a recorded device every report for the patient is used.
+func GetPreviousDeviceReport(report *Report, device *ImplantedDevice) (*Report, error) {
+	var previous Report
+	err := deviceReportsQuery(report, device).
+		Where("report_date < ? OR (report_date = ? AND id < ?)", report.ReportDate, report.ReportDate, report.ID).
+		Order("report_date DESC, id DESC").
+		First(&previous).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
+// GetNextDeviceReport returns the report after this one for the same implanted device, or nil.
+func GetNextDeviceReport(report *Report, device *ImplantedDevice) (*Report, error) {
+	var next Report
+	err := deviceReportsQuery(report, device).
+		Where("report_date > ? OR (report_date = ? AND id > ?)", report.ReportDate, report.ReportDate, report.ID).
+		Order("report_date ASC, id ASC").
+		First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// GetReportProgrammingChange returns the programming change recorded for a report, or nil.
+func GetReportProgrammingChange(reportID uint) (*ReportProgrammingChange, error) {
+	var change ReportProgrammingChange
+	err := config.DB.Where("report_id = ?", reportID).First(&change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// GetPatientProgrammingChanges returns a patient's programming changes, newest first,
+// optionally limited to reports dated within [start, end).
+func GetPatientProgrammingChanges(patientID uint, start, end *time.Time) ([]ReportProgrammingChange, error) {
+	query := config.DB.Where("patient_id = ?", patientID).
+		Where("report_id IN (?)", config.DB.Model(&Report{}).Select("id"))
+	if start != nil {
+		query = query.Where("report_date >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("report_date < ?", *end)
+	}
+	var changes []ReportProgrammingChange
+	err := query.Order("report_date DESC").Find(&changes).Error
+	return changes, err
+}
+
+// DeleteReportProgrammingChange removes the programming change stored for a report.
+func DeleteReportProgrammingChange(reportID uint) error {
+	return config.DB.Unscoped().Where("report_id = ?", reportID).Delete(&ReportProgrammingChange{}).Error
+}
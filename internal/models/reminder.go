@@ -0,0 +1,314 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReminderChannel is how a reminder reaches the patient.
+type ReminderChannel string
+
+const (
+	ReminderChannelEmail ReminderChannel = "email"
+	ReminderChannelSMS   ReminderChannel = "sms"
+)
+
+// ReminderStatus is where a reminder's delivery stands.
+type ReminderStatus string
+
+const (
+	ReminderPending ReminderStatus = "pending" // Waiting to be sent, or to be retried
+	ReminderSent    ReminderStatus = "sent"    // Accepted by the mail server or SMS gateway
+	ReminderFailed  ReminderStatus = "failed"
+	ReminderSkipped ReminderStatus = "skipped" // Not sent, e.g. the patient opted out
+)
+
+// ReminderMergeFields are the placeholders reminder templates may use.
+var ReminderMergeFields = map[string]string{
+	"patient.firstName":    LetterMergeFields["patient.firstName"],
+	"patient.lastName":     LetterMergeFields["patient.lastName"],
+	"patient.fullName":     LetterMergeFields["patient.fullName"],
+	"doctor.name":          LetterMergeFields["doctor.name"],
+	"doctor.phone":         LetterMergeFields["doctor.phone"],
+	"appointment.date":     "Date of the appointment",
+	"appointment.time":     "Time of the appointment",
+	"appointment.location": LetterMergeFields["appointment.location"],
+	"appointment.title":    LetterMergeFields["appointment.title"],
+	"clinic.name":          LetterMergeFields["clinic.name"],
+	"clinic.phone":         LetterMergeFields["clinic.phone"],
+}
+
+// ReminderRule sends a reminder a set number of hours before each matching appointment.
+type ReminderRule struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	Name        string              `json:"name" gorm:"type:varchar(100);not null"`
+	HoursBefore int                 `json:"hoursBefore" gorm:"not null"`
+	Channel     ReminderChannel     `json:"channel" gorm:"type:varchar(10);not null"`
+	Location    AppointmentLocation `json:"location" gorm:"type:varchar(32)"` // Empty matches any
+	Subject     string              `json:"subject" gorm:"type:varchar(255)"` // Email only
+	Body        string              `json:"body" gorm:"type:text;not null"`
+	Active      bool                `json:"active" gorm:"not null"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+// Validate returns a message if the rule is incomplete or its template uses unknown fields.
+func (r *ReminderRule) Validate() string {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		return "name is required and must be at most 100 characters"
+	}
+	if r.HoursBefore < 1 || r.HoursBefore > 24*90 {
+		return "hoursBefore must be between 1 and 2160"
+	}
+	if msg := ValidateReminderTemplate(r.Channel, r.Subject, r.Body); msg != "" {
+		return msg
+	}
+	switch r.Location {
+	case "", AppointmentLocationClinic, AppointmentLocationRemote, AppointmentLocationTelevisit:
+	default:
+		return "location must be clinic, remote, televisit or empty"
+	}
+	return ""
+}
+
+// ValidateReminderTemplate returns a message if a reminder template cannot be sent.
+func ValidateReminderTemplate(channel ReminderChannel, subject, body string) string {
+	switch channel {
+	case ReminderChannelEmail:
+		if strings.TrimSpace(subject) == "" {
+			return "subject is required for email reminders"
+		}
+	case ReminderChannelSMS:
+	default:
+		return "channel must be email or sms"
+	}
+	if strings.TrimSpace(body) == "" {
+		return "body is required"
+	}
+	return checkMergeFields(ReminderMergeFields, subject, body)
+}
+
+// AppointmentReminder is one reminder for one appointment, recording its delivery. A
+// reminder is created once per rule and appointment time, so moving an appointment
+// schedules its reminders again.
+type AppointmentReminder struct {
+	ID                uint            `json:"id" gorm:"primaryKey"`
+	AppointmentID     uint            `json:"appointmentId" gorm:"not null;uniqueIndex:idx_reminder_once"`
+	Appointment       *Appointment    `json:"appointment,omitempty"`
+	RuleID            uint            `json:"ruleId" gorm:"not null;uniqueIndex:idx_reminder_once"`
+	Rule              *ReminderRule   `json:"rule,omitempty"`
+	AppointmentStart  time.Time       `json:"appointmentStart" gorm:"not null;uniqueIndex:idx_reminder_once"`
+	PatientID         uint            `json:"patientId" gorm:"not null;index"`
+	Channel           ReminderChannel `json:"channel" gorm:"type:varchar(10);not null"`
+	Status            ReminderStatus  `json:"status" gorm:"type:varchar(20);not null;index"`
+	Recipient         string          `json:"recipient" gorm:"type:varchar(255)"`
+	Subject           string          `json:"subject" gorm:"type:varchar(255)"`
+	Body              string          `json:"body" gorm:"type:text"`
+	Attempts          int             `json:"attempts" gorm:"not null"`
+	LastError         string          `json:"lastError,omitempty" gorm:"type:text"` // Or why it was skipped
+	ProviderMessageID string          `json:"providerMessageId,omitempty" gorm:"type:varchar(255)"`
+	DueAt             time.Time       `json:"dueAt" gorm:"not null"`
+	NextAttemptAt     *time.Time      `json:"nextAttemptAt" gorm:"index"`
+	SentAt            *time.Time      `json:"sentAt"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+}
+
+// GetReminderRules lists reminder rules, soonest before the appointment last.
+func GetReminderRules() ([]ReminderRule, error) {
+	rules := []ReminderRule{}
+	err := config.DB.Order("hours_before DESC, id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetReminderRule returns a rule, or nil if it does not exist.
+func GetReminderRule(id uint) (*ReminderRule, error) {
+	var rule ReminderRule
+	result := config.DB.Limit(1).Find(&rule, id)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &rule, nil
+}
+
+// ScheduleDueReminders creates the reminders that active rules make due by now, and returns
+// how many it created. A reminder is only due for an appointment still ahead, and only if
+// the appointment was booked before the reminder time, so a visit booked for tomorrow does
+// not get a week-ahead reminder. Reminders that fell due more than maxLateness ago, for
+// example when a rule is switched on or the scheduler was down, are not created at all.
+func ScheduleDueReminders(now time.Time, maxLateness time.Duration) (int, error) {
+	var rules []ReminderRule
+	if err := config.DB.Where("active = ?", true).Find(&rules).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, rule := range rules {
+		before := time.Duration(rule.HoursBefore) * time.Hour
+		query := config.DB.Where("status = ? AND start_at > ? AND start_at <= ?", AppointmentStatusScheduled, now, now.Add(before)).
+			Where(`NOT EXISTS (SELECT 1 FROM appointment_reminders r
+				WHERE r.appointment_id = appointments.id AND r.rule_id = ? AND r.appointment_start = appointments.start_at)`, rule.ID)
+		if rule.Location != "" {
+			query = query.Where("location = ?", rule.Location)
+		}
+		var appointments []Appointment
+		if err := query.Find(&appointments).Error; err != nil {
+			return created, err
+		}
+
+		var reminders []AppointmentReminder
+		for _, a := range appointments {
+			due := a.StartAt.Add(-before)
+			if due.Before(a.CreatedAt) || due.Before(now.Add(-maxLateness)) {
+				continue
+			}
+			next := now
+			reminders = append(reminders, AppointmentReminder{
+				AppointmentID:    a.ID,
+				RuleID:           rule.ID,
+				AppointmentStart: a.StartAt,
+				PatientID:        a.PatientID,
+				Channel:          rule.Channel,
+				Status:           ReminderPending,
+				DueAt:            due,
+				NextAttemptAt:    &next,
+			})
+		}
+		if len(reminders) == 0 {
+			continue
+		}
+		// Another scheduler may have created some meanwhile; the unique index keeps one
+		result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminders)
+		if result.Error != nil {
+			return created, result.Error
+		}
+		created += int(result.RowsAffected)
+	}
+	return created, nil
+}
+
+// GetDueReminders returns pending reminders whose next attempt is due, oldest first, with
+// their appointment, patient and rule. Deleted appointments are loaded too so their
+// reminders can be skipped.
+func GetDueReminders(now time.Time, limit int) ([]AppointmentReminder, error) {
+	var reminders []AppointmentReminder
+	err := config.DB.
+		Preload("Appointment", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Appointment.Patient").Preload("Rule").
+		Where("status = ? AND next_attempt_at <= ?", ReminderPending, now).
+		Order("next_attempt_at ASC, id ASC").Limit(limit).Find(&reminders).Error
+	return reminders, err
+}
+
+// ClaimReminderDelivery counts an attempt at sending the reminder and pushes its next
+// attempt back to retryAt, so nobody else sends it meanwhile. It reports false if the
+// reminder was claimed or finished first.
+func ClaimReminderDelivery(reminder *AppointmentReminder, now, retryAt time.Time) (bool, error) {
+	result := config.DB.Model(&AppointmentReminder{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", reminder.ID, ReminderPending, now).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": retryAt,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	reminder.Attempts++
+	reminder.NextAttemptAt = &retryAt
+	return true, nil
+}
+
+// SaveReminderResult stores the outcome of a delivery attempt.
+func SaveReminderResult(reminder *AppointmentReminder) error {
+	return config.DB.Model(&AppointmentReminder{}).Where("id = ?", reminder.ID).Updates(map[string]interface{}{
+		"status":              reminder.Status,
+		"recipient":           reminder.Recipient,
+		"subject":             reminder.Subject,
+		"body":                reminder.Body,
+		"last_error":          reminder.LastError,
+		"provider_message_id": reminder.ProviderMessageID,
+		"next_attempt_at":     reminder.NextAttemptAt,
+		"sent_at":             reminder.SentAt,
+	}).Error
+}
+
+// RetryReminder queues a failed reminder to be sent again on the next cycle. It reports
+// false if the reminder had not failed.
+func RetryReminder(id uint, now time.Time) (bool, error) {
+	result := config.DB.Model(&AppointmentReminder{}).
+		Where("id = ? AND status = ?", id, ReminderFailed).
+		Updates(map[string]interface{}{
+			"status":          ReminderPending,
+			"attempts":        0,
+			"last_error":      "",
+			"next_attempt_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReminderFilter narrows the reminder list.
+type ReminderFilter struct {
+	Status        ReminderStatus
+	AppointmentID uint
+	PatientID     uint
+}
+
+// GetReminders lists reminders, most recently due first, with the total matching.
+func GetReminders(filter ReminderFilter, limit, offset int) ([]AppointmentReminder, int64, error) {
+	query := config.DB.Model(&AppointmentReminder{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.AppointmentID != 0 {
+		query = query.Where("appointment_id = ?", filter.AppointmentID)
+	}
+	if filter.PatientID != 0 {
+		query = query.Where("patient_id = ?", filter.PatientID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	reminders := []AppointmentReminder{}
+	err := query.Preload("Rule").Order("due_at DESC, id DESC").Limit(limit).Offset(offset).Find(&reminders).Error
+	return reminders, total, err
+}
+
+// SeedDefaultReminderRules adds a week-ahead email and a day-ahead SMS reminder, switched
+// off, as a starting point for the clinic's own wording.
+func SeedDefaultReminderRules(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&ReminderRule{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Create(&[]ReminderRule{
+		{
+			Name:        "One week before",
+			HoursBefore: 7 * 24,
+			Channel:     ReminderChannelEmail,
+			Subject:     "Your appointment on {{appointment.date}}",
+			Body: `Dear {{patient.fullName}},
+
+This is a reminder of your device check at {{appointment.time}} on {{appointment.date}}.
+
+If you cannot attend, please call us on {{clinic.phone}} so we can offer the time to someone else.
+
+{{clinic.name}}`,
+		},
+		{
+			Name:        "One day before",
+			HoursBefore: 24,
+			Channel:     ReminderChannelSMS,
+			Body:        "{{clinic.name}}: reminder of your device check tomorrow at {{appointment.time}}. Can't attend? Call {{clinic.phone}}.",
+		},
+	}).Error
+}
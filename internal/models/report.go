@@ -31,6 +31,14 @@ type Report struct {
 	User                 User    `json:"user"`    // Belongs to User
 	Doctor               *Doctor `json:"doctor"`  // Belongs to Doctor
 
+	// Physician co-signature
+	SignoffStatus    string     `json:"signoffStatus" gorm:"type:varchar(30);index"`
+	SignoffDoctorID  *uint      `json:"signoffDoctorId" gorm:"index"` // Physician expected to co-sign
+	CosignedByUserID *uint      `json:"cosignedByUserId"`
+	CosignedByName   *string    `json:"cosignedByName" gorm:"type:varchar(255)"`
+	CosignSignature  *string    `json:"cosignSignature" gorm:"type:text"`
+	CosignedAt       *time.Time `json:"cosignedAt"`
+
 	// Core Report Info
 	ReportDate   time.Time `json:"reportDate"`
 	ReportType   string    `json:"reportType" gorm:"type:varchar(100)"`  // e.g., "Scheduled", "Symptom"
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// ReportComparisonThreshold overrides the default significance threshold for a compared
+// metric. A change is significant when it reaches either the absolute or the percent delta.
+type ReportComparisonThreshold struct {
+	gorm.Model
+	Metric        string   `json:"metric" gorm:"type:varchar(100);uniqueIndex;not null"`
+	AbsoluteDelta *float64 `json:"absoluteDelta"`
+	PercentDelta  *float64 `json:"percentDelta"`
+}
+
+// GetReportComparisonThresholds returns the configured thresholds keyed by metric.
+func GetReportComparisonThresholds() (map[string]ReportComparisonThreshold, error) {
+	var thresholds []ReportComparisonThreshold
+	if err := config.DB.Order("metric ASC").Find(&thresholds).Error; err != nil {
+		return nil, err
+	}
+	byMetric := make(map[string]ReportComparisonThreshold, len(thresholds))
+	for _, t := range thresholds {
+		byMetric[t.Metric] = t
+	}
+	return byMetric, nil
+}
+
+// UpsertReportComparisonThreshold creates or updates the threshold for a metric.
+func UpsertReportComparisonThreshold(metric string, absoluteDelta, percentDelta *float64) (*ReportComparisonThreshold, error) {
+	var threshold ReportComparisonThreshold
+	err := config.DB.Where("metric = ?", metric).First(&threshold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		threshold = ReportComparisonThreshold{Metric: metric, AbsoluteDelta: absoluteDelta, PercentDelta: percentDelta}
+		return &threshold, config.DB.Create(&threshold).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	threshold.AbsoluteDelta = absoluteDelta
+	threshold.PercentDelta = percentDelta
+	return &threshold, config.DB.Save(&threshold).Error
+}
+
+// DeleteReportComparisonThreshold removes the override for a metric so the default applies again.
+func DeleteReportComparisonThreshold(metric string) error {
+	result := config.DB.Unscoped().Where("metric = ?", metric).Delete(&ReportComparisonThreshold{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	ReportReviewPending   = "pending"
+	ReportReviewInReview  = "in_review"
+	ReportReviewCompleted = "completed"
+)
+
+// DefaultReportTurnaroundHours applies to report types without a configured target or keyword match.
+const DefaultReportTurnaroundHours = 72
+
+var (
+	ErrReportReviewClaimed   = errors.New("report is claimed by another user")
+	ErrReportReviewCompleted = errors.New("report review is already completed")
+	ErrReportReviewNotOwner  = errors.New("report is not claimed by this user")
+)
+
+// ReportReviewItem tracks a report through the review queue: who it is assigned to, who is
+// currently reviewing it, how urgent it is and when it is due.
+type ReportReviewItem struct {
+	gorm.Model
+	ReportID        uint         `json:"reportId" gorm:"not null;uniqueIndex"`
+	PatientID       uint         `json:"patientId" gorm:"not null;index"`
+	Priority        TaskPriority `json:"priority" gorm:"type:varchar(20);default:'medium';index"`
+	PriorityReasons StringArray  `json:"priorityReasons" gorm:"type:text"`
+	DueBy           time.Time    `json:"dueBy" gorm:"index"`
+	Status          string       `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
+
+	AssigneeID *uint `json:"assigneeId" gorm:"index"`
+	TeamID     *uint `json:"teamId" gorm:"index"`
+
+	ClaimedByID    *uint      `json:"claimedById" gorm:"index"`
+	ClaimedAt      *time.Time `json:"claimedAt"`
+	ClaimExpiresAt *time.Time `json:"claimExpiresAt"`
+
+	CompletedByID   *uint      `json:"completedById" gorm:"index"`
+	CompletedAt     *time.Time `json:"completedAt" gorm:"index"`
+	TurnaroundHours *float64   `json:"turnaroundHours"`
+
+	Report      Report  `json:"-" gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE"`
+	Patient     Patient `json:"-" gorm:"foreignKey:PatientID"`
+	Assignee    *User   `json:"-" gorm:"foreignKey:AssigneeID"`
+	Team        *Team   `json:"-" gorm:"foreignKey:TeamID"`
+	ClaimedBy   *User   `json:"-" gorm:"foreignKey:ClaimedByID"`
+	CompletedBy *User   `json:"-" gorm:"foreignKey:CompletedByID"`
+}
+
+// IsClaimedByOther reports whether someone other than userID holds an unexpired claim.
+func (r *ReportReviewItem) IsClaimedByOther(userID uint, at time.Time) bool {
+	if r.ClaimedByID == nil || *r.ClaimedByID == userID {
+		return false
+	}
+	return r.ClaimExpiresAt == nil || r.ClaimExpiresAt.After(at)
+}
+
+// ReportTurnaroundTarget sets the review turnaround for a report type (billing category).
+type ReportTurnaroundTarget struct {
+	gorm.Model
+	ReportType  string `json:"reportType" gorm:"type:varchar(100);uniqueIndex;not null"`
+	TargetHours int    `json:"targetHours" gorm:"not null"`
+}
+
+// ReportReviewFilter narrows ListReportReviewItems.
+type ReportReviewFilter struct {
+	Status     string
+	Priority   string
+	AssigneeID *uint
+	TeamID     *uint
+	ClaimedBy  *uint
+	DoctorID   *uint
+	Overdue    bool
+}
+
+func reportReviewPreloads(db *gorm.DB) *gorm.DB {
+	return db.Preload("Report").Preload("Patient").Preload("Assignee").Preload("Team").
+		Preload("ClaimedBy").Preload("CompletedBy")
+}
+
+// GetReportReviewItem returns the queue entry for a report.
+func GetReportReviewItem(reportID uint) (*ReportReviewItem, error) {
+	var item ReportReviewItem
+	err := reportReviewPreloads(config.DB).Where("report_id = ?", reportID).First(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListReportReviewItems returns queue entries for reports that still exist, most urgent first.
+func ListReportReviewItems(filter ReportReviewFilter, limit, offset int) ([]ReportReviewItem, int64, error) {
+	query := config.DB.Model(&ReportReviewItem{}).
+		Joins("JOIN reports ON reports.id = report_review_items.report_id AND reports.deleted_at IS NULL")
+
+	switch filter.Status {
+	case "":
+		query = query.Where("report_review_items.status <> ?", ReportReviewCompleted)
+	case "all":
+	default:
+		query = query.Where("report_review_items.status = ?", filter.Status)
+	}
+	if filter.Priority != "" {
+		query = query.Where("report_review_items.priority = ?", filter.Priority)
+	}
+	if filter.AssigneeID != nil {
+		query = query.Where("report_review_items.assignee_id = ?", *filter.AssigneeID)
+	}
+	if filter.TeamID != nil {
+		query = query.Where("report_review_items.team_id = ?", *filter.TeamID)
+	}
+	if filter.ClaimedBy != nil {
+		query = query.Where("report_review_items.claimed_by_id = ?", *filter.ClaimedBy)
+	}
+	if filter.DoctorID != nil {
+		query = query.Where("report_review_items.patient_id IN (?)",
+			config.DB.Table("patient_doctors").Select("patient_id").
+				Where("doctor_id = ? AND deleted_at IS NULL AND (access_expires_at IS NULL OR access_expires_at > ?)", *filter.DoctorID, time.Now()))
+	}
+	if filter.Overdue {
+		query = query.Where("report_review_items.status <> ? AND report_review_items.due_by < ?", ReportReviewCompleted, time.Now())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []ReportReviewItem
+	err := reportReviewPreloads(query).
+		Order("CASE report_review_items.priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'medium' THEN 2 ELSE 3 END").
+		Order("report_review_items.due_by ASC").
+		Limit(limit).Offset(offset).
+		Find(&items).Error
+	return items, total, err
+}
+
+// SaveReportReviewItem creates or updates the queue entry for item.ReportID, keeping any
+// existing assignment and claim.
+func SaveReportReviewItem(item *ReportReviewItem) error {
+	var existing ReportReviewItem
+	err := config.DB.Unscoped().Where("report_id = ?", item.ReportID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return config.DB.Create(item).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"patient_id":       item.PatientID,
+		"priority":         item.Priority,
+		"priority_reasons": item.PriorityReasons,
+		"due_by":           item.DueBy,
+		"deleted_at":       nil,
+	}
+	if existing.Status == ReportReviewCompleted && item.Status != ReportReviewCompleted {
+		// Reopened report: back into the queue
+		updates["status"] = ReportReviewPending
+		updates["completed_by_id"] = nil
+		updates["completed_at"] = nil
+		updates["turnaround_hours"] = nil
+	}
+	item.ID = existing.ID
+	return config.DB.Unscoped().Model(&ReportReviewItem{}).Where("id = ?", existing.ID).Updates(updates).Error
+}
+
+// CompleteReportReview closes the queue entry for a report and records the turnaround from
+// ReportDate to completion.
+func CompleteReportReview(reportID uint, completedByID *uint, reportDate, completedAt time.Time) error {
+	hours := completedAt.Sub(reportDate).Hours()
+	if hours < 0 {
+		hours = 0
+	}
+	return config.DB.Model(&ReportReviewItem{}).Where("report_id = ?", reportID).Updates(map[string]interface{}{
+		"status":           ReportReviewCompleted,
+		"completed_by_id":  completedByID,
+		"completed_at":     completedAt,
+		"turnaround_hours": hours,
+		"claimed_by_id":    nil,
+		"claimed_at":       nil,
+		"claim_expires_at": nil,
+	}).Error
+}
+
+// DeleteReportReviewItem removes the queue entry for a deleted report.
+func DeleteReportReviewItem(reportID uint) error {
+	return config.DB.Where("report_id = ?", reportID).Delete(&ReportReviewItem{}).Error
+}
+
+// ClaimReportReview atomically claims a report for userID until ttl elapses. A user can
+// renew their own claim or take over one that has expired.
+func ClaimReportReview(reportID, userID uint, ttl time.Duration) error {
+	now := time.Now()
+	expires := now.Add(ttl)
+	result := config.DB.Model(&ReportReviewItem{}).
+		Where("report_id = ? AND status <> ?", reportID, ReportReviewCompleted).
+		Where("claimed_by_id IS NULL OR claimed_by_id = ? OR claim_expires_at < ?", userID, now).
+		Updates(map[string]interface{}{
+			"status":           ReportReviewInReview,
+			"claimed_by_id":    userID,
+			"claimed_at":       now,
+			"claim_expires_at": expires,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return reviewConflict(reportID)
+}
+
+// ReleaseReportReview returns a claimed report to the queue. Only the claimant can release
+// unless force is set.
+func ReleaseReportReview(reportID, userID uint, force bool) error {
+	query := config.DB.Model(&ReportReviewItem{}).
+		Where("report_id = ? AND status = ?", reportID, ReportReviewInReview)
+	if !force {
+		query = query.Where("claimed_by_id = ?", userID)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":           ReportReviewPending,
+		"claimed_by_id":    nil,
+		"claimed_at":       nil,
+		"claim_expires_at": nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var item ReportReviewItem
+	if err := config.DB.Where("report_id = ?", reportID).First(&item).Error; err != nil {
+		return err
+	}
+	switch {
+	case item.Status == ReportReviewCompleted:
+		return ErrReportReviewCompleted
+	case item.ClaimedByID == nil:
+		return nil
+	default:
+		return ErrReportReviewNotOwner
+	}
+}
+
+func reviewConflict(reportID uint) error {
+	var item ReportReviewItem
+	if err := config.DB.Where("report_id = ?", reportID).First(&item).Error; err != nil {
+		return err
+	}
+	if item.Status == ReportReviewCompleted {
+		return ErrReportReviewCompleted
+	}
+	return ErrReportReviewClaimed
+}
+
+// AssignReportReview sets the assignee and team for a report. Nil clears the field.
+func AssignReportReview(reportID uint, assigneeID, teamID *uint) error {
+	result := config.DB.Model(&ReportReviewItem{}).Where("report_id = ?", reportID).
+		Updates(map[string]interface{}{"assignee_id": assigneeID, "team_id": teamID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetReportTurnaroundTargets lists configured turnaround targets.
+func GetReportTurnaroundTargets() ([]ReportTurnaroundTarget, error) {
+	var targets []ReportTurnaroundTarget
+	err := config.DB.Order("report_type ASC").Find(&targets).Error
+	return targets, err
+}
+
+// UpsertReportTurnaroundTarget creates or updates the target for a report type.
+func UpsertReportTurnaroundTarget(reportType string, hours int) (*ReportTurnaroundTarget, error) {
+	reportType = strings.ToLower(strings.TrimSpace(reportType))
+	var target ReportTurnaroundTarget
+	err := config.DB.Where("report_type = ?", reportType).First(&target).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		target = ReportTurnaroundTarget{ReportType: reportType, TargetHours: hours}
+		return &target, config.DB.Create(&target).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	target.TargetHours = hours
+	return &target, config.DB.Save(&target).Error
+}
+
+// DeleteReportTurnaroundTarget removes a configured target so the default applies again. The
+// row is removed outright so the report type can be configured again later.
+func DeleteReportTurnaroundTarget(id uint) error {
+	return config.DB.Unscoped().Delete(&ReportTurnaroundTarget{}, id).Error
+}
+
+// ReportTurnaroundHours returns the review target for a report type. Configured targets win;
+// otherwise symptom and alert transmissions get 24h, in-clinic checks 48h and remote
+// follow-ups 120h.
+func ReportTurnaroundHours(reportType string) int {
+	normalized := strings.ToLower(strings.TrimSpace(reportType))
+	if normalized != "" {
+		var target ReportTurnaroundTarget
+		if err := config.DB.Where("report_type = ?", normalized).First(&target).Error; err == nil && target.TargetHours > 0 {
+			return target.TargetHours
+		}
+	}
+
+	switch {
+	case strings.Contains(normalized, "symptom"), strings.Contains(normalized, "alert"), strings.Contains(normalized, "urgent"):
+		return 24
+	case strings.Contains(normalized, "clinic"):
+		return 48
+	case strings.Contains(normalized, "remote"):
+		return 120
+	}
+	return DefaultReportTurnaroundHours
+}
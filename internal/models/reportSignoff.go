@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// Report sign-off states. A report completed by device staff waits for the responsible
+// physician, who either signs it (final) or returns it with comments.
+const (
+	SignoffAwaitingPhysician = "awaiting_physician"
+	SignoffReturned          = "returned"
+	SignoffSigned            = "signed"
+)
+
+// Sign-off history actions.
+const (
+	SignoffActionSubmitted = "submitted"
+	SignoffActionApproved  = "approved"
+	SignoffActionReturned  = "returned"
+)
+
+// ReportStatusReviewed is the ReportStatus given to a report once the physician signs it.
+const ReportStatusReviewed = "Reviewed"
+
+var ErrSignoffNotAwaiting = errors.New("report is not awaiting physician sign-off")
+
+// ReportSignoffEvent records one step of the sign-off workflow.
+type ReportSignoffEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ReportID  uint      `json:"reportId" gorm:"not null;index"`
+	Action    string    `json:"action" gorm:"type:varchar(20);not null"`
+	UserID    *uint     `json:"userId"`
+	UserName  string    `json:"userName" gorm:"type:varchar(255)"`
+	Comments  string    `json:"comments" gorm:"type:text"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Report Report `json:"-" gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE"`
+}
+
+// ResponsibleDoctorID returns the physician who should co-sign a report: the report's doctor,
+// otherwise the patient's primary doctor, otherwise any doctor linked to the patient.
+func ResponsibleDoctorID(report *Report) (*uint, error) {
+	if report.DoctorID != nil {
+		return report.DoctorID, nil
+	}
+	var pd PatientDoctor
+	err := config.DB.Where("patient_id = ?", report.PatientID).
+		Where("access_expires_at IS NULL OR access_expires_at > ?", time.Now()).
+		Order("is_primary DESC, id ASC").
+		First(&pd).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pd.DoctorID, nil
+}
+
+// GetPhysicianUsers returns the doctor and staff doctor accounts linked to a doctor record.
+func GetPhysicianUsers(doctorID uint) ([]User, error) {
+	var users []User
+	err := config.DB.Where("doctor_id = ? AND role IN ?", doctorID, []string{"doctor", "staff_doctor"}).
+		Find(&users).Error
+	return users, err
+}
+
+// RecordReportSignoff updates the report's sign-off fields and appends a history entry in one transaction.
+func RecordReportSignoff(reportID uint, updates map[string]interface{}, event *ReportSignoffEvent) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Report{}).Where("id = ?", reportID).Updates(updates).Error; err != nil {
+			return err
+		}
+		event.ReportID = reportID
+		return tx.Create(event).Error
+	})
+}
+
+// GetReportSignoffEvents returns the sign-off history for a report, oldest first.
+func GetReportSignoffEvents(reportID uint) ([]ReportSignoffEvent, error) {
+	var events []ReportSignoffEvent
+	err := config.DB.Where("report_id = ?", reportID).Order("created_at ASC, id ASC").Find(&events).Error
+	return events, err
+}
+
+// GetReportsAwaitingSignoff lists reports waiting for physician sign-off, oldest first. A
+// non-nil doctorID limits the list to that physician.
+func GetReportsAwaitingSignoff(doctorID *uint, limit, offset int) ([]Report, int64, error) {
+	query := config.DB.Model(&Report{}).Where("signoff_status = ?", SignoffAwaitingPhysician)
+	if doctorID != nil {
+		query = query.Where("signoff_doctor_id = ?", *doctorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reports []Report
+	err := query.Preload("Patient").
+		Order("report_date ASC, id ASC").
+		Limit(limit).Offset(offset).
+		Find(&reports).Error
+	return reports, total, err
+}
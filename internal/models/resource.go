@@ -0,0 +1,301 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// ResourceKind is what a clinic resource is.
+type ResourceKind string
+
+const (
+	ResourceKindRoom       ResourceKind = "room"
+	ResourceKindProgrammer ResourceKind = "programmer" // A manufacturer's device programmer
+	ResourceKindStaff      ResourceKind = "staff"
+)
+
+// ErrResourceUnavailable is matched by ResourceUnavailableError.
+var ErrResourceUnavailable = errors.New("required resource is not available")
+
+// ClinicResource is a room, programmer or member of staff that clinic appointments are
+// allocated to, one appointment at a time.
+type ClinicResource struct {
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	Name         string       `json:"name" gorm:"type:varchar(100);not null"`
+	Kind         ResourceKind `json:"kind" gorm:"type:varchar(20);not null;index"`
+	Manufacturer string       `json:"manufacturer" gorm:"type:varchar(255)"` // Programmers only
+	UserID       *uint        `json:"userId,omitempty" gorm:"index"`         // Staff only, optional
+	User         *User        `json:"user,omitempty"`
+	Active       bool         `json:"active" gorm:"not null"`
+	Notes        string       `json:"notes" gorm:"type:text"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+// Validate returns a message if the resource is incomplete.
+func (r *ClinicResource) Validate() string {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Manufacturer = strings.TrimSpace(r.Manufacturer)
+	if r.Name == "" || len(r.Name) > 100 {
+		return "name is required and must be at most 100 characters"
+	}
+	switch r.Kind {
+	case ResourceKindProgrammer:
+		if r.Manufacturer == "" {
+			return "manufacturer is required for programmers"
+		}
+	case ResourceKindRoom, ResourceKindStaff:
+		r.Manufacturer = ""
+	default:
+		return "kind must be room, programmer or staff"
+	}
+	if r.Kind != ResourceKindStaff {
+		r.UserID = nil
+	}
+	return ""
+}
+
+// ResourceRequirement is a kind of resource an appointment needs, and for programmers the
+// manufacturer.
+type ResourceRequirement struct {
+	Kind         ResourceKind `json:"kind"`
+	Manufacturer string       `json:"manufacturer,omitempty"`
+}
+
+func (r ResourceRequirement) String() string {
+	switch r.Kind {
+	case ResourceKindProgrammer:
+		return r.Manufacturer + " programmer"
+	case ResourceKindStaff:
+		return "staff member"
+	}
+	return string(r.Kind)
+}
+
+// ResourceUnavailableError is returned when no resource meeting a requirement is free for
+// the whole appointment.
+type ResourceUnavailableError struct {
+	Requirement ResourceRequirement
+}
+
+func (e *ResourceUnavailableError) Error() string {
+	return fmt.Sprintf("no %s is free at this time", e.Requirement)
+}
+
+func (e *ResourceUnavailableError) Is(target error) bool {
+	return target == ErrResourceUnavailable
+}
+
+// AppointmentResource allocates a resource to an appointment for its whole length.
+type AppointmentResource struct {
+	ID            uint            `json:"id" gorm:"primaryKey"`
+	AppointmentID uint            `json:"appointmentId" gorm:"not null;index"`
+	Appointment   *Appointment    `json:"appointment,omitempty"`
+	ResourceID    uint            `json:"resourceId" gorm:"not null;index"`
+	Resource      *ClinicResource `json:"resource,omitempty"`
+	Kind          ResourceKind    `json:"kind" gorm:"type:varchar(20);not null"`
+	Manufacturer  string          `json:"manufacturer,omitempty" gorm:"type:varchar(255)"` // The requirement it meets
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+// GetClinicResources lists resources by kind and name, optionally only one kind or only
+// active ones.
+func GetClinicResources(kind ResourceKind, activeOnly bool) ([]ClinicResource, error) {
+	resources := []ClinicResource{}
+	query := config.DB.Preload("User", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "username", "full_name")
+	})
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	err := query.Order("kind ASC, name ASC, id ASC").Find(&resources).Error
+	return resources, err
+}
+
+// GetClinicResource returns a resource, or nil if it does not exist.
+func GetClinicResource(id uint) (*ClinicResource, error) {
+	var resource ClinicResource
+	result := config.DB.Limit(1).Find(&resource, id)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &resource, nil
+}
+
+// GetResourceRequirements returns what a clinic appointment for the patient needs: a room,
+// a member of staff, and a programmer from the manufacturer of each of the patient's
+// active implanted devices. A kind is only required once the clinic has an active resource
+// of that kind, so booking works as before until resources are set up.
+func GetResourceRequirements(db *gorm.DB, patientID uint) ([]ResourceRequirement, error) {
+	var kinds []ResourceKind
+	if err := db.Model(&ClinicResource{}).Where("active = ?", true).Distinct().Pluck("kind", &kinds).Error; err != nil {
+		return nil, err
+	}
+	configured := make(map[ResourceKind]bool)
+	for _, kind := range kinds {
+		configured[kind] = true
+	}
+
+	var requirements []ResourceRequirement
+	for _, kind := range []ResourceKind{ResourceKindRoom, ResourceKindStaff} {
+		if configured[kind] {
+			requirements = append(requirements, ResourceRequirement{Kind: kind})
+		}
+	}
+	if !configured[ResourceKindProgrammer] {
+		return requirements, nil
+	}
+
+	var manufacturers []string
+	err := db.Table("implanted_devices").
+		Joins("JOIN devices ON devices.id = implanted_devices.device_id").
+		Where("implanted_devices.patient_id = ? AND implanted_devices.deleted_at IS NULL AND implanted_devices.explanted_at IS NULL", patientID).
+		Distinct().Pluck("devices.manufacturer", &manufacturers).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var programmers []ResourceRequirement
+	for _, manufacturer := range manufacturers {
+		manufacturer = strings.TrimSpace(manufacturer)
+		if manufacturer == "" || seen[strings.ToLower(manufacturer)] {
+			continue
+		}
+		seen[strings.ToLower(manufacturer)] = true
+		programmers = append(programmers, ResourceRequirement{Kind: ResourceKindProgrammer, Manufacturer: manufacturer})
+	}
+	sort.Slice(programmers, func(i, j int) bool { return programmers[i].Manufacturer < programmers[j].Manufacturer })
+	return append(requirements, programmers...), nil
+}
+
+// resourceBusy finds allocations of the resource in the outer query to another live
+// appointment overlapping a time range.
+const resourceBusy = `SELECT 1 FROM appointment_resources ar JOIN appointments a ON a.id = ar.appointment_id
+	WHERE ar.resource_id = clinic_resources.id AND a.id <> ? AND a.deleted_at IS NULL AND a.status <> ?
+	AND a.start_at < ? AND a.end_at > ?`
+
+// allocateResources replaces the appointment's resources with a free one for each of its
+// requirements, taking the lowest-numbered free resource of each. Appointments that hold no
+// clinic slot need no resources. The candidate resources are locked first, so concurrent
+// bookings cannot take the same one.
+func allocateResources(tx *gorm.DB, appointment *Appointment) error {
+	if err := tx.Where("appointment_id = ?", appointment.ID).Delete(&AppointmentResource{}).Error; err != nil {
+		return err
+	}
+	if !appointment.HoldsSlot() || appointment.EndAt == nil {
+		return nil
+	}
+	requirements, err := GetResourceRequirements(tx, appointment.PatientID)
+	if err != nil {
+		return err
+	}
+
+	for _, requirement := range requirements {
+		candidates := tx.Model(&ClinicResource{}).Where("kind = ? AND active = ?", requirement.Kind, true)
+		if requirement.Manufacturer != "" {
+			candidates = candidates.Where("LOWER(manufacturer) = ?", strings.ToLower(requirement.Manufacturer))
+		}
+		var locked []uint
+		if err := forUpdate(candidates.Session(&gorm.Session{})).Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+
+		var resource ClinicResource
+		result := candidates.Session(&gorm.Session{}).
+			Where("NOT EXISTS ("+resourceBusy+")", appointment.ID, AppointmentStatusCancelled, *appointment.EndAt, appointment.StartAt).
+			Order("id ASC").Limit(1).Find(&resource)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &ResourceUnavailableError{Requirement: requirement}
+		}
+
+		allocation := AppointmentResource{
+			AppointmentID: appointment.ID,
+			ResourceID:    resource.ID,
+			Kind:          requirement.Kind,
+			Manufacturer:  requirement.Manufacturer,
+		}
+		if err := tx.Create(&allocation).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAppointmentResources lists the resources allocated to an appointment.
+func GetAppointmentResources(appointmentID uint) ([]AppointmentResource, error) {
+	allocations := []AppointmentResource{}
+	err := config.DB.Preload("Resource").Where("appointment_id = ?", appointmentID).
+		Order("kind ASC, id ASC").Find(&allocations).Error
+	return allocations, err
+}
+
+// ResourceBooking is one appointment on a resource's daily schedule.
+type ResourceBooking struct {
+	AppointmentID uint      `json:"appointmentId"`
+	Title         string    `json:"title"`
+	PatientID     uint      `json:"patientId"`
+	PatientName   string    `json:"patientName"`
+	StartAt       time.Time `json:"startAt"`
+	EndAt         time.Time `json:"endAt"`
+	Manufacturer  string    `json:"manufacturer,omitempty"`
+}
+
+// ResourceSchedule is a resource and the appointments allocated to it.
+type ResourceSchedule struct {
+	Resource ClinicResource    `json:"resource"`
+	Bookings []ResourceBooking `json:"bookings"`
+}
+
+// GetResourceSchedule returns every resource with its live appointments between from and
+// to, in time order. Inactive resources are included only if they still have bookings.
+func GetResourceSchedule(from, to time.Time) ([]ResourceSchedule, error) {
+	resources, err := GetClinicResources("", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ResourceID uint
+		ResourceBooking
+	}
+	err = config.DB.Table("appointment_resources").
+		Select("appointment_resources.resource_id, appointment_resources.manufacturer, a.id AS appointment_id, a.title, "+
+			"a.patient_id, p.first_name || ' ' || p.last_name AS patient_name, a.start_at, a.end_at").
+		Joins("JOIN appointments a ON a.id = appointment_resources.appointment_id").
+		Joins("JOIN patients p ON p.id = a.patient_id").
+		Where("a.deleted_at IS NULL AND a.status <> ? AND a.start_at < ? AND a.end_at > ?", AppointmentStatusCancelled, to, from).
+		Order("a.start_at ASC, a.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	bookings := make(map[uint][]ResourceBooking)
+	for _, row := range rows {
+		bookings[row.ResourceID] = append(bookings[row.ResourceID], row.ResourceBooking)
+	}
+
+	schedule := []ResourceSchedule{}
+	for _, resource := range resources {
+		if !resource.Active && len(bookings[resource.ID]) == 0 {
+			continue
+		}
+		entry := ResourceSchedule{Resource: resource, Bookings: bookings[resource.ID]}
+		if entry.Bookings == nil {
+			entry.Bookings = []ResourceBooking{}
+		}
+		schedule = append(schedule, entry)
+	}
+	return schedule, nil
+}
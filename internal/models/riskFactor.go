@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// PatientRiskFactors holds the clinical history used for stroke and bleeding risk scores.
+// Age and sex come from the patient record and are not stored here.
+type PatientRiskFactors struct {
+	gorm.Model
+	PatientID uint `json:"patientId" gorm:"not null;uniqueIndex"`
+
+	// CHA2DS2-VASc
+	CongestiveHeartFailure bool `json:"congestiveHeartFailure"`
+	Hypertension           bool `json:"hypertension"`
+	Diabetes               bool `json:"diabetes"`
+	StrokeTIA              bool `json:"strokeTia"` // prior stroke, TIA or thromboembolism
+	VascularDisease        bool `json:"vascularDisease"`
+
+	// HAS-BLED (stroke history is shared with CHA2DS2-VASc)
+	UncontrolledHypertension bool `json:"uncontrolledHypertension"` // systolic > 160 mmHg
+	AbnormalRenalFunction    bool `json:"abnormalRenalFunction"`
+	AbnormalLiverFunction    bool `json:"abnormalLiverFunction"`
+	BleedingHistory          bool `json:"bleedingHistory"`
+	LabileINR                bool `json:"labileInr"`
+	AntiplateletOrNSAID      bool `json:"antiplateletOrNsaid"`
+	AlcoholExcess            bool `json:"alcoholExcess"`
+
+	Notes       string `json:"notes" gorm:"type:text"`
+	UpdatedByID *uint  `json:"updatedById"`
+
+	Patient Patient `json:"-" gorm:"foreignKey:PatientID;constraint:OnDelete:CASCADE"`
+}
+
+// RiskScore is a computed score with the components that contributed to it.
+type RiskScore struct {
+	Score      int      `json:"score"`
+	Components []string `json:"components"`
+	Elevated   bool     `json:"elevated"`
+}
+
+// dobLayouts are the date formats seen in Patient.DOB.
+var dobLayouts = []string{"2006-01-02", time.RFC3339, "02/01/2006", "2006/01/02"}
+
+// PatientAge returns the patient's age in whole years at the given time.
+// ok is false when the DOB is missing or cannot be parsed.
+func PatientAge(dob string, at time.Time) (age int, ok bool) {
+	dob = strings.TrimSpace(dob)
+	if dob == "" {
+		return 0, false
+	}
+	var born time.Time
+	var err error
+	for _, layout := range dobLayouts {
+		if born, err = time.Parse(layout, dob); err == nil {
+			break
+		}
+	}
+	if err != nil && len(dob) >= 10 {
+		born, err = time.Parse("2006-01-02", dob[:10])
+	}
+	if err != nil || born.After(at) {
+		return 0, false
+	}
+
+	// Compare month and day rather than day of year, which shifts by one after February
+	// in leap years. A 29 February birthday is reached on 1 March in other years.
+	age = at.Year() - born.Year()
+	if at.Month() < born.Month() || (at.Month() == born.Month() && at.Day() < born.Day()) {
+		age--
+	}
+	return age, true
+}
+
+// IsFemale reports whether the stored gender should score as female.
+func IsFemale(gender string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(gender)), "f")
+}
+
+// CHA2DS2VASc computes the stroke risk score. The score counts as elevated at 2 or more
+// for men and 3 or more for women, where sex alone contributes one point.
+func (rf *PatientRiskFactors) CHA2DS2VASc(age int, ageKnown, female bool) RiskScore {
+	s := RiskScore{Components: []string{}}
+	add := func(points int, label string) {
+		s.Score += points
+		s.Components = append(s.Components, label)
+	}
+
+	if rf.CongestiveHeartFailure {
+		add(1, "Congestive heart failure")
+	}
+	if rf.Hypertension {
+		add(1, "Hypertension")
+	}
+	if ageKnown && age >= 75 {
+		add(2, "Age 75 or over")
+	} else if ageKnown && age >= 65 {
+		add(1, "Age 65-74")
+	}
+	if rf.Diabetes {
+		add(1, "Diabetes")
+	}
+	if rf.StrokeTIA {
+		add(2, "Prior stroke, TIA or thromboembolism")
+	}
+	if rf.VascularDisease {
+		add(1, "Vascular disease")
+	}
+	if female {
+		add(1, "Female sex")
+	}
+
+	threshold := 2
+	if female {
+		threshold = 3
+	}
+	s.Elevated = s.Score >= threshold
+	return s
+}
+
+// HASBLED computes the bleeding risk score. A score of 3 or more counts as elevated.
+// Labile INR only applies to patients on a vitamin K antagonist, so it is left to the user.
+func (rf *PatientRiskFactors) HASBLED(age int, ageKnown bool) RiskScore {
+	s := RiskScore{Components: []string{}}
+	add := func(label string) {
+		s.Score++
+		s.Components = append(s.Components, label)
+	}
+
+	if rf.UncontrolledHypertension {
+		add("Uncontrolled hypertension")
+	}
+	if rf.AbnormalRenalFunction {
+		add("Abnormal renal function")
+	}
+	if rf.AbnormalLiverFunction {
+		add("Abnormal liver function")
+	}
+	if rf.StrokeTIA {
+		add("Prior stroke")
+	}
+	if rf.BleedingHistory {
+		add("Bleeding history or predisposition")
+	}
+	if rf.LabileINR {
+		add("Labile INR")
+	}
+	if ageKnown && age > 65 {
+		add("Elderly (over 65)")
+	}
+	if rf.AntiplateletOrNSAID {
+		add("Antiplatelet or NSAID use")
+	}
+	if rf.AlcoholExcess {
+		add("Alcohol excess")
+	}
+
+	s.Elevated = s.Score >= 3
+	return s
+}
+
+// GetPatientRiskFactors returns the stored risk factors, or an empty record when none
+// have been entered yet.
+func GetPatientRiskFactors(patientID uint) (*PatientRiskFactors, error) {
+	var rf PatientRiskFactors
+	err := config.DB.Where("patient_id = ?", patientID).First(&rf).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &PatientRiskFactors{PatientID: patientID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rf, nil
+}
+
+// SavePatientRiskFactors creates or updates the single risk factor record for a patient.
+func SavePatientRiskFactors(rf *PatientRiskFactors) error {
+	var existing PatientRiskFactors
+	err := config.DB.Where("patient_id = ?", rf.PatientID).First(&existing).Error
+	if err == nil {
+		rf.ID = existing.ID
+		rf.CreatedAt = existing.CreatedAt
+		return config.DB.Omit("Patient").Save(rf).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return config.DB.Omit("Patient").Create(rf).Error
+}
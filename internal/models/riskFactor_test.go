@@ -0,0 +1,114 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatientAge_BirthdayBoundaries(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatalf("bad date %q: %v", s, err)
+		}
+		return d
+	}
+
+	cases := []struct {
+		name string
+		dob  string
+		at   string
+		want int
+	}{
+		{"day before birthday", "1950-06-15", "2020-06-14", 69},
+		{"on birthday", "1950-06-15", "2020-06-15", 70},
+		{"born 1 March in a leap year, first birthday", "2000-03-01", "2001-03-01", 1},
+		{"born 1 March, birthday in a leap year", "1999-03-01", "2000-03-01", 1},
+		{"born 1 March, 29 February of a leap year", "1999-03-01", "2000-02-29", 0},
+		{"born 31 December, birthday in a leap year", "1999-12-31", "2000-12-31", 1},
+		{"born 31 December, day before in a leap year", "1999-12-31", "2000-12-30", 0},
+		{"born 29 February, 28 February of a common year", "2000-02-29", "2001-02-28", 0},
+		{"born 29 February, 1 March of a common year", "2000-02-29", "2001-03-01", 1},
+		{"born 29 February, next 29 February", "2000-02-29", "2004-02-29", 4},
+		{"day/month layout", "15/06/1950", "2020-06-15", 70},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := PatientAge(tc.dob, day(tc.at))
+			if !ok {
+				t.Fatalf("PatientAge(%q) reported an unknown age", tc.dob)
+			}
+			if got != tc.want {
+				t.Fatalf("PatientAge(%q, %s) = %d, want %d", tc.dob, tc.at, got, tc.want)
+			}
+		})
+	}
+
+	for _, dob := range []string{"", "unknown", "2030-01-01"} {
+		if _, ok := PatientAge(dob, day("2020-01-01")); ok {
+			t.Fatalf("expected no age for DOB %q", dob)
+		}
+	}
+}
+
+func TestCHA2DS2VASc_Thresholds(t *testing.T) {
+	cases := []struct {
+		name     string
+		factors  PatientRiskFactors
+		age      int
+		ageKnown bool
+		female   bool
+		want     int
+		elevated bool
+	}{
+		{"no factors", PatientRiskFactors{}, 50, true, false, 0, false},
+		{"female sex alone", PatientRiskFactors{}, 50, true, true, 1, false},
+		{"man aged 65", PatientRiskFactors{Hypertension: true}, 65, true, false, 2, true},
+		{"woman aged 65", PatientRiskFactors{Hypertension: true}, 65, true, true, 3, true},
+		{"woman aged 64", PatientRiskFactors{Hypertension: true}, 64, true, true, 2, false},
+		{"aged 75", PatientRiskFactors{}, 75, true, false, 2, true},
+		{"unknown age", PatientRiskFactors{}, 0, false, false, 0, false},
+		{"prior stroke", PatientRiskFactors{StrokeTIA: true}, 40, true, false, 2, true},
+		{"all factors", PatientRiskFactors{
+			CongestiveHeartFailure: true, Hypertension: true, Diabetes: true, StrokeTIA: true, VascularDisease: true,
+		}, 80, true, true, 9, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.factors.CHA2DS2VASc(tc.age, tc.ageKnown, tc.female)
+			if s.Score != tc.want || s.Elevated != tc.elevated {
+				t.Fatalf("got score %d elevated %v, want %d elevated %v (%v)", s.Score, s.Elevated, tc.want, tc.elevated, s.Components)
+			}
+			if len(s.Components) == 0 && s.Score != 0 {
+				t.Fatalf("score %d has no components", s.Score)
+			}
+		})
+	}
+}
+
+func TestHASBLED_Thresholds(t *testing.T) {
+	cases := []struct {
+		name     string
+		factors  PatientRiskFactors
+		age      int
+		want     int
+		elevated bool
+	}{
+		{"no factors", PatientRiskFactors{}, 60, 0, false},
+		{"aged 65 is not elderly", PatientRiskFactors{}, 65, 0, false},
+		{"aged 66", PatientRiskFactors{}, 66, 1, false},
+		{"three factors", PatientRiskFactors{UncontrolledHypertension: true, BleedingHistory: true}, 70, 3, true},
+		{"stroke and alcohol", PatientRiskFactors{StrokeTIA: true, AlcoholExcess: true}, 40, 2, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.factors.HASBLED(tc.age, true)
+			if s.Score != tc.want || s.Elevated != tc.elevated {
+				t.Fatalf("got score %d elevated %v, want %d elevated %v (%v)", s.Score, s.Elevated, tc.want, tc.elevated, s.Components)
+			}
+		})
+	}
+}
@@ -23,6 +23,21 @@ const (
 	TaskPriorityUrgent TaskPriority = "urgent"
 )
 
+var taskPriorityRank = map[TaskPriority]int{
+	TaskPriorityLow:    0,
+	TaskPriorityMedium: 1,
+	TaskPriorityHigh:   2,
+	TaskPriorityUrgent: 3,
+}
+
+// TaskPriorityRank orders priorities from low (0) to urgent (3); unknown values rank -1.
+func TaskPriorityRank(p TaskPriority) int {
+	if rank, ok := taskPriorityRank[p]; ok {
+		return rank
+	}
+	return -1
+}
+
 type Task struct {
 	ID          uint         `json:"id" gorm:"primaryKey"`
 	Title       string       `json:"title" gorm:"not null"`
@@ -42,15 +57,27 @@ type Task struct {
 	AssignedToTeamID *uint `json:"assignedToTeamId" gorm:"index"`
 	AssignedToTeam   *Team `json:"assignedToTeam,omitempty" gorm:"foreignKey:AssignedToTeamID"`
 
+	// Why team auto-assignment picked the assignee, or why it could not
+	AssignmentReason string `json:"assignmentReason,omitempty" gorm:"type:text"`
+
 	CreatedByID uint `json:"createdById" gorm:"not null;index"`
 	CreatedBy   User `json:"createdBy" gorm:"foreignKey:CreatedByID"`
 
 	TemplateID *uint         `json:"templateId" gorm:"index"`
 	Template   *TaskTemplate `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
 
+	// Recurring tasks: the series the task is an occurrence of and its position in it
+	SeriesID    *uint       `json:"seriesId" gorm:"index"`
+	SeriesIndex int         `json:"seriesIndex"`
+	Series      *TaskSeries `json:"series,omitempty" gorm:"foreignKey:SeriesID"`
+
 	Tags  []Tag      `json:"tags,omitempty" gorm:"many2many:task_tags;"`
 	Notes []TaskNote `json:"notes,omitempty" gorm:"foreignKey:TaskID"`
 
+	// Checklist items, and the tasks that must be done before this one can be completed
+	Checklist []TaskChecklistItem `json:"checklist,omitempty" gorm:"foreignKey:TaskID"`
+	BlockedBy []Task              `json:"blockedBy,omitempty" gorm:"many2many:task_dependencies;joinForeignKey:TaskID;joinReferences:DependsOnID"`
+
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -67,6 +94,9 @@ type TaskNote struct {
 	UpdatedBy     *uint          `json:"updatedBy"`
 	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
 	UpdatedByUser *User          `json:"updatedByUser,omitempty" gorm:"foreignKey:UpdatedBy"`
+
+	// Replies point at the note that starts their thread
+	ParentID *uint `json:"parentId" gorm:"index"`
 }
 
 type TaskTemplate struct {
@@ -81,4 +111,34 @@ type TaskTemplate struct {
 	CreatedAt       time.Time      `json:"createdAt"`
 	UpdatedAt       time.Time      `json:"updatedAt"`
 	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Tasks created from the template repeat on this schedule when set
+	Recurrence *RecurrenceRule `json:"recurrence" gorm:"type:text"`
+
+	// Checklist copied into tasks created from the template
+	Checklist ChecklistTitles `json:"checklist" gorm:"type:text"`
+
+	// A workflow template creates one task per step, linked by their dependencies
+	Steps TemplateSteps `json:"steps" gorm:"type:text"`
+}
+
+// CreateTask saves a new task with its tags in tx, starting a recurring series when rule is
+// set. A task given only to a team is auto-assigned under the team's strategy.
+func CreateTask(tx *gorm.DB, task *Task, rule *RecurrenceRule, tags []Tag) error {
+	if rule != nil {
+		_, err := CreateTaskSeries(tx, *rule, task, tags)
+		return err
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := AutoAssignTask(tx, task, tags); err != nil {
+			return err
+		}
+		if err := tx.Create(task).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			return tx.Model(task).Association("Tags").Append(tags)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	EscalationNotifyAssignee  = "notify_assignee"
+	EscalationReassignManager = "reassign_manager"
+	EscalationRaisePriority   = "raise_priority"
+	EscalationReassignTeam    = "reassign_team" // Another available member, by the team's strategy
+)
+
+// EscalationStep is one action a policy takes once a task is AfterHours overdue.
+type EscalationStep struct {
+	AfterHours int          `json:"afterHours"`
+	Action     string       `json:"action"`
+	Priority   TaskPriority `json:"priority,omitempty"` // raise_priority target; urgent when empty
+}
+
+// EscalationSteps is stored as a JSON array.
+type EscalationSteps []EscalationStep
+
+// Scan implements the sql.Scanner interface
+func (s *EscalationSteps) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = EscalationSteps{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("failed to unmarshal EscalationSteps value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (s EscalationSteps) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// TaskEscalationPolicy escalates open overdue tasks. It applies to tasks matching every
+// criterion that is set, or to all tasks when none is. When several policies match, the most
+// specific wins: template, then tag, then priority.
+type TaskEscalationPolicy struct {
+	gorm.Model
+	Name        string          `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Enabled     bool            `json:"enabled" gorm:"default:true"`
+	Priority    *TaskPriority   `json:"priority" gorm:"type:varchar(20)"`
+	TagID       *uint           `json:"tagId"`
+	TemplateID  *uint           `json:"templateId"`
+	Steps       EscalationSteps `json:"steps" gorm:"type:text"`
+	CreatedByID uint            `json:"createdById" gorm:"not null"` // Escalation notes are written as this user
+}
+
+// TaskEscalation records a policy step applied to a task. Each step runs once per due date,
+// so rescheduling a task starts its escalation over.
+type TaskEscalation struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TaskID       uint      `json:"taskId" gorm:"not null;uniqueIndex:idx_task_escalation_step"`
+	PolicyID     uint      `json:"policyId" gorm:"not null;uniqueIndex:idx_task_escalation_step"`
+	StepIndex    int       `json:"stepIndex" gorm:"uniqueIndex:idx_task_escalation_step"`
+	DueDate      time.Time `json:"dueDate" gorm:"uniqueIndex:idx_task_escalation_step"`
+	Action       string    `json:"action" gorm:"type:varchar(30);not null"`
+	OverdueHours int       `json:"overdueHours"`
+	Detail       string    `json:"detail" gorm:"type:text"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Normalize checks the policy and sorts its steps by AfterHours.
+func (p *TaskEscalationPolicy) Normalize() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.Priority != nil && TaskPriorityRank(*p.Priority) < 0 {
+		return fmt.Errorf("unknown priority %q", *p.Priority)
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("at least one step is required")
+	}
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if step.AfterHours <= 0 {
+			return errors.New("afterHours must be positive")
+		}
+		switch step.Action {
+		case EscalationNotifyAssignee, EscalationReassignManager, EscalationReassignTeam:
+		case EscalationRaisePriority:
+			if step.Priority == "" {
+				step.Priority = TaskPriorityUrgent
+			}
+			if TaskPriorityRank(step.Priority) < 0 {
+				return fmt.Errorf("unknown priority %q", step.Priority)
+			}
+		default:
+			return fmt.Errorf("unknown action %q", step.Action)
+		}
+	}
+	sort.SliceStable(p.Steps, func(i, j int) bool { return p.Steps[i].AfterHours < p.Steps[j].AfterHours })
+	return nil
+}
+
+// Matches reports whether the policy applies to task. task.Tags must be loaded when the
+// policy filters on a tag.
+func (p *TaskEscalationPolicy) Matches(task *Task) bool {
+	if p.Priority != nil && task.Priority != *p.Priority {
+		return false
+	}
+	if p.TemplateID != nil && (task.TemplateID == nil || *task.TemplateID != *p.TemplateID) {
+		return false
+	}
+	if p.TagID != nil {
+		found := false
+		for _, tag := range task.Tags {
+			if tag.ID == *p.TagID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Specificity ranks how narrowly the policy is targeted; higher wins.
+func (p *TaskEscalationPolicy) Specificity() int {
+	score := 0
+	if p.TemplateID != nil {
+		score += 4
+	}
+	if p.TagID != nil {
+		score += 2
+	}
+	if p.Priority != nil {
+		score++
+	}
+	return score
+}
+
+// SelectTaskEscalationPolicy returns the most specific policy matching task, preferring the
+// oldest policy on a tie, or nil when none applies.
+func SelectTaskEscalationPolicy(policies []TaskEscalationPolicy, task *Task) *TaskEscalationPolicy {
+	var best *TaskEscalationPolicy
+	for i := range policies {
+		policy := &policies[i]
+		if !policy.Enabled || !policy.Matches(task) {
+			continue
+		}
+		if best == nil || policy.Specificity() > best.Specificity() {
+			best = policy
+		}
+	}
+	return best
+}
+
+// GetTaskEscalationPolicies lists policies, oldest first.
+func GetTaskEscalationPolicies() ([]TaskEscalationPolicy, error) {
+	var policies []TaskEscalationPolicy
+	err := config.DB.Order("id ASC").Find(&policies).Error
+	return policies, err
+}
+
+// GetTaskEscalationPolicy returns a policy, or nil if it does not exist.
+func GetTaskEscalationPolicy(id uint) (*TaskEscalationPolicy, error) {
+	var policy TaskEscalationPolicy
+	err := config.DB.First(&policy, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeleteTaskEscalationPolicy removes a policy outright so its name can be reused.
+func DeleteTaskEscalationPolicy(id uint) error {
+	result := config.DB.Unscoped().Delete(&TaskEscalationPolicy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetOverdueOpenTasks returns pending and in-progress tasks due before cutoff, with tags.
+func GetOverdueOpenTasks(cutoff time.Time) ([]Task, error) {
+	var tasks []Task
+	err := config.DB.Preload("Tags").
+		Where("status IN ? AND due_date IS NOT NULL AND due_date < ?", []TaskStatus{TaskStatusPending, TaskStatusInProgress}, cutoff).
+		Order("due_date ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ClaimTaskEscalation inserts the escalation record in tx. It returns false when the step
+// was already applied for this due date.
+func ClaimTaskEscalation(tx *gorm.DB, escalation *TaskEscalation) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(escalation)
+	return result.RowsAffected == 1, result.Error
+}
+
+// GetTaskEscalations returns the escalation history of a task, oldest first.
+func GetTaskEscalations(taskID uint) ([]TaskEscalation, error) {
+	var escalations []TaskEscalation
+	err := config.DB.Where("task_id = ?", taskID).Order("created_at ASC, id ASC").Find(&escalations).Error
+	return escalations, err
+}
@@ -0,0 +1,472 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RecurrenceFrequency string
+
+const (
+	RecurrenceDaily   RecurrenceFrequency = "daily"
+	RecurrenceWeekly  RecurrenceFrequency = "weekly"
+	RecurrenceMonthly RecurrenceFrequency = "monthly"
+	RecurrenceYearly  RecurrenceFrequency = "yearly"
+)
+
+var recurrenceWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RecurrenceRule is an RRULE-style schedule: every Interval days, weeks, months or years,
+// optionally limited to Weekdays for weekly rules, and ending on Until or after Count
+// occurrences.
+type RecurrenceRule struct {
+	Frequency RecurrenceFrequency `json:"frequency"`
+	Interval  int                 `json:"interval"`
+	Weekdays  []string            `json:"weekdays,omitempty"` // MO, TU, WE, TH, FR, SA, SU
+	Until     *time.Time          `json:"until,omitempty"`
+	Count     *int                `json:"count,omitempty"`
+}
+
+// Scan implements the sql.Scanner interface
+func (r *RecurrenceRule) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = RecurrenceRule{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return errors.New("failed to unmarshal RecurrenceRule value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (r RecurrenceRule) Value() (driver.Value, error) {
+	b, err := json.Marshal(r)
+	return string(b), err
+}
+
+// Normalize fills in defaults and checks the rule is usable.
+func (r *RecurrenceRule) Normalize() error {
+	r.Frequency = RecurrenceFrequency(strings.ToLower(strings.TrimSpace(string(r.Frequency))))
+	switch r.Frequency {
+	case RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly, RecurrenceYearly:
+	default:
+		return fmt.Errorf("frequency must be one of daily, weekly, monthly or yearly")
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 1 || r.Interval > 366 {
+		return fmt.Errorf("interval must be between 1 and 366")
+	}
+	if len(r.Weekdays) > 0 && r.Frequency != RecurrenceWeekly {
+		return fmt.Errorf("weekdays can only be used with a weekly frequency")
+	}
+	for i, day := range r.Weekdays {
+		day = strings.ToUpper(strings.TrimSpace(day))
+		if _, ok := recurrenceWeekdays[day]; !ok {
+			return fmt.Errorf("unknown weekday %q", r.Weekdays[i])
+		}
+		r.Weekdays[i] = day
+	}
+	if r.Until != nil && r.Count != nil {
+		return fmt.Errorf("use either until or count, not both")
+	}
+	if r.Count != nil && *r.Count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	return nil
+}
+
+// Next returns the occurrence after prev for a series whose first occurrence is start.
+func (r RecurrenceRule) Next(start, prev time.Time) time.Time {
+	switch r.Frequency {
+	case RecurrenceWeekly:
+		if len(r.Weekdays) == 0 {
+			return prev.AddDate(0, 0, 7*r.Interval)
+		}
+		days := make(map[time.Weekday]bool, len(r.Weekdays))
+		for _, day := range r.Weekdays {
+			days[recurrenceWeekdays[day]] = true
+		}
+		startWeek := weekStart(start)
+		for d := prev.AddDate(0, 0, 1); ; d = d.AddDate(0, 0, 1) {
+			weeks := int(weekStart(d).Sub(startWeek).Hours()/24+0.5) / 7
+			if days[d.Weekday()] && weeks%r.Interval == 0 {
+				return d
+			}
+		}
+	case RecurrenceMonthly, RecurrenceYearly:
+		step := r.Interval
+		if r.Frequency == RecurrenceYearly {
+			step *= 12
+		}
+		elapsed := (prev.Year()-start.Year())*12 + int(prev.Month()-start.Month())
+		return addMonthsClamped(start, (elapsed/step+1)*step)
+	default:
+		return prev.AddDate(0, 0, r.Interval)
+	}
+}
+
+// Ended reports whether the occurrence with the given zero-based index and due date falls
+// outside the rule's end.
+func (r RecurrenceRule) Ended(index int, due time.Time) bool {
+	if r.Count != nil && index >= *r.Count {
+		return true
+	}
+	if r.Until != nil {
+		y, m, d := r.Until.Date()
+		if !due.Before(time.Date(y, m, d+1, 0, 0, 0, 0, r.Until.Location())) {
+			return true
+		}
+	}
+	return false
+}
+
+// weekStart returns midnight UTC on the Monday of t's week, so week arithmetic ignores DST.
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// addMonthsClamped adds months to t, moving to the last day of the month when t's day does
+// not exist there (Jan 31 + 1 month is Feb 28 or 29).
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// TaskSeries holds the schedule and shared fields for a recurring task. Each occurrence is
+// a Task with SeriesID set and SeriesIndex counting from 0.
+type TaskSeries struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Rule             RecurrenceRule `json:"rule" gorm:"type:text;not null"`
+	StartDate        time.Time      `json:"startDate"`                // Due date the rule is anchored to
+	NextIndex        int            `json:"nextIndex"`                // Index of the next occurrence to create
+	NextDueDate      *time.Time     `json:"nextDueDate" gorm:"index"` // Nil once the series has ended
+	EndedAt          *time.Time     `json:"endedAt"`
+	Title            string         `json:"title" gorm:"not null"`
+	Description      string         `json:"description" gorm:"type:text"`
+	Priority         TaskPriority   `json:"priority" gorm:"type:varchar(20);default:'medium'"`
+	PatientID        *uint          `json:"patientId" gorm:"index"`
+	AssignedToID     *uint          `json:"assignedToId"`
+	AssignedToTeamID *uint          `json:"assignedToTeamId"`
+	CreatedByID      uint           `json:"createdById" gorm:"not null"`
+	TemplateID       *uint          `json:"templateId" gorm:"index"`
+	Tags             []Tag          `json:"tags,omitempty" gorm:"many2many:task_series_tags;"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// newOccurrence builds the task for the series' occurrence at index.
+func (s *TaskSeries) newOccurrence(index int, due time.Time) Task {
+	return Task{
+		Title:            s.Title,
+		Description:      s.Description,
+		Status:           TaskStatusPending,
+		Priority:         s.Priority,
+		DueDate:          &due,
+		PatientID:        s.PatientID,
+		AssignedToID:     s.AssignedToID,
+		AssignedToTeamID: s.AssignedToTeamID,
+		CreatedByID:      s.CreatedByID,
+		TemplateID:       s.TemplateID,
+		SeriesID:         &s.ID,
+		SeriesIndex:      index,
+	}
+}
+
+// scheduleAfter sets NextDueDate to the occurrence after due, or ends the series.
+func (s *TaskSeries) scheduleAfter(due time.Time) {
+	next := s.Rule.Next(s.StartDate, due)
+	if s.Rule.Ended(s.NextIndex, next) {
+		now := time.Now()
+		s.NextDueDate = nil
+		s.EndedAt = &now
+		return
+	}
+	s.NextDueDate = &next
+}
+
+// CreateTaskSeries starts a recurring series with first as its first occurrence. first must
+// have a due date; the series copies its fields and takes tags. An unsaved first task is
+// created with the tags, an existing one is linked to the series as it is. Everything is
+// saved in tx.
+func CreateTaskSeries(tx *gorm.DB, rule RecurrenceRule, first *Task, tags []Tag) (*TaskSeries, error) {
+	if first.DueDate == nil {
+		return nil, errors.New("a recurring task needs a due date")
+	}
+	series := TaskSeries{
+		Rule:             rule,
+		StartDate:        *first.DueDate,
+		NextIndex:        1,
+		Title:            first.Title,
+		Description:      first.Description,
+		Priority:         first.Priority,
+		PatientID:        first.PatientID,
+		AssignedToID:     first.AssignedToID,
+		AssignedToTeamID: first.AssignedToTeamID,
+		CreatedByID:      first.CreatedByID,
+		TemplateID:       first.TemplateID,
+	}
+	series.scheduleAfter(series.StartDate)
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&series).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if err := tx.Model(&series).Association("Tags").Append(tags); err != nil {
+				return err
+			}
+		}
+		first.SeriesID = &series.ID
+		first.SeriesIndex = 0
+		if first.ID != 0 {
+			return tx.Model(first).Updates(map[string]interface{}{"series_id": series.ID, "series_index": 0}).Error
+		}
+		// The series keeps the team so each occurrence is assigned afresh.
+		if err := AutoAssignTask(tx, first, tags); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(first).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			return tx.Model(first).Association("Tags").Append(tags)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// GetTaskSeries returns the series with its tags, or nil if it does not exist.
+func GetTaskSeries(id uint) (*TaskSeries, error) {
+	var series TaskSeries
+	err := config.DB.Preload("Tags").First(&series, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// GetDueTaskSeries returns active series whose next occurrence is due by cutoff.
+func GetDueTaskSeries(cutoff time.Time) ([]TaskSeries, error) {
+	var series []TaskSeries
+	err := config.DB.Where("ended_at IS NULL AND next_due_date IS NOT NULL AND next_due_date <= ?", cutoff).
+		Order("next_due_date ASC").
+		Find(&series).Error
+	return series, err
+}
+
+// CreateNextSeriesOccurrence creates occurrence index of the series if it has not been
+// created yet. It returns nil when the series has ended or another caller already created
+// that occurrence, so completion and the scheduler can both call it safely.
+func CreateNextSeriesOccurrence(seriesID uint, index int) (*Task, error) {
+	var created *Task
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var series TaskSeries
+		if err := tx.Preload("Tags").First(&series, seriesID).Error; err != nil {
+			return err
+		}
+		if series.EndedAt != nil || series.NextDueDate == nil || series.NextIndex != index {
+			return nil
+		}
+
+		due := *series.NextDueDate
+		series.NextIndex++
+		series.scheduleAfter(due)
+
+		// Claim the index; a concurrent caller that got here first leaves no row to update.
+		result := tx.Model(&TaskSeries{}).
+			Where("id = ? AND next_index = ?", series.ID, index).
+			Updates(map[string]interface{}{
+				"next_index":    series.NextIndex,
+				"next_due_date": series.NextDueDate,
+				"ended_at":      series.EndedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		task := series.newOccurrence(index, due)
+		if err := AutoAssignTask(tx, &task, series.Tags); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(&task).Error; err != nil {
+			return err
+		}
+		if len(series.Tags) > 0 {
+			if err := tx.Model(&task).Association("Tags").Append(series.Tags); err != nil {
+				return err
+			}
+		}
+		// Each occurrence starts with a fresh copy of the previous one's checklist.
+		var previous Task
+		if err := tx.Select("id").Where("series_id = ? AND series_index < ?", series.ID, index).
+			Order("series_index DESC").Limit(1).Find(&previous).Error; err != nil {
+			return err
+		}
+		if previous.ID != 0 {
+			if err := copyChecklist(tx, previous.ID, task.ID); err != nil {
+				return err
+			}
+		}
+		created = &task
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return created, err
+}
+
+// openFutureOccurrences selects the series' unfinished occurrences from index onward.
+func openFutureOccurrences(tx *gorm.DB, seriesID uint, index int) *gorm.DB {
+	return tx.Model(&Task{}).Where("series_id = ? AND series_index >= ? AND status IN ?",
+		seriesID, index, []TaskStatus{TaskStatusPending, TaskStatusInProgress})
+}
+
+// TaskSeriesChanges are the edits applied to every future occurrence of a series.
+type TaskSeriesChanges struct {
+	Fields   map[string]interface{} // Column updates for the series and its open occurrences
+	DueShift time.Duration          // Moves open occurrences and the schedule by this much
+	Rule     *RecurrenceRule        // Replaces the schedule from the edited occurrence on
+	Tags     []Tag                  // Replaces tags when non-nil
+}
+
+// UpdateFutureOccurrences applies changes to the series and to every open occurrence after
+// task; the caller saves task itself in the same transaction. A new rule is anchored on
+// task's due date.
+func UpdateFutureOccurrences(tx *gorm.DB, task *Task, changes TaskSeriesChanges) error {
+	if task.SeriesID == nil {
+		return errors.New("task is not part of a series")
+	}
+	var series TaskSeries
+	if err := tx.First(&series, *task.SeriesID).Error; err != nil {
+		return err
+	}
+
+	if len(changes.Fields) > 0 {
+		if err := tx.Model(&series).Updates(changes.Fields).Error; err != nil {
+			return err
+		}
+		if err := openFutureOccurrences(tx, series.ID, task.SeriesIndex+1).Updates(changes.Fields).Error; err != nil {
+			return err
+		}
+	}
+
+	var occurrences []Task
+	if err := openFutureOccurrences(tx, series.ID, task.SeriesIndex+1).Order("series_index ASC").Find(&occurrences).Error; err != nil {
+		return err
+	}
+
+	if changes.DueShift != 0 {
+		for _, occurrence := range occurrences {
+			if occurrence.DueDate == nil {
+				continue
+			}
+			shifted := occurrence.DueDate.Add(changes.DueShift)
+			if err := tx.Model(&occurrence).Update("due_date", shifted).Error; err != nil {
+				return err
+			}
+		}
+		series.StartDate = series.StartDate.Add(changes.DueShift)
+		if series.NextDueDate != nil {
+			shifted := series.NextDueDate.Add(changes.DueShift)
+			series.NextDueDate = &shifted
+		}
+	}
+
+	if changes.Rule != nil && task.DueDate != nil {
+		series.Rule = *changes.Rule
+		series.StartDate = *task.DueDate
+		series.EndedAt = nil
+		latest := *task.DueDate
+		for _, occurrence := range occurrences {
+			if occurrence.DueDate != nil && occurrence.DueDate.After(latest) {
+				latest = *occurrence.DueDate
+			}
+		}
+		series.scheduleAfter(latest)
+	}
+
+	if changes.DueShift != 0 || changes.Rule != nil {
+		err := tx.Model(&series).Updates(map[string]interface{}{
+			"rule":          series.Rule,
+			"start_date":    series.StartDate,
+			"next_due_date": series.NextDueDate,
+			"ended_at":      series.EndedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if changes.Tags != nil {
+		if err := tx.Model(&series).Association("Tags").Replace(changes.Tags); err != nil {
+			return err
+		}
+		for i := range occurrences {
+			if err := tx.Model(&occurrences[i]).Association("Tags").Replace(changes.Tags); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EndTaskSeriesFrom stops the series and deletes its open occurrences from task onward.
+func EndTaskSeriesFrom(task *Task) error {
+	if task.SeriesID == nil {
+		return errors.New("task is not part of a series")
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&TaskSeries{}).Where("id = ?", *task.SeriesID).
+			Updates(map[string]interface{}{"next_due_date": nil, "ended_at": now}).Error
+		if err != nil {
+			return err
+		}
+		if err := openFutureOccurrences(tx, *task.SeriesID, task.SeriesIndex).Delete(&Task{}).Error; err != nil {
+			return err
+		}
+		// The edited occurrence goes too, even if it was already finished.
+		return tx.Delete(&Task{}, task.ID).Error
+	})
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTaskDependencySelf  = errors.New("a task cannot depend on itself")
+	ErrTaskDependencyCycle = errors.New("dependency would create a cycle")
+)
+
+// TaskChecklistItem is one step to tick off inside a task.
+type TaskChecklistItem struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TaskID    uint       `json:"taskId" gorm:"not null;index"`
+	Title     string     `json:"title" gorm:"type:varchar(255);not null"`
+	Position  int        `json:"position"`
+	Done      bool       `json:"done" gorm:"default:false"`
+	DoneAt    *time.Time `json:"doneAt"`
+	DoneByID  *uint      `json:"doneById"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// ChecklistTitles is a template's checklist, stored as a JSON array.
+type ChecklistTitles []string
+
+// Scan implements the sql.Scanner interface
+func (c *ChecklistTitles) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = ChecklistTitles{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return errors.New("failed to unmarshal ChecklistTitles value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (c ChecklistTitles) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// TemplateStep is one task of a workflow template.
+type TemplateStep struct {
+	Key         string          `json:"key"` // Referenced by DependsOn
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	Priority    TaskPriority    `json:"priority,omitempty"`  // The template's priority when empty
+	DueInDays   *int            `json:"dueInDays,omitempty"` // Days after the workflow starts; no due date when nil
+	DependsOn   []string        `json:"dependsOn,omitempty"` // Keys of the steps that must be done first
+	Checklist   ChecklistTitles `json:"checklist,omitempty"`
+}
+
+// TemplateSteps is stored as a JSON array.
+type TemplateSteps []TemplateStep
+
+// Scan implements the sql.Scanner interface
+func (s *TemplateSteps) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = TemplateSteps{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("failed to unmarshal TemplateSteps value")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (s TemplateSteps) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// Normalize checks the workflow: keys are unique and steps only depend on earlier steps,
+// which also rules out cycles. Missing keys default to the step's position.
+func (s TemplateSteps) Normalize() error {
+	seen := make(map[string]bool, len(s))
+	for i := range s {
+		step := &s[i]
+		step.Title = strings.TrimSpace(step.Title)
+		if step.Title == "" {
+			return fmt.Errorf("step %d needs a title", i+1)
+		}
+		step.Key = strings.TrimSpace(step.Key)
+		if step.Key == "" {
+			step.Key = fmt.Sprintf("%d", i+1)
+		}
+		if seen[step.Key] {
+			return fmt.Errorf("duplicate step key %q", step.Key)
+		}
+		if step.Priority != "" && TaskPriorityRank(step.Priority) < 0 {
+			return fmt.Errorf("unknown priority %q", step.Priority)
+		}
+		if step.DueInDays != nil && *step.DueInDays < 0 {
+			return fmt.Errorf("step %q cannot be due before the workflow starts", step.Key)
+		}
+		for _, key := range step.DependsOn {
+			if !seen[key] {
+				return fmt.Errorf("step %q can only depend on earlier steps, not %q", step.Key, key)
+			}
+		}
+		seen[step.Key] = true
+	}
+	return nil
+}
+
+// CreateChecklistItems adds items to the end of a task's checklist.
+func CreateChecklistItems(tx *gorm.DB, taskID uint, titles []string) error {
+	var position int
+	if err := tx.Model(&TaskChecklistItem{}).Where("task_id = ?", taskID).
+		Select("COALESCE(MAX(position), 0)").Scan(&position).Error; err != nil {
+		return err
+	}
+	items := make([]TaskChecklistItem, 0, len(titles))
+	for _, title := range titles {
+		title = strings.TrimSpace(title)
+		if title == "" {
+			continue
+		}
+		position++
+		items = append(items, TaskChecklistItem{TaskID: taskID, Title: title, Position: position})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return tx.Create(&items).Error
+}
+
+// copyChecklist gives a task fresh, unticked copies of another task's checklist.
+func copyChecklist(tx *gorm.DB, fromTaskID, toTaskID uint) error {
+	var titles []string
+	if err := tx.Model(&TaskChecklistItem{}).Where("task_id = ?", fromTaskID).
+		Order("position ASC").Pluck("title", &titles).Error; err != nil {
+		return err
+	}
+	return CreateChecklistItems(tx, toTaskID, titles)
+}
+
+// GetTaskChecklistItem returns a checklist item of a task, or nil if it does not exist.
+func GetTaskChecklistItem(taskID, itemID uint) (*TaskChecklistItem, error) {
+	var item TaskChecklistItem
+	err := config.DB.Where("id = ? AND task_id = ?", itemID, taskID).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// AddTaskDependency makes dependsOnID a prerequisite of taskID. It refuses dependencies that
+// would form a cycle.
+func AddTaskDependency(tx *gorm.DB, taskID, dependsOnID uint) error {
+	if taskID == dependsOnID {
+		return ErrTaskDependencySelf
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		// Walk the prerequisites of dependsOnID; reaching taskID means a cycle.
+		frontier := []uint{dependsOnID}
+		visited := map[uint]bool{dependsOnID: true}
+		for len(frontier) > 0 {
+			var next []uint
+			if err := tx.Table("task_dependencies").Where("task_id IN ?", frontier).
+				Pluck("depends_on_id", &next).Error; err != nil {
+				return err
+			}
+			frontier = frontier[:0]
+			for _, id := range next {
+				if id == taskID {
+					return ErrTaskDependencyCycle
+				}
+				if !visited[id] {
+					visited[id] = true
+					frontier = append(frontier, id)
+				}
+			}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Table("task_dependencies").
+			Create(map[string]interface{}{"task_id": taskID, "depends_on_id": dependsOnID}).Error
+	})
+}
+
+// RemoveTaskDependency drops a prerequisite.
+func RemoveTaskDependency(taskID, dependsOnID uint) error {
+	return config.DB.Exec("DELETE FROM task_dependencies WHERE task_id = ? AND depends_on_id = ?", taskID, dependsOnID).Error
+}
+
+// GetOpenPrerequisites returns the prerequisites of a task that are still pending or in
+// progress. Cancelled prerequisites no longer block.
+func GetOpenPrerequisites(taskID uint) ([]Task, error) {
+	var tasks []Task
+	err := config.DB.Select("id", "title", "status", "due_date").
+		Where("id IN (?) AND status IN ?",
+			config.DB.Table("task_dependencies").Select("depends_on_id").Where("task_id = ?", taskID),
+			[]TaskStatus{TaskStatusPending, TaskStatusInProgress}).
+		Order("id ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// CreateWorkflowTasks creates one task per step of a workflow template, with due dates
+// counted from start, the steps' checklists and their dependencies. base supplies the
+// patient, creator and assignee. The tasks are created together or not at all.
+func CreateWorkflowTasks(template *TaskTemplate, base Task, start time.Time) ([]Task, error) {
+	tasks := make([]Task, 0, len(template.Steps))
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		ids := make(map[string]uint, len(template.Steps))
+		for _, step := range template.Steps {
+			task := base
+			task.ID = 0
+			task.Title = step.Title
+			task.Description = step.Description
+			task.Status = TaskStatusPending
+			task.Priority = step.Priority
+			if task.Priority == "" {
+				task.Priority = template.Priority
+			}
+			task.DueDate = nil
+			if step.DueInDays != nil {
+				due := start.AddDate(0, 0, *step.DueInDays)
+				task.DueDate = &due
+			}
+			templateID := template.ID
+			task.TemplateID = &templateID
+			if err := AutoAssignTask(tx, &task, template.Tags); err != nil {
+				return err
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&task).Error; err != nil {
+				return err
+			}
+			if len(template.Tags) > 0 {
+				if err := tx.Model(&task).Association("Tags").Append(template.Tags); err != nil {
+					return err
+				}
+			}
+			if err := CreateChecklistItems(tx, task.ID, step.Checklist); err != nil {
+				return err
+			}
+			for _, key := range step.DependsOn {
+				if err := tx.Table("task_dependencies").
+					Create(map[string]interface{}{"task_id": task.ID, "depends_on_id": ids[key]}).Error; err != nil {
+					return err
+				}
+			}
+			ids[step.Key] = task.ID
+			tasks = append(tasks, task)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// CreateTasksFromTemplate creates task, which the caller has filled in from the template,
+// along with the template's tags, checklist and recurrence. A workflow template instead
+// creates its steps, using task for the shared fields and start for the due dates.
+func CreateTasksFromTemplate(template *TaskTemplate, task *Task, start time.Time) ([]Task, error) {
+	if len(template.Steps) > 0 {
+		return CreateWorkflowTasks(template, *task, start)
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := CreateTask(tx, task, template.Recurrence, template.Tags); err != nil {
+			return err
+		}
+		return CreateChecklistItems(tx, task.ID, template.Checklist)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []Task{*task}, nil
+}
@@ -19,6 +19,10 @@ type Team struct {
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
 	DeletedAt   gorm.DeletedAt `gorm:"uniqueIndex:idx_teams_name_deleted;index" json:"-"`
+
+	// How tasks assigned to the team get an owner, and round robin's last pick
+	AssignmentStrategy string `gorm:"type:varchar(20);default:'manual'" json:"assignmentStrategy"`
+	LastAssignedUserID *uint  `json:"-"`
 }
 
 // GetAllTeams retrieves all teams with their members
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// Team auto-assignment strategies. Manual teams leave their tasks for members to pick up.
+const (
+	AssignmentManual     = "manual"
+	AssignmentRoundRobin = "round_robin"
+	AssignmentLeastOpen  = "least_open"
+	AssignmentSkill      = "skill"
+)
+
+// IsAssignmentStrategy reports whether s is a known strategy.
+func IsAssignmentStrategy(s string) bool {
+	switch s {
+	case AssignmentManual, AssignmentRoundRobin, AssignmentLeastOpen, AssignmentSkill:
+		return true
+	}
+	return false
+}
+
+// UserSkill marks a user as suited to tasks carrying a tag, for skill-based assignment.
+type UserSkill struct {
+	UserID    uint      `json:"userId" gorm:"primaryKey;autoIncrement:false"`
+	TagID     uint      `json:"tagId" gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserAbsence is an out-of-office period. Auto-assignment skips the user while it lasts.
+type UserAbsence struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"userId" gorm:"not null;index"`
+	User        *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	StartsAt    time.Time `json:"startsAt" gorm:"not null;index"`
+	EndsAt      time.Time `json:"endsAt" gorm:"not null;index"`
+	Reason      string    `json:"reason" gorm:"type:varchar(255)"`
+	CreatedByID uint      `json:"createdById"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// GetUserSkills returns the tags a user is skilled in.
+func GetUserSkills(userID uint) ([]Tag, error) {
+	var tags []Tag
+	err := config.DB.Where("id IN (?)", config.DB.Model(&UserSkill{}).Select("tag_id").Where("user_id = ?", userID)).
+		Order("name ASC").Find(&tags).Error
+	return tags, err
+}
+
+// SetUserSkills replaces a user's skills.
+func SetUserSkills(userID uint, tagIDs []uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&UserSkill{}).Error; err != nil {
+			return err
+		}
+		skills := make([]UserSkill, 0, len(tagIDs))
+		seen := make(map[uint]bool, len(tagIDs))
+		for _, tagID := range tagIDs {
+			if !seen[tagID] {
+				seen[tagID] = true
+				skills = append(skills, UserSkill{UserID: userID, TagID: tagID})
+			}
+		}
+		if len(skills) == 0 {
+			return nil
+		}
+		return tx.Create(&skills).Error
+	})
+}
+
+// GetUserAbsences returns absences that have not ended by from, soonest first, optionally
+// for one user.
+func GetUserAbsences(userID *uint, from time.Time) ([]UserAbsence, error) {
+	query := config.DB.Preload("User").Where("ends_at > ?", from)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	var absences []UserAbsence
+	err := query.Order("starts_at ASC, id ASC").Find(&absences).Error
+	return absences, err
+}
+
+// GetUserAbsence returns an absence, or nil if it does not exist.
+func GetUserAbsence(id uint) (*UserAbsence, error) {
+	var absence UserAbsence
+	err := config.DB.First(&absence, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &absence, nil
+}
+
+// CountOpenTasksByUser returns the number of pending and in-progress tasks assigned to
+// each user. Users without open tasks are left out.
+func CountOpenTasksByUser(tx *gorm.DB, userIDs []uint) (map[uint]int, error) {
+	var rows []struct {
+		AssignedToID uint
+		Count        int
+	}
+	err := tx.Model(&Task{}).
+		Select("assigned_to_id, COUNT(*) AS count").
+		Where("assigned_to_id IN ? AND status IN ?", userIDs, []TaskStatus{TaskStatusPending, TaskStatusInProgress}).
+		Group("assigned_to_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.AssignedToID] = row.Count
+	}
+	return counts, nil
+}
+
+// TeamAssignment is the member chosen for a task under a team's strategy, and why.
+type TeamAssignment struct {
+	TeamID   uint
+	Strategy string
+	UserID   *uint // Nil when nobody is available
+	Reason   string
+}
+
+// Record advances the team's round robin past the chosen member. Call it in the
+// transaction that saves the assignment.
+func (a *TeamAssignment) Record(tx *gorm.DB) error {
+	if a.Strategy != AssignmentRoundRobin || a.UserID == nil {
+		return nil
+	}
+	return tx.Model(&Team{}).Where("id = ?", a.TeamID).Update("last_assigned_user_id", *a.UserID).Error
+}
+
+// AutoAssignTask picks an owner for a task assigned only to a team, using the team's
+// strategy, and records why on the task. tags are the task's tags, used by skill-based
+// assignment. It does nothing for manual teams or tasks that already have a user.
+func AutoAssignTask(tx *gorm.DB, task *Task, tags []Tag) error {
+	if task.AssignedToID != nil || task.AssignedToTeamID == nil {
+		return nil
+	}
+	assignment, err := PickTeamAssignee(tx, *task.AssignedToTeamID, tags, nil, time.Now())
+	if err != nil || assignment == nil {
+		return err
+	}
+	task.AssignedToID = assignment.UserID
+	task.AssignmentReason = assignment.Reason
+	return assignment.Record(tx)
+}
+
+// PickTeamAssignee chooses the team member to give a task to under the team's strategy,
+// leaving out exclude and members who are out of office at the given time. It returns nil
+// for manual teams. It does not write anything; see TeamAssignment.Record.
+func PickTeamAssignee(tx *gorm.DB, teamID uint, tags []Tag, exclude *uint, at time.Time) (*TeamAssignment, error) {
+	var team Team
+	if err := tx.Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("users.id ASC") }).
+		Limit(1).Find(&team, teamID).Error; err != nil {
+		return nil, err
+	}
+	if team.ID == 0 || team.AssignmentStrategy == "" || team.AssignmentStrategy == AssignmentManual {
+		return nil, nil
+	}
+	assignment := &TeamAssignment{TeamID: team.ID, Strategy: team.AssignmentStrategy}
+
+	memberIDs := make([]uint, 0, len(team.Members))
+	for _, member := range team.Members {
+		memberIDs = append(memberIDs, member.ID)
+	}
+	var absentIDs []uint
+	if len(memberIDs) > 0 {
+		if err := tx.Model(&UserAbsence{}).
+			Where("user_id IN ? AND starts_at <= ? AND ends_at > ?", memberIDs, at, at).
+			Distinct().Pluck("user_id", &absentIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+	absent := make(map[uint]bool, len(absentIDs))
+	for _, id := range absentIDs {
+		absent[id] = true
+	}
+
+	var candidates []User
+	var away []string
+	for _, member := range team.Members {
+		switch {
+		case exclude != nil && member.ID == *exclude:
+		case absent[member.ID]:
+			away = append(away, assigneeName(&member))
+		default:
+			candidates = append(candidates, member)
+		}
+	}
+	awayNote := ""
+	if len(away) > 0 {
+		awayNote = fmt.Sprintf("; skipped out of office: %s", strings.Join(away, ", "))
+	}
+	if len(candidates) == 0 {
+		assignment.Reason = fmt.Sprintf("No available member of team %s to auto-assign%s", team.Name, awayNote)
+		return assignment, nil
+	}
+
+	ids := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		ids = append(ids, candidate.ID)
+	}
+	open, err := CountOpenTasksByUser(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var chosen *User
+	var why string
+	switch team.AssignmentStrategy {
+	case AssignmentRoundRobin:
+		// Members are in ID order; take the first after the last one assigned, wrapping round.
+		chosen = &candidates[0]
+		if team.LastAssignedUserID != nil {
+			for i := range candidates {
+				if candidates[i].ID > *team.LastAssignedUserID {
+					chosen = &candidates[i]
+					break
+				}
+			}
+		}
+		why = fmt.Sprintf("next in round robin for team %s", team.Name)
+	case AssignmentSkill:
+		chosen, why, err = pickBySkill(tx, candidates, tags, open)
+		if err != nil {
+			return nil, err
+		}
+		why += fmt.Sprintf(" in team %s", team.Name)
+	default:
+		chosen = leastOpen(candidates, open)
+		why = fmt.Sprintf("fewest open tasks in team %s", team.Name)
+	}
+
+	id := chosen.ID
+	assignment.UserID = &id
+	assignment.Reason = fmt.Sprintf("Auto-assigned to %s: %s (%d open)%s", assigneeName(chosen), why, open[id], awayNote)
+	return assignment, nil
+}
+
+// pickBySkill prefers the candidates skilled in the most of the task's tags, then the one
+// with the fewest open tasks. Without any match it falls back to the fewest open tasks.
+func pickBySkill(tx *gorm.DB, candidates []User, tags []Tag, open map[uint]int) (*User, string, error) {
+	if len(tags) == 0 {
+		return leastOpen(candidates, open), "task has no tags to match, fewest open tasks", nil
+	}
+	tagIDs := make([]uint, 0, len(tags))
+	names := make(map[uint]string, len(tags))
+	for _, tag := range tags {
+		tagIDs = append(tagIDs, tag.ID)
+		names[tag.ID] = tag.Name
+	}
+	ids := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		ids = append(ids, candidate.ID)
+	}
+	var skills []UserSkill
+	if err := tx.Where("user_id IN ? AND tag_id IN ?", ids, tagIDs).Find(&skills).Error; err != nil {
+		return nil, "", err
+	}
+	matched := make(map[uint][]string)
+	for _, skill := range skills {
+		matched[skill.UserID] = append(matched[skill.UserID], names[skill.TagID])
+	}
+
+	best := 0
+	for _, list := range matched {
+		if len(list) > best {
+			best = len(list)
+		}
+	}
+	if best == 0 {
+		return leastOpen(candidates, open), "no member has the task's skills, fewest open tasks", nil
+	}
+	var skilled []User
+	for _, candidate := range candidates {
+		if len(matched[candidate.ID]) == best {
+			skilled = append(skilled, candidate)
+		}
+	}
+	chosen := leastOpen(skilled, open)
+	list := matched[chosen.ID]
+	sort.Strings(list)
+	return chosen, fmt.Sprintf("skilled in %d of %d tags (%s)", best, len(tags), strings.Join(list, ", ")), nil
+}
+
+// leastOpen returns the candidate with the fewest open tasks, the earliest on a tie.
+func leastOpen(candidates []User, open map[uint]int) *User {
+	chosen := &candidates[0]
+	for i := range candidates {
+		if open[candidates[i].ID] < open[chosen.ID] {
+			chosen = &candidates[i]
+		}
+	}
+	return chosen
+}
+
+func assigneeName(user *User) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return user.Username
+}
@@ -0,0 +1,434 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"gorm.io/gorm"
+)
+
+// WaitlistStatus is where a waitlist entry is in its life.
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting WaitlistStatus = "waiting"
+	WaitlistOffered WaitlistStatus = "offered" // A place is held for the patient
+	WaitlistBooked  WaitlistStatus = "booked"
+	WaitlistRemoved WaitlistStatus = "removed"
+)
+
+// WaitlistOfferStatus is the outcome of an offered slot.
+type WaitlistOfferStatus string
+
+const (
+	WaitlistOfferPending   WaitlistOfferStatus = "pending"
+	WaitlistOfferAccepted  WaitlistOfferStatus = "accepted"
+	WaitlistOfferDeclined  WaitlistOfferStatus = "declined"
+	WaitlistOfferExpired   WaitlistOfferStatus = "expired"
+	WaitlistOfferWithdrawn WaitlistOfferStatus = "withdrawn" // The entry was removed
+)
+
+// ErrWaitlistOfferClosed is returned when an offer is no longer open to accept or decline.
+var ErrWaitlistOfferClosed = errors.New("waitlist offer is no longer open")
+
+// WaitlistEntry is a patient waiting for a place between two dates. An entry may name the
+// appointment the patient wants brought forward; it is then only offered earlier slots and
+// accepting moves that appointment.
+type WaitlistEntry struct {
+	ID            uint                `json:"id" gorm:"primaryKey"`
+	PatientID     uint                `json:"patientId" gorm:"not null;index"`
+	Patient       *Patient            `json:"patient,omitempty"`
+	AppointmentID *uint               `json:"appointmentId" gorm:"index"`
+	Appointment   *Appointment        `json:"appointment,omitempty"`
+	EarliestDate  string              `json:"earliestDate" gorm:"type:varchar(10);not null;index"` // "2006-01-02", clinic timezone
+	LatestDate    string              `json:"latestDate" gorm:"type:varchar(10);not null;index"`
+	Location      AppointmentLocation `json:"location" gorm:"type:varchar(32);not null"`
+	Priority      TaskPriority        `json:"priority" gorm:"type:varchar(20);not null"`
+	Status        WaitlistStatus      `json:"status" gorm:"type:varchar(20);not null;index"`
+	Note          string              `json:"note" gorm:"type:text"`
+	CreatedByID   uint                `json:"createdById" gorm:"not null;index"`
+	CreatedBy     *User               `json:"createdBy,omitempty"`
+	Offers        []WaitlistOffer     `json:"offers,omitempty" gorm:"foreignKey:EntryID"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt"`
+}
+
+// Validate returns a message if the entry is incomplete.
+func (e *WaitlistEntry) Validate() string {
+	if e.PatientID == 0 {
+		return "patientId is required"
+	}
+	for _, date := range []string{e.EarliestDate, e.LatestDate} {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return "earliestDate and latestDate must be dates (YYYY-MM-DD)"
+		}
+	}
+	if e.LatestDate < e.EarliestDate {
+		return "latestDate must not be before earliestDate"
+	}
+	switch e.Location {
+	case AppointmentLocationClinic, AppointmentLocationRemote, AppointmentLocationTelevisit:
+	default:
+		return "location must be clinic, remote or televisit"
+	}
+	if TaskPriorityRank(e.Priority) < 0 {
+		return "priority must be low, medium, high or urgent"
+	}
+	return ""
+}
+
+// WaitlistOffer is a freed place offered to a waitlist entry. While pending and not expired
+// the place is held: it counts against the slot's capacity so nobody else can book it.
+type WaitlistOffer struct {
+	ID            uint                `json:"id" gorm:"primaryKey"`
+	EntryID       uint                `json:"entryId" gorm:"not null;index"`
+	Entry         *WaitlistEntry      `json:"entry,omitempty"`
+	SlotID        uint                `json:"slotId" gorm:"not null;index"`
+	SlotTime      time.Time           `json:"slotTime" gorm:"not null"`
+	Location      AppointmentLocation `json:"location" gorm:"type:varchar(32);not null"`
+	Status        WaitlistOfferStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	ExpiresAt     time.Time           `json:"expiresAt" gorm:"not null;index"`
+	TaskID        *uint               `json:"taskId"`
+	AppointmentID *uint               `json:"appointmentId"`
+	RespondedByID *uint               `json:"respondedById"`
+	RespondedAt   *time.Time          `json:"respondedAt"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt"`
+}
+
+// IsOpen reports whether the offer can still be accepted.
+func (o *WaitlistOffer) IsOpen(now time.Time) bool {
+	return o.Status == WaitlistOfferPending && o.ExpiresAt.After(now)
+}
+
+// WaitlistFilter narrows the waitlist.
+type WaitlistFilter struct {
+	Status    WaitlistStatus
+	Location  AppointmentLocation
+	PatientID uint
+}
+
+// GetWaitlistEntries lists entries with their patient and open offer, highest priority
+// first and then the longest waiting.
+func GetWaitlistEntries(filter WaitlistFilter) ([]WaitlistEntry, error) {
+	query := config.DB.Preload("Patient").Preload("Appointment").
+		Preload("Offers", "status = ?", WaitlistOfferPending)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	} else {
+		query = query.Where("status IN ?", []WaitlistStatus{WaitlistWaiting, WaitlistOffered})
+	}
+	if filter.Location != "" {
+		query = query.Where("location = ?", filter.Location)
+	}
+	if filter.PatientID != 0 {
+		query = query.Where("patient_id = ?", filter.PatientID)
+	}
+
+	entries := []WaitlistEntry{}
+	if err := query.Order("created_at ASC, id ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	sortWaitlistEntries(entries)
+	return entries, nil
+}
+
+// GetWaitlistEntry returns an entry with its offers, or nil if it does not exist.
+func GetWaitlistEntry(id uint) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	result := config.DB.Preload("Patient").Preload("Appointment").
+		Preload("Offers", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC, id DESC") }).
+		Limit(1).Find(&entry, id)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &entry, nil
+}
+
+// GetWaitlistOffer returns an offer with its entry, or nil if it does not exist.
+func GetWaitlistOffer(id uint) (*WaitlistOffer, error) {
+	var offer WaitlistOffer
+	result := config.DB.Preload("Entry.Patient").Preload("Entry.Appointment").Limit(1).Find(&offer, id)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &offer, nil
+}
+
+// sortWaitlistEntries orders entries by priority, keeping the order they were loaded in
+// (oldest first) within a priority.
+func sortWaitlistEntries(entries []WaitlistEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return TaskPriorityRank(entries[i].Priority) > TaskPriorityRank(entries[j].Priority)
+	})
+}
+
+// OfferSlotToWaitlist holds a free place in the slot for the best matching waitlist entry
+// and returns the offer, or nil when the slot has no free place, has started or nobody on
+// the waitlist matches. The place is held until now+hold, or the slot's start if sooner.
+//
+// An entry matches if it is waiting for the slot's location with the slot's date in its
+// range, was not offered this slot before and the patient is not already booked into it.
+// Entries moving an appointment only match slots before it. The most urgent entry wins,
+// then the longest waiting.
+func OfferSlotToWaitlist(slotID uint, hold time.Duration, now time.Time) (*WaitlistOffer, error) {
+	unlock := lockSlotBooking(config.DB)
+	defer unlock()
+
+	var offer *WaitlistOffer
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var slot AppointmentSlot
+		result := forUpdate(tx).Limit(1).Find(&slot, slotID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if !slot.SlotTime.After(now) {
+			return nil
+		}
+		held, err := countHeldPlaces(tx, []uint{slot.ID}, now, 0)
+		if err != nil {
+			return err
+		}
+		if slot.BookedCount+held[slot.ID] >= slot.MaxCapacity {
+			return nil
+		}
+
+		entry, err := nextWaitlistEntry(tx, &slot)
+		if err != nil || entry == nil {
+			return err
+		}
+		result = tx.Model(&WaitlistEntry{}).Where("id = ? AND status = ?", entry.ID, WaitlistWaiting).
+			Update("status", WaitlistOffered)
+		if result.Error != nil || result.RowsAffected == 0 {
+			// Removed since it was read; the next offer cycle picks someone else
+			return result.Error
+		}
+
+		expires := now.Add(hold)
+		if expires.After(slot.SlotTime) {
+			expires = slot.SlotTime
+		}
+		offer = &WaitlistOffer{
+			EntryID:   entry.ID,
+			SlotID:    slot.ID,
+			SlotTime:  slot.SlotTime,
+			Location:  slot.Location,
+			Status:    WaitlistOfferPending,
+			ExpiresAt: expires,
+		}
+		if err := tx.Create(offer).Error; err != nil {
+			return err
+		}
+		entry.Status = WaitlistOffered
+		offer.Entry = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// FreedSlotIDs returns upcoming slots that have had a booking released and still have room,
+// so a place nobody could be offered when it was freed is offered once someone is waiting.
+// It returns nothing while the waitlist is empty.
+func FreedSlotIDs(now time.Time) ([]uint, error) {
+	var waiting int64
+	if err := config.DB.Model(&WaitlistEntry{}).Where("status = ?", WaitlistWaiting).Count(&waiting).Error; err != nil {
+		return nil, err
+	}
+	if waiting == 0 {
+		return nil, nil
+	}
+	var ids []uint
+	err := config.DB.Model(&AppointmentSlot{}).
+		Where("freed_at IS NOT NULL AND slot_time > ? AND booked_count < max_capacity", now).
+		Order("slot_time ASC").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func nextWaitlistEntry(tx *gorm.DB, slot *AppointmentSlot) (*WaitlistEntry, error) {
+	tz, err := ClinicTimeLocation()
+	if err != nil {
+		return nil, err
+	}
+	date := slot.SlotTime.In(tz).Format("2006-01-02")
+
+	var entries []WaitlistEntry
+	err = tx.Preload("Patient").Preload("Appointment").
+		Where("status = ? AND location = ? AND earliest_date <= ? AND latest_date >= ?",
+			WaitlistWaiting, slot.Location, date, date).
+		Where("NOT EXISTS (SELECT 1 FROM waitlist_offers o WHERE o.entry_id = waitlist_entries.id AND o.slot_id = ?)", slot.ID).
+		Where(`NOT EXISTS (SELECT 1 FROM appointments a WHERE a.patient_id = waitlist_entries.patient_id
+			AND a.slot_id = ? AND a.deleted_at IS NULL AND a.status <> ?)`, slot.ID, AppointmentStatusCancelled).
+		Order("created_at ASC, id ASC").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	sortWaitlistEntries(entries)
+
+	for i := range entries {
+		a := entries[i].Appointment
+		if a != nil && a.Status == AppointmentStatusScheduled && !a.StartAt.After(slot.SlotTime) {
+			// Already booked no later than this slot
+			continue
+		}
+		return &entries[i], nil
+	}
+	return nil, nil
+}
+
+// AcceptWaitlistOffer books the offered place for the entry's patient, moving the entry's
+// appointment if it is still scheduled and creating one otherwise. The offer and entry are
+// closed in the same transaction as the booking. It returns ErrWaitlistOfferClosed if the
+// offer was answered or expired first.
+func AcceptWaitlistOffer(offer *WaitlistOffer, userID uint, now time.Time) (*Appointment, error) {
+	if !offer.IsOpen(now) || offer.Entry == nil {
+		return nil, ErrWaitlistOfferClosed
+	}
+	entry := offer.Entry
+
+	appointment := &Appointment{
+		Title:       "Clinic appointment",
+		Description: "Booked from the waitlist",
+		Status:      AppointmentStatusScheduled,
+		PatientID:   entry.PatientID,
+		CreatedByID: userID,
+	}
+	if a := entry.Appointment; a != nil && a.Status == AppointmentStatusScheduled {
+		moved := *a
+		moved.Patient, moved.Slot, moved.CreatedBy = nil, nil, nil
+		// The new slot sets the end time
+		moved.EndAt = nil
+		appointment = &moved
+	}
+	appointment.StartAt = offer.SlotTime
+	appointment.Location = offer.Location
+
+	offer.RespondedByID = &userID
+	offer.RespondedAt = &now
+	if _, err := saveAppointmentBooking(appointment, offer, now); err != nil {
+		return nil, err
+	}
+	offer.Status = WaitlistOfferAccepted
+	offer.AppointmentID = &appointment.ID
+	entry.Status = WaitlistBooked
+	return appointment, nil
+}
+
+// acceptWaitlistOffer closes an offer taken by the appointment, within the booking
+// transaction.
+func acceptWaitlistOffer(tx *gorm.DB, offer *WaitlistOffer, appointmentID uint, now time.Time) error {
+	result := tx.Model(&WaitlistOffer{}).
+		Where("id = ? AND status = ? AND expires_at > ?", offer.ID, WaitlistOfferPending, now).
+		Updates(map[string]interface{}{
+			"status":          WaitlistOfferAccepted,
+			"appointment_id":  appointmentID,
+			"responded_by_id": offer.RespondedByID,
+			"responded_at":    now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWaitlistOfferClosed
+	}
+	return tx.Model(&WaitlistEntry{}).Where("id = ?", offer.EntryID).
+		Updates(map[string]interface{}{"status": WaitlistBooked, "appointment_id": appointmentID}).Error
+}
+
+// DeclineWaitlistOffer releases the held place and puts the entry back on the waitlist. It
+// returns ErrWaitlistOfferClosed if the offer was answered or expired first.
+func DeclineWaitlistOffer(offer *WaitlistOffer, userID uint, now time.Time) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&WaitlistOffer{}).
+			Where("id = ? AND status = ? AND expires_at > ?", offer.ID, WaitlistOfferPending, now).
+			Updates(map[string]interface{}{
+				"status":          WaitlistOfferDeclined,
+				"responded_by_id": userID,
+				"responded_at":    now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWaitlistOfferClosed
+		}
+		return reopenWaitlistEntry(tx, offer.EntryID)
+	})
+	if err != nil {
+		return err
+	}
+	offer.Status = WaitlistOfferDeclined
+	offer.RespondedByID = &userID
+	offer.RespondedAt = &now
+	return nil
+}
+
+// ExpireWaitlistOffers closes pending offers whose hold has run out, puts their entries back
+// on the waitlist and returns the offers it expired.
+func ExpireWaitlistOffers(now time.Time) ([]WaitlistOffer, error) {
+	var due []WaitlistOffer
+	err := config.DB.Where("status = ? AND expires_at <= ?", WaitlistOfferPending, now).
+		Order("expires_at ASC, id ASC").Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []WaitlistOffer
+	for _, offer := range due {
+		closed := false
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&WaitlistOffer{}).Where("id = ? AND status = ?", offer.ID, WaitlistOfferPending).
+				Update("status", WaitlistOfferExpired)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			closed = true
+			return reopenWaitlistEntry(tx, offer.EntryID)
+		})
+		if err != nil {
+			return expired, err
+		}
+		if closed {
+			offer.Status = WaitlistOfferExpired
+			expired = append(expired, offer)
+		}
+	}
+	return expired, nil
+}
+
+// RemoveWaitlistEntry takes the entry off the waitlist and withdraws its open offer,
+// returning the withdrawn offers so their places can be offered again.
+func RemoveWaitlistEntry(entry *WaitlistEntry) ([]WaitlistOffer, error) {
+	var withdrawn []WaitlistOffer
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("entry_id = ? AND status = ?", entry.ID, WaitlistOfferPending).Find(&withdrawn).Error; err != nil {
+			return err
+		}
+		if len(withdrawn) > 0 {
+			ids := make([]uint, 0, len(withdrawn))
+			for i := range withdrawn {
+				ids = append(ids, withdrawn[i].ID)
+				withdrawn[i].Status = WaitlistOfferWithdrawn
+			}
+			err := tx.Model(&WaitlistOffer{}).Where("id IN ? AND status = ?", ids, WaitlistOfferPending).
+				Update("status", WaitlistOfferWithdrawn).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(entry).Update("status", WaitlistRemoved).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withdrawn, nil
+}
+
+func reopenWaitlistEntry(tx *gorm.DB, entryID uint) error {
+	return tx.Model(&WaitlistEntry{}).Where("id = ? AND status = ?", entryID, WaitlistOffered).
+		Update("status", WaitlistWaiting).Error
+}
@@ -16,6 +16,7 @@ const (
 	EventReportCreated   WebhookEvent = "report.created"
 	EventReportCompleted WebhookEvent = "report.completed"
 	EventReportReviewed  WebhookEvent = "report.reviewed"
+	EventReportAFRisk    WebhookEvent = "report.af_risk" // New AF, elevated CHA2DS2-VASc, no anticoagulant
 
 	// Battery events
 	EventBatteryLow      WebhookEvent = "battery.low"      // < 20%
@@ -26,10 +27,12 @@ const (
 	EventTaskDue       WebhookEvent = "task.due" // Due today
 	EventTaskOverdue   WebhookEvent = "task.overdue"
 	EventTaskCompleted WebhookEvent = "task.completed"
+	EventTaskEscalated WebhookEvent = "task.escalated" // An escalation policy step was applied
 
 	// Consent events
 	EventConsentExpiring WebhookEvent = "consent.expiring" // Within 30 days
 	EventConsentExpired  WebhookEvent = "consent.expired"
+	EventConsentRevoked  WebhookEvent = "consent.revoked"
 
 	// Device events
 	EventDeviceImplanted WebhookEvent = "device.implanted"
@@ -46,8 +49,13 @@ func (s *StringArray) Scan(value interface{}) error {
 		return nil
 	}
 
-	bytes, ok := value.([]byte)
-	if !ok {
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string: // text columns scan as strings on some drivers
+		bytes = []byte(v)
+	default:
 		return errors.New("failed to unmarshal StringArray value")
 	}
 
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringArrayScan(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		want  StringArray
+	}{
+		{"null", nil, StringArray{}},
+		{"json bytes", []byte(`["report.created"]`), StringArray{"report.created"}},
+		{"text column string", `["AF burden 12.0%","CHA2DS2-VASc 3"]`, StringArray{"AF burden 12.0%", "CHA2DS2-VASc 3"}},
+		{"empty array string", "[]", StringArray{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got StringArray
+			if err := got.Scan(tc.value); err != nil {
+				t.Fatalf("Scan(%v) failed: %v", tc.value, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Scan(%v) = %#v, want %#v", tc.value, got, tc.want)
+			}
+		})
+	}
+
+	var got StringArray
+	if err := got.Scan(42); err == nil {
+		t.Fatal("expected an error scanning a number")
+	}
+}
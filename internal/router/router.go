@@ -37,6 +37,9 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	auth.Post("/refresh-token", handlers.RefreshToken)
 	auth.Get("/me", middleware.AuthenticateJWT, handlers.GetMe)
 
+	// iCalendar subscriptions, authenticated by the secret token in the URL
+	app.Get("/api/calendar/feed/:token", handlers.GetCalendarFeedICS)
+
 	app.Use(middleware.AuthenticateJWT)
 
 	// Apply security logging AFTER authentication so user context is available
@@ -48,6 +51,38 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Get("/api/admin/security-logs/export", middleware.RequireAdmin, handlers.ExportSecurityLogs)
 	app.Get("/api/admin/appointments", middleware.RequireAdmin, handlers.GetAdminAppointments)
 	app.Post("/api/admin/appointments/missed-letter", middleware.RequireAdmin, handlers.MarkMissedLettersSent)
+	app.Post("/api/admin/appointments/missed-letters/generate", middleware.RequireAdmin, handlers.GenerateMissedLetters)
+	app.Get("/api/admin/letter-templates", middleware.RequireAdmin, handlers.GetLetterTemplates)
+	app.Post("/api/admin/letter-templates", middleware.RequireAdmin, handlers.CreateLetterTemplate)
+	app.Put("/api/admin/letter-templates/:id", middleware.RequireAdmin, handlers.UpdateLetterTemplate)
+	app.Delete("/api/admin/letter-templates/:id", middleware.RequireAdmin, handlers.DeleteLetterTemplate)
+	app.Post("/api/admin/appointments/slots/reconcile", middleware.RequireAdmin, handlers.ReconcileAppointmentSlots)
+
+	// Clinic schedule: weekly session templates, closures and dated overrides
+	app.Get("/api/admin/clinic-sessions", middleware.RequireAdmin, handlers.GetClinicSessions)
+	app.Post("/api/admin/clinic-sessions", middleware.RequireAdmin, handlers.CreateClinicSession)
+	app.Put("/api/admin/clinic-sessions/:id", middleware.RequireAdmin, handlers.UpdateClinicSession)
+	app.Delete("/api/admin/clinic-sessions/:id", middleware.RequireAdmin, handlers.DeleteClinicSession)
+	app.Get("/api/admin/clinic-closures", middleware.RequireAdmin, handlers.GetClinicClosures)
+	app.Post("/api/admin/clinic-closures", middleware.RequireAdmin, handlers.CreateClinicClosure)
+	app.Delete("/api/admin/clinic-closures/:id", middleware.RequireAdmin, handlers.DeleteClinicClosure)
+	app.Get("/api/admin/clinic-overrides", middleware.RequireAdmin, handlers.GetClinicSessionOverrides)
+	app.Post("/api/admin/clinic-overrides", middleware.RequireAdmin, handlers.CreateClinicSessionOverride)
+	app.Delete("/api/admin/clinic-overrides/:id", middleware.RequireAdmin, handlers.DeleteClinicSessionOverride)
+	app.Get("/api/admin/follow-up-rules", middleware.RequireAdmin, handlers.GetFollowUpRules)
+	app.Post("/api/admin/follow-up-rules", middleware.RequireAdmin, handlers.CreateFollowUpRule)
+	app.Put("/api/admin/follow-up-rules/:id", middleware.RequireAdmin, handlers.UpdateFollowUpRule)
+	app.Delete("/api/admin/follow-up-rules/:id", middleware.RequireAdmin, handlers.DeleteFollowUpRule)
+	app.Get("/api/admin/reminder-rules", middleware.RequireAdmin, handlers.GetReminderRules)
+	app.Post("/api/admin/reminder-rules", middleware.RequireAdmin, handlers.CreateReminderRule)
+	app.Post("/api/admin/reminder-rules/preview", middleware.RequireAdmin, handlers.PreviewReminder)
+	app.Put("/api/admin/reminder-rules/:id", middleware.RequireAdmin, handlers.UpdateReminderRule)
+	app.Delete("/api/admin/reminder-rules/:id", middleware.RequireAdmin, handlers.DeleteReminderRule)
+	app.Get("/api/admin/reminders", middleware.RequireAdmin, handlers.GetReminders)
+	app.Post("/api/admin/reminders/:id/retry", middleware.RequireAdmin, handlers.RetryReminder)
+	app.Post("/api/admin/resources", middleware.RequireAdmin, handlers.CreateClinicResource)
+	app.Put("/api/admin/resources/:id", middleware.RequireAdmin, handlers.UpdateClinicResource)
+	app.Delete("/api/admin/resources/:id", middleware.RequireAdmin, handlers.DeleteClinicResource)
 
 	// WebSocket upgrade needs special handling - check auth in the filter
 	app.Get("/api/admin/notifications/ws", websocket.New(handlers.AdminNotificationsWS, websocket.Config{
@@ -96,6 +131,19 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Delete("/api/users/:id", handlers.DeleteUser)
 	app.Post("/api/users", handlers.CreateUser)
 
+	// @mentions of the current user in patient and task notes
+	app.Get("/api/mentions", handlers.GetMyMentions)
+	app.Get("/api/mentions/unread-count", handlers.GetUnreadMentionCount)
+	app.Put("/api/mentions/read", handlers.MarkMentionsRead)
+
+	// Calendar feed subscriptions of the current user
+	app.Get("/api/calendar/feeds", handlers.GetCalendarFeeds)
+	app.Post("/api/calendar/feeds", handlers.CreateCalendarFeed)
+	app.Put("/api/calendar/feeds/:id", handlers.UpdateCalendarFeed)
+	app.Delete("/api/calendar/feeds/:id", handlers.RevokeCalendarFeed)
+	app.Post("/api/calendar/feeds/:id/rotate", handlers.RotateCalendarFeed)
+	app.Delete("/api/admin/users/:id/calendar-feeds", middleware.RequireAdmin, handlers.RevokeUserCalendarFeeds)
+
 	// Device routes - admin only for CUD operations
 	app.Get("/api/devices/all", handlers.GetDevicesBasic)
 	app.Get("/api/devices/search", handlers.SearchDevices)
@@ -121,11 +169,23 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Get("/api/patients/recent", middleware.SetUserRole, handlers.GetMostRecentPatientList)
 	app.Get("/api/patients/overdue", middleware.SetUserRole, handlers.GetOverduePatients)
 	app.Get("/api/patients/search", middleware.SetUserRole, handlers.SearchPatients)
+	app.Get("/api/patients/duplicates/check", middleware.RequireAdminOrUser, handlers.CheckPatientDuplicates)
 	app.Post("/api/patients", middleware.RequireAdminOrUser, handlers.CreatePatient)
 	app.Get("/api/patients/:id", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatient)
+	app.Get("/api/patients/:id/summary", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientSummary)
+	app.Get("/api/patients/:id/summary/pdf", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientSummaryPDF)
+	app.Get("/api/patients/:id/letters", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientLetters)
+	app.Get("/api/patients/:id/resource-requirements", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientResourceRequirements)
+	app.Get("/api/patients/:id/letters/:letterId/pdf", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientLetterPDF)
 	app.Put("/api/patients/:id", middleware.RequireAdminOrUser, handlers.UpdatePatient)
 	app.Delete("/api/patients/:id", middleware.RequireAdminOrUser, handlers.DeletePatient)
 
+	// Duplicate patient review queue
+	app.Get("/api/admin/duplicate-patients", middleware.RequireAdmin, handlers.GetDuplicatePatientCandidates)
+	app.Post("/api/admin/duplicate-patients/scan", middleware.RequireAdmin, handlers.RunDuplicatePatientScan)
+	app.Get("/api/admin/duplicate-patients/:id", middleware.RequireAdmin, handlers.GetDuplicatePatientCandidate)
+	app.Put("/api/admin/duplicate-patients/:id", middleware.RequireAdmin, handlers.ResolveDuplicatePatientCandidate)
+
 	// Access request workflow (doctors request; admins approve/deny)
 	app.Get("/api/access-requests/patient-lookup", middleware.RequireRole("doctor"), handlers.LookupPatientForAccessRequest)
 	app.Post("/api/access-requests", middleware.RequireRole("doctor"), handlers.CreateAccessRequest)
@@ -143,6 +203,21 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Put("/api/patients/:id/notes/:noteId", middleware.RequireAdminUserOrStaffDoctor, handlers.UpdatePatientNote)
 	app.Delete("/api/patients/:id/notes/:noteId", middleware.RequireAdminUserOrStaffDoctor, handlers.DeletePatientNote)
 
+	// Patient medication regimens
+	app.Get("/api/patients/:id/medications", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientMedicationRegimens)
+	app.Get("/api/patients/:id/medications/history", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientMedicationHistory)
+	app.Post("/api/patients/:id/medications", middleware.RequireAdminUserOrStaffDoctor, handlers.CreatePatientMedicationRegimen)
+	app.Put("/api/patients/:id/medications/:regimenId", middleware.RequireAdminUserOrStaffDoctor, handlers.UpdatePatientMedicationRegimen)
+	app.Post("/api/patients/:id/medications/:regimenId/change", middleware.RequireAdminUserOrStaffDoctor, handlers.ChangePatientMedicationRegimen)
+	app.Post("/api/patients/:id/medications/:regimenId/stop", middleware.RequireAdminUserOrStaffDoctor, handlers.StopPatientMedicationRegimen)
+	app.Delete("/api/patients/:id/medications/:regimenId", middleware.RequireAdminUserOrStaffDoctor, handlers.DeletePatientMedicationRegimen)
+
+	// Stroke and bleeding risk
+	app.Get("/api/patients/:id/risk-factors", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientRiskProfile)
+	app.Put("/api/patients/:id/risk-factors", middleware.RequireAdminUserOrStaffDoctor, handlers.UpdatePatientRiskFactors)
+	app.Get("/api/af-alerts", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetAFRiskAlerts)
+	app.Put("/api/af-alerts/:id", middleware.RequireAdminUserOrStaffDoctor, handlers.AcknowledgeAFRiskAlert)
+
 	// Timeline routes
 	app.Get("/api/patients/:patientId/timeline", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientTimeline)
 	app.Get("/api/patients/:patientId/timeline/stats", middleware.AuthorizeDoctorPatientAccess, handlers.GetPatientTimelineStats)
@@ -164,11 +239,60 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	// Report routes
 	app.Post("/api/reports", handlers.UploadFile, handlers.CreateReport)
 	app.Get("/api/reports/recent", middleware.SetUserRole, handlers.GetRecentReports)
+	app.Get("/api/reports/awaiting-signoff", middleware.RequireRole("admin", "doctor", "staff_doctor"), handlers.GetReportsAwaitingSignoff)
+	app.Get("/api/reports/compare", handlers.CompareReports)
 	app.Get("/api/patients/:patientId/reports", middleware.AuthorizeDoctorPatientAccess, handlers.GetReportsByPatient)
 	app.Get("/api/reports/:id", handlers.GetReport)
 	app.Put("/api/reports/:id", middleware.RequireAdminUserOrStaffDoctor, handlers.UploadFile, handlers.UpdateReport)
 	app.Delete("/api/reports/:id", middleware.RequireAdminOrUser, handlers.DeleteReport)
 
+	// Physician co-signature
+	app.Get("/api/reports/:id/signoff", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetReportSignoffHistory)
+	app.Post("/api/reports/:id/signoff", middleware.RequireRole("admin", "doctor", "staff_doctor"), handlers.SignoffReport)
+
+	// Next follow-up after a completed report
+	app.Get("/api/follow-ups/worklist", middleware.RequireAdminUserOrStaffDoctor, handlers.GetFollowUpWorklist)
+	app.Get("/api/reports/:id/follow-up", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetReportFollowUp)
+	app.Post("/api/reports/:id/follow-up", middleware.RequireAdminUserOrStaffDoctor, handlers.BookReportFollowUp)
+	app.Post("/api/reports/:id/follow-up/dismiss", middleware.RequireAdminUserOrStaffDoctor, handlers.DismissReportFollowUp)
+
+	// Waitlist for freed clinic places
+	app.Get("/api/waitlist", middleware.RequireAdminUserOrStaffDoctor, handlers.GetWaitlist)
+	app.Post("/api/waitlist", middleware.RequireAdminUserOrStaffDoctor, handlers.CreateWaitlistEntry)
+	app.Get("/api/waitlist/:id", middleware.RequireAdminUserOrStaffDoctor, handlers.GetWaitlistEntry)
+	app.Put("/api/waitlist/:id", middleware.RequireAdminUserOrStaffDoctor, handlers.UpdateWaitlistEntry)
+	app.Delete("/api/waitlist/:id", middleware.RequireAdminUserOrStaffDoctor, handlers.DeleteWaitlistEntry)
+	app.Post("/api/waitlist/offers/:id/accept", middleware.RequireAdminUserOrStaffDoctor, handlers.AcceptWaitlistOffer)
+	app.Post("/api/waitlist/offers/:id/decline", middleware.RequireAdminUserOrStaffDoctor, handlers.DeclineWaitlistOffer)
+
+	// Rooms, programmers and staff allocated to clinic appointments
+	app.Get("/api/resources", middleware.RequireAdminUserOrStaffDoctor, handlers.GetClinicResources)
+	app.Get("/api/resources/schedule", middleware.RequireAdminUserOrStaffDoctor, handlers.GetResourceSchedule)
+
+	// Report review queue
+	app.Get("/api/report-queue", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetReportReviewQueue)
+	app.Get("/api/report-queue/metrics", middleware.RequireAdminUserOrStaffDoctor, handlers.GetReportTurnaroundMetrics)
+	app.Get("/api/reports/:id/review", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetReportReview)
+	app.Post("/api/reports/:id/review/claim", middleware.RequireAdminUserOrStaffDoctor, handlers.ClaimReportReview)
+	app.Post("/api/reports/:id/review/release", middleware.RequireAdminUserOrStaffDoctor, handlers.ReleaseReportReview)
+	app.Put("/api/reports/:id/review/assignment", middleware.RequireAdminUserOrStaffDoctor, handlers.AssignReportReview)
+	app.Get("/api/admin/report-turnaround-targets", middleware.RequireAdmin, handlers.GetReportTurnaroundTargets)
+	app.Put("/api/admin/report-turnaround-targets", middleware.RequireAdmin, handlers.UpsertReportTurnaroundTarget)
+	app.Delete("/api/admin/report-turnaround-targets/:id", middleware.RequireAdmin, handlers.DeleteReportTurnaroundTarget)
+	app.Get("/api/admin/report-comparison-thresholds", middleware.RequireAdmin, handlers.GetReportComparisonThresholds)
+	app.Put("/api/admin/report-comparison-thresholds", middleware.RequireAdmin, handlers.UpsertReportComparisonThreshold)
+	app.Delete("/api/admin/report-comparison-thresholds/:metric", middleware.RequireAdmin, handlers.DeleteReportComparisonThreshold)
+	app.Get("/api/admin/task-escalation-policies", middleware.RequireAdmin, handlers.GetTaskEscalationPolicies)
+	app.Post("/api/admin/task-escalation-policies", middleware.RequireAdmin, handlers.CreateTaskEscalationPolicy)
+	app.Put("/api/admin/task-escalation-policies/:id", middleware.RequireAdmin, handlers.UpdateTaskEscalationPolicy)
+	app.Delete("/api/admin/task-escalation-policies/:id", middleware.RequireAdmin, handlers.DeleteTaskEscalationPolicy)
+	app.Get("/api/admin/automation-rules", middleware.RequireAdmin, handlers.GetAutomationRules)
+	app.Post("/api/admin/automation-rules", middleware.RequireAdmin, handlers.CreateAutomationRule)
+	app.Put("/api/admin/automation-rules/:id", middleware.RequireAdmin, handlers.UpdateAutomationRule)
+	app.Delete("/api/admin/automation-rules/:id", middleware.RequireAdmin, handlers.DeleteAutomationRule)
+	app.Post("/api/admin/automation-rules/:id/dry-run", middleware.RequireAdmin, handlers.DryRunAutomationRule)
+	app.Get("/api/admin/automation-executions", middleware.RequireAdmin, handlers.GetAutomationExecutions)
+
 	// Report Builder routes
 	reportBuilder := handlers.NewReportBuilderHandler(db)
 	app.Get("/api/report-builder/fields", reportBuilder.GetAvailableFields)
@@ -216,6 +340,23 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Post("/api/tasks/:id/notes", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.AddTaskNote)
 	app.Put("/api/tasks/:id/notes/:noteId", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.UpdateTaskNote)
 	app.Delete("/api/tasks/:id/notes/:noteId", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.DeleteTaskNote)
+	app.Get("/api/tasks/:id/escalations", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetTaskEscalationHistory)
+	app.Post("/api/tasks/:id/checklist", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.AddTaskChecklistItem)
+	app.Put("/api/tasks/:id/checklist/:itemId", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.UpdateTaskChecklistItem)
+	app.Delete("/api/tasks/:id/checklist/:itemId", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.DeleteTaskChecklistItem)
+	app.Post("/api/tasks/:id/dependencies", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.AddTaskDependency)
+	app.Delete("/api/tasks/:id/dependencies/:dependsOnId", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.RemoveTaskDependency)
+
+	// Bulk actions; each item is checked as if changed on its own
+	app.Post("/api/bulk/tasks/reassign", middleware.RequireAdmin, handlers.BulkReassignTasks)
+	app.Post("/api/bulk/tasks/status", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.BulkUpdateTaskStatus)
+	app.Post("/api/bulk/patients/tags", middleware.RequireAdminOrUser, handlers.BulkTagPatients)
+	app.Post("/api/bulk/reports/tags", middleware.RequireAdminUserOrStaffDoctor, handlers.BulkTagReports)
+	app.Post("/api/bulk/reports/review", middleware.RequireRole("admin", "doctor", "staff_doctor"), handlers.BulkReviewReports)
+	app.Post("/api/bulk/export", handlers.BulkExport)
+	app.Get("/api/bulk/jobs", handlers.GetBulkJobs)
+	app.Get("/api/bulk/jobs/:id", handlers.GetBulkJob)
+	app.Get("/api/bulk/jobs/:id/download", handlers.DownloadBulkJobExport)
 
 	// Patient-specific tasks
 	app.Get("/api/patients/:patientId/tasks", middleware.AuthorizeDoctorPatientAccess, handlers.GetTasksByPatient)
@@ -224,6 +365,8 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Get("/api/appointments", handlers.GetAppointments)
 	app.Get("/api/appointments/slots/available", handlers.GetAvailableSlots)
 	app.Get("/api/appointments/:id", handlers.GetAppointment)
+	app.Get("/api/appointments/:id/reminders", handlers.GetAppointmentReminders)
+	app.Get("/api/appointments/:id/resources", handlers.GetAppointmentResources)
 	app.Post("/api/appointments", middleware.RequireAdminOrUser, handlers.CreateAppointment)
 	app.Put("/api/appointments/:id", middleware.RequireAdminOrUser, handlers.UpdateAppointment)
 	app.Delete("/api/appointments/:id", middleware.RequireAdminOrUser, handlers.DeleteAppointment)
@@ -283,6 +426,13 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	app.Delete("/api/teams/:id", middleware.RequireAdmin, handlers.DeleteTeam)
 	app.Post("/api/teams/:id/members", middleware.RequireAdmin, handlers.AddTeamMembers)
 	app.Delete("/api/teams/:id/members", middleware.RequireAdmin, handlers.RemoveTeamMembers)
+	app.Get("/api/users/:id/skills", middleware.RequireAdmin, handlers.GetUserSkills)
+	app.Put("/api/users/:id/skills", middleware.RequireAdmin, handlers.SetUserSkills)
+
+	// Out-of-office periods, skipped by team auto-assignment
+	app.Get("/api/absences", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.GetUserAbsences)
+	app.Post("/api/absences", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.CreateUserAbsence)
+	app.Delete("/api/absences/:id", middleware.RequireAdminUserDoctorOrStaffDoctor, handlers.DeleteUserAbsence)
 
 	// Team productivity routes
 	app.Get("/api/productivity/teams/:id", middleware.RequireAdmin, handlers.GetSpecificTeamProductivityReport)
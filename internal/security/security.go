@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"log"
 	"net"
 	"os"
@@ -165,6 +166,12 @@ func GetRealIP(c *fiber.Ctx) string {
 
 // Helper function to log from Fiber context
 func LogEventFromContext(c *fiber.Ctx, eventType EventType, message string, severity string, details map[string]interface{}) {
+	LogEvent(EventFromContext(c, eventType, message, severity, details))
+}
+
+// EventFromContext builds a security event from the request. Its strings are copied so the
+// event can still be logged after the handler returns, e.g. when a background job ends.
+func EventFromContext(c *fiber.Ctx, eventType EventType, message string, severity string, details map[string]interface{}) SecurityEvent {
 	userID := ""
 	username := ""
 
@@ -181,24 +188,22 @@ func LogEventFromContext(c *fiber.Ctx, eventType EventType, message string, seve
 			username = unameStr
 		}
 	}
-	event := SecurityEvent{
+	return SecurityEvent{
 		EventType:  eventType,
 		UserID:     userID,
 		Username:   username,
-		IPAddress:  GetRealIP(c),
-		UserAgent:  c.Get("User-Agent"),
-		Path:       c.Path(),
-		Method:     c.Method(),
+		IPAddress:  utils.CopyString(GetRealIP(c)),
+		UserAgent:  utils.CopyString(c.Get("User-Agent")),
+		Path:       utils.CopyString(c.Path()),
+		Method:     utils.CopyString(c.Method()),
 		StatusCode: c.Response().StatusCode(),
 		Message:    message,
 		Severity:   severity,
 		Details:    details,
 		DeviceInfo: map[string]string{
-			"fingerprint": c.Get("X-Device-Fingerprint"),
+			"fingerprint": utils.CopyString(c.Get("X-Device-Fingerprint")),
 		},
 	}
-
-	LogEvent(event)
 }
 
 // LogEventWithUser logs a security event with explicit user information
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
+)
+
+// PatientRiskAssessment combines stored risk factors, demographics and current
+// medications into stroke and bleeding risk scores.
+type PatientRiskAssessment struct {
+	PatientID      uint                       `json:"patientId"`
+	Age            *int                       `json:"age"`
+	Female         bool                       `json:"female"`
+	Factors        *models.PatientRiskFactors `json:"factors"`
+	CHA2DS2VASc    models.RiskScore           `json:"cha2ds2vasc"`
+	HASBLED        models.RiskScore           `json:"hasbled"`
+	Anticoagulated bool                       `json:"anticoagulated"`
+}
+
+// AFBurdenThreshold is the AT/AF burden percentage at or above which AF is considered present.
+func AFBurdenThreshold() float64 {
+	return getEnvFloat("AF_BURDEN_ALERT_THRESHOLD", 1.0)
+}
+
+// AssessPatientRisk computes risk scores for a patient as of the given time.
+func AssessPatientRisk(patientID uint, at time.Time) (*PatientRiskAssessment, error) {
+	var patient models.Patient
+	if err := config.DB.Select("id", "dob", "gender").First(&patient, patientID).Error; err != nil {
+		return nil, err
+	}
+
+	factors, err := models.GetPatientRiskFactors(patientID)
+	if err != nil {
+		return nil, err
+	}
+	anticoagulated, err := models.IsPatientAnticoagulated(patientID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	assessment := &PatientRiskAssessment{
+		PatientID:      patientID,
+		Female:         models.IsFemale(patient.Gender),
+		Factors:        factors,
+		Anticoagulated: anticoagulated,
+	}
+	age, ageKnown := models.PatientAge(patient.DOB, at)
+	if ageKnown {
+		assessment.Age = &age
+	}
+	assessment.CHA2DS2VASc = factors.CHA2DS2VASc(age, ageKnown, assessment.Female)
+	assessment.HASBLED = factors.HASBLED(age, ageKnown)
+	return assessment, nil
+}
+
+// EvaluateReportAFRisk raises an AF risk alert when the report shows AF burden at or above
+// the threshold, the previous report for the patient did not, the CHA2DS2-VASc score is
+// elevated and the patient is not on an anticoagulant. An open alert that no longer applies
+// (for example after the report is corrected) is removed. created is true only when a new
+// alert was stored.
+func EvaluateReportAFRisk(report *models.Report) (alert *models.AFRiskAlert, created bool, err error) {
+	existing, err := models.GetAFRiskAlertByReportID(report.ID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	clearAlert := func() (*models.AFRiskAlert, bool, error) {
+		if existing != nil && existing.Status == models.AFRiskAlertOpen {
+			return nil, false, config.DB.Unscoped().Delete(existing).Error
+		}
+		return existing, false, nil
+	}
+
+	threshold := AFBurdenThreshold()
+	burden := report.MdcIdcStatAtafBurdenPercent
+	if burden == nil || *burden < threshold {
+		return clearAlert()
+	}
+
+	var previous models.Report
+	var previousBurden *float64
+	err = config.DB.Select("id", "mdc_idc_stat_ataf_burden_percent").
+		Where("patient_id = ? AND id <> ?", report.PatientID, report.ID).
+		Where("report_date < ? OR (report_date = ? AND id < ?)", report.ReportDate, report.ReportDate, report.ID).
+		Order("report_date DESC, id DESC").
+		First(&previous).Error
+	switch {
+	case err == nil:
+		previousBurden = previous.MdcIdcStatAtafBurdenPercent
+		if previousBurden != nil && *previousBurden >= threshold {
+			return clearAlert()
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, false, err
+	}
+
+	assessment, err := AssessPatientRisk(report.PatientID, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if !assessment.CHA2DS2VASc.Elevated || assessment.Anticoagulated {
+		return clearAlert()
+	}
+
+	reasons := models.StringArray{
+		fmt.Sprintf("AT/AF burden %.1f%% (threshold %.1f%%)", *burden, threshold),
+		fmt.Sprintf("CHA2DS2-VASc %d", assessment.CHA2DS2VASc.Score),
+		"No active anticoagulant",
+	}
+	if previousBurden == nil {
+		reasons = append(reasons, "No AF recorded on previous report")
+	} else {
+		reasons = append(reasons, fmt.Sprintf("Previous burden %.1f%%", *previousBurden))
+	}
+
+	if existing != nil {
+		alert = existing
+	} else {
+		alert = &models.AFRiskAlert{
+			ReportID:  report.ID,
+			PatientID: report.PatientID,
+			Status:    models.AFRiskAlertOpen,
+		}
+	}
+	alert.BurdenPercent = *burden
+	alert.PreviousBurdenPercent = previousBurden
+	alert.ThresholdPercent = threshold
+	alert.CHA2DS2VASc = assessment.CHA2DS2VASc.Score
+	alert.HASBLED = assessment.HASBLED.Score
+	alert.Reasons = reasons
+
+	if err := config.DB.Omit("Patient", "Report", "AcknowledgedBy").Save(alert).Error; err != nil {
+		return nil, false, err
+	}
+	return alert, existing == nil, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// RunAutomationRules applies the enabled rules for an event and logs every rule whose
+// conditions matched. trigger fires task.created for the tasks it creates and may be nil.
+func RunAutomationRules(event models.WebhookEvent, data map[string]interface{}, trigger WebhookTrigger) {
+	if !models.IsAutomationEvent(event) {
+		return
+	}
+	rules, err := models.GetEnabledAutomationRules(event)
+	if err != nil {
+		log.Printf("[Automation] Failed to load rules for %s: %v", event, err)
+		return
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Matches(data) {
+			continue
+		}
+		execution, task := ExecuteAutomationRule(rule, event, data, rule.DryRun)
+		if err := config.DB.Create(&execution).Error; err != nil {
+			log.Printf("[Automation] Failed to log execution of rule %d: %v", rule.ID, err)
+		}
+		if task != nil && execution.Status == models.AutomationCreated {
+			announceAutomatedTask(rule, task, trigger)
+		}
+	}
+}
+
+// ExecuteAutomationRule creates the rule's task for an event whose conditions already
+// matched, or with dryRun only builds it. It returns the execution to log and the task.
+func ExecuteAutomationRule(rule *models.AutomationRule, event models.WebhookEvent, data map[string]interface{}, dryRun bool) (models.AutomationExecution, *models.Task) {
+	execution := models.AutomationExecution{RuleID: rule.ID, Event: event}
+	if payload, err := json.Marshal(data); err == nil {
+		execution.EventData = string(payload)
+	}
+
+	patientID, ok := automationPatientID(data)
+	if !ok {
+		execution.Status = models.AutomationSkipped
+		execution.Message = "Event has no patient"
+		return execution, nil
+	}
+	execution.PatientID = &patientID
+
+	var template models.TaskTemplate
+	if err := config.DB.Preload("Tags").First(&template, rule.TemplateID).Error; err != nil {
+		execution.Status = models.AutomationFailed
+		execution.Message = "Task template not found"
+		return execution, nil
+	}
+
+	// Repeated events (a report saved twice, several low-battery readings) should not pile up
+	// copies of the same follow-up.
+	var existing models.Task
+	if err := config.DB.Select("id").
+		Where("patient_id = ? AND template_id = ? AND status IN ?", patientID, template.ID, []models.TaskStatus{models.TaskStatusPending, models.TaskStatusInProgress}).
+		Limit(1).Find(&existing).Error; err != nil {
+		execution.Status = models.AutomationFailed
+		execution.Message = "Failed to check for an open task: " + err.Error()
+		return execution, nil
+	}
+	if existing.ID != 0 {
+		execution.Status = models.AutomationSkipped
+		execution.TaskID = &existing.ID
+		execution.Message = fmt.Sprintf("Patient already has open task #%d from template %s", existing.ID, template.Name)
+		return execution, nil
+	}
+
+	task := automationTask(rule, &template, patientID)
+	if dryRun {
+		execution.Status = models.AutomationWouldCreate
+		execution.Message = fmt.Sprintf("Would create '%s'%s", task.Title, automationAssignee(task))
+		if len(template.Steps) > 0 {
+			execution.Message = fmt.Sprintf("Would create the %d-step workflow '%s'%s", len(template.Steps), template.Name, automationAssignee(task))
+		}
+		return execution, task
+	}
+
+	tasks, err := models.CreateTasksFromTemplate(&template, task, time.Now())
+	if err != nil {
+		execution.Status = models.AutomationFailed
+		execution.Message = "Failed to create task: " + err.Error()
+		return execution, nil
+	}
+	// A workflow is logged against its first step.
+	task = &tasks[0]
+	execution.Status = models.AutomationCreated
+	execution.TaskID = &task.ID
+	execution.Message = fmt.Sprintf("Created '%s'%s", task.Title, automationAssignee(task))
+	if len(tasks) > 1 {
+		execution.Message = fmt.Sprintf("Created the %d-step workflow '%s'%s", len(tasks), template.Name, automationAssignee(task))
+	}
+	return execution, task
+}
+
+// automationTask builds the task a rule creates from its template.
+func automationTask(rule *models.AutomationRule, template *models.TaskTemplate, patientID uint) *models.Task {
+	var dueDate *time.Time
+	days := template.DaysUntilDue
+	if rule.DueInDays != nil {
+		days = rule.DueInDays
+	}
+	if days != nil {
+		calculated := time.Now().AddDate(0, 0, *days)
+		dueDate = &calculated
+	} else if template.Recurrence != nil {
+		calculated := time.Now()
+		dueDate = &calculated
+	}
+
+	templateID := template.ID
+	return &models.Task{
+		Title:            template.Title,
+		Description:      template.TaskDescription,
+		Status:           models.TaskStatusPending,
+		Priority:         template.Priority,
+		DueDate:          dueDate,
+		PatientID:        &patientID,
+		AssignedToID:     rule.AssignToUserID,
+		AssignedToTeamID: rule.AssignToTeamID,
+		CreatedByID:      rule.CreatedByID,
+		TemplateID:       &templateID,
+	}
+}
+
+func automationAssignee(task *models.Task) string {
+	switch {
+	case task.AssignedToID != nil:
+		return fmt.Sprintf(" for user %d", *task.AssignedToID)
+	case task.AssignedToTeamID != nil:
+		return fmt.Sprintf(" for team %d", *task.AssignedToTeamID)
+	}
+	return ""
+}
+
+// automationPatientID reads the patientId every patient-related event carries.
+func automationPatientID(data map[string]interface{}) (uint, bool) {
+	switch v := data["patientId"].(type) {
+	case uint:
+		return v, v != 0
+	case *uint:
+		if v != nil {
+			return *v, *v != 0
+		}
+	case int:
+		return uint(v), v > 0
+	case float64:
+		return uint(v), v > 0
+	}
+	return 0, false
+}
+
+func announceAutomatedTask(rule *models.AutomationRule, task *models.Task, trigger WebhookTrigger) {
+	taskID := task.ID
+	event := NotificationEvent{
+		Type:    "task.automated",
+		Title:   "Task created by automation",
+		Message: fmt.Sprintf("Rule '%s' created '%s'", rule.Name, task.Title),
+		TaskID:  &taskID,
+	}
+	for _, userID := range taskAssignees(task) {
+		NotificationsHub.SendToUser(userID, event)
+	}
+
+	if trigger != nil {
+		trigger(models.EventTaskCreated, map[string]interface{}{
+			"taskId":           task.ID,
+			"title":            task.Title,
+			"description":      task.Description,
+			"priority":         task.Priority,
+			"status":           task.Status,
+			"dueDate":          task.DueDate,
+			"patientId":        task.PatientID,
+			"assignedTo":       task.AssignedToID,
+			"automationRuleId": rule.ID,
+		})
+	}
+}
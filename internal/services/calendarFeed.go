@@ -0,0 +1,309 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// CalendarFeedMaxPrivacy is the most detail any calendar feed may show, whatever the feed
+// asks for. Feeds end up in third-party calendar apps, so it defaults to limited and full
+// feeds must be enabled with ICS_MAX_PRIVACY=full.
+func CalendarFeedMaxPrivacy() string {
+	if level := strings.ToLower(os.Getenv("ICS_MAX_PRIVACY")); models.IsFeedPrivacyLevel(level) {
+		return level
+	}
+	return models.FeedPrivacyLimited
+}
+
+// CalendarFeedPrivacy returns the privacy level a feed is rendered with.
+func CalendarFeedPrivacy(feed *models.CalendarFeed) string {
+	limit := CalendarFeedMaxPrivacy()
+	if models.FeedPrivacyRank(feed.PrivacyLevel) < models.FeedPrivacyRank(limit) {
+		return feed.PrivacyLevel
+	}
+	return limit
+}
+
+// BuildCalendarFeed renders a feed as an iCalendar document for the user who owns it. Every
+// event keeps its UID across fetches and its SEQUENCE grows when the source record changes,
+// so calendar apps update events in place; cancelled and deleted records stay in the feed
+// as cancelled events until they fall out of the window.
+func BuildCalendarFeed(feed *models.CalendarFeed, user *models.User, now time.Time) ([]byte, error) {
+	from := now.AddDate(0, 0, -getEnvInt("ICS_FEED_PAST_DAYS", 30))
+	to := now.AddDate(0, 0, getEnvInt("ICS_FEED_FUTURE_DAYS", 365))
+
+	b := &calendarFeedBuilder{
+		user:    user,
+		privacy: CalendarFeedPrivacy(feed),
+		access:  make(map[uint]bool),
+		baseURL: strings.TrimRight(os.Getenv("APP_BASE_URL"), "/"),
+	}
+	b.line("BEGIN:VCALENDAR")
+	b.line("VERSION:2.0")
+	b.line("PRODID:-//goReporter//Calendar Feed//EN")
+	b.line("CALSCALE:GREGORIAN")
+	b.line("METHOD:PUBLISH")
+	b.prop("X-WR-CALNAME", feed.Name)
+	b.line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	b.line("X-PUBLISHED-TTL:PT1H")
+
+	appointments, err := calendarFeedAppointments(feed, user, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range appointments {
+		if err := b.appointment(&appointments[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if feed.IncludeTasks {
+		tasks, err := models.GetCalendarTasks(user.ID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for i := range tasks {
+			if err := b.task(&tasks[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b.line("END:VCALENDAR")
+	return []byte(b.sb.String()), nil
+}
+
+// calendarFeedAppointments collects the feed's appointments, each once.
+func calendarFeedAppointments(feed *models.CalendarFeed, user *models.User, from, to time.Time) ([]models.Appointment, error) {
+	var filters []models.AppointmentFilter
+	switch feed.Appointments {
+	case models.FeedAppointmentsMine:
+		filters = append(filters, models.AppointmentFilter{CreatedByID: &user.ID})
+	case models.FeedAppointmentsClinic:
+		// Only roles that can see every patient get the whole clinic's schedule
+		if user.Role != "doctor" {
+			filters = append(filters, models.AppointmentFilter{})
+		}
+	}
+	if feed.IncludePatientAppointments && user.Role == "doctor" {
+		filters = append(filters, models.AppointmentFilter{DoctorUserID: &user.ID})
+	}
+
+	seen := make(map[uint]bool)
+	var appointments []models.Appointment
+	for _, filter := range filters {
+		filter.StartAt = &from
+		filter.EndAt = &to
+		filter.IncludeDeleted = true
+		found, err := models.ListAppointments(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range found {
+			if !seen[a.ID] {
+				seen[a.ID] = true
+				appointments = append(appointments, a)
+			}
+		}
+	}
+	return appointments, nil
+}
+
+type calendarFeedBuilder struct {
+	sb      strings.Builder
+	user    *models.User
+	privacy string
+	access  map[uint]bool // Patient IDs the user may see, cached
+	baseURL string
+}
+
+func (b *calendarFeedBuilder) appointment(a *models.Appointment) error {
+	end := a.StartAt.Add(30 * time.Minute)
+	if a.EndAt != nil && a.EndAt.After(a.StartAt) {
+		end = *a.EndAt
+	}
+	changed := a.UpdatedAt
+	cancelled := a.Status == models.AppointmentStatusCancelled
+	if a.DeletedAt.Valid {
+		cancelled = true
+		changed = a.DeletedAt.Time
+	}
+
+	summary := "Appointment"
+	var description, location, url string
+	if b.privacy != models.FeedPrivacyBusy {
+		summary = a.Title
+		location = string(a.Location)
+		patient, err := b.patientLabel(a.Patient)
+		if err != nil {
+			return err
+		}
+		if patient != "" {
+			summary += " - " + patient
+		}
+		if b.privacy == models.FeedPrivacyFull && b.access[a.PatientID] {
+			description = a.Description
+			url = b.link(fmt.Sprintf("/patients/%d", a.PatientID))
+		}
+	}
+
+	b.line("BEGIN:VEVENT")
+	b.prop("UID", fmt.Sprintf("appointment-%d@goreporter", a.ID))
+	b.line("DTSTAMP:" + icsTime(changed))
+	b.line(fmt.Sprintf("SEQUENCE:%d", icsSequence(a.CreatedAt, changed)))
+	b.line("DTSTART:" + icsTime(a.StartAt))
+	b.line("DTEND:" + icsTime(end))
+	b.prop("SUMMARY", summary)
+	b.prop("LOCATION", location)
+	b.prop("DESCRIPTION", description)
+	b.prop("URL", url)
+	if cancelled {
+		b.line("STATUS:CANCELLED")
+	} else {
+		b.line("STATUS:CONFIRMED")
+	}
+	b.line("TRANSP:OPAQUE")
+	b.line("END:VEVENT")
+	return nil
+}
+
+func (b *calendarFeedBuilder) task(t *models.Task) error {
+	// Completed tasks drop out of the calendar
+	if t.Status == models.TaskStatusCompleted && !t.DeletedAt.Valid {
+		return nil
+	}
+	changed := t.UpdatedAt
+	cancelled := t.Status == models.TaskStatusCancelled
+	if t.DeletedAt.Valid {
+		cancelled = true
+		changed = t.DeletedAt.Time
+	}
+	day := t.DueDate.In(time.Local)
+
+	summary := "Task due"
+	var description, url string
+	if b.privacy != models.FeedPrivacyBusy {
+		summary = "Task due: " + t.Title
+		patient, err := b.patientLabel(t.Patient)
+		if err != nil {
+			return err
+		}
+		if patient != "" {
+			summary += " - " + patient
+		}
+		if b.privacy == models.FeedPrivacyFull {
+			description = fmt.Sprintf("Priority: %s", t.Priority)
+			if t.Description != "" {
+				description += "\n\n" + t.Description
+			}
+			url = b.link(fmt.Sprintf("/tasks/%d", t.ID))
+		}
+	}
+
+	b.line("BEGIN:VEVENT")
+	b.prop("UID", fmt.Sprintf("task-%d@goreporter", t.ID))
+	b.line("DTSTAMP:" + icsTime(changed))
+	b.line(fmt.Sprintf("SEQUENCE:%d", icsSequence(t.CreatedAt, changed)))
+	b.line("DTSTART;VALUE=DATE:" + day.Format("20060102"))
+	b.line("DTEND;VALUE=DATE:" + day.AddDate(0, 0, 1).Format("20060102"))
+	b.prop("SUMMARY", summary)
+	b.prop("DESCRIPTION", description)
+	b.prop("URL", url)
+	if cancelled {
+		b.line("STATUS:CANCELLED")
+	} else {
+		b.line("STATUS:CONFIRMED")
+	}
+	b.line("TRANSP:TRANSPARENT")
+	b.line("END:VEVENT")
+	return nil
+}
+
+// patientLabel names the patient as far as the privacy level allows: initials for limited
+// feeds, name and MRN for full ones. Patients the user may not see are left out.
+func (b *calendarFeedBuilder) patientLabel(p *models.Patient) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	allowed, ok := b.access[p.ID]
+	if !ok {
+		var err error
+		if allowed, err = models.CanAccessPatient(b.user, p.ID); err != nil {
+			return "", err
+		}
+		b.access[p.ID] = allowed
+	}
+	if !allowed {
+		return "", nil
+	}
+	if b.privacy == models.FeedPrivacyFull {
+		return fmt.Sprintf("%s %s (MRN %d)", p.FirstName, p.LastName, p.MRN), nil
+	}
+	return nameInitial(p.FirstName) + nameInitial(p.LastName), nil
+}
+
+func (b *calendarFeedBuilder) link(path string) string {
+	if b.baseURL == "" {
+		return ""
+	}
+	return b.baseURL + path
+}
+
+// prop writes a text property, skipping empty values.
+func (b *calendarFeedBuilder) prop(name, value string) {
+	if value == "" {
+		return
+	}
+	if name != "URL" {
+		value = icsEscape(value)
+	}
+	b.line(name + ":" + value)
+}
+
+// line writes a content line, folded at 75 octets as RFC 5545 requires. Continuation
+// lines start with a space, which counts towards their length.
+func (b *calendarFeedBuilder) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.sb.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	b.sb.WriteString(s + "\r\n")
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsSequence derives an event's revision from how long after creation it last changed, so
+// it only ever grows without storing a counter.
+func icsSequence(created, changed time.Time) int64 {
+	if seq := int64(changed.Sub(created) / time.Second); seq > 0 {
+		return seq
+	}
+	return 0
+}
+
+func nameInitial(name string) string {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(name))
+	if r == utf8.RuneError {
+		return ""
+	}
+	return strings.ToUpper(string(r)) + "."
+}
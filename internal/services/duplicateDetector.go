@@ -0,0 +1,517 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// Weights for each signal. The total is capped at 100.
+const (
+	duplicateWeightName   = 35.0
+	duplicateWeightDOB    = 25.0
+	duplicateWeightPhone  = 15.0
+	duplicateWeightEmail  = 15.0
+	duplicateWeightPostal = 5.0
+	duplicateWeightSerial = 40.0
+
+	// Blocking buckets larger than this (e.g. a shared clinic phone number) are skipped
+	// during full scans to keep the pair count bounded.
+	duplicateMaxBucketSize = 200
+)
+
+// ErrDuplicateScanRunning is returned when a scan is requested while another is in progress.
+var ErrDuplicateScanRunning = errors.New("duplicate scan already running")
+
+var duplicateScanMu sync.Mutex
+
+// DuplicateMatch describes an existing patient that may be the same person as the subject.
+type DuplicateMatch struct {
+	PatientID uint     `json:"patientId"`
+	MRN       int      `json:"mrn"`
+	FirstName string   `json:"fname"`
+	LastName  string   `json:"lname"`
+	DOB       string   `json:"dob"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+// DuplicateScanResult summarizes a full scan of the patients table.
+type DuplicateScanResult struct {
+	PatientsScanned int           `json:"patientsScanned"`
+	PairsCompared   int           `json:"pairsCompared"`
+	CandidatesFound int           `json:"candidatesFound"`
+	Duration        time.Duration `json:"duration"`
+}
+
+type patientFingerprint struct {
+	first   string
+	last    string
+	dob     string
+	phone   string
+	email   string
+	postal  string
+	serials []string
+}
+
+// FuzzyMatchScore rates how closely target matches query on a 0-100 scale:
+// exact 100, prefix 80, word prefix 70, substring 60, word substring 50,
+// otherwise a character overlap score of up to 40.
+func FuzzyMatchScore(query, target string) float64 {
+	query = strings.ToLower(query)
+	target = strings.ToLower(target)
+
+	// Exact match scores highest
+	if query == target {
+		return 100.0
+	}
+
+	// Starts with query scores high
+	if strings.HasPrefix(target, query) {
+		return 80.0
+	}
+
+	// Contains query scores medium
+	if strings.Contains(target, query) {
+		return 60.0
+	}
+
+	// Word boundary match
+	words := strings.Fields(target)
+	for _, word := range words {
+		if strings.HasPrefix(word, query) {
+			return 70.0
+		}
+		if strings.Contains(word, query) {
+			return 50.0
+		}
+	}
+
+	// Fuzzy match (simple character overlap)
+	if len(query) == 0 {
+		return 0
+	}
+	overlap := 0
+	for _, char := range query {
+		if strings.ContainsRune(target, char) {
+			overlap++
+		}
+	}
+	fuzzyScore := (float64(overlap) / float64(len(query))) * 40.0
+
+	return fuzzyScore
+}
+
+// ScorePatients compares two patients and returns a 0-100 likelihood that they are the
+// same person, along with the signals that contributed to the score.
+func ScorePatients(a, b models.Patient, aSerials, bSerials []string) (float64, []string) {
+	return scoreFingerprints(newPatientFingerprint(a, aSerials), newPatientFingerprint(b, bSerials))
+}
+
+// FindPossibleDuplicates returns existing patients scoring at or above threshold against p.
+// Candidates are narrowed in SQL before fuzzy scoring to patients sharing an email, phone or
+// device serial with p, or two of first name, last name, date of birth and postal code.
+func FindPossibleDuplicates(p models.Patient, serials []string, threshold float64) ([]DuplicateMatch, error) {
+	subject := newPatientFingerprint(p, serials)
+
+	query := config.DB.Model(&models.Patient{}).
+		Select("id, mrn, first_name, last_name, dob, email, phone, postal")
+	if p.ID != 0 {
+		query = query.Where("id <> ?", p.ID)
+	}
+
+	// Names, date of birth and postal code are shared by many patients, so a candidate must
+	// match on two of them. Email, phone and device serial are specific enough alone.
+	type field struct {
+		clause string
+		arg    interface{}
+	}
+	var weak []field
+	first := strings.ToLower(strings.TrimSpace(p.FirstName))
+	last := strings.ToLower(strings.TrimSpace(p.LastName))
+	if last != "" {
+		weak = append(weak, field{"LOWER(last_name) = ?", last})
+	}
+	if first != "" {
+		weak = append(weak, field{"LOWER(first_name) = ?", first})
+	}
+	if subject.dob != "" {
+		weak = append(weak, field{"dob LIKE ?", subject.dob + "%"})
+	}
+	if subject.postal != "" {
+		weak = append(weak, field{"UPPER(REPLACE(postal, ' ', '')) = ?", subject.postal})
+	}
+
+	var clauses []string
+	var args []interface{}
+	for i := range weak {
+		for j := i + 1; j < len(weak); j++ {
+			clauses = append(clauses, "("+weak[i].clause+" AND "+weak[j].clause+")")
+			args = append(args, weak[i].arg, weak[j].arg)
+		}
+	}
+	if first != "" && last != "" {
+		// Catches first and last names entered the wrong way round
+		clauses = append(clauses, "(LOWER(first_name) = ? AND LOWER(last_name) = ?)")
+		args = append(args, last, first)
+	}
+	if subject.email != "" {
+		clauses = append(clauses, "LOWER(email) = ?")
+		args = append(args, subject.email)
+	}
+	if subject.phone != "" {
+		// normalizePhone keeps the last nine digits, so match stored numbers ending in them
+		clauses = append(clauses, strippedPhoneColumn+" LIKE ?")
+		args = append(args, "%"+subject.phone)
+	}
+	if len(subject.serials) > 0 {
+		clauses = append(clauses, "id IN (?)")
+		args = append(args, config.DB.Model(&models.ImplantedDevice{}).Select("patient_id").Where("UPPER(serial) IN ?", subject.serials))
+	}
+	if len(clauses) == 0 {
+		return nil, nil
+	}
+
+	var patients []models.Patient
+	err := query.Where(strings.Join(clauses, " OR "), args...).
+		Order("id DESC").Limit(duplicateCandidateLimit).Find(&patients).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(patients) == 0 {
+		return nil, nil
+	}
+
+	serialsByPatient, err := loadDeviceSerials(patientIDs(patients))
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []DuplicateMatch
+	for _, existing := range patients {
+		score, reasons := scoreFingerprints(subject, newPatientFingerprint(existing, serialsByPatient[existing.ID]))
+		if score < threshold {
+			continue
+		}
+		matches = append(matches, DuplicateMatch{
+			PatientID: existing.ID,
+			MRN:       existing.MRN,
+			FirstName: existing.FirstName,
+			LastName:  existing.LastName,
+			DOB:       existing.DOB,
+			Score:     score,
+			Reasons:   reasons,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches, nil
+}
+
+// DuplicatePatientDetector periodically scans all patients and records likely duplicate
+// pairs in the review queue.
+type DuplicatePatientDetector struct {
+	interval  time.Duration
+	threshold float64
+}
+
+// NewDuplicatePatientDetector configures the detector using environment overrides when available.
+func NewDuplicatePatientDetector() *DuplicatePatientDetector {
+	return &DuplicatePatientDetector{
+		interval:  getEnvDuration("DUPLICATE_SCAN_INTERVAL", 6*time.Hour),
+		threshold: float64(getEnvInt("DUPLICATE_MATCH_THRESHOLD", 60)),
+	}
+}
+
+// Threshold returns the minimum score treated as a likely duplicate.
+func (d *DuplicatePatientDetector) Threshold() float64 {
+	return d.threshold
+}
+
+// Start begins the background scan loop.
+func (d *DuplicatePatientDetector) Start() {
+	go d.run()
+}
+
+func (d *DuplicatePatientDetector) run() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := d.Scan()
+		if err != nil {
+			if !errors.Is(err, ErrDuplicateScanRunning) {
+				log.Printf("[DuplicatePatientDetector] Scan failed: %v", err)
+			}
+			continue
+		}
+		if result.CandidatesFound > 0 {
+			log.Printf("[DuplicatePatientDetector] Found %d candidate pair(s) across %d patient(s)", result.CandidatesFound, result.PatientsScanned)
+		}
+	}
+}
+
+// Scan compares patients that share a blocking key (DOB, last name, phone, email or
+// device serial) and upserts every pair scoring at or above the threshold.
+func (d *DuplicatePatientDetector) Scan() (*DuplicateScanResult, error) {
+	if !duplicateScanMu.TryLock() {
+		return nil, ErrDuplicateScanRunning
+	}
+	defer duplicateScanMu.Unlock()
+
+	started := time.Now()
+
+	var patients []models.Patient
+	if err := config.DB.Model(&models.Patient{}).
+		Select("id, mrn, first_name, last_name, dob, email, phone, postal").
+		Find(&patients).Error; err != nil {
+		return nil, fmt.Errorf("load patients: %w", err)
+	}
+
+	serialsByPatient, err := loadDeviceSerials(nil)
+	if err != nil {
+		return nil, fmt.Errorf("load device serials: %w", err)
+	}
+
+	fingerprints := make(map[uint]patientFingerprint, len(patients))
+	buckets := make(map[string][]uint)
+	for _, p := range patients {
+		fp := newPatientFingerprint(p, serialsByPatient[p.ID])
+		fingerprints[p.ID] = fp
+		for _, key := range blockingKeys(fp) {
+			buckets[key] = append(buckets[key], p.ID)
+		}
+	}
+
+	seen := make(map[[2]uint]struct{})
+	result := &DuplicateScanResult{PatientsScanned: len(patients)}
+	for _, ids := range buckets {
+		if len(ids) < 2 || len(ids) > duplicateMaxBucketSize {
+			continue
+		}
+		for i := 0; i < len(ids); i++ {
+			for j := i + 1; j < len(ids); j++ {
+				aID, bID := models.OrderedPatientPair(ids[i], ids[j])
+				if aID == bID {
+					continue
+				}
+				pair := [2]uint{aID, bID}
+				if _, ok := seen[pair]; ok {
+					continue
+				}
+				seen[pair] = struct{}{}
+				result.PairsCompared++
+
+				score, reasons := scoreFingerprints(fingerprints[aID], fingerprints[bID])
+				if score < d.threshold {
+					continue
+				}
+				if err := models.UpsertDuplicateCandidate(aID, bID, score, reasons); err != nil {
+					log.Printf("[DuplicatePatientDetector] Failed to record pair %d/%d: %v", aID, bID, err)
+					continue
+				}
+				result.CandidatesFound++
+			}
+		}
+	}
+
+	result.Duration = time.Since(started)
+	return result, nil
+}
+
+func newPatientFingerprint(p models.Patient, serials []string) patientFingerprint {
+	fp := patientFingerprint{
+		first:  normalizeName(p.FirstName),
+		last:   normalizeName(p.LastName),
+		dob:    normalizeDOB(p.DOB),
+		phone:  normalizePhone(p.Phone),
+		email:  strings.ToLower(strings.TrimSpace(p.Email)),
+		postal: strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(p.Postal), " ", "")),
+	}
+	for _, s := range serials {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+			fp.serials = append(fp.serials, s)
+		}
+	}
+	return fp
+}
+
+func scoreFingerprints(a, b patientFingerprint) (float64, []string) {
+	var score float64
+	var reasons []string
+
+	nameSim := math.Max(
+		(nameSimilarity(a.first, b.first)+nameSimilarity(a.last, b.last))/2,
+		(nameSimilarity(a.first, b.last)+nameSimilarity(a.last, b.first))/2,
+	)
+	if nameSim > 0 {
+		score += duplicateWeightName * nameSim
+		switch {
+		case nameSim >= 0.999:
+			reasons = append(reasons, "same name")
+		case nameSim >= 0.7:
+			reasons = append(reasons, "similar name")
+		}
+	}
+
+	if a.dob != "" && a.dob == b.dob {
+		score += duplicateWeightDOB
+		reasons = append(reasons, "same date of birth")
+	}
+	if a.phone != "" && a.phone == b.phone {
+		score += duplicateWeightPhone
+		reasons = append(reasons, "same phone")
+	}
+	if a.email != "" && a.email == b.email {
+		score += duplicateWeightEmail
+		reasons = append(reasons, "same email")
+	}
+	if a.postal != "" && a.postal == b.postal {
+		score += duplicateWeightPostal
+		reasons = append(reasons, "same postal code")
+	}
+
+	for _, s := range a.serials {
+		if containsString(b.serials, s) {
+			score += duplicateWeightSerial
+			reasons = append(reasons, "shared device serial "+s)
+			break
+		}
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	return math.Round(score*10) / 10, reasons
+}
+
+// nameSimilarity returns a 0-1 similarity built on FuzzyMatchScore, checked in both
+// directions so that "jon" vs "jonathan" and "jonathan" vs "jon" score alike.
+func nameSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	best := math.Max(FuzzyMatchScore(a, b), FuzzyMatchScore(b, a))
+	// Character overlap alone is weak evidence for names; discount it.
+	if best <= 40 {
+		best /= 2
+	}
+	return best / 100
+}
+
+func blockingKeys(fp patientFingerprint) []string {
+	var keys []string
+	if fp.dob != "" {
+		keys = append(keys, "dob:"+fp.dob)
+	}
+	if fp.last != "" {
+		keys = append(keys, "name:"+fp.last)
+	}
+	if fp.first != "" {
+		// Catches first/last name swaps.
+		keys = append(keys, "name:"+fp.first)
+	}
+	if fp.phone != "" {
+		keys = append(keys, "phone:"+fp.phone)
+	}
+	if fp.email != "" {
+		keys = append(keys, "email:"+fp.email)
+	}
+	for _, s := range fp.serials {
+		keys = append(keys, "serial:"+s)
+	}
+	return keys
+}
+
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func normalizeDOB(dob string) string {
+	dob = strings.TrimSpace(dob)
+	if len(dob) >= 10 {
+		return dob[:10]
+	}
+	return dob
+}
+
+// duplicateCandidateLimit caps how many candidates are scored for one patient, newest first.
+const duplicateCandidateLimit = 200
+
+// strippedPhoneColumn is the phone column without the separators people type into numbers.
+const strippedPhoneColumn = `REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(phone, ' ', ''), '-', ''), '(', ''), ')', ''), '.', '')`
+
+// normalizePhone keeps the last nine digits so that local and international formats
+// of the same number compare equal.
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if len(digits) < 6 {
+		return ""
+	}
+	if len(digits) > 9 {
+		digits = digits[len(digits)-9:]
+	}
+	return digits
+}
+
+func loadDeviceSerials(patientIDs []uint) (map[uint][]string, error) {
+	var rows []struct {
+		PatientID uint
+		Serial    string
+	}
+	query := config.DB.Model(&models.ImplantedDevice{}).Select("patient_id, serial").Where("serial <> ''")
+	if patientIDs != nil {
+		query = query.Where("patient_id IN ?", patientIDs)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint][]string)
+	for _, row := range rows {
+		result[row.PatientID] = append(result[row.PatientID], row.Serial)
+	}
+	return result, nil
+}
+
+func patientIDs(patients []models.Patient) []uint {
+	ids := make([]uint, 0, len(patients))
+	for _, p := range patients {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func seedDuplicatePatients(t *testing.T) map[string]models.Patient {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.Device{}, &models.ImplantedDevice{}); err != nil {
+		t.Fatalf("failed to migrate device models: %v", err)
+	}
+
+	patients := map[string]models.Patient{
+		"thompson":  {MRN: 2001, FirstName: "Margaret", LastName: "Thompson", DOB: "1948-07-19", Postal: "2145"},
+		"smith":     {MRN: 2002, FirstName: "Jonathan", LastName: "Smith", DOB: "1950-03-02", Phone: "(02) 9555-1234", Postal: "2000"},
+		"unrelated": {MRN: 2003, FirstName: "Alice", LastName: "Nguyen", DOB: "1975-11-30", Phone: "0400 111 222", Postal: "3000"},
+	}
+	for key, p := range patients {
+		if err := config.DB.Create(&p).Error; err != nil {
+			t.Fatalf("failed to seed patient: %v", err)
+		}
+		patients[key] = p
+	}
+	return patients
+}
+
+func TestFindPossibleDuplicates_FindsNearDuplicates(t *testing.T) {
+	existing := seedDuplicatePatients(t)
+
+	cases := []struct {
+		name    string
+		subject models.Patient
+		want    string
+		reason  string
+	}{
+		{
+			// Registered again without a date of birth and with the surname misspelt
+			name:    "same first name",
+			subject: models.Patient{FirstName: "Margaret", LastName: "Thomson", Postal: "2145"},
+			want:    "thompson",
+			reason:  "same postal code",
+		},
+		{
+			// Date of birth typo and a different phone format; only the phone is exact
+			name:    "same phone",
+			subject: models.Patient{FirstName: "Jon", LastName: "Smyth", DOB: "1950-03-20", Phone: "+61 2 9555 1234", Postal: "2000"},
+			want:    "smith",
+			reason:  "same phone",
+		},
+		{
+			name:    "swapped names",
+			subject: models.Patient{FirstName: "Thompson", LastName: "Margaret", DOB: "1948-07-19"},
+			want:    "thompson",
+			reason:  "same name",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := FindPossibleDuplicates(tc.subject, nil, 20)
+			if err != nil {
+				t.Fatalf("FindPossibleDuplicates failed: %v", err)
+			}
+			var found *DuplicateMatch
+			for i := range matches {
+				if matches[i].PatientID == existing["unrelated"].ID {
+					t.Fatalf("unrelated patient matched with score %.1f", matches[i].Score)
+				}
+				if matches[i].PatientID == existing[tc.want].ID {
+					found = &matches[i]
+				}
+			}
+			if found == nil {
+				t.Fatalf("expected %s to be found, got %+v", tc.want, matches)
+			}
+			if !containsString(found.Reasons, tc.reason) {
+				t.Fatalf("expected reason %q, got %v", tc.reason, found.Reasons)
+			}
+		})
+	}
+}
+
+func TestFindPossibleDuplicates_OneSharedNameIsNotACandidate(t *testing.T) {
+	existing := seedDuplicatePatients(t)
+
+	// Shares only a first name with one patient and only a postal code with another
+	subject := models.Patient{FirstName: "Margaret", LastName: "Jones", DOB: "1990-01-01", Postal: "3000"}
+	matches, err := FindPossibleDuplicates(subject, nil, 0)
+	if err != nil {
+		t.Fatalf("FindPossibleDuplicates failed: %v", err)
+	}
+	for _, m := range matches {
+		if m.PatientID == existing["thompson"].ID || m.PatientID == existing["unrelated"].ID {
+			t.Fatalf("expected no candidates from a single shared field, got %+v", matches)
+		}
+	}
+}
+
+func TestScorePatients_SharedSerialIsStrongEvidence(t *testing.T) {
+	a := models.Patient{FirstName: "Robert", LastName: "Brown", DOB: "1960-01-01"}
+	b := models.Patient{FirstName: "Bob", LastName: "Brown", DOB: "1960-01-01"}
+
+	withoutSerial, _ := ScorePatients(a, b, nil, nil)
+	withSerial, reasons := ScorePatients(a, b, []string{"pjn123456"}, []string{"PJN123456 "})
+	if withSerial-withoutSerial != duplicateWeightSerial {
+		t.Fatalf("expected the shared serial to add %.0f, got %.1f -> %.1f", duplicateWeightSerial, withoutSerial, withSerial)
+	}
+	if !containsString(reasons, "shared device serial PJN123456") {
+		t.Fatalf("expected shared serial reason, got %v", reasons)
+	}
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// consentExpiringWindow is how far ahead consent.expiring warns about an expiry date.
+const consentExpiringWindow = 30 * 24 * time.Hour
+
+// EventSweeper emits the time-based webhook events (task.due, task.overdue, task.completed,
+// consent.expiring, consent.expired, device.implanted and device.explanted). Each transition
+// is claimed with an EventMarker before it is sent, so it is emitted once.
+type EventSweeper struct {
+	interval  time.Duration
+	lookback  time.Duration
+	retention time.Duration
+	trigger   WebhookTrigger
+}
+
+// NewEventSweeper configures the sweeper from the environment. trigger may be nil.
+// EVENT_SWEEP_LOOKBACK_HOURS bounds how old a transition may be and still be emitted, which
+// covers downtime without replaying history on first start. EVENT_MARKER_RETENTION_DAYS is
+// how long markers are kept; it is never shorter than the windows they guard.
+func NewEventSweeper(trigger WebhookTrigger) *EventSweeper {
+	lookback := time.Duration(getEnvInt("EVENT_SWEEP_LOOKBACK_HOURS", 72)) * time.Hour
+	retention := time.Duration(getEnvInt("EVENT_MARKER_RETENTION_DAYS", 90)) * 24 * time.Hour
+	if minimum := lookback + consentExpiringWindow + 24*time.Hour; retention < minimum {
+		retention = minimum
+	}
+	return &EventSweeper{
+		interval:  getEnvDuration("EVENT_SWEEP_INTERVAL", 5*time.Minute),
+		lookback:  lookback,
+		retention: retention,
+		trigger:   trigger,
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (s *EventSweeper) Start() {
+	s.runCycle()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runCycle()
+	}
+}
+
+// sweptEvent is a detected transition and who to tell about it.
+type sweptEvent struct {
+	event     models.WebhookEvent
+	subjectID uint
+	key       string
+	data      map[string]interface{}
+	notice    NotificationEvent
+	userIDs   []uint
+	admins    bool
+}
+
+func (s *EventSweeper) runCycle() {
+	now := time.Now()
+	sources := []struct {
+		name  string
+		sweep func(time.Time) ([]sweptEvent, error)
+	}{
+		{"task due", s.sweepTasksDue},
+		{"task overdue", s.sweepTasksOverdue},
+		{"task completed", s.sweepTasksCompleted},
+		{"consent expiring", s.sweepConsentsExpiring},
+		{"consent expired", s.sweepConsentsExpired},
+		{"device implanted", s.sweepDevicesImplanted},
+		{"device explanted", s.sweepDevicesExplanted},
+	}
+
+	emitted := 0
+	for _, source := range sources {
+		events, err := source.sweep(now)
+		if err != nil {
+			log.Printf("[EventSweeper] Failed to sweep %s events: %v", source.name, err)
+			continue
+		}
+		for _, event := range events {
+			claimed, err := models.ClaimEventMarker(event.event, event.subjectID, event.key)
+			if err != nil {
+				log.Printf("[EventSweeper] Failed to record %s for %d: %v", event.event, event.subjectID, err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			s.dispatch(event)
+			emitted++
+		}
+	}
+	if emitted > 0 {
+		log.Printf("[EventSweeper] Emitted %d event(s)", emitted)
+	}
+
+	if pruned, err := models.PruneEventMarkers(now.Add(-s.retention)); err != nil {
+		log.Printf("[EventSweeper] Failed to prune event markers: %v", err)
+	} else if pruned > 0 {
+		log.Printf("[EventSweeper] Pruned %d event marker(s)", pruned)
+	}
+}
+
+func (s *EventSweeper) dispatch(event sweptEvent) {
+	event.notice.Type = string(event.event)
+	for _, userID := range event.userIDs {
+		NotificationsHub.SendToUser(userID, event.notice)
+	}
+	if event.admins {
+		NotificationsHub.BroadcastToAdmins(event.notice)
+	}
+	if s.trigger != nil {
+		s.trigger(event.event, event.data)
+	}
+}
+
+var openTaskStatuses = []models.TaskStatus{models.TaskStatusPending, models.TaskStatusInProgress}
+
+// startOfDay returns local midnight, matching how the UI decides a task is due today.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func taskEventData(task *models.Task) map[string]interface{} {
+	return map[string]interface{}{
+		"taskId":      task.ID,
+		"title":       task.Title,
+		"description": task.Description,
+		"priority":    task.Priority,
+		"status":      task.Status,
+		"dueDate":     task.DueDate,
+		"patientId":   task.PatientID,
+		"assignedTo":  task.AssignedToID,
+	}
+}
+
+// sweepTasksDue finds open tasks due today.
+func (s *EventSweeper) sweepTasksDue(now time.Time) ([]sweptEvent, error) {
+	today := startOfDay(now)
+	var tasks []models.Task
+	if err := config.DB.Where("status IN ? AND due_date >= ? AND due_date < ?", openTaskStatuses, today, today.AddDate(0, 0, 1)).
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		taskID := task.ID
+		events = append(events, sweptEvent{
+			event:     models.EventTaskDue,
+			subjectID: task.ID,
+			key:       task.DueDate.In(now.Location()).Format("2006-01-02"),
+			data:      taskEventData(task),
+			notice: NotificationEvent{
+				Title:   "Task due today",
+				Message: fmt.Sprintf("'%s' is due today", task.Title),
+				TaskID:  &taskID,
+			},
+			userIDs: taskAssignees(task),
+		})
+	}
+	return events, nil
+}
+
+// sweepTasksOverdue finds open tasks whose due day ended within the lookback.
+func (s *EventSweeper) sweepTasksOverdue(now time.Time) ([]sweptEvent, error) {
+	today := startOfDay(now)
+	var tasks []models.Task
+	if err := config.DB.Where("status IN ? AND due_date < ? AND due_date >= ?", openTaskStatuses, today, today.Add(-s.lookback)).
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		taskID := task.ID
+		events = append(events, sweptEvent{
+			event:     models.EventTaskOverdue,
+			subjectID: task.ID,
+			key:       task.DueDate.In(now.Location()).Format("2006-01-02"),
+			data:      taskEventData(task),
+			notice: NotificationEvent{
+				Title:    "Task overdue",
+				Message:  fmt.Sprintf("'%s' was due %s", task.Title, task.DueDate.In(now.Location()).Format("2006-01-02")),
+				Severity: "warning",
+				TaskID:   &taskID,
+			},
+			userIDs: taskAssignees(task),
+		})
+	}
+	return events, nil
+}
+
+// sweepTasksCompleted finds tasks completed within the lookback and tells their creators.
+func (s *EventSweeper) sweepTasksCompleted(now time.Time) ([]sweptEvent, error) {
+	var tasks []models.Task
+	if err := config.DB.Where("status = ? AND completed_at >= ?", models.TaskStatusCompleted, now.Add(-s.lookback)).
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		taskID := task.ID
+		data := taskEventData(task)
+		data["completedAt"] = task.CompletedAt
+		event := sweptEvent{
+			event:     models.EventTaskCompleted,
+			subjectID: task.ID,
+			key:       task.CompletedAt.UTC().Format(time.RFC3339),
+			data:      data,
+			notice: NotificationEvent{
+				Title:   "Task completed",
+				Message: fmt.Sprintf("'%s' was completed", task.Title),
+				TaskID:  &taskID,
+			},
+		}
+		// Creators working their own tasks need no notice.
+		if task.AssignedToID == nil || *task.AssignedToID != task.CreatedByID {
+			event.userIDs = []uint{task.CreatedByID}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func consentEventData(consent *models.PatientConsent) map[string]interface{} {
+	return map[string]interface{}{
+		"consentId":   consent.ID,
+		"patientId":   consent.PatientID,
+		"consentType": consent.ConsentType,
+		"status":      consent.Status,
+		"expiryDate":  consent.ExpiryDate,
+	}
+}
+
+// sweepConsentsExpiring finds granted consents that expire within the next 30 days.
+func (s *EventSweeper) sweepConsentsExpiring(now time.Time) ([]sweptEvent, error) {
+	var consents []models.PatientConsent
+	if err := config.DB.Where("status = ? AND expiry_date > ? AND expiry_date <= ?", models.ConsentGranted, now, now.Add(consentExpiringWindow)).
+		Find(&consents).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(consents))
+	for i := range consents {
+		consent := &consents[i]
+		days := int(consent.ExpiryDate.Sub(now).Hours() / 24)
+		data := consentEventData(consent)
+		data["daysRemaining"] = days
+		events = append(events, sweptEvent{
+			event:     models.EventConsentExpiring,
+			subjectID: consent.ID,
+			key:       consent.ExpiryDate.UTC().Format("2006-01-02"),
+			data:      data,
+			notice: NotificationEvent{
+				Title:     "Consent expiring",
+				Message:   fmt.Sprintf("%s consent for patient %d expires in %d day(s)", consent.ConsentType, consent.PatientID, days),
+				Severity:  "warning",
+				ActionURL: fmt.Sprintf("/patients/%d", consent.PatientID),
+			},
+			admins: true,
+		})
+	}
+	return events, nil
+}
+
+// sweepConsentsExpired finds consents that expired within the lookback and were not revoked.
+func (s *EventSweeper) sweepConsentsExpired(now time.Time) ([]sweptEvent, error) {
+	var consents []models.PatientConsent
+	if err := config.DB.Where("status IN ? AND expiry_date <= ? AND expiry_date >= ?",
+		[]models.ConsentStatus{models.ConsentGranted, models.ConsentExpired}, now, now.Add(-s.lookback)).
+		Find(&consents).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(consents))
+	for i := range consents {
+		consent := &consents[i]
+		events = append(events, sweptEvent{
+			event:     models.EventConsentExpired,
+			subjectID: consent.ID,
+			key:       consent.ExpiryDate.UTC().Format("2006-01-02"),
+			data:      consentEventData(consent),
+			notice: NotificationEvent{
+				Title:     "Consent expired",
+				Message:   fmt.Sprintf("%s consent for patient %d has expired", consent.ConsentType, consent.PatientID),
+				Severity:  "critical",
+				ActionURL: fmt.Sprintf("/patients/%d", consent.PatientID),
+			},
+			admins: true,
+		})
+	}
+	return events, nil
+}
+
+func deviceEventData(device *models.ImplantedDevice) map[string]interface{} {
+	return map[string]interface{}{
+		"implantedDeviceId": device.ID,
+		"patientId":         device.PatientID,
+		"deviceId":          device.DeviceID,
+		"serial":            device.Serial,
+		"manufacturer":      device.Device.Manufacturer,
+		"model":             device.Device.DevModel,
+		"deviceName":        device.Device.Name,
+		"status":            device.Status,
+		"implantedAt":       device.ImplantedAt,
+		"explantedAt":       device.ExplantedAt,
+	}
+}
+
+// Saving a patient recreates its implanted device rows, so device events are keyed on the
+// patient, serial and date rather than the row, and only recent clinical dates qualify so a
+// pruned marker can never be replayed.
+
+// sweepDevicesImplanted finds devices recorded within the lookback.
+func (s *EventSweeper) sweepDevicesImplanted(now time.Time) ([]sweptEvent, error) {
+	var devices []models.ImplantedDevice
+	if err := config.DB.Preload("Device").
+		Where("created_at >= ? AND implanted_at >= ? AND implanted_at <= ?", now.Add(-s.lookback), now.Add(-s.retention), now).
+		Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(devices))
+	for i := range devices {
+		device := &devices[i]
+		events = append(events, sweptEvent{
+			event:     models.EventDeviceImplanted,
+			subjectID: device.PatientID,
+			key:       device.Serial + "|" + device.ImplantedAt.UTC().Format("2006-01-02"),
+			data:      deviceEventData(device),
+			notice: NotificationEvent{
+				Title:     "Device implanted",
+				Message:   fmt.Sprintf("%s (%s) implanted for patient %d", device.Device.Name, device.Serial, device.PatientID),
+				ActionURL: fmt.Sprintf("/patients/%d", device.PatientID),
+			},
+			admins: true,
+		})
+	}
+	return events, nil
+}
+
+// sweepDevicesExplanted finds devices given an explant date within the lookback.
+func (s *EventSweeper) sweepDevicesExplanted(now time.Time) ([]sweptEvent, error) {
+	var devices []models.ImplantedDevice
+	if err := config.DB.Preload("Device").
+		Where("updated_at >= ? AND explanted_at IS NOT NULL AND explanted_at >= ? AND explanted_at <= ?", now.Add(-s.lookback), now.Add(-s.retention), now).
+		Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]sweptEvent, 0, len(devices))
+	for i := range devices {
+		device := &devices[i]
+		events = append(events, sweptEvent{
+			event:     models.EventDeviceExplanted,
+			subjectID: device.PatientID,
+			key:       device.Serial + "|" + device.ExplantedAt.UTC().Format("2006-01-02"),
+			data:      deviceEventData(device),
+			notice: NotificationEvent{
+				Title:     "Device explanted",
+				Message:   fmt.Sprintf("%s (%s) explanted for patient %d", device.Device.Name, device.Serial, device.PatientID),
+				ActionURL: fmt.Sprintf("/patients/%d", device.PatientID),
+			},
+			admins: true,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// ErrNoFollowUpSlot is returned when no clinic slot is free in the search window after a
+// follow-up's due date.
+var ErrNoFollowUpSlot = errors.New("no clinic slot available for the follow-up")
+
+// remoteFollowUpHour is when unslotted follow-ups start on their due date, clinic time.
+const remoteFollowUpHour = 9
+
+// PlanReportFollowUp applies the matching follow-up rule to a completed report. The next
+// visit is due the rule's interval after the report date; auto rules book it straight away
+// and propose rules leave it for a clinician to confirm. If an auto booking finds no free
+// slot the follow-up stays proposed with a note. A report that already has a follow-up
+// keeps it, and nil is returned when no rule applies.
+func PlanReportFollowUp(report *models.Report, userID uint, now time.Time) (*models.ReportFollowUp, error) {
+	existing, err := models.GetReportFollowUp(report.ID)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	deviceType := ""
+	device, err := models.GetReportImplantedDevice(report)
+	if err != nil {
+		return nil, err
+	}
+	if device != nil {
+		var d models.Device
+		if err := config.DB.Select("type").Limit(1).Find(&d, device.DeviceID).Error; err != nil {
+			return nil, err
+		}
+		deviceType = d.Type
+	}
+
+	rule, err := models.MatchFollowUpRule(deviceType, report.ReportType)
+	if err != nil || rule == nil {
+		return nil, err
+	}
+
+	due := report.ReportDate.AddDate(0, 0, rule.IntervalDays)
+	if due.Before(now) {
+		due = now
+	}
+	followUp := &models.ReportFollowUp{
+		ReportID:  report.ID,
+		PatientID: report.PatientID,
+		RuleID:    &rule.ID,
+		Rule:      rule,
+		Location:  rule.Location,
+		DueAt:     due,
+		Status:    models.FollowUpProposed,
+	}
+	if err := config.DB.Omit("Rule", "Appointment").Create(followUp).Error; err != nil {
+		return nil, err
+	}
+
+	if rule.Mode == models.FollowUpModeAuto {
+		_, err := BookReportFollowUp(followUp, nil, userID, now)
+		if errors.Is(err, ErrNoFollowUpSlot) {
+			followUp.Note = fmt.Sprintf("No clinic slot free within %d days of the due date", followUpSearchDays())
+			return followUp, config.DB.Model(followUp).Update("note", followUp.Note).Error
+		}
+		if err != nil {
+			return followUp, err
+		}
+	}
+	return followUp, nil
+}
+
+// BookReportFollowUp books the appointment for a proposed follow-up and links it. With
+// startAt the appointment is booked at that time; otherwise clinic follow-ups take the first
+// free slot from the due date and others start on the due date. Booking errors from the
+// slot schedule are returned as they are.
+func BookReportFollowUp(followUp *models.ReportFollowUp, startAt *time.Time, userID uint, now time.Time) (*models.Appointment, error) {
+	// Claim the follow-up first so two clinicians cannot both book it
+	claim := config.DB.Model(&models.ReportFollowUp{}).
+		Where("id = ? AND status = ?", followUp.ID, models.FollowUpProposed).
+		Update("status", models.FollowUpScheduled)
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return nil, models.ErrFollowUpResolved
+	}
+
+	appointment, err := bookFollowUpAppointment(followUp, startAt, userID, now)
+	if err != nil {
+		if revert := config.DB.Model(&models.ReportFollowUp{}).Where("id = ?", followUp.ID).
+			Update("status", models.FollowUpProposed).Error; revert != nil {
+			return nil, revert
+		}
+		return nil, err
+	}
+
+	resolvedAt := now
+	err = config.DB.Model(followUp).Updates(map[string]interface{}{
+		"appointment_id": appointment.ID,
+		"resolved_by_id": userID,
+		"resolved_at":    resolvedAt,
+		"note":           "",
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	followUp.Status = models.FollowUpScheduled
+	followUp.AppointmentID = &appointment.ID
+	followUp.Appointment = appointment
+	followUp.ResolvedByID = &userID
+	followUp.ResolvedAt = &resolvedAt
+	followUp.Note = ""
+	return appointment, nil
+}
+
+// DismissReportFollowUp closes a proposed follow-up without booking, e.g. when the patient
+// is followed up elsewhere.
+func DismissReportFollowUp(followUp *models.ReportFollowUp, userID uint, note string, now time.Time) error {
+	result := config.DB.Model(&models.ReportFollowUp{}).
+		Where("id = ? AND status = ?", followUp.ID, models.FollowUpProposed).
+		Updates(map[string]interface{}{
+			"status":         models.FollowUpDismissed,
+			"note":           note,
+			"resolved_by_id": userID,
+			"resolved_at":    now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrFollowUpResolved
+	}
+	followUp.Status = models.FollowUpDismissed
+	followUp.Note = note
+	followUp.ResolvedByID = &userID
+	followUp.ResolvedAt = &now
+	return nil
+}
+
+func bookFollowUpAppointment(followUp *models.ReportFollowUp, startAt *time.Time, userID uint, now time.Time) (*models.Appointment, error) {
+	appointment := &models.Appointment{
+		Title:       "Device follow-up",
+		Description: fmt.Sprintf("Follow-up from report #%d", followUp.ReportID),
+		Location:    followUp.Location,
+		Status:      models.AppointmentStatusScheduled,
+		PatientID:   followUp.PatientID,
+		CreatedByID: userID,
+	}
+	if followUp.Rule != nil {
+		appointment.Title = "Follow-up: " + followUp.Rule.Name
+	}
+
+	if startAt != nil {
+		appointment.StartAt = *startAt
+		if _, err := models.SaveAppointmentBooking(appointment, true); err != nil {
+			return nil, err
+		}
+		return appointment, nil
+	}
+
+	if followUp.Location != models.AppointmentLocationClinic {
+		tz, err := models.ClinicTimeLocation()
+		if err != nil {
+			return nil, err
+		}
+		day := followUp.DueAt.In(tz)
+		appointment.StartAt = time.Date(day.Year(), day.Month(), day.Day(), remoteFollowUpHour, 0, 0, 0, tz)
+		if appointment.StartAt.Before(now) {
+			appointment.StartAt = now
+		}
+		if _, err := models.SaveAppointmentBooking(appointment, true); err != nil {
+			return nil, err
+		}
+		return appointment, nil
+	}
+
+	from := followUp.DueAt
+	if from.Before(now) {
+		from = now
+	}
+	slots, err := models.GetAvailableSlots(from, from.AddDate(0, 0, followUpSearchDays()), followUp.Location)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		if slot.Remaining <= 0 || slot.SlotTime.Before(from) {
+			continue
+		}
+		candidate := *appointment
+		candidate.StartAt = slot.SlotTime
+		_, err := models.SaveAppointmentBooking(&candidate, true)
+		if errors.Is(err, models.ErrSlotFull) || errors.Is(err, models.ErrResourceUnavailable) {
+			// Taken since availability was read, or the patient's programmer is busy
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &candidate, nil
+	}
+	return nil, ErrNoFollowUpSlot
+}
+
+// followUpSearchDays is how far past the due date to look for a free clinic slot.
+func followUpSearchDays() int {
+	if days := getEnvInt("FOLLOWUP_SLOT_SEARCH_DAYS", 28); days > 0 {
+		return days
+	}
+	return 28
+}
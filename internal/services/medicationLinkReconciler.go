@@ -0,0 +1,44 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// MedicationLinkReconciler periodically re-syncs the legacy patient medication list with the
+// regimens in effect, so regimens that start or stop on a future date are linked and
+// unlinked once that date arrives.
+type MedicationLinkReconciler struct {
+	interval time.Duration
+}
+
+// NewMedicationLinkReconciler configures the reconciler from MEDICATION_LINK_RECONCILE_INTERVAL (default 1h).
+func NewMedicationLinkReconciler() *MedicationLinkReconciler {
+	return &MedicationLinkReconciler{
+		interval: getEnvDuration("MEDICATION_LINK_RECONCILE_INTERVAL", time.Hour),
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (r *MedicationLinkReconciler) Start() {
+	r.runCycle()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.runCycle()
+	}
+}
+
+func (r *MedicationLinkReconciler) runCycle() {
+	fixed, err := models.ReconcileLegacyPatientMedications()
+	if err != nil {
+		log.Printf("[MedicationLinkReconciler] Error reconciling patient medications: %v", err)
+		return
+	}
+	if fixed > 0 {
+		log.Printf("[MedicationLinkReconciler] Corrected %d patient medication link(s)", fixed)
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func legacyMedicationLinked(t *testing.T, patientID, medicationID uint) bool {
+	t.Helper()
+	var count int64
+	if err := config.DB.Table("patient_medications").
+		Where("patient_id = ? AND medication_id = ?", patientID, medicationID).
+		Count(&count).Error; err != nil {
+		t.Fatalf("failed to count links: %v", err)
+	}
+	return count > 0
+}
+
+func TestReconcileLegacyPatientMedications_FollowsRegimenDates(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.Medication{}, &models.Patient{}, &models.PatientMedication{}); err != nil {
+		t.Fatalf("failed to migrate medication models: %v", err)
+	}
+
+	patient := models.Patient{MRN: 3001, FirstName: "Ruth", LastName: "Ellis", DOB: "1944-02-11"}
+	if err := config.DB.Create(&patient).Error; err != nil {
+		t.Fatalf("failed to seed patient: %v", err)
+	}
+	starting := models.Medication{Name: "Apixaban"}
+	stopping := models.Medication{Name: "Sotalol"}
+	for _, med := range []*models.Medication{&starting, &stopping} {
+		if err := config.DB.Create(med).Error; err != nil {
+			t.Fatalf("failed to seed medication: %v", err)
+		}
+	}
+
+	now := time.Now()
+	startsLater := now.Add(time.Hour)
+	stopsLater := now.Add(time.Hour)
+	future := models.PatientMedication{PatientID: patient.ID, MedicationID: starting.ID, StartDate: &startsLater}
+	current := models.PatientMedication{PatientID: patient.ID, MedicationID: stopping.ID, StopDate: &stopsLater}
+	for _, regimen := range []*models.PatientMedication{&future, &current} {
+		if err := models.CreatePatientMedication(regimen); err != nil {
+			t.Fatalf("failed to create regimen: %v", err)
+		}
+	}
+
+	if legacyMedicationLinked(t, patient.ID, starting.ID) {
+		t.Fatalf("a regimen that has not started yet should not be linked")
+	}
+	if !legacyMedicationLinked(t, patient.ID, stopping.ID) {
+		t.Fatalf("a regimen in effect should be linked")
+	}
+
+	// Move both dates into the past, as if an hour had gone by without either regimen being edited.
+	past := now.Add(-time.Minute)
+	config.DB.Model(&future).Update("start_date", past)
+	config.DB.Model(&current).Update("stop_date", past)
+
+	fixed, err := models.ReconcileLegacyPatientMedications()
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if fixed != 2 {
+		t.Fatalf("expected 2 links corrected, got %d", fixed)
+	}
+	if !legacyMedicationLinked(t, patient.ID, starting.ID) {
+		t.Fatalf("expected the started regimen to be linked")
+	}
+	if legacyMedicationLinked(t, patient.ID, stopping.ID) {
+		t.Fatalf("expected the stopped regimen to be unlinked")
+	}
+
+	if fixed, err := models.ReconcileLegacyPatientMedications(); err != nil || fixed != 0 {
+		t.Fatalf("expected nothing left to correct, got %d (%v)", fixed, err)
+	}
+}
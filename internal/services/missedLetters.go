@@ -0,0 +1,341 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrLetterTemplateNotFound is returned when the requested letter template does not exist.
+var ErrLetterTemplateNotFound = errors.New("letter template not found")
+
+// MissedLetterBatchError rejects a batch of letters, naming the appointments at fault so
+// they can be deselected and the batch generated again.
+type MissedLetterBatchError struct {
+	Reason         string
+	AppointmentIDs []uint
+	AlreadySent    bool // The letters were sent, possibly by a batch running at the same time
+}
+
+func (e *MissedLetterBatchError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.AppointmentIDs)
+}
+
+// MissedLetterBatch is a set of generated letters and the PDF to print them from.
+type MissedLetterBatch struct {
+	BatchID string
+	Letters []models.PatientLetter
+	PDF     []byte
+}
+
+// GenerateMissedLetters merges the template for each missed appointment, archives every
+// letter against its patient and marks the appointments' letters sent, all or nothing. The
+// PDF is rendered before anything is saved, so a batch is only recorded as sent once its
+// letters exist. Appointments that already had a letter are rejected unless resend is set.
+func GenerateMissedLetters(appointmentIDs []uint, templateID uint, resend bool, userID uint, now time.Time) (*MissedLetterBatch, error) {
+	template, err := models.GetLetterTemplate(templateID, models.LetterKindMissedAppointment)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, ErrLetterTemplateNotFound
+	}
+
+	var appointments []models.Appointment
+	err = config.DB.Preload("Patient").Where("id IN ?", appointmentIDs).
+		Order("start_at ASC, id ASC").Find(&appointments).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMissedLetterAppointments(appointmentIDs, appointments, resend, now); err != nil {
+		return nil, err
+	}
+
+	doctors, err := primaryDoctors(appointments)
+	if err != nil {
+		return nil, err
+	}
+	nextAvailable, err := nextAvailableSlot(now)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &MissedLetterBatch{BatchID: uuid.NewString()}
+	for i := range appointments {
+		a := &appointments[i]
+		values := appointmentMergeValues(a, doctors[a.PatientID], now)
+		values["rebooking.nextAvailable"] = nextAvailable
+		values["rebooking.instructions"] = models.MergeLetterFields(template.RebookingInstructions, values)
+
+		appointmentID := a.ID
+		batch.Letters = append(batch.Letters, models.PatientLetter{
+			PatientID:     a.PatientID,
+			AppointmentID: &appointmentID,
+			TemplateID:    &template.ID,
+			Kind:          models.LetterKindMissedAppointment,
+			BatchID:       batch.BatchID,
+			Recipient:     letterRecipient(a.Patient),
+			Subject:       models.MergeLetterFields(template.Subject, values),
+			Body:          models.MergeLetterFields(template.Body, values),
+			GeneratedByID: userID,
+		})
+		batch.Letters[i].CreatedAt = now
+	}
+
+	if batch.PDF, err = RenderLettersPDF(batch.Letters); err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var alreadySent []uint
+		for _, a := range appointments {
+			query := tx.Model(&models.Appointment{}).Where("id = ?", a.ID)
+			if !resend {
+				query = query.Where("missed_letter_sent_at IS NULL")
+			}
+			result := query.Update("missed_letter_sent_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				alreadySent = append(alreadySent, a.ID)
+			}
+		}
+		if len(alreadySent) > 0 {
+			// Another batch got there first
+			return &MissedLetterBatchError{Reason: "letters already sent", AppointmentIDs: alreadySent, AlreadySent: true}
+		}
+		return tx.Omit("Patient", "Appointment", "GeneratedBy").Create(&batch.Letters).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// checkMissedLetterAppointments rejects the batch if any appointment is unknown, was not
+// missed, already had its letter or has no postal address.
+func checkMissedLetterAppointments(ids []uint, appointments []models.Appointment, resend bool, now time.Time) error {
+	found := make(map[uint]bool, len(appointments))
+	for _, a := range appointments {
+		found[a.ID] = true
+	}
+	var missing []uint
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissedLetterBatchError{Reason: "appointments not found", AppointmentIDs: missing}
+	}
+
+	grace := time.Duration(config.LoadConfig().MissedGraceMinutes) * time.Minute
+	checks := []struct {
+		reason      string
+		alreadySent bool
+		failed      func(a *models.Appointment) bool
+	}{
+		{"appointments were not missed", false, func(a *models.Appointment) bool {
+			return a.Status != models.AppointmentStatusScheduled || !a.StartAt.Before(now.Add(-grace))
+		}},
+		{"letters already sent", true, func(a *models.Appointment) bool {
+			return !resend && a.MissedLetterSentAt != nil
+		}},
+		{"patients have no postal address", false, func(a *models.Appointment) bool {
+			p := a.Patient
+			return p == nil || strings.TrimSpace(p.Street) == "" || strings.TrimSpace(p.City) == "" || strings.TrimSpace(p.Postal) == ""
+		}},
+	}
+	for _, check := range checks {
+		var failed []uint
+		for i := range appointments {
+			if check.failed(&appointments[i]) {
+				failed = append(failed, appointments[i].ID)
+			}
+		}
+		if len(failed) > 0 {
+			return &MissedLetterBatchError{Reason: check.reason, AppointmentIDs: failed, AlreadySent: check.alreadySent}
+		}
+	}
+	return nil
+}
+
+// primaryDoctors returns each patient's primary doctor, or their first linked doctor when
+// none is marked primary.
+func primaryDoctors(appointments []models.Appointment) (map[uint]*models.Doctor, error) {
+	patientIDs := make([]uint, 0, len(appointments))
+	for _, a := range appointments {
+		patientIDs = append(patientIDs, a.PatientID)
+	}
+	var links []models.PatientDoctor
+	err := config.DB.Preload("Doctor").Where("patient_id IN ?", patientIDs).
+		Order("is_primary DESC, id ASC").Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	doctors := make(map[uint]*models.Doctor)
+	for i := range links {
+		if _, ok := doctors[links[i].PatientID]; !ok && links[i].Doctor.ID != 0 {
+			doctors[links[i].PatientID] = &links[i].Doctor
+		}
+	}
+	return doctors, nil
+}
+
+// nextAvailableSlot describes the first clinic slot with room in the next four weeks, or is
+// empty when there is none.
+func nextAvailableSlot(now time.Time) (string, error) {
+	slots, err := models.GetAvailableSlots(now, now.AddDate(0, 0, 28), models.AppointmentLocationClinic)
+	if err != nil {
+		return "", err
+	}
+	for _, slot := range slots {
+		if slot.Remaining > 0 && slot.SlotTime.After(now) {
+			return letterDateTime(slot.SlotTime), nil
+		}
+	}
+	return "", nil
+}
+
+// appointmentMergeValues fills the merge fields describing an appointment, its patient and
+// the clinic.
+func appointmentMergeValues(a *models.Appointment, doctor *models.Doctor, now time.Time) map[string]string {
+	cfg := config.LoadConfig()
+	values := map[string]string{
+		"appointment.date":     letterDate(a.StartAt),
+		"appointment.time":     letterTime(a.StartAt),
+		"appointment.location": string(a.Location),
+		"appointment.title":    a.Title,
+		"clinic.name":          cfg.ClinicName,
+		"clinic.phone":         cfg.ClinicPhone,
+		"today":                letterDate(now),
+	}
+	if p := a.Patient; p != nil {
+		values["patient.firstName"] = p.FirstName
+		values["patient.lastName"] = p.LastName
+		values["patient.fullName"] = strings.TrimSpace(p.FirstName + " " + p.LastName)
+		values["patient.mrn"] = strconv.Itoa(p.MRN)
+		values["patient.dob"] = p.DOB
+		values["address.street"] = p.Street
+		values["address.city"] = p.City
+		values["address.state"] = p.State
+		values["address.postal"] = p.Postal
+		values["address.country"] = p.Country
+	}
+	if doctor != nil {
+		values["doctor.name"] = doctor.FullName
+		values["doctor.phone"] = doctor.Phone
+	}
+	return values
+}
+
+// letterRecipient is the address block shown through the envelope window.
+func letterRecipient(p *models.Patient) string {
+	if p == nil {
+		return ""
+	}
+	lines := []string{
+		strings.TrimSpace(p.FirstName + " " + p.LastName),
+		strings.TrimSpace(p.Street),
+		strings.Join(strings.Fields(p.City+" "+p.State+" "+p.Postal), " "),
+		strings.TrimSpace(p.Country),
+	}
+	var block []string
+	for _, line := range lines {
+		if line != "" {
+			block = append(block, line)
+		}
+	}
+	return strings.Join(block, "\n")
+}
+
+func letterDate(t time.Time) string {
+	return t.In(clinicLocation()).Format("Monday 2 January 2006")
+}
+
+func letterTime(t time.Time) string {
+	return t.In(clinicLocation()).Format("3:04 pm")
+}
+
+func letterDateTime(t time.Time) string {
+	return letterDate(t) + " at " + letterTime(t)
+}
+
+func clinicLocation() *time.Location {
+	if tz, err := models.ClinicTimeLocation(); err == nil {
+		return tz
+	}
+	return time.Local
+}
+
+const (
+	letterMargin     = 15.0
+	letterLineHeight = 5.0
+	letterWindowTop  = 40.0 // Address block position for windowed envelopes
+)
+
+// RenderLettersPDF renders letters as one A5 PDF, each letter starting on a new page and
+// running onto more pages if it is long. Letters are ordered by patient name so the printed
+// batch can be matched to envelopes.
+func RenderLettersPDF(letters []models.PatientLetter) ([]byte, error) {
+	ordered := make([]*models.PatientLetter, len(letters))
+	for i := range letters {
+		ordered[i] = &letters[i]
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return strings.ToLower(ordered[i].Recipient) < strings.ToLower(ordered[j].Recipient)
+	})
+
+	cfg := config.LoadConfig()
+	pdf := fpdf.New("P", "mm", "A5", "")
+	pdf.SetMargins(letterMargin, letterMargin, letterMargin)
+	pdf.SetAutoPageBreak(true, letterMargin)
+	pdf.SetTitle("Letters", true)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - 2*letterMargin
+
+	for _, letter := range ordered {
+		pdf.AddPage()
+
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(width, letterLineHeight, tr(cfg.ClinicName), "", 1, "R", false, 0, "")
+		if cfg.ClinicPhone != "" {
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.CellFormat(width, letterLineHeight, tr("Phone "+cfg.ClinicPhone), "", 1, "R", false, 0, "")
+		}
+
+		pdf.SetY(letterWindowTop)
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(width*0.6, letterLineHeight, tr(letter.Recipient), "", "L", false)
+
+		pdf.Ln(letterLineHeight * 2)
+		pdf.CellFormat(width, letterLineHeight, tr(letterDate(letter.CreatedAt)), "", 1, "R", false, 0, "")
+		pdf.Ln(letterLineHeight)
+
+		if letter.Subject != "" {
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.MultiCell(width, letterLineHeight, tr(letter.Subject), "", "L", false)
+			pdf.Ln(letterLineHeight)
+		}
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(width, letterLineHeight, tr(letter.Body), "", "L", false)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
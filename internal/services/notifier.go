@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// ReminderMessage is a rendered reminder ready to hand to a notifier.
+type ReminderMessage struct {
+	To      string
+	Subject string // Email only
+	Body    string
+}
+
+// Notifier delivers messages over one channel. Send returns the provider's message ID when
+// it gives one.
+type Notifier interface {
+	Channel() models.ReminderChannel
+	Send(ctx context.Context, msg ReminderMessage) (string, error)
+}
+
+// NotifiersFromEnv returns a notifier for each channel that is configured: email when
+// SMTP_HOST is set and SMS when SMS_GATEWAY_URL is set.
+func NotifiersFromEnv() map[models.ReminderChannel]Notifier {
+	notifiers := make(map[models.ReminderChannel]Notifier)
+	if n := NewSMTPNotifier(); n != nil {
+		notifiers[n.Channel()] = n
+	}
+	if n := NewHTTPSMSNotifier(); n != nil {
+		notifiers[n.Channel()] = n
+	}
+	return notifiers
+}
+
+// SMTPNotifier sends email through an SMTP server, upgrading to TLS when the server offers
+// STARTTLS.
+type SMTPNotifier struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     *mail.Address
+}
+
+// NewSMTPNotifier configures email from SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM. It returns nil if SMTP_HOST or a valid SMTP_FROM is missing.
+func NewSMTPNotifier() *SMTPNotifier {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		log.Printf("[Notifier] Email disabled, invalid SMTP_FROM: %v", err)
+		return nil
+	}
+	return &SMTPNotifier{
+		host:     host,
+		port:     getEnvInt("SMTP_PORT", 587),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+	}
+}
+
+func (n *SMTPNotifier) Channel() models.ReminderChannel {
+	return models.ReminderChannelEmail
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg ReminderMessage) (string, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return "", fmt.Errorf("invalid email address %q: %w", msg.To, err)
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.host, strconv.Itoa(n.port)))
+	if err != nil {
+		return "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return "", err
+		}
+	}
+	if n.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return "", err
+		}
+	}
+	if err := client.Mail(n.from.Address); err != nil {
+		return "", err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return "", err
+	}
+
+	messageID := fmt.Sprintf("<%s@%s>", uuid.NewString(), n.domain())
+	w, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(n.message(to, messageID, msg)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return messageID, client.Quit()
+}
+
+// message builds a plain text email with the body quoted-printable encoded.
+func (n *SMTPNotifier) message(to *mail.Address, messageID string, msg ReminderMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", messageID)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+func (n *SMTPNotifier) domain() string {
+	if at := strings.LastIndex(n.from.Address, "@"); at >= 0 {
+		return n.from.Address[at+1:]
+	}
+	return n.host
+}
+
+// HTTPSMSNotifier sends text messages through an HTTP gateway. It posts
+// {"to", "from", "message"} as JSON and treats any 2xx response as accepted, reading the
+// message ID from an "id" or "messageId" field if the gateway returns one.
+type HTTPSMSNotifier struct {
+	url    string
+	token  string
+	sender string
+	client *http.Client
+}
+
+// NewHTTPSMSNotifier configures SMS from SMS_GATEWAY_URL, SMS_GATEWAY_TOKEN (sent as a
+// bearer token) and SMS_SENDER. It returns nil if SMS_GATEWAY_URL is not set.
+func NewHTTPSMSNotifier() *HTTPSMSNotifier {
+	url := os.Getenv("SMS_GATEWAY_URL")
+	if url == "" {
+		return nil
+	}
+	return &HTTPSMSNotifier{
+		url:    url,
+		token:  os.Getenv("SMS_GATEWAY_TOKEN"),
+		sender: os.Getenv("SMS_SENDER"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *HTTPSMSNotifier) Channel() models.ReminderChannel {
+	return models.ReminderChannelSMS
+}
+
+func (n *HTTPSMSNotifier) Send(ctx context.Context, msg ReminderMessage) (string, error) {
+	payload, err := json.Marshal(map[string]string{
+		"to":      msg.To,
+		"from":    n.sender,
+		"message": msg.Body,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goReporter-Reminders/1.0")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		ID        string `json:"id"`
+		MessageID string `json:"messageId"`
+	}
+	if json.Unmarshal(body, &result) == nil {
+		if result.ID != "" {
+			return result.ID, nil
+		}
+		return result.MessageID, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
+)
+
+// summaryTaskLimit caps the open tasks listed on the face sheet; OpenTaskCount has the total.
+const summaryTaskLimit = 5
+
+// PatientSummary is the pre-visit face sheet for a patient.
+type PatientSummary struct {
+	GeneratedAt     time.Time           `json:"generatedAt"`
+	Patient         SummaryPatient      `json:"patient"`
+	Doctors         []SummaryDoctor     `json:"doctors"`
+	Devices         []SummaryImplant    `json:"devices"`
+	Leads           []SummaryImplant    `json:"leads"`
+	MRIConditional  bool                `json:"mriConditional"` // Every active device and lead is MRI conditional
+	LatestReport    *SummaryReport      `json:"latestReport"`
+	LastAppointment *SummaryAppointment `json:"lastAppointment"`
+	NextAppointment *SummaryAppointment `json:"nextAppointment"`
+	OpenTasks       []SummaryTask       `json:"openTasks"`
+	OpenTaskCount   int64               `json:"openTaskCount"`
+	ActiveConsents  []SummaryConsent    `json:"activeConsents"`
+	Alerts          []SummaryAlert      `json:"alerts"`
+}
+
+type SummaryPatient struct {
+	ID        uint   `json:"id"`
+	MRN       int    `json:"mrn"`
+	FirstName string `json:"fname"`
+	LastName  string `json:"lname"`
+	DOB       string `json:"dob"`
+	Age       *int   `json:"age"`
+	Gender    string `json:"gender"`
+	Phone     string `json:"phone"`
+}
+
+type SummaryDoctor struct {
+	ID        uint   `json:"id"`
+	FullName  string `json:"fullName"`
+	Phone     string `json:"phone"`
+	IsPrimary bool   `json:"isPrimary"`
+}
+
+type SummaryImplant struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	Manufacturer string    `json:"manufacturer"`
+	Model        string    `json:"model"`
+	Type         string    `json:"type,omitempty"`
+	Serial       string    `json:"serial"`
+	Chamber      string    `json:"chamber,omitempty"`
+	Status       string    `json:"status"`
+	ImplantedAt  time.Time `json:"implantedAt"`
+	IsMri        bool      `json:"isMri"`
+	HasAlert     bool      `json:"hasAlert"`
+}
+
+// SummaryReport holds the latest report's key measurements and battery status.
+type SummaryReport struct {
+	ID              uint       `json:"id"`
+	ReportDate      time.Time  `json:"reportDate"`
+	ReportType      string     `json:"reportType"`
+	ReportStatus    string     `json:"reportStatus"`
+	IsCompleted     bool       `json:"isCompleted"`
+	SignoffStatus   string     `json:"signoffStatus"`
+	BradyMode       *string    `json:"bradyMode"`
+	LowerRate       *int       `json:"lowerRate"`
+	Rhythm          *string    `json:"rhythm"`
+	Dependency      *string    `json:"dependency"`
+	AtafBurden      *float64   `json:"atafBurdenPercent"`
+	Leads           []LeadMeas `json:"leads"`
+	ShockImpedance  *float64   `json:"shockImpedance"`
+	BatteryStatus   *string    `json:"batteryStatus"`
+	BatteryVoltage  *float64   `json:"batteryVoltage"`
+	BatteryYears    *float64   `json:"batteryRemainingYears"`
+	BatteryPercent  *float64   `json:"batteryPercent"`
+	ChargeTime      *float64   `json:"chargeTime"`
+	PriorityReasons []string   `json:"priorityReasons"`
+}
+
+// LeadMeas is one chamber's measurements on the latest report.
+type LeadMeas struct {
+	Chamber     string   `json:"chamber"`
+	Impedance   *float64 `json:"impedance"`
+	Sensing     *float64 `json:"sensing"`
+	Threshold   *float64 `json:"threshold"`
+	PulseWidth  *float64 `json:"pulseWidth"`
+	PercentPace *float64 `json:"percentPaced"`
+}
+
+type SummaryAppointment struct {
+	ID       uint                       `json:"id"`
+	Title    string                     `json:"title"`
+	StartAt  time.Time                  `json:"startAt"`
+	Location models.AppointmentLocation `json:"location"`
+	Status   models.AppointmentStatus   `json:"status"`
+}
+
+type SummaryTask struct {
+	ID       uint                `json:"id"`
+	Title    string              `json:"title"`
+	Status   models.TaskStatus   `json:"status"`
+	Priority models.TaskPriority `json:"priority"`
+	DueDate  *time.Time          `json:"dueDate"`
+	Overdue  bool                `json:"overdue"`
+}
+
+type SummaryConsent struct {
+	ConsentType models.ConsentType `json:"consentType"`
+	GrantedDate time.Time          `json:"grantedDate"`
+	ExpiryDate  *time.Time         `json:"expiryDate"`
+}
+
+// SummaryAlert is anything staff should see before the visit. Severity is "critical",
+// "warning" or "info".
+type SummaryAlert struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// BuildPatientSummary assembles the face sheet with one narrow query per section instead of
+// preloading the full patient record.
+func BuildPatientSummary(patientID uint) (*PatientSummary, error) {
+	now := time.Now()
+	summary := &PatientSummary{
+		GeneratedAt:    now,
+		Doctors:        []SummaryDoctor{},
+		Devices:        []SummaryImplant{},
+		Leads:          []SummaryImplant{},
+		OpenTasks:      []SummaryTask{},
+		ActiveConsents: []SummaryConsent{},
+		Alerts:         []SummaryAlert{},
+	}
+
+	var patient models.Patient
+	if err := config.DB.Select("id", "mrn", "first_name", "last_name", "dob", "gender", "phone").
+		First(&patient, patientID).Error; err != nil {
+		return nil, err
+	}
+	summary.Patient = SummaryPatient{
+		ID:        patient.ID,
+		MRN:       patient.MRN,
+		FirstName: patient.FirstName,
+		LastName:  patient.LastName,
+		DOB:       patient.DOB,
+		Gender:    patient.Gender,
+		Phone:     patient.Phone,
+	}
+	if age, ok := models.PatientAge(patient.DOB, now); ok {
+		summary.Patient.Age = &age
+	}
+
+	err := config.DB.Table("patient_doctors").
+		Select("doctors.id, doctors.full_name, doctors.phone, patient_doctors.is_primary").
+		Joins("JOIN doctors ON doctors.id = patient_doctors.doctor_id AND doctors.deleted_at IS NULL").
+		Where("patient_doctors.patient_id = ? AND patient_doctors.deleted_at IS NULL", patientID).
+		Where("patient_doctors.access_expires_at IS NULL OR patient_doctors.access_expires_at > ?", now).
+		Order("patient_doctors.is_primary DESC, doctors.full_name ASC").
+		Scan(&summary.Doctors).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Table("implanted_devices").
+		Select("implanted_devices.id, devices.name, devices.manufacturer, devices.dev_model AS model, devices.type, "+
+			"implanted_devices.serial, implanted_devices.status, implanted_devices.implanted_at, devices.is_mri, devices.has_alert").
+		Joins("JOIN devices ON devices.id = implanted_devices.device_id").
+		Where("implanted_devices.patient_id = ? AND implanted_devices.deleted_at IS NULL AND implanted_devices.explanted_at IS NULL", patientID).
+		Order("implanted_devices.implanted_at DESC").
+		Scan(&summary.Devices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Table("implanted_leads").
+		Select("implanted_leads.id, leads.name, leads.manufacturer, leads.lead_model AS model, implanted_leads.serial, "+
+			"implanted_leads.chamber, implanted_leads.status, implanted_leads.implanted_at, leads.is_mri, leads.has_alert").
+		Joins("JOIN leads ON leads.id = implanted_leads.lead_id").
+		Where("implanted_leads.patient_id = ? AND implanted_leads.deleted_at IS NULL AND implanted_leads.explanted_at IS NULL", patientID).
+		Order("implanted_leads.implanted_at DESC").
+		Scan(&summary.Leads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary.MRIConditional = len(summary.Devices) > 0
+	for _, implant := range append(append([]SummaryImplant{}, summary.Devices...), summary.Leads...) {
+		if !implant.IsMri {
+			summary.MRIConditional = false
+		}
+		if implant.HasAlert {
+			summary.Alerts = append(summary.Alerts, SummaryAlert{
+				Type:     "advisory",
+				Severity: "warning",
+				Message:  fmt.Sprintf("Advisory on %s %s (serial %s)", implant.Manufacturer, implant.Name, implant.Serial),
+			})
+		}
+	}
+
+	if err := loadSummaryReport(summary, patientID); err != nil {
+		return nil, err
+	}
+	if err := loadSummaryAppointments(summary, patientID, now); err != nil {
+		return nil, err
+	}
+	if err := loadSummaryTasks(summary, patientID, now); err != nil {
+		return nil, err
+	}
+
+	var consents []models.PatientConsent
+	err = config.DB.Select("consent_type", "granted_date", "expiry_date").
+		Where("patient_id = ? AND status = ? AND (expiry_date IS NULL OR expiry_date > ?)", patientID, models.ConsentGranted, now).
+		Order("consent_type ASC").
+		Find(&consents).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, consent := range consents {
+		summary.ActiveConsents = append(summary.ActiveConsents, SummaryConsent{
+			ConsentType: consent.ConsentType,
+			GrantedDate: consent.GrantedDate,
+			ExpiryDate:  consent.ExpiryDate,
+		})
+	}
+
+	var afAlerts []models.AFRiskAlert
+	err = config.DB.Select("id", "report_id", "burden_percent", "cha2ds2_vasc").
+		Where("patient_id = ? AND status = ?", patientID, models.AFRiskAlertOpen).
+		Order("created_at DESC").
+		Find(&afAlerts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range afAlerts {
+		summary.Alerts = append(summary.Alerts, SummaryAlert{
+			Type:     "af_risk",
+			Severity: "critical",
+			Message:  fmt.Sprintf("AF burden %.1f%% with CHA2DS2-VASc %d and no anticoagulant (report #%d)", alert.BurdenPercent, alert.CHA2DS2VASc, alert.ReportID),
+		})
+	}
+
+	sort.SliceStable(summary.Alerts, func(i, j int) bool {
+		return summaryAlertRank(summary.Alerts[i].Severity) < summaryAlertRank(summary.Alerts[j].Severity)
+	})
+	return summary, nil
+}
+
+// loadSummaryReport fills in the latest report and the findings that would raise its review priority.
+func loadSummaryReport(summary *PatientSummary, patientID uint) error {
+	var report models.Report
+	err := config.DB.Select("id", "patient_id", "report_date", "report_type", "report_status", "is_completed", "signoff_status",
+		"current_rhythm", "current_dependency", "mdc_idc_stat_ataf_burden_percent",
+		"mdc_idc_set_brady_mode", "mdc_idc_set_brady_lowrate",
+		"mdc_idc_batt_status", "mdc_idc_batt_volt", "mdc_idc_batt_remaining", "mdc_idc_batt_percentage", "mdc_idc_cap_charge_time",
+		"mdc_idc_msmt_ra_impedance_mean", "mdc_idc_msmt_ra_sensing", "mdc_idc_msmt_ra_pacing_threshold", "mdc_idc_msmt_ra_pw",
+		"mdc_idc_msmt_rv_impedance_mean", "mdc_idc_msmt_rv_sensing", "mdc_idc_msmt_rv_pacing_threshold", "mdc_idc_msmt_rv_pw",
+		"mdc_idc_msmt_lv_impedance_mean", "mdc_idc_msmt_lv_sensing", "mdc_idc_msmt_lv_pacing_threshold", "mdc_idc_msmt_lv_pw",
+		"mdc_idc_msmt_shock_impedance",
+		"mdc_idc_stat_brady_ra_percent_paced", "mdc_idc_stat_brady_rv_percent_paced", "mdc_idc_stat_brady_lv_percent_paced",
+		"episode_tachy_count_since_last_check", "episode_pause_count_since_last_check", "episode_symptom_all_count_since_last_check").
+		Where("patient_id = ?", patientID).
+		Order("report_date DESC, id DESC").
+		Preload("Arrhythmias", func(db *gorm.DB) *gorm.DB { return db.Select("id", "report_id", "name", "type") }).
+		First(&report).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	priority, reasons := DeriveReportPriority(&report)
+	summary.LatestReport = &SummaryReport{
+		ID:             report.ID,
+		ReportDate:     report.ReportDate,
+		ReportType:     report.ReportType,
+		ReportStatus:   report.ReportStatus,
+		IsCompleted:    report.IsCompleted != nil && *report.IsCompleted,
+		SignoffStatus:  report.SignoffStatus,
+		BradyMode:      report.MdcIdcSetBradyMode,
+		LowerRate:      report.MdcIdcSetBradyLowrate,
+		Rhythm:         report.CurrentRhythm,
+		Dependency:     report.CurrentDependency,
+		AtafBurden:     report.MdcIdcStatAtafBurdenPercent,
+		ShockImpedance: report.MdcIdcMsmtHvImpedanceMean,
+		BatteryStatus:  report.MdcIdcBattStatus,
+		BatteryVoltage: report.MdcIdcBattVolt,
+		BatteryYears:   report.MdcIdcBattRemaining,
+		BatteryPercent: report.MdcIdcBattPercentage,
+		ChargeTime:     report.MdcIdcCapChargeTime,
+		Leads: []LeadMeas{
+			{"RA", report.MdcIdcMsmtRaImpedanceMean, report.MdcIdcMsmtRaSensing, report.MdcIdcMsmtRaPacingThreshold, report.MdcIdcMsmtRaPw, report.MdcIdcStatBradyRaPercentPaced},
+			{"RV", report.MdcIdcMsmtRvImpedanceMean, report.MdcIdcMsmtRvSensing, report.MdcIdcMsmtRvPacingThreshold, report.MdcIdcMsmtRvPw, report.MdcIdcStatBradyRvPercentPaced},
+			{"LV", report.MdcIdcMsmtLvImpedanceMean, report.MdcIdcMsmtLvSensing, report.MdcIdcMsmtLvPacingThreshold, report.MdcIdcMsmtLvPw, report.MdcIdcStatBradyLvPercentPaced},
+		},
+		PriorityReasons: reasons,
+	}
+
+	severity := ""
+	switch priority {
+	case models.TaskPriorityUrgent:
+		severity = "critical"
+	case models.TaskPriorityHigh:
+		severity = "warning"
+	}
+	if severity != "" {
+		for _, reason := range reasons {
+			summary.Alerts = append(summary.Alerts, SummaryAlert{Type: "report", Severity: severity, Message: "Latest report: " + reason})
+		}
+	}
+	if report.SignoffStatus == models.SignoffAwaitingPhysician {
+		summary.Alerts = append(summary.Alerts, SummaryAlert{Type: "signoff", Severity: "info", Message: "Latest report is awaiting physician sign-off"})
+	}
+
+	change, err := models.GetReportProgrammingChange(report.ID)
+	if err != nil {
+		return err
+	}
+	if change != nil && change.TherapyDisabledWithoutComment {
+		summary.Alerts = append(summary.Alerts, SummaryAlert{Type: "programming", Severity: "critical", Message: "Tachy therapy disabled on latest report without a comment"})
+	}
+	return nil
+}
+
+func loadSummaryAppointments(summary *PatientSummary, patientID uint, now time.Time) error {
+	columns := []string{"id", "title", "start_at", "location", "status"}
+
+	var last models.Appointment
+	err := config.DB.Select(columns).
+		Where("patient_id = ? AND start_at < ? AND status <> ?", patientID, now, models.AppointmentStatusCancelled).
+		Order("start_at DESC").
+		First(&last).Error
+	switch {
+	case err == nil:
+		summary.LastAppointment = &SummaryAppointment{ID: last.ID, Title: last.Title, StartAt: last.StartAt, Location: last.Location, Status: last.Status}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	var next models.Appointment
+	err = config.DB.Select(columns).
+		Where("patient_id = ? AND start_at >= ? AND status = ?", patientID, now, models.AppointmentStatusScheduled).
+		Order("start_at ASC").
+		First(&next).Error
+	switch {
+	case err == nil:
+		summary.NextAppointment = &SummaryAppointment{ID: next.ID, Title: next.Title, StartAt: next.StartAt, Location: next.Location, Status: next.Status}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	return nil
+}
+
+func loadSummaryTasks(summary *PatientSummary, patientID uint, now time.Time) error {
+	open := config.DB.Model(&models.Task{}).
+		Where("patient_id = ? AND status IN ?", patientID, []models.TaskStatus{models.TaskStatusPending, models.TaskStatusInProgress})
+	if err := open.Session(&gorm.Session{}).Count(&summary.OpenTaskCount).Error; err != nil {
+		return err
+	}
+
+	var tasks []models.Task
+	err := open.Session(&gorm.Session{}).
+		Select("id", "title", "status", "priority", "due_date").
+		Order("CASE WHEN due_date IS NULL THEN 1 ELSE 0 END, due_date ASC, id ASC").
+		Limit(summaryTaskLimit).
+		Find(&tasks).Error
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		summary.OpenTasks = append(summary.OpenTasks, SummaryTask{
+			ID:       task.ID,
+			Title:    task.Title,
+			Status:   task.Status,
+			Priority: task.Priority,
+			DueDate:  task.DueDate,
+			Overdue:  task.DueDate != nil && task.DueDate.Before(now),
+		})
+	}
+
+	var overdue int64
+	if err := open.Session(&gorm.Session{}).Where("due_date < ?", now).Count(&overdue).Error; err != nil {
+		return err
+	}
+	if overdue > 0 {
+		noun := "task"
+		if overdue > 1 {
+			noun = "tasks"
+		}
+		summary.Alerts = append(summary.Alerts, SummaryAlert{Type: "task", Severity: "warning", Message: fmt.Sprintf("%d overdue %s", overdue, noun)})
+	}
+	return nil
+}
+
+// summaryAlertRank orders alerts most severe first.
+func summaryAlertRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return 0
+	case "warning":
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	summaryPageMargin = 10.0
+	summaryPageBottom = 287.0 // A4 height less the bottom margin
+	summaryLineHeight = 5.0
+)
+
+// summaryPDF writes the face sheet top to bottom and drops whatever no longer fits, so the
+// output is always a single page.
+type summaryPDF struct {
+	pdf       *fpdf.Fpdf
+	tr        func(string) string
+	width     float64
+	truncated bool
+}
+
+// RenderPatientSummaryPDF renders the face sheet as a one-page A4 PDF for the procedure room.
+func RenderPatientSummaryPDF(summary *PatientSummary) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(summaryPageMargin, summaryPageMargin, summaryPageMargin)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetTitle(fmt.Sprintf("Patient summary - MRN %d", summary.Patient.MRN), true)
+	pdf.AddPage()
+
+	pageWidth, _ := pdf.GetPageSize()
+	w := &summaryPDF{
+		pdf:   pdf,
+		tr:    pdf.UnicodeTranslatorFromDescriptor(""),
+		width: pageWidth - 2*summaryPageMargin,
+	}
+
+	w.writeHeader(summary)
+	w.writeAlerts(summary.Alerts)
+	w.writeImplants(summary)
+	w.writeLatestReport(summary.LatestReport)
+	w.writeAppointments(summary)
+	w.writeTasks(summary)
+	w.writeConsents(summary.ActiveConsents)
+	w.writeDoctors(summary.Doctors)
+
+	if w.truncated {
+		pdf.SetY(summaryPageBottom - summaryLineHeight)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(w.width, summaryLineHeight, "Some sections were shortened to fit one page; see the full record online.", "", 0, "C", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fits reports whether another h millimetres fit above the footer, marking the sheet
+// truncated when they do not.
+func (w *summaryPDF) fits(h float64) bool {
+	if w.pdf.GetY()+h > summaryPageBottom-summaryLineHeight {
+		w.truncated = true
+		return false
+	}
+	return true
+}
+
+func (w *summaryPDF) section(title string) bool {
+	if !w.fits(3 + 2*summaryLineHeight) {
+		return false
+	}
+	w.pdf.Ln(3)
+	w.pdf.SetFont("Helvetica", "B", 11)
+	w.pdf.SetTextColor(0, 0, 0)
+	w.pdf.SetFillColor(230, 230, 230)
+	w.pdf.CellFormat(w.width, summaryLineHeight+1, w.tr(title), "", 1, "L", true, 0, "")
+	w.pdf.SetFont("Helvetica", "", 9)
+	return true
+}
+
+// line writes one row of cells with the given widths, clipping each value to its cell.
+func (w *summaryPDF) line(widths []float64, values ...string) bool {
+	if !w.fits(summaryLineHeight) {
+		return false
+	}
+	for i, value := range values {
+		cell := w.clip(w.tr(value), widths[i]-1)
+		ln := 0
+		if i == len(values)-1 {
+			ln = 1
+		}
+		w.pdf.CellFormat(widths[i], summaryLineHeight, cell, "", ln, "L", false, 0, "")
+	}
+	return true
+}
+
+func (w *summaryPDF) text(value string) bool {
+	return w.line([]float64{w.width}, value)
+}
+
+func (w *summaryPDF) clip(s string, width float64) string {
+	if w.pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	for len(s) > 0 && w.pdf.GetStringWidth(s+"...") > width {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
+
+func (w *summaryPDF) writeHeader(s *PatientSummary) {
+	p := s.Patient
+	w.pdf.SetFont("Helvetica", "B", 16)
+	w.pdf.CellFormat(w.width, 8, w.tr(fmt.Sprintf("%s, %s", strings.ToUpper(p.LastName), p.FirstName)), "", 1, "L", false, 0, "")
+
+	age := ""
+	if p.Age != nil {
+		age = fmt.Sprintf(" (%d y)", *p.Age)
+	}
+	mri := "No"
+	if s.MRIConditional {
+		mri = "Yes"
+	}
+	w.pdf.SetFont("Helvetica", "", 10)
+	cols := []float64{w.width / 4, w.width / 4, w.width / 4, w.width / 4}
+	w.line(cols, fmt.Sprintf("MRN: %d", p.MRN), "DOB: "+p.DOB+age, "Gender: "+p.Gender, "Phone: "+p.Phone)
+	w.line(cols, "MRI conditional: "+mri, "", "", "Printed: "+s.GeneratedAt.Format("2006-01-02 15:04"))
+	w.pdf.Line(summaryPageMargin, w.pdf.GetY()+1, summaryPageMargin+w.width, w.pdf.GetY()+1)
+	w.pdf.Ln(1)
+}
+
+func (w *summaryPDF) writeAlerts(alerts []SummaryAlert) {
+	if len(alerts) == 0 || !w.section("Alerts") {
+		return
+	}
+	for _, alert := range alerts {
+		switch alert.Severity {
+		case "critical":
+			w.pdf.SetTextColor(180, 0, 0)
+		case "warning":
+			w.pdf.SetTextColor(170, 100, 0)
+		default:
+			w.pdf.SetTextColor(0, 0, 0)
+		}
+		if !w.text(fmt.Sprintf("[%s] %s", strings.ToUpper(alert.Severity), alert.Message)) {
+			break
+		}
+	}
+	w.pdf.SetTextColor(0, 0, 0)
+}
+
+func (w *summaryPDF) writeImplants(s *PatientSummary) {
+	if !w.section("Active devices and leads") {
+		return
+	}
+	if len(s.Devices) == 0 && len(s.Leads) == 0 {
+		w.text("No active implants")
+		return
+	}
+	cols := []float64{18, 50, 40, 30, 30, 22}
+	w.pdf.SetFont("Helvetica", "B", 9)
+	w.line(cols, "Kind", "Name / model", "Manufacturer", "Serial", "Implanted", "MRI")
+	w.pdf.SetFont("Helvetica", "", 9)
+	rows := make([][]string, 0, len(s.Devices)+len(s.Leads))
+	for _, d := range s.Devices {
+		rows = append(rows, implantRow("Device", d))
+	}
+	for _, l := range s.Leads {
+		kind := "Lead"
+		if l.Chamber != "" {
+			kind = "Lead " + l.Chamber
+		}
+		rows = append(rows, implantRow(kind, l))
+	}
+	for _, row := range rows {
+		if !w.line(cols, row...) {
+			return
+		}
+	}
+}
+
+func implantRow(kind string, implant SummaryImplant) []string {
+	mri := "No"
+	if implant.IsMri {
+		mri = "Yes"
+	}
+	if implant.HasAlert {
+		mri += " / advisory"
+	}
+	return []string{kind, strings.TrimSpace(implant.Name + " " + implant.Model), implant.Manufacturer, implant.Serial, implant.ImplantedAt.Format("2006-01-02"), mri}
+}
+
+func (w *summaryPDF) writeLatestReport(r *SummaryReport) {
+	if !w.section("Latest report") {
+		return
+	}
+	if r == nil {
+		w.text("No reports on file")
+		return
+	}
+	half := []float64{w.width / 2, w.width / 2}
+	w.line(half,
+		fmt.Sprintf("%s, %s (%s)", r.ReportDate.Format("2006-01-02"), r.ReportType, r.ReportStatus),
+		"Rhythm: "+summaryStr(r.Rhythm)+", dependency: "+summaryStr(r.Dependency))
+	mode := summaryStr(r.BradyMode)
+	if r.LowerRate != nil {
+		mode += fmt.Sprintf(" %d bpm", *r.LowerRate)
+	}
+	w.line(half, "Brady: "+mode, "AT/AF burden: "+summaryNum(r.AtafBurden, "%.1f%%"))
+	w.line(half,
+		fmt.Sprintf("Battery: %s, %s, %s remaining", summaryStr(r.BatteryStatus), summaryNum(r.BatteryVoltage, "%.2f V"), summaryNum(r.BatteryYears, "%.1f y")),
+		"Charge time: "+summaryNum(r.ChargeTime, "%.1f s")+", shock impedance: "+summaryNum(r.ShockImpedance, "%.0f ohm"))
+
+	cols := []float64{20, 34, 34, 34, 34, 34}
+	w.pdf.SetFont("Helvetica", "B", 9)
+	w.line(cols, "Chamber", "Impedance", "Sensing", "Threshold", "Pulse width", "Paced")
+	w.pdf.SetFont("Helvetica", "", 9)
+	for _, lead := range r.Leads {
+		if lead.Impedance == nil && lead.Sensing == nil && lead.Threshold == nil && lead.PercentPace == nil {
+			continue
+		}
+		if !w.line(cols, lead.Chamber,
+			summaryNum(lead.Impedance, "%.0f ohm"),
+			summaryNum(lead.Sensing, "%.1f mV"),
+			summaryNum(lead.Threshold, "%.2f V"),
+			summaryNum(lead.PulseWidth, "%.2f ms"),
+			summaryNum(lead.PercentPace, "%.0f%%")) {
+			return
+		}
+	}
+}
+
+func (w *summaryPDF) writeAppointments(s *PatientSummary) {
+	if !w.section("Appointments") {
+		return
+	}
+	half := []float64{w.width / 2, w.width / 2}
+	w.line(half, "Last: "+summaryAppointment(s.LastAppointment), "Next: "+summaryAppointment(s.NextAppointment))
+}
+
+func (w *summaryPDF) writeTasks(s *PatientSummary) {
+	if !w.section(fmt.Sprintf("Open tasks (%d)", s.OpenTaskCount)) {
+		return
+	}
+	if len(s.OpenTasks) == 0 {
+		w.text("None")
+		return
+	}
+	cols := []float64{100, 30, 30, 30}
+	for _, task := range s.OpenTasks {
+		due := "-"
+		if task.DueDate != nil {
+			due = task.DueDate.Format("2006-01-02")
+			if task.Overdue {
+				due += " (overdue)"
+			}
+		}
+		if !w.line(cols, task.Title, string(task.Priority), string(task.Status), due) {
+			return
+		}
+	}
+	if s.OpenTaskCount > int64(len(s.OpenTasks)) {
+		w.text(fmt.Sprintf("... and %d more", s.OpenTaskCount-int64(len(s.OpenTasks))))
+	}
+}
+
+func (w *summaryPDF) writeConsents(consents []SummaryConsent) {
+	if !w.section("Active consents") {
+		return
+	}
+	if len(consents) == 0 {
+		w.text("None")
+		return
+	}
+	for _, consent := range consents {
+		expiry := "no expiry"
+		if consent.ExpiryDate != nil {
+			expiry = "expires " + consent.ExpiryDate.Format("2006-01-02")
+		}
+		if !w.text(fmt.Sprintf("%s - granted %s, %s", consent.ConsentType, consent.GrantedDate.Format("2006-01-02"), expiry)) {
+			return
+		}
+	}
+}
+
+func (w *summaryPDF) writeDoctors(doctors []SummaryDoctor) {
+	if !w.section("Care team") {
+		return
+	}
+	if len(doctors) == 0 {
+		w.text("No doctors assigned")
+		return
+	}
+	half := []float64{w.width / 2, w.width / 2}
+	for _, doctor := range doctors {
+		name := doctor.FullName
+		if doctor.IsPrimary {
+			name += " (primary)"
+		}
+		if !w.line(half, name, doctor.Phone) {
+			return
+		}
+	}
+}
+
+func summaryAppointment(a *SummaryAppointment) string {
+	if a == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s %s (%s)", a.StartAt.In(time.Local).Format("2006-01-02 15:04"), a.Title, a.Location)
+}
+
+func summaryStr(s *string) string {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return "-"
+	}
+	return *s
+}
+
+func summaryNum(v *float64, format string) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format, *v)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// DetectProgrammingChanges compares the report's device settings with the previous report
+// for the same implanted device and stores the differences. The stored record is removed
+// when there is no previous report or nothing changed. newlyFlagged is true when a therapy
+// was disabled without a comment and the report was not already flagged.
+func DetectProgrammingChanges(report *models.Report) (change *models.ReportProgrammingChange, newlyFlagged bool, err error) {
+	existing, err := models.GetReportProgrammingChange(report.ID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	device, err := models.GetReportImplantedDevice(report)
+	if err != nil {
+		return nil, false, err
+	}
+	previous, err := models.GetPreviousDeviceReport(report, device)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var changes models.ProgrammingChanges
+	if previous != nil {
+		changes = models.CompareProgrammingSettings(previous, report)
+	}
+	if len(changes) == 0 {
+		if existing != nil {
+			return nil, false, models.DeleteReportProgrammingChange(report.ID)
+		}
+		return nil, false, nil
+	}
+
+	therapyDisabled := false
+	for _, ch := range changes {
+		if ch.TherapyDisabled {
+			therapyDisabled = true
+			break
+		}
+	}
+	commented := report.Comments != nil && strings.TrimSpace(*report.Comments) != ""
+
+	if existing != nil {
+		change = existing
+	} else {
+		change = &models.ReportProgrammingChange{ReportID: report.ID}
+	}
+	wasFlagged := change.TherapyDisabledWithoutComment
+
+	change.PreviousReportID = previous.ID
+	change.PatientID = report.PatientID
+	change.ImplantedDeviceID = nil
+	if device != nil {
+		change.ImplantedDeviceID = &device.ID
+	}
+	change.ReportDate = report.ReportDate
+	change.Changes = changes
+	change.ChangeCount = len(changes)
+	change.TherapyDisabled = therapyDisabled
+	change.TherapyDisabledWithoutComment = therapyDisabled && !commented
+
+	if err := config.DB.Omit("Patient", "Report").Save(change).Error; err != nil {
+		return nil, false, err
+	}
+	return change, change.TherapyDisabledWithoutComment && !wasFlagged, nil
+}
+
+// RefreshNextProgrammingChange re-runs detection for the report that follows this one on the
+// same implanted device, whose baseline changes when this report is edited or deleted.
+func RefreshNextProgrammingChange(report *models.Report) error {
+	device, err := models.GetReportImplantedDevice(report)
+	if err != nil {
+		return err
+	}
+	next, err := models.GetNextDeviceReport(report, device)
+	if err != nil || next == nil {
+		return err
+	}
+	_, _, err = DetectProgrammingChanges(next)
+	return err
+}
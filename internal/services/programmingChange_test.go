@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+func strPtr(s string) *string { return &s }
+
+// seedProgrammingReports stores two reports a month apart for one patient and lets edit
+// set the later report's settings.
+func seedProgrammingReports(t *testing.T, edit func(previous, current *models.Report)) *models.Report {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(&models.Device{}, &models.ImplantedDevice{}, &models.ReportProgrammingChange{}); err != nil {
+		t.Fatalf("failed to migrate programming change models: %v", err)
+	}
+	patient := models.Patient{MRN: 3001, FirstName: "Ivy", LastName: "Shock"}
+	if err := config.DB.Create(&patient).Error; err != nil {
+		t.Fatalf("failed to seed patient: %v", err)
+	}
+
+	now := time.Now()
+	previous := &models.Report{PatientID: patient.ID, ReportDate: now.AddDate(0, -1, 0)}
+	current := &models.Report{PatientID: patient.ID, ReportDate: now}
+	edit(previous, current)
+	for _, r := range []*models.Report{previous, current} {
+		if err := config.DB.Create(r).Error; err != nil {
+			t.Fatalf("failed to seed report: %v", err)
+		}
+	}
+	return current
+}
+
+func TestDetectProgrammingChanges_VFShockTurnedOff(t *testing.T) {
+	current := seedProgrammingReports(t, func(previous, current *models.Report) {
+		previous.VfActive, current.VfActive = strPtr("On"), strPtr("On")
+		previous.VfTherapy2Energy, current.VfTherapy2Energy = strPtr("35 J"), strPtr("Off")
+	})
+
+	change, newlyFlagged, err := DetectProgrammingChanges(current)
+	if err != nil {
+		t.Fatalf("DetectProgrammingChanges failed: %v", err)
+	}
+	if change == nil || change.ChangeCount != 1 {
+		t.Fatalf("expected one change, got %+v", change)
+	}
+	if got := change.Changes[0]; got.Setting != "VF_therapy_2_energy" || !got.TherapyDisabled {
+		t.Fatalf("expected VF therapy 2 energy to be marked as therapy disabled, got %+v", got)
+	}
+	if !change.TherapyDisabled || !change.TherapyDisabledWithoutComment {
+		t.Fatalf("expected the report to be flagged, got therapyDisabled=%v withoutComment=%v",
+			change.TherapyDisabled, change.TherapyDisabledWithoutComment)
+	}
+	if !newlyFlagged {
+		t.Fatal("expected the report to be newly flagged so the warning is sent")
+	}
+
+	// A comment explaining the change clears the flag
+	current.Comments = strPtr("Shock disabled at patient request")
+	change, newlyFlagged, err = DetectProgrammingChanges(current)
+	if err != nil {
+		t.Fatalf("DetectProgrammingChanges failed: %v", err)
+	}
+	if !change.TherapyDisabled || change.TherapyDisabledWithoutComment || newlyFlagged {
+		t.Fatalf("expected a commented change not to be flagged, got %+v newlyFlagged=%v", change, newlyFlagged)
+	}
+}
+
+func TestCompareProgrammingSettings_ShockEnergies(t *testing.T) {
+	cases := []struct {
+		name     string
+		edit     func(previous, current *models.Report)
+		setting  string
+		disabled bool
+	}{
+		{"VT1 cardioversion energy off", func(p, c *models.Report) {
+			p.Vt1Therapy3Energy, c.Vt1Therapy3Energy = strPtr("20 J"), strPtr("Off")
+		}, "VT1_therapy_3_energy", true},
+		{"VT2 cardioversion off", func(p, c *models.Report) {
+			p.Vt2Therapy4Cvrt, c.Vt2Therapy4Cvrt = strPtr("On"), strPtr("Off")
+		}, "VT2_therapy_4_cvrt", true},
+		{"VF energy reduced", func(p, c *models.Report) {
+			p.VfTherapy4Energy, c.VfTherapy4Energy = strPtr("41 J"), strPtr("35 J")
+		}, "VF_therapy_4_energy", false},
+		{"VF energy turned back on", func(p, c *models.Report) {
+			p.VfTherapy3Energy, c.VfTherapy3Energy = strPtr("Off"), strPtr("35 J")
+		}, "VF_therapy_3_energy", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			previous, current := &models.Report{}, &models.Report{}
+			tc.edit(previous, current)
+			changes := models.CompareProgrammingSettings(previous, current)
+			if len(changes) != 1 || changes[0].Setting != tc.setting {
+				t.Fatalf("expected one %s change, got %+v", tc.setting, changes)
+			}
+			if changes[0].TherapyDisabled != tc.disabled {
+				t.Fatalf("expected therapyDisabled=%v, got %v", tc.disabled, changes[0].TherapyDisabled)
+			}
+		})
+	}
+}
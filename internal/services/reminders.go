@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// RenderReminder merges a reminder template for an appointment and addresses it to the
+// patient over the channel. Without an appointment it uses sample values, for previewing a
+// template before any appointment matches it.
+func RenderReminder(channel models.ReminderChannel, subject, body string, appointment *models.Appointment, now time.Time) (ReminderMessage, error) {
+	var values map[string]string
+	var to string
+	if appointment == nil {
+		values = sampleReminderValues(now)
+	} else {
+		doctors, err := primaryDoctors([]models.Appointment{*appointment})
+		if err != nil {
+			return ReminderMessage{}, err
+		}
+		values = appointmentMergeValues(appointment, doctors[appointment.PatientID], now)
+		to = reminderRecipient(channel, appointment.Patient)
+	}
+
+	msg := ReminderMessage{
+		To:   to,
+		Body: models.MergeLetterFields(body, values),
+	}
+	if channel == models.ReminderChannelEmail {
+		msg.Subject = models.MergeLetterFields(subject, values)
+	}
+	return msg, nil
+}
+
+// SMSSegments is how many messages an SMS body is split into, assuming the GSM alphabet.
+func SMSSegments(body string) int {
+	length := len([]rune(body))
+	if length <= 160 {
+		return 1
+	}
+	return (length + 152) / 153
+}
+
+func sampleReminderValues(now time.Time) map[string]string {
+	cfg := config.LoadConfig()
+	at := now.In(clinicLocation()).AddDate(0, 0, 7)
+	at = time.Date(at.Year(), at.Month(), at.Day(), 10, 30, 0, 0, at.Location())
+	return map[string]string{
+		"patient.firstName":    "Jane",
+		"patient.lastName":     "Citizen",
+		"patient.fullName":     "Jane Citizen",
+		"doctor.name":          "Dr Alex Morgan",
+		"doctor.phone":         "(02) 5550 1234",
+		"appointment.date":     letterDate(at),
+		"appointment.time":     letterTime(at),
+		"appointment.location": string(models.AppointmentLocationClinic),
+		"appointment.title":    "Device check",
+		"clinic.name":          cfg.ClinicName,
+		"clinic.phone":         cfg.ClinicPhone,
+	}
+}
+
+func reminderRecipient(channel models.ReminderChannel, p *models.Patient) string {
+	if p == nil {
+		return ""
+	}
+	switch channel {
+	case models.ReminderChannelEmail:
+		return strings.TrimSpace(p.Email)
+	case models.ReminderChannelSMS:
+		return strings.Join(strings.Fields(p.Phone), "")
+	}
+	return ""
+}
+
+// ReminderScheduler creates appointment reminders as their rules make them due and sends
+// them through the configured notifiers, retrying failed sends with a growing delay.
+type ReminderScheduler struct {
+	interval    time.Duration
+	maxAttempts int
+	retryDelay  time.Duration
+	maxLateness time.Duration
+	notifiers   map[models.ReminderChannel]Notifier
+}
+
+// NewReminderScheduler configures the scheduler from REMINDER_SCHEDULER_INTERVAL (default 5m),
+// REMINDER_MAX_ATTEMPTS (default 3), REMINDER_RETRY_DELAY (default 15m, doubling after
+// each failure) and REMINDER_MAX_LATENESS (default 6h, how long after its due time a
+// reminder may still be sent), with the notifiers configured in the environment.
+func NewReminderScheduler() *ReminderScheduler {
+	return NewReminderSchedulerWithNotifiers(NotifiersFromEnv())
+}
+
+// NewReminderSchedulerWithNotifiers configures the scheduler with the given notifiers in
+// place of those from the environment.
+func NewReminderSchedulerWithNotifiers(notifiers map[models.ReminderChannel]Notifier) *ReminderScheduler {
+	return &ReminderScheduler{
+		interval:    getEnvDuration("REMINDER_SCHEDULER_INTERVAL", 5*time.Minute),
+		maxAttempts: getEnvInt("REMINDER_MAX_ATTEMPTS", 3),
+		retryDelay:  getEnvDuration("REMINDER_RETRY_DELAY", 15*time.Minute),
+		maxLateness: getEnvDuration("REMINDER_MAX_LATENESS", 6*time.Hour),
+		notifiers:   notifiers,
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (s *ReminderScheduler) Start() {
+	channels := make([]string, 0, len(s.notifiers))
+	for channel := range s.notifiers {
+		channels = append(channels, string(channel))
+	}
+	log.Printf("[ReminderScheduler] Started, delivering over: %s", strings.Join(channels, ", "))
+
+	s.runCycle()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runCycle()
+	}
+}
+
+func (s *ReminderScheduler) runCycle() {
+	now := time.Now()
+	created, err := models.ScheduleDueReminders(now, s.maxLateness)
+	if err != nil {
+		log.Printf("[ReminderScheduler] Error scheduling reminders: %v", err)
+	}
+	if created > 0 {
+		log.Printf("[ReminderScheduler] Scheduled %d reminder(s)", created)
+	}
+
+	reminders, err := models.GetDueReminders(now, 200)
+	if err != nil {
+		log.Printf("[ReminderScheduler] Error loading due reminders: %v", err)
+		return
+	}
+	for i := range reminders {
+		if err := s.deliver(&reminders[i], now); err != nil {
+			log.Printf("[ReminderScheduler] Error delivering reminder %d: %v", reminders[i].ID, err)
+		}
+	}
+}
+
+// deliver sends one reminder unless something has changed since it was scheduled, such as
+// the appointment being cancelled or the patient withdrawing consent, or it is now too late
+// to be useful, in which case it is skipped with the reason.
+func (s *ReminderScheduler) deliver(r *models.AppointmentReminder, now time.Time) error {
+	retryAt := now.Add(s.retryDelay << r.Attempts)
+	claimed, err := models.ClaimReminderDelivery(r, now, retryAt)
+	if err != nil || !claimed {
+		return err
+	}
+
+	reason, err := reminderSkipReason(r, now)
+	if err != nil {
+		return err
+	}
+	if reason == "" && r.DueAt.Before(now.Add(-s.maxLateness)) {
+		reason = "reminder is overdue"
+	}
+	if reason != "" {
+		r.Status = models.ReminderSkipped
+		r.LastError = reason
+		r.NextAttemptAt = nil
+		return models.SaveReminderResult(r)
+	}
+
+	msg, err := RenderReminder(r.Channel, r.Rule.Subject, r.Rule.Body, r.Appointment, now)
+	if err != nil {
+		return err
+	}
+	r.Recipient, r.Subject, r.Body = msg.To, msg.Subject, msg.Body
+
+	notifier := s.notifiers[r.Channel]
+	if notifier == nil {
+		r.Status = models.ReminderFailed
+		r.LastError = fmt.Sprintf("no %s notifier is configured", r.Channel)
+		r.NextAttemptAt = nil
+		return models.SaveReminderResult(r)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	providerID, err := notifier.Send(ctx, msg)
+	if err != nil {
+		r.LastError = err.Error()
+		if r.Attempts >= s.maxAttempts {
+			r.Status = models.ReminderFailed
+			r.NextAttemptAt = nil
+		}
+		return models.SaveReminderResult(r)
+	}
+
+	sentAt := time.Now()
+	r.Status = models.ReminderSent
+	r.LastError = ""
+	r.ProviderMessageID = providerID
+	r.NextAttemptAt = nil
+	r.SentAt = &sentAt
+	return models.SaveReminderResult(r)
+}
+
+func reminderSkipReason(r *models.AppointmentReminder, now time.Time) (string, error) {
+	a := r.Appointment
+	switch {
+	case a == nil || a.DeletedAt.Valid:
+		return "appointment was deleted", nil
+	case a.Status != models.AppointmentStatusScheduled:
+		return fmt.Sprintf("appointment is %s", a.Status), nil
+	case !a.StartAt.Equal(r.AppointmentStart):
+		return "appointment was moved", nil
+	case !a.StartAt.After(now):
+		return "appointment has already started", nil
+	case r.Rule == nil || !r.Rule.Active:
+		return "reminder rule is switched off", nil
+	}
+
+	consented, err := models.HasActiveConsent(r.PatientID, models.ConsentElectronicComm)
+	if err != nil {
+		return "", err
+	}
+	if !consented {
+		return "patient has not consented to electronic communication", nil
+	}
+	if reminderRecipient(r.Channel, a.Patient) == "" {
+		if r.Channel == models.ReminderChannelEmail {
+			return "patient has no email address", nil
+		}
+		return "patient has no phone number", nil
+	}
+	return "", nil
+}
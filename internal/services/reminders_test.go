@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"github.com/rogerhendricks/goReporter/internal/testutil"
+)
+
+// fakeNotifier records the messages it is asked to send.
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []ReminderMessage
+}
+
+func (n *fakeNotifier) Channel() models.ReminderChannel { return models.ReminderChannelEmail }
+
+func (n *fakeNotifier) Send(_ context.Context, msg ReminderMessage) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, msg)
+	return "msg-1", nil
+}
+
+// setupReminderTest seeds a consenting patient and a week-ahead email rule, and returns a
+// scheduler that sends through a fake notifier.
+func setupReminderTest(t *testing.T) (*ReminderScheduler, *fakeNotifier, models.Patient, models.ReminderRule) {
+	t.Helper()
+	testutil.SetupTestEnv(t)
+	if err := config.DB.AutoMigrate(
+		&models.Appointment{},
+		&models.ReminderRule{},
+		&models.AppointmentReminder{},
+		&models.PatientConsent{},
+	); err != nil {
+		t.Fatalf("failed to migrate reminder models: %v", err)
+	}
+
+	patient := models.Patient{MRN: 4001, FirstName: "Rita", LastName: "Reminder", Email: "rita@example.com"}
+	if err := config.DB.Create(&patient).Error; err != nil {
+		t.Fatalf("failed to seed patient: %v", err)
+	}
+	consent := models.PatientConsent{PatientID: patient.ID, ConsentType: models.ConsentElectronicComm}
+	if err := models.CreateConsent(&consent); err != nil {
+		t.Fatalf("failed to seed consent: %v", err)
+	}
+	rule := models.ReminderRule{
+		Name:        "Week before",
+		HoursBefore: 7 * 24,
+		Channel:     models.ReminderChannelEmail,
+		Subject:     "Your appointment",
+		Body:        "See you soon",
+		Active:      true,
+	}
+	if err := config.DB.Create(&rule).Error; err != nil {
+		t.Fatalf("failed to seed rule: %v", err)
+	}
+
+	t.Setenv("REMINDER_MAX_LATENESS", "6h")
+	notifier := &fakeNotifier{}
+	scheduler := NewReminderSchedulerWithNotifiers(map[models.ReminderChannel]Notifier{
+		models.ReminderChannelEmail: notifier,
+	})
+	return scheduler, notifier, patient, rule
+}
+
+func seedReminderAppointment(t *testing.T, patientID uint, startAt, bookedAt time.Time) models.Appointment {
+	t.Helper()
+	appointment := models.Appointment{
+		Title:       "Device check",
+		Location:    models.AppointmentLocationClinic,
+		Status:      models.AppointmentStatusScheduled,
+		StartAt:     startAt,
+		PatientID:   patientID,
+		CreatedByID: 1,
+		CreatedAt:   bookedAt,
+	}
+	if err := config.DB.Create(&appointment).Error; err != nil {
+		t.Fatalf("failed to seed appointment: %v", err)
+	}
+	return appointment
+}
+
+func TestScheduleDueReminders_LatenessBound(t *testing.T) {
+	_, _, patient, _ := setupReminderTest(t)
+	now := time.Now()
+	monthAgo := now.AddDate(0, -1, 0)
+
+	onTime := seedReminderAppointment(t, patient.ID, now.Add(7*24*time.Hour-time.Hour), monthAgo)
+	tomorrow := seedReminderAppointment(t, patient.ID, now.Add(24*time.Hour), monthAgo)
+	past := seedReminderAppointment(t, patient.ID, now.Add(-time.Hour), monthAgo)
+
+	created, err := models.ScheduleDueReminders(now, 6*time.Hour)
+	if err != nil {
+		t.Fatalf("ScheduleDueReminders failed: %v", err)
+	}
+	if created != 1 {
+		t.Fatalf("expected 1 reminder, got %d", created)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		appointment models.Appointment
+		want        int64
+	}{
+		{"due an hour ago", onTime, 1},
+		{"due six days ago", tomorrow, 0},
+		{"already started", past, 0},
+	} {
+		var count int64
+		config.DB.Model(&models.AppointmentReminder{}).Where("appointment_id = ?", tc.appointment.ID).Count(&count)
+		if count != tc.want {
+			t.Fatalf("%s: expected %d reminder(s), got %d", tc.name, tc.want, count)
+		}
+	}
+}
+
+func TestReminderScheduler_SendsDueAndSkipsOverdue(t *testing.T) {
+	scheduler, notifier, patient, rule := setupReminderTest(t)
+	now := time.Now()
+
+	due := seedReminderAppointment(t, patient.ID, now.Add(7*24*time.Hour-time.Hour), now.AddDate(0, -1, 0))
+	// Scheduled while the appointment was a week out, then never sent
+	late := seedReminderAppointment(t, patient.ID, now.Add(5*24*time.Hour), now.AddDate(0, -1, 0))
+	queued := now.Add(-2 * 24 * time.Hour)
+	overdue := models.AppointmentReminder{
+		AppointmentID:    late.ID,
+		RuleID:           rule.ID,
+		AppointmentStart: late.StartAt,
+		PatientID:        patient.ID,
+		Channel:          models.ReminderChannelEmail,
+		Status:           models.ReminderPending,
+		DueAt:            late.StartAt.Add(-7 * 24 * time.Hour),
+		NextAttemptAt:    &queued,
+	}
+	if err := config.DB.Create(&overdue).Error; err != nil {
+		t.Fatalf("failed to seed reminder: %v", err)
+	}
+
+	scheduler.runCycle()
+
+	if len(notifier.sent) != 1 || notifier.sent[0].To != "rita@example.com" {
+		t.Fatalf("expected one email to the patient, got %+v", notifier.sent)
+	}
+
+	var sent models.AppointmentReminder
+	if err := config.DB.Where("appointment_id = ?", due.ID).First(&sent).Error; err != nil {
+		t.Fatalf("expected a reminder for the due appointment: %v", err)
+	}
+	if sent.Status != models.ReminderSent || sent.ProviderMessageID != "msg-1" {
+		t.Fatalf("expected the due reminder to be sent, got %s (%s)", sent.Status, sent.LastError)
+	}
+
+	var skipped models.AppointmentReminder
+	if err := config.DB.First(&skipped, overdue.ID).Error; err != nil {
+		t.Fatalf("failed to reload overdue reminder: %v", err)
+	}
+	if skipped.Status != models.ReminderSkipped || skipped.LastError != "reminder is overdue" {
+		t.Fatalf("expected the overdue reminder to be skipped, got %s (%s)", skipped.Status, skipped.LastError)
+	}
+}
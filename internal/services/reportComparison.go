@@ -0,0 +1,366 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// ComparisonThreshold is the change needed for a metric to count as significant. Either
+// limit may be unset.
+type ComparisonThreshold struct {
+	AbsoluteDelta *float64 `json:"absoluteDelta"`
+	PercentDelta  *float64 `json:"percentDelta"`
+}
+
+// ReportComparisonItem is one compared value. Numeric metrics carry deltas; text settings
+// only report whether they changed.
+type ReportComparisonItem struct {
+	Metric        string               `json:"metric"`
+	Label         string               `json:"label"`
+	Unit          string               `json:"unit,omitempty"`
+	Baseline      interface{}          `json:"baseline"`
+	Current       interface{}          `json:"current"`
+	AbsoluteDelta *float64             `json:"absoluteDelta"`
+	PercentDelta  *float64             `json:"percentDelta"`
+	Changed       bool                 `json:"changed"`
+	Significant   bool                 `json:"significant"`
+	Threshold     *ComparisonThreshold `json:"threshold,omitempty"`
+}
+
+// ReportComparisonGroup collects the items for one part of the interrogation.
+type ReportComparisonGroup struct {
+	Key              string                 `json:"key"`
+	Label            string                 `json:"label"`
+	SignificantCount int                    `json:"significantCount"`
+	Items            []ReportComparisonItem `json:"items"`
+}
+
+// ReportComparisonSide identifies one of the compared reports.
+type ReportComparisonSide struct {
+	ID         uint      `json:"id"`
+	ReportDate time.Time `json:"reportDate"`
+	ReportType string    `json:"reportType"`
+}
+
+// ReportComparison is the grouped comparison of two reports for the same patient.
+type ReportComparison struct {
+	PatientID        uint                    `json:"patientId"`
+	Baseline         ReportComparisonSide    `json:"baseline"`
+	Current          ReportComparisonSide    `json:"current"`
+	DaysBetween      int                     `json:"daysBetween"`
+	SignificantCount int                     `json:"significantCount"`
+	Groups           []ReportComparisonGroup `json:"groups"`
+}
+
+type comparisonMetric struct {
+	key   string
+	label string
+	unit  string
+	value func(r *models.Report) *float64
+}
+
+func intMetric(f func(r *models.Report) *int) func(r *models.Report) *float64 {
+	return func(r *models.Report) *float64 {
+		v := f(r)
+		if v == nil {
+			return nil
+		}
+		out := float64(*v)
+		return &out
+	}
+}
+
+func absThreshold(v float64) ComparisonThreshold {
+	return ComparisonThreshold{AbsoluteDelta: &v}
+}
+
+func pctThreshold(v float64) ComparisonThreshold {
+	return ComparisonThreshold{PercentDelta: &v}
+}
+
+const (
+	arrhythmiaCountMetric    = "arrhythmia_count"
+	arrhythmiaDurationMetric = "arrhythmia_duration"
+)
+
+// DefaultComparisonThresholds apply to any metric without a configured override.
+var DefaultComparisonThresholds = map[string]ComparisonThreshold{
+	"currentHeartRate":                                      absThreshold(20),
+	"qrs_duration":                                          absThreshold(20),
+	"mdc_idc_msmt_ra_impedance_mean":                        pctThreshold(30),
+	"mdc_idc_msmt_ra_sensing":                               pctThreshold(50),
+	"mdc_idc_msmt_ra_pacing_threshold":                      absThreshold(1),
+	"mdc_idc_msmt_ra_pw":                                    absThreshold(0.2),
+	"mdc_idc_stat_brady_ra_percent_paced":                   absThreshold(20),
+	"mdc_idc_msmt_rv_impedance_mean":                        pctThreshold(30),
+	"mdc_idc_msmt_rv_sensing":                               pctThreshold(50),
+	"mdc_idc_msmt_rv_pacing_threshold":                      absThreshold(1),
+	"mdc_idc_msmt_rv_pw":                                    absThreshold(0.2),
+	"mdc_idc_msmt_hv_impedance_mean":                        pctThreshold(30),
+	"mdc_idc_stat_brady_rv_percent_paced":                   absThreshold(20),
+	"mdc_idc_msmt_lv_impedance_mean":                        pctThreshold(30),
+	"mdc_idc_msmt_lv_sensing":                               pctThreshold(50),
+	"mdc_idc_msmt_lv_pacing_threshold":                      absThreshold(1),
+	"mdc_idc_msmt_lv_pw":                                    absThreshold(0.2),
+	"mdc_idc_stat_brady_lv_percent_paced":                   absThreshold(20),
+	"mdc_idc_stat_brady_biv_percent_paced":                  absThreshold(5),
+	"mdc_idc_batt_volt":                                     absThreshold(0.1),
+	"mdc_idc_batt_remaining":                                absThreshold(1),
+	"mdc_idc_batt_percentage":                               absThreshold(20),
+	"mdc_idc_cap_charge_time":                               absThreshold(2),
+	"mdc_idc_stat_ataf_burden_percent":                      absThreshold(5),
+	"episode_af_count_since_last_check":                     absThreshold(10),
+	"episode_tachy_count_since_last_check":                  absThreshold(1),
+	"episode_pause_count_since_last_check":                  absThreshold(1),
+	"episode_symptom_all_count_since_last_check":            absThreshold(1),
+	"episode_symptom_with_detection_count_since_last_check": absThreshold(1),
+	arrhythmiaCountMetric:                                   absThreshold(5),
+	arrhythmiaDurationMetric:                                pctThreshold(100),
+}
+
+type comparisonGroupSpec struct {
+	key     string
+	label   string
+	metrics []comparisonMetric
+}
+
+var comparisonGroups = []comparisonGroupSpec{
+	{"rhythm", "Rhythm", []comparisonMetric{
+		{"currentHeartRate", "Heart rate", "bpm", intMetric(func(r *models.Report) *int { return r.CurrentHeartRate })},
+		{"qrs_duration", "QRS duration", "ms", func(r *models.Report) *float64 { return r.QrsDuration }},
+	}},
+	{"ra", "Right atrium", []comparisonMetric{
+		{"mdc_idc_msmt_ra_impedance_mean", "Impedance", "Ω", func(r *models.Report) *float64 { return r.MdcIdcMsmtRaImpedanceMean }},
+		{"mdc_idc_msmt_ra_sensing", "Sensing", "mV", func(r *models.Report) *float64 { return r.MdcIdcMsmtRaSensing }},
+		{"mdc_idc_msmt_ra_pacing_threshold", "Pacing threshold", "V", func(r *models.Report) *float64 { return r.MdcIdcMsmtRaPacingThreshold }},
+		{"mdc_idc_msmt_ra_pw", "Pulse width", "ms", func(r *models.Report) *float64 { return r.MdcIdcMsmtRaPw }},
+		{"mdc_idc_stat_brady_ra_percent_paced", "Paced", "%", func(r *models.Report) *float64 { return r.MdcIdcStatBradyRaPercentPaced }},
+	}},
+	{"rv", "Right ventricle", []comparisonMetric{
+		{"mdc_idc_msmt_rv_impedance_mean", "Impedance", "Ω", func(r *models.Report) *float64 { return r.MdcIdcMsmtRvImpedanceMean }},
+		{"mdc_idc_msmt_rv_sensing", "Sensing", "mV", func(r *models.Report) *float64 { return r.MdcIdcMsmtRvSensing }},
+		{"mdc_idc_msmt_rv_pacing_threshold", "Pacing threshold", "V", func(r *models.Report) *float64 { return r.MdcIdcMsmtRvPacingThreshold }},
+		{"mdc_idc_msmt_rv_pw", "Pulse width", "ms", func(r *models.Report) *float64 { return r.MdcIdcMsmtRvPw }},
+		{"mdc_idc_msmt_hv_impedance_mean", "Shock impedance", "Ω", func(r *models.Report) *float64 { return r.MdcIdcMsmtHvImpedanceMean }},
+		{"mdc_idc_stat_brady_rv_percent_paced", "Paced", "%", func(r *models.Report) *float64 { return r.MdcIdcStatBradyRvPercentPaced }},
+	}},
+	{"lv", "Left ventricle", []comparisonMetric{
+		{"mdc_idc_msmt_lv_impedance_mean", "Impedance", "Ω", func(r *models.Report) *float64 { return r.MdcIdcMsmtLvImpedanceMean }},
+		{"mdc_idc_msmt_lv_sensing", "Sensing", "mV", func(r *models.Report) *float64 { return r.MdcIdcMsmtLvSensing }},
+		{"mdc_idc_msmt_lv_pacing_threshold", "Pacing threshold", "V", func(r *models.Report) *float64 { return r.MdcIdcMsmtLvPacingThreshold }},
+		{"mdc_idc_msmt_lv_pw", "Pulse width", "ms", func(r *models.Report) *float64 { return r.MdcIdcMsmtLvPw }},
+		{"mdc_idc_stat_brady_lv_percent_paced", "Paced", "%", func(r *models.Report) *float64 { return r.MdcIdcStatBradyLvPercentPaced }},
+		{"mdc_idc_stat_brady_biv_percent_paced", "BiV paced", "%", func(r *models.Report) *float64 { return r.MdcIdcStatBradyBivPercentPaced }},
+	}},
+	{"battery", "Battery", []comparisonMetric{
+		{"mdc_idc_batt_volt", "Voltage", "V", func(r *models.Report) *float64 { return r.MdcIdcBattVolt }},
+		{"mdc_idc_batt_remaining", "Remaining longevity", "years", func(r *models.Report) *float64 { return r.MdcIdcBattRemaining }},
+		{"mdc_idc_batt_percentage", "Remaining", "%", func(r *models.Report) *float64 { return r.MdcIdcBattPercentage }},
+		{"mdc_idc_cap_charge_time", "Charge time", "s", func(r *models.Report) *float64 { return r.MdcIdcCapChargeTime }},
+	}},
+	{"episodes", "Episodes", []comparisonMetric{
+		{"mdc_idc_stat_ataf_burden_percent", "AT/AF burden", "%", func(r *models.Report) *float64 { return r.MdcIdcStatAtafBurdenPercent }},
+		{"episode_af_count_since_last_check", "AF episodes", "", intMetric(func(r *models.Report) *int { return r.EpisodeAfCountSinceLastCheck })},
+		{"episode_tachy_count_since_last_check", "Tachy episodes", "", intMetric(func(r *models.Report) *int { return r.EpisodeTachyCountSinceLastCheck })},
+		{"episode_pause_count_since_last_check", "Pause episodes", "", intMetric(func(r *models.Report) *int { return r.EpisodePauseCountSinceLastCheck })},
+		{"episode_symptom_all_count_since_last_check", "Symptom episodes", "", intMetric(func(r *models.Report) *int { return r.EpisodeSymptomAllCountSinceLastCheck })},
+		{"episode_symptom_with_detection_count_since_last_check", "Symptom episodes with detection", "", intMetric(func(r *models.Report) *int { return r.EpisodeSymptomWithDetectionCountSinceLastCheck })},
+	}},
+}
+
+// IsComparisonMetric reports whether a threshold can be configured for the metric key.
+func IsComparisonMetric(metric string) bool {
+	_, ok := DefaultComparisonThresholds[metric]
+	return ok
+}
+
+// ResolveComparisonThresholds merges configured overrides with the defaults.
+func ResolveComparisonThresholds() (map[string]ComparisonThreshold, error) {
+	configured, err := models.GetReportComparisonThresholds()
+	if err != nil {
+		return nil, err
+	}
+	resolved := make(map[string]ComparisonThreshold, len(DefaultComparisonThresholds))
+	for metric, threshold := range DefaultComparisonThresholds {
+		resolved[metric] = threshold
+	}
+	for metric, t := range configured {
+		resolved[metric] = ComparisonThreshold{AbsoluteDelta: t.AbsoluteDelta, PercentDelta: t.PercentDelta}
+	}
+	return resolved, nil
+}
+
+func roundDelta(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func numericComparisonItem(metric, label, unit string, baseline, current *float64, threshold *ComparisonThreshold) ReportComparisonItem {
+	item := ReportComparisonItem{Metric: metric, Label: label, Unit: unit, Baseline: baseline, Current: current, Threshold: threshold}
+	if baseline == nil || current == nil {
+		item.Changed = (baseline == nil) != (current == nil)
+		return item
+	}
+
+	abs := roundDelta(*current - *baseline)
+	item.AbsoluteDelta = &abs
+	item.Changed = abs != 0
+	if *baseline != 0 {
+		pct := roundDelta((*current - *baseline) / math.Abs(*baseline) * 100)
+		item.PercentDelta = &pct
+	}
+
+	if threshold != nil && item.Changed {
+		if threshold.AbsoluteDelta != nil && math.Abs(abs) >= *threshold.AbsoluteDelta {
+			item.Significant = true
+		}
+		if threshold.PercentDelta != nil && item.PercentDelta != nil && math.Abs(*item.PercentDelta) >= *threshold.PercentDelta {
+			item.Significant = true
+		}
+	}
+	return item
+}
+
+// textComparisonItem compares a text setting. A change is significant only when the value
+// was recorded on both reports.
+func textComparisonItem(metric, label string, baseline, current *string) ReportComparisonItem {
+	prev, curr := textValue(baseline), textValue(current)
+	changed := !strings.EqualFold(textOrEmpty(prev), textOrEmpty(curr))
+	return ReportComparisonItem{
+		Metric:      metric,
+		Label:       label,
+		Baseline:    prev,
+		Current:     curr,
+		Changed:     changed,
+		Significant: changed && prev != nil && curr != nil,
+	}
+}
+
+func textValue(v *string) *string {
+	if v == nil || strings.TrimSpace(*v) == "" {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*v)
+	return &trimmed
+}
+
+func textOrEmpty(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+// arrhythmiaTotals sums arrhythmia counts and durations per type, falling back to the name.
+func arrhythmiaTotals(arrhythmias []models.Arrhythmia) (map[string]*float64, map[string]*float64) {
+	counts := make(map[string]*float64)
+	durations := make(map[string]*float64)
+	add := func(m map[string]*float64, key string, v *int) {
+		if v == nil {
+			return
+		}
+		if m[key] == nil {
+			m[key] = new(float64)
+		}
+		*m[key] += float64(*v)
+	}
+	for _, a := range arrhythmias {
+		key := strings.TrimSpace(a.Type)
+		if key == "" {
+			key = strings.TrimSpace(a.Name)
+		}
+		if key == "" {
+			continue
+		}
+		add(counts, key, a.Count)
+		add(durations, key, a.Duration)
+	}
+	return counts, durations
+}
+
+// CompareReports builds a grouped comparison of two reports. Settings count as significant
+// whenever they change; numeric metrics use the configured or default thresholds.
+func CompareReports(baseline, current *models.Report) (*ReportComparison, error) {
+	thresholds, err := ResolveComparisonThresholds()
+	if err != nil {
+		return nil, err
+	}
+	thresholdFor := func(metric string) *ComparisonThreshold {
+		if t, ok := thresholds[metric]; ok {
+			return &t
+		}
+		return nil
+	}
+
+	comparison := &ReportComparison{
+		PatientID:   current.PatientID,
+		Baseline:    ReportComparisonSide{ID: baseline.ID, ReportDate: baseline.ReportDate, ReportType: baseline.ReportType},
+		Current:     ReportComparisonSide{ID: current.ID, ReportDate: current.ReportDate, ReportType: current.ReportType},
+		DaysBetween: int(math.Round(current.ReportDate.Sub(baseline.ReportDate).Hours() / 24)),
+	}
+
+	for _, spec := range comparisonGroups {
+		group := ReportComparisonGroup{Key: spec.key, Label: spec.label, Items: []ReportComparisonItem{}}
+		for _, m := range spec.metrics {
+			group.Items = append(group.Items, numericComparisonItem(m.key, m.label, m.unit, m.value(baseline), m.value(current), thresholdFor(m.key)))
+		}
+		if spec.key == "battery" {
+			group.Items = append(group.Items, textComparisonItem("mdc_idc_batt_status", "Status", baseline.MdcIdcBattStatus, current.MdcIdcBattStatus))
+		}
+		comparison.Groups = append(comparison.Groups, group)
+	}
+
+	settings := ReportComparisonGroup{Key: "settings", Label: "Settings", Items: []ReportComparisonItem{}}
+	for _, s := range models.ProgrammingSettings {
+		settings.Items = append(settings.Items, textComparisonItem(s.Setting, s.Label, s.Value(baseline), s.Value(current)))
+	}
+	comparison.Groups = append(comparison.Groups, settings)
+
+	arrhythmias := ReportComparisonGroup{Key: "arrhythmias", Label: "Arrhythmias", Items: []ReportComparisonItem{}}
+	baseCounts, baseDurations := arrhythmiaTotals(baseline.Arrhythmias)
+	currCounts, currDurations := arrhythmiaTotals(current.Arrhythmias)
+	types := make(map[string]bool)
+	for _, m := range []map[string]*float64{baseCounts, baseDurations, currCounts, currDurations} {
+		for key := range m {
+			types[key] = true
+		}
+	}
+	sortedTypes := make([]string, 0, len(types))
+	for key := range types {
+		sortedTypes = append(sortedTypes, key)
+	}
+	sort.Strings(sortedTypes)
+	zeroIfMissing := func(v *float64) *float64 {
+		if v == nil {
+			return new(float64)
+		}
+		return v
+	}
+	for _, key := range sortedTypes {
+		// A type recorded on only one report counts as zero on the other
+		if baseCounts[key] != nil || currCounts[key] != nil {
+			baseCounts[key], currCounts[key] = zeroIfMissing(baseCounts[key]), zeroIfMissing(currCounts[key])
+		}
+		if baseDurations[key] != nil || currDurations[key] != nil {
+			baseDurations[key], currDurations[key] = zeroIfMissing(baseDurations[key]), zeroIfMissing(currDurations[key])
+		}
+		arrhythmias.Items = append(arrhythmias.Items,
+			numericComparisonItem(arrhythmiaCountMetric+":"+key, key+" count", "", baseCounts[key], currCounts[key], thresholdFor(arrhythmiaCountMetric)),
+			numericComparisonItem(arrhythmiaDurationMetric+":"+key, key+" duration", "s", baseDurations[key], currDurations[key], thresholdFor(arrhythmiaDurationMetric)),
+		)
+	}
+	comparison.Groups = append(comparison.Groups, arrhythmias)
+
+	for i := range comparison.Groups {
+		for _, item := range comparison.Groups[i].Items {
+			if item.Significant {
+				comparison.Groups[i].SignificantCount++
+			}
+		}
+		comparison.SignificantCount += comparison.Groups[i].SignificantCount
+	}
+	return comparison, nil
+}
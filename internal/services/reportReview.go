@@ -0,0 +1,365 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
+)
+
+// Lead impedance limits (ohms) outside which a report is prioritized for review.
+const (
+	leadImpedanceMin  = 200.0
+	leadImpedanceMax  = 2000.0
+	shockImpedanceMin = 20.0
+	shockImpedanceMax = 200.0
+)
+
+// ReportClaimTTL is how long a review claim lasts before others can take the report over.
+func ReportClaimTTL() time.Duration {
+	return getEnvDuration("REPORT_REVIEW_CLAIM_TTL", 2*time.Hour)
+}
+
+// DeriveReportPriority scores a report's content and returns the review priority with the
+// findings that drove it.
+func DeriveReportPriority(report *models.Report) (models.TaskPriority, []string) {
+	priority := models.TaskPriorityLow
+	reasons := []string{}
+	raise := func(p models.TaskPriority, reason string) {
+		if models.TaskPriorityRank(p) > models.TaskPriorityRank(priority) {
+			priority = p
+		}
+		reasons = append(reasons, reason)
+	}
+
+	if report.MdcIdcBattStatus != nil {
+		status := strings.ToUpper(strings.TrimSpace(*report.MdcIdcBattStatus))
+		if status == "ERI" || status == "EOL" {
+			raise(models.TaskPriorityUrgent, "Battery at "+status)
+		}
+	}
+	for _, a := range report.Arrhythmias {
+		kind := strings.ToUpper(a.Type + " " + a.Name)
+		if strings.Contains(kind, "VT") || strings.Contains(kind, "VF") {
+			raise(models.TaskPriorityUrgent, "Ventricular arrhythmia recorded")
+			break
+		}
+	}
+
+	if report.MdcIdcBattPercentage != nil && *report.MdcIdcBattPercentage < 20 {
+		raise(models.TaskPriorityHigh, fmt.Sprintf("Battery %.0f%%", *report.MdcIdcBattPercentage))
+	}
+	if report.MdcIdcStatAtafBurdenPercent != nil && *report.MdcIdcStatAtafBurdenPercent >= AFBurdenThreshold() {
+		raise(models.TaskPriorityHigh, fmt.Sprintf("AT/AF burden %.1f%%", *report.MdcIdcStatAtafBurdenPercent))
+	}
+	if report.EpisodeTachyCountSinceLastCheck != nil && *report.EpisodeTachyCountSinceLastCheck > 0 {
+		raise(models.TaskPriorityHigh, fmt.Sprintf("%d tachy episodes", *report.EpisodeTachyCountSinceLastCheck))
+	}
+	if report.EpisodePauseCountSinceLastCheck != nil && *report.EpisodePauseCountSinceLastCheck > 0 {
+		raise(models.TaskPriorityHigh, fmt.Sprintf("%d pause episodes", *report.EpisodePauseCountSinceLastCheck))
+	}
+	leads := []struct {
+		name     string
+		value    *float64
+		min, max float64
+	}{
+		{"RA", report.MdcIdcMsmtRaImpedanceMean, leadImpedanceMin, leadImpedanceMax},
+		{"RV", report.MdcIdcMsmtRvImpedanceMean, leadImpedanceMin, leadImpedanceMax},
+		{"LV", report.MdcIdcMsmtLvImpedanceMean, leadImpedanceMin, leadImpedanceMax},
+		{"Shock", report.MdcIdcMsmtHvImpedanceMean, shockImpedanceMin, shockImpedanceMax},
+	}
+	for _, lead := range leads {
+		if lead.value != nil && *lead.value > 0 && (*lead.value < lead.min || *lead.value > lead.max) {
+			raise(models.TaskPriorityHigh, fmt.Sprintf("%s impedance %.0f ohms", lead.name, *lead.value))
+		}
+	}
+
+	if report.EpisodeSymptomAllCountSinceLastCheck != nil && *report.EpisodeSymptomAllCountSinceLastCheck > 0 {
+		raise(models.TaskPriorityMedium, fmt.Sprintf("%d symptom episodes", *report.EpisodeSymptomAllCountSinceLastCheck))
+	}
+
+	return priority, reasons
+}
+
+// ReportReviewDueBy returns when review of a report is due: the turnaround target for its type
+// counted from ReportDate, capped at 24 hours for urgent reports.
+func ReportReviewDueBy(report *models.Report, priority models.TaskPriority) time.Time {
+	start := report.ReportDate
+	if start.IsZero() {
+		start = report.CreatedAt
+	}
+	hours := models.ReportTurnaroundHours(report.ReportType)
+	if priority == models.TaskPriorityUrgent && hours > 24 {
+		hours = 24
+	}
+	return start.Add(time.Duration(hours) * time.Hour)
+}
+
+// SyncReportReview creates or refreshes the review queue entry for a report and closes it
+// once the report is completed.
+func SyncReportReview(report *models.Report) error {
+	var existing models.ReportReviewItem
+	err := config.DB.Select("id", "status").Where("report_id = ?", report.ID).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	alreadyCompleted := err == nil && existing.Status == models.ReportReviewCompleted
+	completed := report.IsCompleted != nil && *report.IsCompleted
+
+	priority, reasons := DeriveReportPriority(report)
+	item := models.ReportReviewItem{
+		ReportID:        report.ID,
+		PatientID:       report.PatientID,
+		Priority:        priority,
+		PriorityReasons: models.StringArray(reasons),
+		DueBy:           ReportReviewDueBy(report, priority),
+		Status:          models.ReportReviewPending,
+	}
+	if completed {
+		item.Status = models.ReportReviewCompleted
+	}
+	if err := models.SaveReportReviewItem(&item); err != nil {
+		return err
+	}
+
+	if completed && !alreadyCompleted {
+		start := report.ReportDate
+		if start.IsZero() {
+			start = report.CreatedAt
+		}
+		return models.CompleteReportReview(report.ID, report.CompletedByUserID, start, time.Now())
+	}
+	return nil
+}
+
+// ReportReviewMonitor keeps the review queue in step with reports: it queues incomplete
+// reports that have no entry yet and returns expired claims to the queue.
+type ReportReviewMonitor struct {
+	interval time.Duration
+}
+
+// NewReportReviewMonitor configures the monitor from the environment.
+func NewReportReviewMonitor() *ReportReviewMonitor {
+	return &ReportReviewMonitor{
+		interval: getEnvDuration("REPORT_REVIEW_SYNC_INTERVAL", 15*time.Minute),
+	}
+}
+
+// Start runs a sync immediately and then on every interval.
+func (m *ReportReviewMonitor) Start() {
+	m.runCycle()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.runCycle()
+	}
+}
+
+func (m *ReportReviewMonitor) runCycle() {
+	queued, err := m.queueMissingReports()
+	if err != nil {
+		log.Printf("[ReportReviewMonitor] Failed to queue reports: %v", err)
+	} else if queued > 0 {
+		log.Printf("[ReportReviewMonitor] Queued %d reports for review", queued)
+	}
+
+	result := config.DB.Model(&models.ReportReviewItem{}).
+		Where("status = ? AND claim_expires_at < ?", models.ReportReviewInReview, time.Now()).
+		Updates(map[string]interface{}{
+			"status":           models.ReportReviewPending,
+			"claimed_by_id":    nil,
+			"claimed_at":       nil,
+			"claim_expires_at": nil,
+		})
+	if result.Error != nil {
+		log.Printf("[ReportReviewMonitor] Failed to release expired claims: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[ReportReviewMonitor] Released %d expired claims", result.RowsAffected)
+	}
+}
+
+func (m *ReportReviewMonitor) queueMissingReports() (int, error) {
+	var reports []models.Report
+	err := config.DB.Preload("Arrhythmias").
+		Joins("LEFT JOIN report_review_items ON report_review_items.report_id = reports.id").
+		Where("report_review_items.id IS NULL").
+		Where("reports.is_completed IS NULL OR reports.is_completed = ?", false).
+		Find(&reports).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range reports {
+		if err := SyncReportReview(&reports[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(reports), nil
+}
+
+// TurnaroundStat summarizes completed reviews for one user, team or the whole clinic.
+type TurnaroundStat struct {
+	ID                  uint    `json:"id,omitempty"`
+	Name                string  `json:"name,omitempty"`
+	Completed           int     `json:"completed"`
+	AverageHours        float64 `json:"averageHours"`
+	MedianHours         float64 `json:"medianHours"`
+	WithinTarget        int     `json:"withinTarget"`
+	WithinTargetPercent float64 `json:"withinTargetPercent"`
+}
+
+// TurnaroundMetrics reports time from ReportDate to completion over a date range.
+type TurnaroundMetrics struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Overall TurnaroundStat   `json:"overall"`
+	ByUser  []TurnaroundStat `json:"byUser"`
+	ByTeam  []TurnaroundStat `json:"byTeam"`
+}
+
+type turnaroundAccumulator struct {
+	name   string
+	hours  []float64
+	onTime int
+}
+
+func (a *turnaroundAccumulator) add(hours float64, onTime bool) {
+	a.hours = append(a.hours, hours)
+	if onTime {
+		a.onTime++
+	}
+}
+
+func (a *turnaroundAccumulator) stat(id uint) TurnaroundStat {
+	s := TurnaroundStat{ID: id, Name: a.name, Completed: len(a.hours), WithinTarget: a.onTime}
+	if len(a.hours) == 0 {
+		return s
+	}
+	sorted := append([]float64(nil), a.hours...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, h := range sorted {
+		sum += h
+	}
+	s.AverageHours = roundOneDecimal(sum / float64(len(sorted)))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		s.MedianHours = roundOneDecimal((sorted[mid-1] + sorted[mid]) / 2)
+	} else {
+		s.MedianHours = roundOneDecimal(sorted[mid])
+	}
+	s.WithinTargetPercent = roundOneDecimal(float64(a.onTime) * 100 / float64(len(sorted)))
+	return s
+}
+
+func roundOneDecimal(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// ReportTurnaroundMetrics computes review turnaround for reviews completed between from and to.
+// Reviews count toward their assigned team, or toward every team the completing user belongs
+// to when no team was assigned.
+func ReportTurnaroundMetrics(from, to time.Time) (*TurnaroundMetrics, error) {
+	var items []models.ReportReviewItem
+	err := config.DB.Preload("CompletedBy").Preload("Team").
+		Where("status = ? AND completed_at >= ? AND completed_at < ?", models.ReportReviewCompleted, from, to).
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var memberships []struct {
+		UserID uint
+		TeamID uint
+		Name   string
+	}
+	err = config.DB.Table("team_members").
+		Select("team_members.user_id, team_members.team_id, teams.name").
+		Joins("JOIN teams ON teams.id = team_members.team_id AND teams.deleted_at IS NULL").
+		Scan(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	userTeams := make(map[uint][]uint)
+	teamNames := make(map[uint]string)
+	for _, m := range memberships {
+		userTeams[m.UserID] = append(userTeams[m.UserID], m.TeamID)
+		teamNames[m.TeamID] = m.Name
+	}
+
+	overall := &turnaroundAccumulator{}
+	byUser := make(map[uint]*turnaroundAccumulator)
+	byTeam := make(map[uint]*turnaroundAccumulator)
+	accumulate := func(m map[uint]*turnaroundAccumulator, id uint, name string, hours float64, onTime bool) {
+		acc, ok := m[id]
+		if !ok {
+			acc = &turnaroundAccumulator{name: name}
+			m[id] = acc
+		}
+		acc.add(hours, onTime)
+	}
+
+	for _, item := range items {
+		if item.TurnaroundHours == nil || item.CompletedAt == nil {
+			continue
+		}
+		hours := *item.TurnaroundHours
+		onTime := !item.CompletedAt.After(item.DueBy)
+		overall.add(hours, onTime)
+
+		if item.CompletedByID != nil {
+			name := fmt.Sprintf("User #%d", *item.CompletedByID)
+			if item.CompletedBy != nil {
+				name = item.CompletedBy.FullName
+				if name == "" {
+					name = item.CompletedBy.Username
+				}
+			}
+			accumulate(byUser, *item.CompletedByID, name, hours, onTime)
+		}
+
+		switch {
+		case item.TeamID != nil:
+			name := teamNames[*item.TeamID]
+			if item.Team != nil {
+				name = item.Team.Name
+			}
+			accumulate(byTeam, *item.TeamID, name, hours, onTime)
+		case item.CompletedByID != nil:
+			for _, teamID := range userTeams[*item.CompletedByID] {
+				accumulate(byTeam, teamID, teamNames[teamID], hours, onTime)
+			}
+		}
+	}
+
+	metrics := &TurnaroundMetrics{
+		From:    from,
+		To:      to,
+		Overall: overall.stat(0),
+		ByUser:  collectTurnaroundStats(byUser),
+		ByTeam:  collectTurnaroundStats(byTeam),
+	}
+	return metrics, nil
+}
+
+func collectTurnaroundStats(m map[uint]*turnaroundAccumulator) []TurnaroundStat {
+	stats := make([]TurnaroundStat, 0, len(m))
+	for id, acc := range m {
+		stats = append(stats, acc.stat(id))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Completed != stats[j].Completed {
+			return stats[i].Completed > stats[j].Completed
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// SlotReconciler periodically recomputes clinic slot booked counts from the appointments
+// booked into them, repairing counts left wrong by failures or older code.
+type SlotReconciler struct {
+	interval time.Duration
+}
+
+// NewSlotReconciler configures the reconciler from SLOT_RECONCILE_INTERVAL (default 1h).
+func NewSlotReconciler() *SlotReconciler {
+	return &SlotReconciler{
+		interval: getEnvDuration("SLOT_RECONCILE_INTERVAL", time.Hour),
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (r *SlotReconciler) Start() {
+	r.runCycle()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.runCycle()
+	}
+}
+
+func (r *SlotReconciler) runCycle() {
+	fixed, err := models.ReconcileSlotBookings()
+	if err != nil {
+		log.Printf("[SlotReconciler] Error reconciling slot bookings: %v", err)
+		return
+	}
+	if fixed > 0 {
+		log.Printf("[SlotReconciler] Corrected booked counts of %d slots", fixed)
+	}
+}
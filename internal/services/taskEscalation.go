@@ -0,0 +1,309 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+	"gorm.io/gorm"
+)
+
+// WebhookTrigger sends a webhook event; main wires in the handlers' webhook service.
+type WebhookTrigger func(event models.WebhookEvent, data map[string]interface{})
+
+// TaskEscalationMonitor applies escalation policies to open overdue tasks.
+type TaskEscalationMonitor struct {
+	interval time.Duration
+	trigger  WebhookTrigger
+}
+
+// NewTaskEscalationMonitor configures the monitor from the environment. trigger may be nil.
+func NewTaskEscalationMonitor(trigger WebhookTrigger) *TaskEscalationMonitor {
+	return &TaskEscalationMonitor{
+		interval: getEnvDuration("TASK_ESCALATION_INTERVAL", 15*time.Minute),
+		trigger:  trigger,
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (m *TaskEscalationMonitor) Start() {
+	m.runCycle()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.runCycle()
+	}
+}
+
+// taskEscalationResult is what an applied step changed, for notifications after commit.
+type taskEscalationResult struct {
+	escalation models.TaskEscalation
+	notifyIDs  []uint
+}
+
+func (m *TaskEscalationMonitor) runCycle() {
+	policies, err := models.GetTaskEscalationPolicies()
+	if err != nil {
+		log.Printf("[TaskEscalationMonitor] Failed to load policies: %v", err)
+		return
+	}
+	minHours := 0
+	for _, policy := range policies {
+		if policy.Enabled && len(policy.Steps) > 0 && (minHours == 0 || policy.Steps[0].AfterHours < minHours) {
+			minHours = policy.Steps[0].AfterHours
+		}
+	}
+	if minHours == 0 {
+		return
+	}
+
+	now := time.Now()
+	tasks, err := models.GetOverdueOpenTasks(now.Add(-time.Duration(minHours) * time.Hour))
+	if err != nil {
+		log.Printf("[TaskEscalationMonitor] Failed to load overdue tasks: %v", err)
+		return
+	}
+
+	applied := 0
+	for i := range tasks {
+		task := &tasks[i]
+		policy := models.SelectTaskEscalationPolicy(policies, task)
+		if policy == nil {
+			continue
+		}
+		overdue := now.Sub(*task.DueDate)
+		for index, step := range policy.Steps {
+			if overdue < time.Duration(step.AfterHours)*time.Hour {
+				break
+			}
+			result, err := applyEscalationStep(task, policy, index, int(overdue.Hours()))
+			if err != nil {
+				log.Printf("[TaskEscalationMonitor] Failed to escalate task %d: %v", task.ID, err)
+				break
+			}
+			if result != nil {
+				applied++
+				m.announce(task, policy, result)
+			}
+		}
+	}
+	if applied > 0 {
+		log.Printf("[TaskEscalationMonitor] Applied %d escalation step(s)", applied)
+	}
+}
+
+// applyEscalationStep runs one policy step on task and records it with a task note. It
+// returns nil when the step was already applied for the task's current due date. task is
+// updated in place.
+func applyEscalationStep(task *models.Task, policy *models.TaskEscalationPolicy, index int, overdueHours int) (*taskEscalationResult, error) {
+	step := policy.Steps[index]
+	result := &taskEscalationResult{escalation: models.TaskEscalation{
+		TaskID:       task.ID,
+		PolicyID:     policy.ID,
+		StepIndex:    index,
+		DueDate:      *task.DueDate,
+		Action:       step.Action,
+		OverdueHours: overdueHours,
+	}}
+
+	// Work out the step's effect before writing so the transaction only holds writes.
+	var detail string
+	var assignment *models.TeamAssignment
+	updates := map[string]interface{}{}
+	switch step.Action {
+	case models.EscalationNotifyAssignee:
+		result.notifyIDs = taskAssignees(task)
+		if len(result.notifyIDs) == 0 {
+			detail = "No assignee to notify"
+		} else {
+			detail = fmt.Sprintf("Notified %s", userNames(result.notifyIDs))
+		}
+	case models.EscalationReassignManager:
+		managerID, err := escalationManager(task)
+		if err != nil {
+			return nil, err
+		}
+		if managerID == nil {
+			detail = "No team manager to reassign to"
+			break
+		}
+		updates["assigned_to_id"] = *managerID
+		updates["assigned_to_team_id"] = nil
+		updates["assignment_reason"] = ""
+		result.notifyIDs = []uint{*managerID}
+		detail = fmt.Sprintf("Reassigned to team manager %s", userNames(result.notifyIDs))
+	case models.EscalationReassignTeam:
+		if task.AssignedToTeamID == nil {
+			detail = "No team to reassign within"
+			break
+		}
+		var err error
+		assignment, err = models.PickTeamAssignee(config.DB, *task.AssignedToTeamID, task.Tags, task.AssignedToID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if assignment == nil {
+			detail = "Team assigns its tasks manually"
+			break
+		}
+		detail = assignment.Reason
+		if assignment.UserID == nil {
+			break
+		}
+		updates["assigned_to_id"] = *assignment.UserID
+		updates["assignment_reason"] = assignment.Reason
+		result.notifyIDs = []uint{*assignment.UserID}
+	case models.EscalationRaisePriority:
+		if models.TaskPriorityRank(task.Priority) >= models.TaskPriorityRank(step.Priority) {
+			detail = fmt.Sprintf("Priority already %s", task.Priority)
+			break
+		}
+		updates["priority"] = step.Priority
+		result.notifyIDs = taskAssignees(task)
+		detail = fmt.Sprintf("Priority raised from %s to %s", task.Priority, step.Priority)
+	}
+	result.escalation.Detail = detail
+
+	claimed := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		claimed, err = models.ClaimTaskEscalation(tx, &result.escalation)
+		if err != nil || !claimed {
+			return err
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&models.Task{}).Where("id = ?", task.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if assignment != nil {
+			if err := assignment.Record(tx); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&models.TaskNote{
+			TaskID:      task.ID,
+			Content:     fmt.Sprintf("[Escalation] Overdue by %dh under policy \"%s\": %s.", overdueHours, policy.Name, detail),
+			CreatedByID: policy.CreatedByID,
+		}).Error
+	})
+	if err != nil || !claimed {
+		return nil, err
+	}
+
+	if id, ok := updates["assigned_to_id"].(uint); ok {
+		task.AssignedToID = &id
+		task.AssignmentReason, _ = updates["assignment_reason"].(string)
+		if _, cleared := updates["assigned_to_team_id"]; cleared {
+			task.AssignedToTeamID = nil
+		}
+	}
+	if priority, ok := updates["priority"].(models.TaskPriority); ok {
+		task.Priority = priority
+	}
+	return result, nil
+}
+
+// announce notifies the affected users and admins and fires the task.escalated webhook.
+func (m *TaskEscalationMonitor) announce(task *models.Task, policy *models.TaskEscalationPolicy, result *taskEscalationResult) {
+	taskID := task.ID
+	escalation := result.escalation
+	event := NotificationEvent{
+		Type:     "task.escalated",
+		Title:    "Overdue task escalated",
+		Message:  fmt.Sprintf("'%s' is %dh overdue: %s", task.Title, escalation.OverdueHours, escalation.Detail),
+		Severity: "warning",
+		TaskID:   &taskID,
+	}
+	for _, userID := range result.notifyIDs {
+		NotificationsHub.SendToUser(userID, event)
+	}
+	if escalation.Action != models.EscalationNotifyAssignee {
+		NotificationsHub.BroadcastToAdmins(event)
+	}
+
+	if m.trigger != nil {
+		m.trigger(models.EventTaskEscalated, map[string]interface{}{
+			"taskId":       task.ID,
+			"title":        task.Title,
+			"priority":     task.Priority,
+			"dueDate":      task.DueDate,
+			"patientId":    task.PatientID,
+			"assignedTo":   task.AssignedToID,
+			"policy":       policy.Name,
+			"action":       escalation.Action,
+			"overdueHours": escalation.OverdueHours,
+			"detail":       escalation.Detail,
+		})
+	}
+}
+
+// taskAssignees returns the assigned user, or for a team task its manager or members.
+func taskAssignees(task *models.Task) []uint {
+	if task.AssignedToID != nil {
+		return []uint{*task.AssignedToID}
+	}
+	if task.AssignedToTeamID == nil {
+		return nil
+	}
+	team, err := models.GetTeamByID(*task.AssignedToTeamID)
+	if err != nil {
+		return nil
+	}
+	if team.ManagerID != nil {
+		return []uint{*team.ManagerID}
+	}
+	ids := make([]uint, 0, len(team.Members))
+	for _, member := range team.Members {
+		ids = append(ids, member.ID)
+	}
+	return ids
+}
+
+// escalationManager finds the manager to hand a task to: the assigned team's manager, or
+// the manager of a team the assignee belongs to. It returns nil when there is none, or when
+// the manager already has the task.
+func escalationManager(task *models.Task) (*uint, error) {
+	var managerIDs []uint
+	query := config.DB.Model(&models.Team{}).Where("manager_id IS NOT NULL")
+	switch {
+	case task.AssignedToTeamID != nil:
+		query = query.Where("id = ?", *task.AssignedToTeamID)
+	case task.AssignedToID != nil:
+		query = query.Where("id IN (?) AND manager_id <> ?",
+			config.DB.Table("team_members").Select("team_id").Where("user_id = ?", *task.AssignedToID),
+			*task.AssignedToID)
+	default:
+		return nil, nil
+	}
+	if err := query.Order("id ASC").Limit(1).Pluck("manager_id", &managerIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(managerIDs) == 0 {
+		return nil, nil
+	}
+	return &managerIDs[0], nil
+}
+
+// userNames formats users for escalation notes, preferring full names.
+func userNames(ids []uint) string {
+	var users []models.User
+	if err := config.DB.Select("id", "username", "full_name").Where("id IN ?", ids).Find(&users).Error; err != nil || len(users) == 0 {
+		return fmt.Sprintf("%d user(s)", len(ids))
+	}
+	names := ""
+	for i, user := range users {
+		if i > 0 {
+			names += ", "
+		}
+		if user.FullName != "" {
+			names += user.FullName
+		} else {
+			names += user.Username
+		}
+	}
+	return names
+}
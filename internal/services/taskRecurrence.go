@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// maxOccurrencesPerCycle bounds how far one cycle catches up a series after downtime.
+const maxOccurrencesPerCycle = 50
+
+// TaskRecurrenceScheduler creates the next occurrence of recurring tasks when its date
+// arrives, even if the previous occurrence is still open.
+type TaskRecurrenceScheduler struct {
+	interval time.Duration
+	leadTime time.Duration
+}
+
+// NewTaskRecurrenceScheduler configures the scheduler from the environment.
+// TASK_RECURRENCE_LEAD_DAYS creates occurrences that many days before they are due.
+func NewTaskRecurrenceScheduler() *TaskRecurrenceScheduler {
+	return &TaskRecurrenceScheduler{
+		interval: getEnvDuration("TASK_RECURRENCE_INTERVAL", 15*time.Minute),
+		leadTime: 24 * time.Hour * time.Duration(getEnvInt("TASK_RECURRENCE_LEAD_DAYS", 0)),
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (s *TaskRecurrenceScheduler) Start() {
+	s.runCycle()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runCycle()
+	}
+}
+
+func (s *TaskRecurrenceScheduler) runCycle() {
+	cutoff := time.Now().Add(s.leadTime)
+	due, err := models.GetDueTaskSeries(cutoff)
+	if err != nil {
+		log.Printf("[TaskRecurrenceScheduler] Failed to load due series: %v", err)
+		return
+	}
+
+	created := 0
+	for _, series := range due {
+		index := series.NextIndex
+		for i := 0; i < maxOccurrencesPerCycle; i++ {
+			task, err := CreateNextTaskOccurrence(series.ID, index)
+			if err != nil {
+				log.Printf("[TaskRecurrenceScheduler] Failed to create occurrence %d of series %d: %v", index, series.ID, err)
+				break
+			}
+			if task == nil {
+				break
+			}
+			created++
+			index++
+
+			next, err := models.GetTaskSeries(series.ID)
+			if err != nil || next == nil || next.NextDueDate == nil || next.NextDueDate.After(cutoff) {
+				break
+			}
+		}
+	}
+	if created > 0 {
+		log.Printf("[TaskRecurrenceScheduler] Created %d recurring task occurrence(s)", created)
+	}
+}
+
+// CreateNextTaskOccurrence creates occurrence index of a series and tells the assignee.
+// It returns nil when the occurrence already exists or the series has ended.
+func CreateNextTaskOccurrence(seriesID uint, index int) (*models.Task, error) {
+	task, err := models.CreateNextSeriesOccurrence(seriesID, index)
+	if err != nil || task == nil {
+		return task, err
+	}
+
+	if task.AssignedToID != nil {
+		taskID := task.ID
+		NotificationsHub.SendToUser(*task.AssignedToID, NotificationEvent{
+			Type:    "task.recurring",
+			Title:   "Recurring task created",
+			Message: fmt.Sprintf("'%s' is due %s", task.Title, task.DueDate.Format("2006-01-02")),
+			TaskID:  &taskID,
+		})
+	}
+	return task, nil
+}
@@ -182,3 +182,13 @@ func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			return parsed
+		}
+		log.Printf("[TemporaryAccessMonitor] Invalid float for %s: %s", key, val)
+	}
+	return fallback
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rogerhendricks/goReporter/internal/config"
+	"github.com/rogerhendricks/goReporter/internal/models"
+)
+
+// OfferFreedSlot offers each free place in the slot to the waitlist, holding it for
+// WAITLIST_HOLD_MINUTES. Every offer becomes a task for whoever added the patient to the
+// waitlist, so they can phone the patient before the hold runs out.
+func OfferFreedSlot(slotID uint, now time.Time) ([]models.WaitlistOffer, error) {
+	hold := time.Duration(config.LoadConfig().WaitlistHoldMinutes) * time.Minute
+	if hold <= 0 {
+		return nil, nil
+	}
+
+	var offers []models.WaitlistOffer
+	for {
+		offer, err := models.OfferSlotToWaitlist(slotID, hold, now)
+		if err != nil {
+			return offers, err
+		}
+		if offer == nil {
+			return offers, nil
+		}
+		if err := announceWaitlistOffer(offer); err != nil {
+			// The hold stands; the offer is still on the waitlist to answer
+			log.Printf("Error creating task for waitlist offer %d: %v", offer.ID, err)
+		}
+		offers = append(offers, *offer)
+	}
+}
+
+// reofferSlot offers a place released by an answered or expired offer to the next entry.
+func reofferSlot(slotID uint, now time.Time) {
+	if _, err := OfferFreedSlot(slotID, now); err != nil {
+		log.Printf("Error offering slot %d to the waitlist: %v", slotID, err)
+	}
+}
+
+func announceWaitlistOffer(offer *models.WaitlistOffer) error {
+	entry := offer.Entry
+	patient := fmt.Sprintf("patient #%d", entry.PatientID)
+	if entry.Patient != nil {
+		patient = strings.TrimSpace(entry.Patient.FirstName + " " + entry.Patient.LastName)
+	}
+	slot := letterDateTime(offer.SlotTime)
+	expires := letterDateTime(offer.ExpiresAt)
+
+	patientID := entry.PatientID
+	assigneeID := entry.CreatedByID
+	dueDate := offer.ExpiresAt
+	task := &models.Task{
+		Title: "Offer earlier appointment to " + patient,
+		Description: fmt.Sprintf("A %s place on %s is held for %s until %s. Accept or decline waitlist offer #%d once you have spoken to them.",
+			offer.Location, slot, patient, expires, offer.ID),
+		Status:       models.TaskStatusPending,
+		Priority:     entry.Priority,
+		DueDate:      &dueDate,
+		PatientID:    &patientID,
+		AssignedToID: &assigneeID,
+		CreatedByID:  entry.CreatedByID,
+	}
+	if err := models.CreateTask(config.DB, task, nil, nil); err != nil {
+		return err
+	}
+	if err := config.DB.Model(&models.WaitlistOffer{}).Where("id = ?", offer.ID).Update("task_id", task.ID).Error; err != nil {
+		return err
+	}
+	offer.TaskID = &task.ID
+
+	taskID := task.ID
+	event := NotificationEvent{
+		Type:      "waitlist.offer",
+		Title:     "Waitlist place held",
+		Message:   fmt.Sprintf("%s can have %s if they confirm by %s", patient, slot, expires),
+		ActionURL: fmt.Sprintf("/patients/%d", patientID),
+		TaskID:    &taskID,
+	}
+	for _, userID := range taskAssignees(task) {
+		NotificationsHub.SendToUser(userID, event)
+	}
+	return nil
+}
+
+// closeOfferTask closes the offer's task if nobody has yet.
+func closeOfferTask(offer *models.WaitlistOffer, status models.TaskStatus, now time.Time) {
+	if offer.TaskID == nil {
+		return
+	}
+	updates := map[string]interface{}{"status": status}
+	if status == models.TaskStatusCompleted {
+		updates["completed_at"] = now
+	}
+	err := config.DB.Model(&models.Task{}).
+		Where("id = ? AND status IN ?", *offer.TaskID, []models.TaskStatus{models.TaskStatusPending, models.TaskStatusInProgress}).
+		Updates(updates).Error
+	if err != nil {
+		log.Printf("Error closing task %d of waitlist offer %d: %v", *offer.TaskID, offer.ID, err)
+	}
+}
+
+// AcceptWaitlistOffer books the held place for the patient. When it moves the patient's
+// existing appointment, the place that appointment held is offered on in turn.
+func AcceptWaitlistOffer(offer *models.WaitlistOffer, userID uint, now time.Time) (*models.Appointment, error) {
+	var previousSlotID *uint
+	if offer.Entry != nil {
+		if a := offer.Entry.Appointment; a != nil && a.Status == models.AppointmentStatusScheduled {
+			previousSlotID = a.SlotID
+		}
+	}
+
+	appointment, err := models.AcceptWaitlistOffer(offer, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	closeOfferTask(offer, models.TaskStatusCompleted, now)
+
+	if previousSlotID != nil && (appointment.SlotID == nil || *appointment.SlotID != *previousSlotID) {
+		reofferSlot(*previousSlotID, now)
+	}
+	return appointment, nil
+}
+
+// DeclineWaitlistOffer puts the patient back on the waitlist and offers the place to the
+// next entry.
+func DeclineWaitlistOffer(offer *models.WaitlistOffer, userID uint, now time.Time) error {
+	if err := models.DeclineWaitlistOffer(offer, userID, now); err != nil {
+		return err
+	}
+	closeOfferTask(offer, models.TaskStatusCancelled, now)
+	reofferSlot(offer.SlotID, now)
+	return nil
+}
+
+// RemoveWaitlistEntry takes a patient off the waitlist, passing any place held for them to
+// the next entry.
+func RemoveWaitlistEntry(entry *models.WaitlistEntry, now time.Time) error {
+	withdrawn, err := models.RemoveWaitlistEntry(entry)
+	if err != nil {
+		return err
+	}
+	for i := range withdrawn {
+		closeOfferTask(&withdrawn[i], models.TaskStatusCancelled, now)
+		reofferSlot(withdrawn[i].SlotID, now)
+	}
+	return nil
+}
+
+// WaitlistMonitor expires waitlist offers whose hold has run out and offers freed places
+// to the next patient on the waitlist, including places freed while every matching patient
+// already had an offer open.
+type WaitlistMonitor struct {
+	interval time.Duration
+}
+
+// NewWaitlistMonitor configures the monitor from WAITLIST_SWEEP_INTERVAL (default 5m).
+func NewWaitlistMonitor() *WaitlistMonitor {
+	return &WaitlistMonitor{
+		interval: getEnvDuration("WAITLIST_SWEEP_INTERVAL", 5*time.Minute),
+	}
+}
+
+// Start runs a cycle immediately and then on every interval.
+func (m *WaitlistMonitor) Start() {
+	m.runCycle()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.runCycle()
+	}
+}
+
+func (m *WaitlistMonitor) runCycle() {
+	now := time.Now()
+	expired, err := models.ExpireWaitlistOffers(now)
+	if err != nil {
+		log.Printf("[WaitlistMonitor] Error expiring offers: %v", err)
+	}
+	for i := range expired {
+		closeOfferTask(&expired[i], models.TaskStatusCancelled, now)
+	}
+	if len(expired) > 0 {
+		log.Printf("[WaitlistMonitor] Expired %d waitlist offer(s)", len(expired))
+	}
+
+	slotIDs, err := models.FreedSlotIDs(now)
+	if err != nil {
+		log.Printf("[WaitlistMonitor] Error finding freed slots: %v", err)
+		return
+	}
+	offered := 0
+	for _, slotID := range slotIDs {
+		offers, err := OfferFreedSlot(slotID, now)
+		if err != nil {
+			log.Printf("[WaitlistMonitor] Error offering slot %d: %v", slotID, err)
+		}
+		offered += len(offers)
+	}
+	if offered > 0 {
+		log.Printf("[WaitlistMonitor] Made %d waitlist offer(s)", offered)
+	}
+}